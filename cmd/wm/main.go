@@ -2,6 +2,7 @@ package main
 
 import (
 	"compress/flate"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,8 +14,11 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
 	mw "gitlab.uncharted.software/WM/wm-go/pkg/middleware"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
 	"gitlab.uncharted.software/WM/wm-go/pkg/wm/api"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm/elastic"
 	"gitlab.uncharted.software/WM/wm-go/pkg/wm/env"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm/memory"
 	"gitlab.uncharted.software/WM/wm-go/pkg/wm/storage"
 	"go.uber.org/zap"
 )
@@ -67,33 +71,112 @@ func main() {
 	})
 	r.Use(c.Handler)
 
-	s3, err := storage.New(&aws.Config{
-		Credentials:      credentials.NewStaticCredentials(s.AwsS3Id, s.AwsS3Secret, s.AwsS3Token),
-		S3ForcePathStyle: aws.Bool(true),
-		Region:           aws.String(endpoints.UsEast1RegionID),
-		Endpoint:         aws.String(s.AwsS3URL), // LocalStack/Minio S3 Port
-	},
-		&storage.BucketInfo{
+	var reader storage.BlobReader
+	switch s.StorageBackend {
+	case "local":
+		reader, err = storage.NewLocalReader(s.LocalStorageDir)
+	default:
+		reader = storage.NewS3Reader(&aws.Config{
+			Credentials:      credentials.NewStaticCredentials(s.AwsS3Id, s.AwsS3Secret, s.AwsS3Token),
+			S3ForcePathStyle: aws.Bool(true),
+			Region:           aws.String(endpoints.UsEast1RegionID),
+			Endpoint:         aws.String(s.AwsS3URL), // LocalStack/Minio S3 Port
+			MaxRetries:       aws.Int(0),             // Retries are done by the storage.RetryReader
+		})
+	}
+	if err != nil {
+		sugar.Fatal(err)
+	}
+	// Bound the concurrent requests to the storage backend
+	limitedReader := storage.NewLimitedReader(reader, s.StorageMaxConcurrency)
+	reader = limitedReader
+	expvar.Publish("storage_in_flight", expvar.Func(func() interface{} { return limitedReader.InFlight() }))
+
+	// Retry transient failures without holding on to a concurrency slot while waiting
+	retryReader := storage.NewRetryReader(reader, storage.RetryConfig{
+		MaxAttempts:      s.StorageRetryAttempts,
+		BaseDelay:        s.StorageRetryBaseDelay,
+		MaxDelay:         s.StorageRetryMaxDelay,
+		BreakerThreshold: s.StorageBreakerThreshold,
+		BreakerCooldown:  s.StorageBreakerCooldown,
+	})
+	reader = retryReader
+	expvar.Publish("storage_breaker_open", expvar.Func(func() interface{} { return retryReader.BreakerOpen() }))
+
+	var cache *storage.Cache
+	if s.CacheEnabled {
+		cache = storage.NewCache(storage.CacheConfig{
+			MaxBytes: s.CacheMaxBytes,
+			TTL:      s.CacheTTL,
+			Buckets:  s.CacheBuckets,
+		})
+		reader = storage.NewCachedReader(reader, cache)
+		expvar.Publish("storage_cache", expvar.Func(func() interface{} { return cache.Stats() }))
+	}
+	// Share concurrent downloads of the same object
+	reader = storage.NewCoalescingReader(reader)
+
+	populationParams := storage.DefaultPopulationParams
+	populationParams.DataID = s.PopulationDataID
+	populationParams.RunID = s.PopulationRunID
+	populationParams.Feature = s.PopulationFeature
+	store, err := storage.NewFromConfig(&storage.Config{
+		Reader:         reader,
+		Cache:          cache,
+		MaxConcurrency: s.RequestMaxConcurrency,
+		Population: &storage.PopulationConfig{
+			Params:      populationParams,
+			Interpolate: s.PopulationInterpolate,
+			TTL:         s.PopulationCacheTTL,
+		},
+		BucketInfo: &storage.BucketInfo{
 			TileOutputBucket: s.OutputBucket,
 			VectorTileBucket: s.VectorTileBucket,
 			ModelsBucket:     s.ModelOutputBucket,
 			IndicatorsBucket: s.IndicatorOutputBucket,
 		},
-		sugar)
+		Logger: sugar,
+	})
 	if err != nil {
 		sugar.Fatal(err)
 	}
 
+	// Model metadata is only served by elasticsearch
+	var datacubeSearch wm.DatacubeSearch
+	var modelMetadata wm.ModelMetadata
+	if s.ElasticURL != "" {
+		es, err := elastic.New(&elastic.Config{
+			Addr:           s.ElasticURL,
+			DatacubeIndex:  s.ElasticDatacubeIndex,
+			RunIndex:       s.ElasticRunIndex,
+			ParameterIndex: s.ElasticParameterIndex,
+		})
+		if err != nil {
+			sugar.Fatal(err)
+		}
+		datacubeSearch = es
+		modelMetadata = es
+	}
+	if s.DatacubeBackend == "memory" {
+		if datacubeSearch, err = memory.New(&memory.Config{Dir: s.DatacubeDir}); err != nil {
+			sugar.Fatal(err)
+		}
+	}
+
 	apiRouter, err := api.New(&api.Config{
-		DataOutput: s3,
-		VectorTile: s3,
-		Logger:     sugar,
+		DataOutput:     store,
+		VectorTile:     store,
+		DatacubeSearch: datacubeSearch,
+		ModelMetadata:  modelMetadata,
+		Logger:         sugar,
+		MaxConcurrency: s.RequestMaxConcurrency,
 	})
 	if err != nil {
 		sugar.Fatal(err)
 	}
 
 	r.Mount("/", apiRouter)
+	r.Handle("/debug/vars", expvar.Handler())
 
 	sugar.Infof("Listening on %s", s.Addr)
 	sugar.Fatal(http.ListenAndServe(s.Addr, r))
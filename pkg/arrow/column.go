@@ -0,0 +1,171 @@
+package arrow
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Type is the data type of a column
+type Type int
+
+// Available column types
+const (
+	Int64 Type = iota
+	Float64
+	Utf8
+)
+
+// Column is a column of a record batch, built by appending values to it
+type Column interface {
+	// Type returns the data type of the column
+	Type() Type
+	// Len returns the number of values of the column
+	Len() int
+	// NullCount returns the number of null values of the column
+	NullCount() int
+	// buffers returns the buffers of the column in the order of the Arrow columnar format, starting with the
+	// validity bitmap
+	buffers() [][]byte
+}
+
+// validity is a validity bitmap, with the bit of each valid value set
+type validity struct {
+	bits  []byte
+	n     int
+	nulls int
+}
+
+func (v *validity) append(valid bool) {
+	if v.n%8 == 0 {
+		v.bits = append(v.bits, 0)
+	}
+	if valid {
+		v.bits[v.n/8] |= 1 << (v.n % 8)
+	} else {
+		v.nulls++
+	}
+	v.n++
+}
+
+// buffer returns the bitmap, which may be left empty if there are no nulls
+func (v *validity) buffer() []byte {
+	if v.nulls == 0 {
+		return nil
+	}
+	return v.bits
+}
+
+// Int64Column is a column of signed 64 bit integers
+type Int64Column struct {
+	validity validity
+	values   []byte
+}
+
+// Append appends a value to the column
+func (c *Int64Column) Append(v int64) {
+	c.validity.append(true)
+	c.values = appendUint64(c.values, uint64(v))
+}
+
+// AppendNull appends a null value to the column
+func (c *Int64Column) AppendNull() {
+	c.validity.append(false)
+	c.values = appendUint64(c.values, 0)
+}
+
+// Type returns Int64
+func (c *Int64Column) Type() Type { return Int64 }
+
+// Len returns the number of values of the column
+func (c *Int64Column) Len() int { return c.validity.n }
+
+// NullCount returns the number of null values of the column
+func (c *Int64Column) NullCount() int { return c.validity.nulls }
+
+func (c *Int64Column) buffers() [][]byte { return [][]byte{c.validity.buffer(), c.values} }
+
+// Float64Column is a column of double precision floats
+type Float64Column struct {
+	validity validity
+	values   []byte
+}
+
+// Append appends a value to the column
+func (c *Float64Column) Append(v float64) {
+	c.validity.append(true)
+	c.values = appendUint64(c.values, math.Float64bits(v))
+}
+
+// AppendNull appends a null value to the column
+func (c *Float64Column) AppendNull() {
+	c.validity.append(false)
+	c.values = appendUint64(c.values, 0)
+}
+
+// Type returns Float64
+func (c *Float64Column) Type() Type { return Float64 }
+
+// Len returns the number of values of the column
+func (c *Float64Column) Len() int { return c.validity.n }
+
+// NullCount returns the number of null values of the column
+func (c *Float64Column) NullCount() int { return c.validity.nulls }
+
+func (c *Float64Column) buffers() [][]byte { return [][]byte{c.validity.buffer(), c.values} }
+
+// Utf8Column is a column of strings
+type Utf8Column struct {
+	validity validity
+	offsets  []byte
+	data     []byte
+}
+
+// Append appends a value to the column
+func (c *Utf8Column) Append(v string) {
+	c.validity.append(true)
+	c.data = append(c.data, v...)
+	c.appendOffset()
+}
+
+// AppendNull appends a null value to the column
+func (c *Utf8Column) AppendNull() {
+	c.validity.append(false)
+	c.appendOffset()
+}
+
+// appendOffset appends the end offset of the last value, after the start offset of the first one
+func (c *Utf8Column) appendOffset() {
+	if len(c.offsets) == 0 {
+		c.offsets = make([]byte, 4)
+	}
+	c.offsets = appendUint32(c.offsets, uint32(len(c.data)))
+}
+
+// Type returns Utf8
+func (c *Utf8Column) Type() Type { return Utf8 }
+
+// Len returns the number of values of the column
+func (c *Utf8Column) Len() int { return c.validity.n }
+
+// NullCount returns the number of null values of the column
+func (c *Utf8Column) NullCount() int { return c.validity.nulls }
+
+func (c *Utf8Column) buffers() [][]byte {
+	offsets := c.offsets
+	if len(offsets) == 0 {
+		offsets = make([]byte, 4)
+	}
+	return [][]byte{c.validity.buffer(), offsets, c.data}
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	buf = append(buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(buf[len(buf)-4:], v)
+	return buf
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	buf = append(buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(buf[len(buf)-8:], v)
+	return buf
+}
@@ -0,0 +1,173 @@
+package arrow
+
+import (
+	"encoding/binary"
+)
+
+// This is a minimal flatbuffers encoder for the Arrow IPC metadata. Unlike the flatbuffers builder, it writes the
+// buffer front to back: each object is followed by the objects it references, which keeps all the offsets positive
+// as flatbuffers requires, and each table is preceded by its vtable.
+
+// fbObject is a flatbuffers table, vector or string
+type fbObject interface {
+	// write appends the object and the objects it references to b, and returns the position of the object
+	write(b *fbBuilder) int
+}
+
+type fbBuilder struct {
+	buf []byte
+}
+
+// pad aligns the end of the buffer to align bytes
+func (b *fbBuilder) pad(align int) {
+	for len(b.buf)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *fbBuilder) appendUint16(v uint16) {
+	b.buf = append(b.buf, byte(v), byte(v>>8))
+}
+
+func (b *fbBuilder) appendUint32(v uint32) {
+	b.buf = appendUint32(b.buf, v)
+}
+
+func (b *fbBuilder) appendUint64(v uint64) {
+	b.buf = appendUint64(b.buf, v)
+}
+
+// putOffset sets the offset stored at pos to point to the object at target
+func (b *fbBuilder) putOffset(pos int, target int) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(target-pos))
+}
+
+// finishFlatbuffer returns the flatbuffer of the root table, padded to 8 bytes
+func finishFlatbuffer(root fbTable) []byte {
+	b := &fbBuilder{buf: make([]byte, 4, 256)}
+	b.putOffset(0, root.write(b))
+	b.pad(8)
+	return b.buf
+}
+
+// fbField is a field of a table, either a scalar of size bytes or an offset to an object
+type fbField struct {
+	size   int
+	value  uint64
+	object fbObject
+}
+
+func fbScalar(size int, value uint64) *fbField {
+	return &fbField{size: size, value: value}
+}
+
+func fbBool(value bool) *fbField {
+	if value {
+		return fbScalar(1, 1)
+	}
+	return fbScalar(1, 0)
+}
+
+func fbOffset(object fbObject) *fbField {
+	return &fbField{size: 4, object: object}
+}
+
+// fbTable is a table, indexed by field slot. Missing fields are nil.
+type fbTable []*fbField
+
+func (t fbTable) write(b *fbBuilder) int {
+	// Lay the fields out after the vtable offset, each aligned to its size
+	offsets := make([]int, len(t))
+	size := 4
+	for i, f := range t {
+		if f == nil {
+			continue
+		}
+		for size%f.size != 0 {
+			size++
+		}
+		offsets[i] = size
+		size += f.size
+	}
+
+	b.pad(2)
+	vtable := len(b.buf)
+	b.appendUint16(uint16(4 + 2*len(t)))
+	b.appendUint16(uint16(size))
+	for _, offset := range offsets {
+		b.appendUint16(uint16(offset))
+	}
+
+	// The buffer starts 8 byte aligned, so aligning the table aligns its 8 byte fields
+	b.pad(8)
+	table := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[table:], uint32(int32(table-vtable)))
+	for i, f := range t {
+		if f == nil || f.object != nil {
+			continue
+		}
+		field := b.buf[table+offsets[i]:]
+		switch f.size {
+		case 1:
+			field[0] = byte(f.value)
+		case 2:
+			binary.LittleEndian.PutUint16(field, uint16(f.value))
+		case 4:
+			binary.LittleEndian.PutUint32(field, uint32(f.value))
+		case 8:
+			binary.LittleEndian.PutUint64(field, f.value)
+		}
+	}
+	for i, f := range t {
+		if f != nil && f.object != nil {
+			b.putOffset(table+offsets[i], f.object.write(b))
+		}
+	}
+	return table
+}
+
+// fbTables is a vector of tables
+type fbTables []fbTable
+
+func (v fbTables) write(b *fbBuilder) int {
+	b.pad(4)
+	pos := len(b.buf)
+	b.appendUint32(uint32(len(v)))
+	slots := len(b.buf)
+	b.buf = append(b.buf, make([]byte, 4*len(v))...)
+	for i, t := range v {
+		b.putOffset(slots+4*i, t.write(b))
+	}
+	return pos
+}
+
+// fbInt64Pairs is a vector of structs made of two longs, such as the FieldNode and Buffer structs
+type fbInt64Pairs [][2]int64
+
+func (v fbInt64Pairs) write(b *fbBuilder) int {
+	// Align the elements, which follow the length, to 8 bytes
+	b.pad(4)
+	if len(b.buf)%8 == 0 {
+		b.appendUint32(0)
+	}
+	pos := len(b.buf)
+	b.appendUint32(uint32(len(v)))
+	for _, pair := range v {
+		b.appendUint64(uint64(pair[0]))
+		b.appendUint64(uint64(pair[1]))
+	}
+	return pos
+}
+
+// fbString is a null terminated string
+type fbString string
+
+func (s fbString) write(b *fbBuilder) int {
+	b.pad(4)
+	pos := len(b.buf)
+	b.appendUint32(uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	return pos
+}
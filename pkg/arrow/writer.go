@@ -0,0 +1,161 @@
+// Package arrow writes tables in the Apache Arrow IPC streaming format, see
+// https://arrow.apache.org/docs/format/Columnar.html#ipc-streaming-format. Only the types used by the API are
+// supported, and there are no dictionaries.
+package arrow
+
+import (
+	"fmt"
+	"io"
+)
+
+// MediaType is the media type of Arrow IPC streams
+const MediaType = "application/vnd.apache.arrow.stream"
+
+// Values of the enums and unions of the Arrow flatbuffers schema
+const (
+	metadataV5        = 4
+	endiannessLittle  = 0
+	headerSchema      = 1
+	headerRecordBatch = 3
+	typeInt           = 2
+	typeFloatingPoint = 3
+	typeUtf8          = 5
+	precisionDouble   = 2
+)
+
+const (
+	// continuationMarker starts each encapsulated message, and the end of the stream
+	continuationMarker = 0xFFFFFFFF
+	// bufferAlignment is the alignment of the buffers of the body of record batches
+	bufferAlignment = 8
+	int64BitWidth   = 64
+)
+
+// Field is a column of the schema of a stream
+type Field struct {
+	Name     string
+	Type     Type
+	Nullable bool
+}
+
+// Writer writes a stream of record batches sharing a schema
+type Writer struct {
+	w       io.Writer
+	fields  []Field
+	started bool
+}
+
+// NewWriter returns a Writer writing a stream of record batches with the fields to w
+func NewWriter(w io.Writer, fields []Field) *Writer {
+	return &Writer{w: w, fields: fields}
+}
+
+// Write writes a record batch made of the columns, which must match the fields of the schema and have the same
+// length. The schema is written before the first batch.
+func (w *Writer) Write(columns ...Column) error {
+	if len(columns) != len(w.fields) {
+		return fmt.Errorf("record batch has %d columns instead of %d", len(columns), len(w.fields))
+	}
+	length := 0
+	if len(columns) > 0 {
+		length = columns[0].Len()
+	}
+	for i, c := range columns {
+		field := w.fields[i]
+		if c.Type() != field.Type {
+			return fmt.Errorf("column %s has the wrong type", field.Name)
+		}
+		if c.Len() != length {
+			return fmt.Errorf("column %s has %d values instead of %d", field.Name, c.Len(), length)
+		}
+		if !field.Nullable && c.NullCount() > 0 {
+			return fmt.Errorf("column %s is not nullable", field.Name)
+		}
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	var nodes, buffers fbInt64Pairs
+	var body []byte
+	for _, c := range columns {
+		nodes = append(nodes, [2]int64{int64(c.Len()), int64(c.NullCount())})
+		for _, buf := range c.buffers() {
+			buffers = append(buffers, [2]int64{int64(len(body)), int64(len(buf))})
+			body = append(body, buf...)
+			for len(body)%bufferAlignment != 0 {
+				body = append(body, 0)
+			}
+		}
+	}
+	batch := fbTable{
+		fbScalar(8, uint64(length)),
+		fbOffset(nodes),
+		fbOffset(buffers),
+	}
+	return w.writeMessage(headerRecordBatch, batch, body)
+}
+
+// Close writes the end of the stream, after the schema if no batch was written. It doesn't close the underlying
+// writer.
+func (w *Writer) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	_, err := w.w.Write(appendUint32(appendUint32(nil, continuationMarker), 0))
+	return err
+}
+
+// start writes the schema if it hasn't been written yet
+func (w *Writer) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	fields := make(fbTables, len(w.fields))
+	for i, f := range w.fields {
+		var typeID uint64
+		var typ fbTable
+		switch f.Type {
+		case Int64:
+			typeID, typ = typeInt, fbTable{fbScalar(4, int64BitWidth), fbBool(true)}
+		case Float64:
+			typeID, typ = typeFloatingPoint, fbTable{fbScalar(2, precisionDouble)}
+		case Utf8:
+			typeID, typ = typeUtf8, fbTable{}
+		default:
+			return fmt.Errorf("column %s has an unsupported type", f.Name)
+		}
+		fields[i] = fbTable{
+			fbOffset(fbString(f.Name)),
+			fbBool(f.Nullable),
+			fbScalar(1, typeID),
+			fbOffset(typ),
+			nil,
+			fbOffset(fbTables{}),
+		}
+	}
+	schema := fbTable{
+		fbScalar(2, endiannessLittle),
+		fbOffset(fields),
+	}
+	return w.writeMessage(headerSchema, schema, nil)
+}
+
+// writeMessage writes an encapsulated message: the continuation marker, the length of the metadata, the Message
+// flatbuffer holding the header, and the body
+func (w *Writer) writeMessage(headerType uint64, header fbTable, body []byte) error {
+	metadata := finishFlatbuffer(fbTable{
+		fbScalar(2, metadataV5),
+		fbScalar(1, headerType),
+		fbOffset(header),
+		fbScalar(8, uint64(len(body))),
+	})
+	buf := make([]byte, 0, 8+len(metadata)+len(body))
+	buf = appendUint32(buf, continuationMarker)
+	buf = appendUint32(buf, uint32(len(metadata)))
+	buf = append(buf, metadata...)
+	buf = append(buf, body...)
+	_, err := w.w.Write(buf)
+	return err
+}
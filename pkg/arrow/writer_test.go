@@ -0,0 +1,268 @@
+package arrow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fbReader reads the tables of a flatbuffer
+type fbReader []byte
+
+func (r fbReader) u16(pos int) int { return int(binary.LittleEndian.Uint16(r[pos:])) }
+func (r fbReader) u32(pos int) int { return int(binary.LittleEndian.Uint32(r[pos:])) }
+func (r fbReader) u64(pos int) int64 {
+	return int64(binary.LittleEndian.Uint64(r[pos:]))
+}
+
+// root returns the position of the root table
+func (r fbReader) root() int { return r.u32(0) }
+
+// field returns the position of the field of the table at pos, or 0 if it is missing
+func (r fbReader) field(table int, slot int) int {
+	vtable := table - int(int32(r.u32(table)))
+	if 4+2*slot >= r.u16(vtable) {
+		return 0
+	}
+	if offset := r.u16(vtable + 4 + 2*slot); offset != 0 {
+		return table + offset
+	}
+	return 0
+}
+
+// deref returns the position of the object referenced by the field of the table at pos
+func (r fbReader) deref(table int, slot int) int {
+	pos := r.field(table, slot)
+	return pos + r.u32(pos)
+}
+
+// vectorTable returns the position of the ith table of the vector at pos
+func (r fbReader) vectorTable(vector int, i int) int {
+	pos := vector + 4 + 4*i
+	return pos + r.u32(pos)
+}
+
+func (r fbReader) string(pos int) string {
+	return string(r[pos+4 : pos+4+r.u32(pos)])
+}
+
+// readMessage reads an encapsulated message from buf, and returns its metadata, body and the rest of buf
+func readMessage(t *testing.T, buf []byte) (fbReader, []byte, []byte) {
+	require.Equal(t, uint32(continuationMarker), binary.LittleEndian.Uint32(buf))
+	length := int(binary.LittleEndian.Uint32(buf[4:]))
+	require.Zero(t, length%8)
+	metadata := fbReader(buf[8 : 8+length])
+	message := metadata.root()
+	require.Equal(t, metadataV5, metadata.u16(metadata.field(message, 0)))
+	// bodyLength is omitted when it is the default 0
+	bodyLength := 0
+	if pos := metadata.field(message, 3); pos != 0 {
+		bodyLength = int(metadata.u64(pos))
+	}
+	require.Zero(t, bodyLength%8)
+	return metadata, buf[8+length : 8+length+bodyLength], buf[8+length+bodyLength:]
+}
+
+// decodedField is a field of a decoded stream
+type decodedField struct {
+	name     string
+	nullable bool
+	typeID   int
+	values   []interface{}
+}
+
+// decodeStream decodes the fields and values of a stream of Utf8, Int64 and Float64 columns
+func decodeStream(t *testing.T, buf []byte) []decodedField {
+	metadata, _, rest := readMessage(t, buf)
+	message := metadata.root()
+	require.Equal(t, headerSchema, int(metadata[metadata.field(message, 1)]))
+	vector := metadata.deref(metadata.deref(message, 2), 1)
+	fields := make([]decodedField, metadata.u32(vector))
+	for i := range fields {
+		field := metadata.vectorTable(vector, i)
+		fields[i] = decodedField{
+			name:     metadata.string(metadata.deref(field, 0)),
+			nullable: metadata.field(field, 1) != 0 && metadata[metadata.field(field, 1)] == 1,
+			typeID:   int(metadata[metadata.field(field, 2)]),
+		}
+	}
+
+	for !bytes.Equal(rest, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}) {
+		var body []byte
+		metadata, body, rest = readMessage(t, rest)
+		message = metadata.root()
+		require.Equal(t, headerRecordBatch, int(metadata[metadata.field(message, 1)]))
+		batch := metadata.deref(message, 2)
+		nodes, buffers := metadata.deref(batch, 1), metadata.deref(batch, 2)
+		buffer := 0
+		nextBuffer := func() []byte {
+			offset, length := metadata.u64(buffers+4+16*buffer), metadata.u64(buffers+4+16*buffer+8)
+			buffer++
+			return body[offset : offset+length]
+		}
+		for i := range fields {
+			length := int(metadata.u64(nodes + 4 + 16*i))
+			validity := nextBuffer()
+			valid := func(j int) bool { return len(validity) == 0 || validity[j/8]&(1<<(j%8)) != 0 }
+			switch fields[i].typeID {
+			case typeUtf8:
+				offsets, data := nextBuffer(), nextBuffer()
+				for j := 0; j < length; j++ {
+					start, end := binary.LittleEndian.Uint32(offsets[4*j:]), binary.LittleEndian.Uint32(offsets[4*j+4:])
+					var v interface{}
+					if valid(j) {
+						v = string(data[start:end])
+					}
+					fields[i].values = append(fields[i].values, v)
+				}
+			case typeInt, typeFloatingPoint:
+				data := nextBuffer()
+				for j := 0; j < length; j++ {
+					var v interface{}
+					if valid(j) {
+						bits := binary.LittleEndian.Uint64(data[8*j:])
+						if fields[i].typeID == typeInt {
+							v = int64(bits)
+						} else {
+							v = math.Float64frombits(bits)
+						}
+					}
+					fields[i].values = append(fields[i].values, v)
+				}
+			default:
+				require.Fail(t, "unexpected type", fields[i].typeID)
+			}
+		}
+	}
+	return fields
+}
+
+func TestWriter(t *testing.T) {
+	fields := []Field{
+		{Name: "key", Type: Utf8},
+		{Name: "timestamp", Type: Int64, Nullable: true},
+		{Name: "value", Type: Float64, Nullable: true},
+	}
+	var keys Utf8Column
+	var timestamps Int64Column
+	var values Float64Column
+	keys.Append("a")
+	timestamps.Append(10)
+	values.Append(1.5)
+	keys.Append("")
+	timestamps.AppendNull()
+	values.Append(-2)
+	keys.Append("bcd")
+	timestamps.Append(-3)
+	values.AppendNull()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, fields)
+	require.NoError(t, w.Write(&keys, &timestamps, &values))
+	require.NoError(t, w.Close())
+
+	// Schema
+	metadata, body, rest := readMessage(t, buf.Bytes())
+	require.Empty(t, body)
+	message := metadata.root()
+	require.Equal(t, headerSchema, int(metadata[metadata.field(message, 1)]))
+	schema := metadata.deref(message, 2)
+	vector := metadata.deref(schema, 1)
+	require.Equal(t, 3, metadata.u32(vector))
+	for i, want := range []struct {
+		name     string
+		nullable bool
+		typeID   int
+	}{{"key", false, typeUtf8}, {"timestamp", true, typeInt}, {"value", true, typeFloatingPoint}} {
+		field := metadata.vectorTable(vector, i)
+		require.Equal(t, want.name, metadata.string(metadata.deref(field, 0)))
+		require.Equal(t, want.nullable, metadata[metadata.field(field, 1)] == 1)
+		require.Equal(t, want.typeID, int(metadata[metadata.field(field, 2)]))
+		require.Equal(t, 0, metadata.u32(metadata.deref(field, 5)))
+		typ := metadata.deref(field, 3)
+		switch want.typeID {
+		case typeInt:
+			require.Equal(t, 64, metadata.u32(metadata.field(typ, 0)))
+			require.Equal(t, byte(1), metadata[metadata.field(typ, 1)])
+		case typeFloatingPoint:
+			require.Equal(t, precisionDouble, metadata.u16(metadata.field(typ, 0)))
+		}
+	}
+
+	// Record batch
+	metadata, body, rest = readMessage(t, rest)
+	message = metadata.root()
+	require.Zero(t, message%8)
+	require.Equal(t, headerRecordBatch, int(metadata[metadata.field(message, 1)]))
+	batch := metadata.deref(message, 2)
+	require.Zero(t, batch%8)
+	require.Equal(t, int64(3), metadata.u64(metadata.field(batch, 0)))
+	nodes := metadata.deref(batch, 1)
+	require.Equal(t, 3, metadata.u32(nodes))
+	require.Zero(t, (nodes+4)%8)
+	var nullCounts []int64
+	for i := 0; i < 3; i++ {
+		require.Equal(t, int64(3), metadata.u64(nodes+4+16*i))
+		nullCounts = append(nullCounts, metadata.u64(nodes+4+16*i+8))
+	}
+	require.Equal(t, []int64{0, 1, 1}, nullCounts)
+	buffers := metadata.deref(batch, 2)
+	require.Equal(t, 7, metadata.u32(buffers))
+	bodyBuffer := func(i int) []byte {
+		offset, length := metadata.u64(buffers+4+16*i), metadata.u64(buffers+4+16*i+8)
+		require.Zero(t, offset%8)
+		return body[offset : offset+length]
+	}
+	require.Empty(t, bodyBuffer(0))
+	require.Equal(t, []byte{0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 4, 0, 0, 0}, bodyBuffer(1))
+	require.Equal(t, "abcd", string(bodyBuffer(2)))
+	require.Equal(t, []byte{0x5}, bodyBuffer(3))
+	require.Equal(t, int64(10), int64(binary.LittleEndian.Uint64(bodyBuffer(4))))
+	require.Equal(t, int64(-3), int64(binary.LittleEndian.Uint64(bodyBuffer(4)[16:])))
+	require.Equal(t, []byte{0x3}, bodyBuffer(5))
+	require.Equal(t, -2.0, math.Float64frombits(binary.LittleEndian.Uint64(bodyBuffer(6)[8:])))
+
+	// End of stream
+	require.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}, rest)
+
+	// testdata/timeseries.arrows holds the same table written by the Apache Arrow Go ipc.Writer
+	golden, err := os.ReadFile("testdata/timeseries.arrows")
+	require.NoError(t, err)
+	want := decodeStream(t, golden)
+	require.Equal(t, []decodedField{
+		{"key", false, typeUtf8, []interface{}{"a", "", "bcd"}},
+		{"timestamp", true, typeInt, []interface{}{int64(10), nil, int64(-3)}},
+		{"value", true, typeFloatingPoint, []interface{}{1.5, -2.0, nil}},
+	}, want)
+	require.Equal(t, want, decodeStream(t, buf.Bytes()))
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, []Field{{Name: "key", Type: Utf8}})
+	require.NoError(t, w.Close())
+	_, _, rest := readMessage(t, buf.Bytes())
+	require.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}, rest)
+}
+
+func TestWriterInvalidColumns(t *testing.T) {
+	fields := []Field{{Name: "key", Type: Utf8}, {Name: "value", Type: Float64}}
+	var keys Utf8Column
+	var values Float64Column
+	var timestamps Int64Column
+	keys.Append("a")
+	values.AppendNull()
+	timestamps.Append(1)
+
+	w := NewWriter(&bytes.Buffer{}, fields)
+	require.Error(t, w.Write(&keys))
+	require.Error(t, w.Write(&keys, &timestamps))
+	require.Error(t, w.Write(&keys, &values))
+	keys.Append("b")
+	values.Append(1)
+	require.Error(t, w.Write(&keys, &values))
+}
@@ -0,0 +1,81 @@
+package fanout
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Run calls fn for each of the n tasks, with at most limit of them running at a time. A limit <= 0 means no limit.
+// It returns the error of each task, indexed the same as the tasks. Once ctx is done, the tasks that have not started yet
+// are skipped and fail with the context error.
+func Run(ctx context.Context, n int, limit int, fn func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < limit; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				errs[i] = fn(ctx, i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		tasks <- i
+	}
+	close(tasks)
+	wg.Wait()
+	return errs
+}
+
+// Semaphore limits the number of concurrent holders. It is meant to be shared, eg. to put a global limit on
+// the number of storage requests of the service regardless of how many requests are being served.
+type Semaphore struct {
+	// inUse is first to be 64-bit aligned for the atomic operations
+	inUse int64
+	// tokens is nil when there is no limit
+	tokens chan struct{}
+}
+
+// NewSemaphore returns a Semaphore allowing up to n concurrent holders. An n <= 0 means no limit.
+func NewSemaphore(n int) *Semaphore {
+	if n <= 0 {
+		return &Semaphore{}
+	}
+	return &Semaphore{tokens: make(chan struct{}, n)}
+}
+
+// Acquire blocks until the semaphore is acquired or ctx is done, in which case the context error is returned
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	if s.tokens != nil {
+		select {
+		case s.tokens <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	atomic.AddInt64(&s.inUse, 1)
+	return nil
+}
+
+// Release releases the semaphore previously acquired with Acquire
+func (s *Semaphore) Release() {
+	atomic.AddInt64(&s.inUse, -1)
+	if s.tokens != nil {
+		<-s.tokens
+	}
+}
+
+// InUse returns the number of current holders
+func (s *Semaphore) InUse() int {
+	return int(atomic.LoadInt64(&s.inUse))
+}
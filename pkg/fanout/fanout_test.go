@@ -0,0 +1,91 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	var running, maxRunning int32
+	errs := Run(context.Background(), 20, 3, func(ctx context.Context, i int) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if i%2 == 1 {
+			return errors.New("odd")
+		}
+		return nil
+	})
+	require.Equal(t, int32(3), maxRunning)
+	require.Len(t, errs, 20)
+	for i, err := range errs {
+		if i%2 == 1 {
+			require.EqualError(t, err, "odd")
+		} else {
+			require.NoError(t, err)
+		}
+	}
+
+	// No tasks
+	require.Empty(t, Run(context.Background(), 0, 3, func(ctx context.Context, i int) error { return nil }))
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+	errs := Run(ctx, 10, 1, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&calls, 1)
+		if i == 2 {
+			cancel()
+		}
+		return nil
+	})
+	require.Equal(t, int32(3), calls)
+	for i, err := range errs {
+		if i <= 2 {
+			require.NoError(t, err)
+		} else {
+			require.Equal(t, context.Canceled, err)
+		}
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	s := NewSemaphore(2)
+	require.NoError(t, s.Acquire(context.Background()))
+	require.NoError(t, s.Acquire(context.Background()))
+	require.Equal(t, 2, s.InUse())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, s.Acquire(ctx))
+
+	s.Release()
+	require.NoError(t, s.Acquire(context.Background()))
+	s.Release()
+	s.Release()
+	require.Equal(t, 0, s.InUse())
+}
+
+func TestSemaphoreNoLimit(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		s := NewSemaphore(n)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, s.Acquire(context.Background()))
+		}
+		require.Equal(t, 100, s.InUse())
+		s.Release()
+		require.Equal(t, 99, s.InUse())
+	}
+}
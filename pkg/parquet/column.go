@@ -0,0 +1,94 @@
+package parquet
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Type is the physical type of a column
+type Type int
+
+// Physical types, with the values of the parquet format
+const (
+	Boolean           Type = 0
+	Int32             Type = 1
+	Int64             Type = 2
+	Int96             Type = 3
+	Float             Type = 4
+	Double            Type = 5
+	ByteArray         Type = 6
+	FixedLenByteArray Type = 7
+)
+
+// Column holds the decoded values of a column. Integers are widened to int64, floats to float64, and byte arrays
+// are held as strings. Nulls hold the zero value in the slice of the type.
+type Column struct {
+	Name string
+	Type Type
+	// valid is nil as long as there are no nulls
+	valid   []bool
+	n       int
+	bools   []bool
+	ints    []int64
+	floats  []float64
+	strings []string
+}
+
+// Len returns the number of values of the column
+func (c *Column) Len() int {
+	return c.n
+}
+
+// IsNull returns whether the ith value is null
+func (c *Column) IsNull(i int) bool {
+	return c.valid != nil && !c.valid[i]
+}
+
+// Float64 returns the ith value as a float. It fails if the value is null or isn't a number.
+func (c *Column) Float64(i int) (float64, error) {
+	if c.IsNull(i) {
+		return 0, fmt.Errorf("column %s: null value", c.Name)
+	}
+	switch c.Type {
+	case Int32, Int64:
+		return float64(c.ints[i]), nil
+	case Float, Double:
+		return c.floats[i], nil
+	}
+	return 0, fmt.Errorf("column %s: not a number", c.Name)
+}
+
+// Int64 returns the ith value as an integer. Floats are accepted if they are whole numbers. It fails if the value is
+// null or isn't an integer.
+func (c *Column) Int64(i int) (int64, error) {
+	if c.IsNull(i) {
+		return 0, fmt.Errorf("column %s: null value", c.Name)
+	}
+	switch c.Type {
+	case Int32, Int64:
+		return c.ints[i], nil
+	case Float, Double:
+		if v := c.floats[i]; v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return int64(v), nil
+		}
+	}
+	return 0, fmt.Errorf("column %s: not an integer", c.Name)
+}
+
+// String returns the ith value as a string, formatting the numbers and booleans. It returns an empty string for a
+// null value.
+func (c *Column) String(i int) string {
+	if c.IsNull(i) {
+		return ""
+	}
+	switch c.Type {
+	case Boolean:
+		return strconv.FormatBool(c.bools[i])
+	case Int32, Int64:
+		return strconv.FormatInt(c.ints[i], 10)
+	case Float, Double:
+		return strconv.FormatFloat(c.floats[i], 'f', -1, 64)
+	}
+	return c.strings[i]
+}
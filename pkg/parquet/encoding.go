@@ -0,0 +1,370 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// Encodings of the parquet format
+const (
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingRLEDictionary   = 8
+)
+
+// Compression codecs of the parquet format
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+)
+
+var errTruncated = errors.New("truncated data")
+
+// values holds decoded non null values, in the slice of their type
+type values struct {
+	bools   []bool
+	ints    []int64
+	floats  []float64
+	strings []string
+}
+
+// decodePlain decodes n PLAIN encoded values
+func decodePlain(schema columnSchema, buf []byte, n int, dst *values) error {
+	size := 0
+	switch schema.typ {
+	case Boolean:
+		if len(buf)*8 < n {
+			return errTruncated
+		}
+		for i := 0; i < n; i++ {
+			dst.bools = append(dst.bools, buf[i/8]>>(i%8)&1 == 1)
+		}
+		return nil
+	case Int32, Float:
+		size = 4
+	case Int64, Double:
+		size = 8
+	case FixedLenByteArray:
+		size = schema.typeLength
+	case ByteArray:
+		for i := 0; i < n; i++ {
+			if len(buf) < 4 {
+				return errTruncated
+			}
+			length := int(binary.LittleEndian.Uint32(buf))
+			if length > len(buf)-4 {
+				return errTruncated
+			}
+			dst.strings = append(dst.strings, string(buf[4:4+length]))
+			buf = buf[4+length:]
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported type %d", schema.typ)
+	}
+	if len(buf) < n*size {
+		return errTruncated
+	}
+	for i := 0; i < n; i++ {
+		v := buf[i*size : (i+1)*size]
+		switch schema.typ {
+		case Int32:
+			dst.ints = append(dst.ints, int64(int32(binary.LittleEndian.Uint32(v))))
+		case Int64:
+			dst.ints = append(dst.ints, int64(binary.LittleEndian.Uint64(v)))
+		case Float:
+			dst.floats = append(dst.floats, float64(math.Float32frombits(binary.LittleEndian.Uint32(v))))
+		case Double:
+			dst.floats = append(dst.floats, math.Float64frombits(binary.LittleEndian.Uint64(v)))
+		case FixedLenByteArray:
+			dst.strings = append(dst.strings, string(v))
+		}
+	}
+	return nil
+}
+
+// decodeHybrid decodes n values of the RLE / bit-packing hybrid encoding, with values of bitWidth bits
+func decodeHybrid(buf []byte, bitWidth int, n int) ([]uint32, error) {
+	if bitWidth > 32 {
+		return nil, errors.New("invalid bit width")
+	}
+	out := make([]uint32, 0, n)
+	byteWidth := (bitWidth + 7) / 8
+	mask := uint64(1)<<uint(bitWidth) - 1
+	for len(out) < n {
+		header, k := binary.Uvarint(buf)
+		if k <= 0 {
+			return nil, errTruncated
+		}
+		buf = buf[k:]
+		if header&1 == 0 {
+			// RLE run of a repeated value
+			if len(buf) < byteWidth {
+				return nil, errTruncated
+			}
+			var v uint32
+			for i := 0; i < byteWidth; i++ {
+				v |= uint32(buf[i]) << (8 * uint(i))
+			}
+			buf = buf[byteWidth:]
+			for count := int(header >> 1); count > 0 && len(out) < n; count-- {
+				out = append(out, v)
+			}
+			continue
+		}
+		// Bit-packed run of groups of 8 values, the last run may be truncated
+		count := int(header>>1) * 8
+		size := int(header>>1) * bitWidth
+		if size > len(buf) {
+			size = len(buf)
+			if bitWidth > 0 {
+				count = size * 8 / bitWidth
+			}
+		}
+		run := buf[:size]
+		buf = buf[size:]
+		for i := 0; i < count && len(out) < n; i++ {
+			pos := i * bitWidth
+			var w uint64
+			for b := 0; b < 8 && pos/8+b < len(run); b++ {
+				w |= uint64(run[pos/8+b]) << (8 * uint(b))
+			}
+			out = append(out, uint32(w>>uint(pos%8)&mask))
+		}
+		if count == 0 && len(out) < n {
+			return nil, errTruncated
+		}
+	}
+	return out, nil
+}
+
+// decodeValues decodes the values of a data page and appends them to the column. defLevels gives the nulls of
+// optional columns, it is nil for required columns.
+func decodeValues(schema columnSchema, buf []byte, encoding int64, n int, defLevels []uint32, dict *values, column *Column) error {
+	nonNull := n
+	if defLevels != nil {
+		nonNull = 0
+		for _, level := range defLevels {
+			if level > 0 {
+				nonNull++
+			}
+		}
+	}
+	var v values
+	switch {
+	case encoding == encodingPlain:
+		if err := decodePlain(schema, buf, nonNull, &v); err != nil {
+			return err
+		}
+	case encoding == encodingRLE && schema.typ == Boolean:
+		if len(buf) < 4 {
+			return errTruncated
+		}
+		length := int(binary.LittleEndian.Uint32(buf))
+		if length > len(buf)-4 {
+			return errTruncated
+		}
+		bits, err := decodeHybrid(buf[4:4+length], 1, nonNull)
+		if err != nil {
+			return err
+		}
+		for _, b := range bits {
+			v.bools = append(v.bools, b == 1)
+		}
+	case encoding == encodingPlainDictionary || encoding == encodingRLEDictionary:
+		if dict == nil {
+			return errors.New("missing dictionary page")
+		}
+		if len(buf) < 1 {
+			return errTruncated
+		}
+		indices, err := decodeHybrid(buf[1:], int(buf[0]), nonNull)
+		if err != nil {
+			return err
+		}
+		if err := v.gather(schema.typ, dict, indices); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported encoding %d", encoding)
+	}
+
+	j := 0
+	for i := 0; i < n; i++ {
+		if defLevels != nil && defLevels[i] == 0 {
+			column.appendNull()
+		} else {
+			column.append(&v, j)
+			j++
+		}
+	}
+	return nil
+}
+
+// gather appends the dictionary values of the indices
+func (v *values) gather(typ Type, dict *values, indices []uint32) error {
+	for _, index := range indices {
+		i := int(index)
+		switch typ {
+		case Boolean:
+			if i >= len(dict.bools) {
+				return errors.New("invalid dictionary index")
+			}
+			v.bools = append(v.bools, dict.bools[i])
+		case Int32, Int64:
+			if i >= len(dict.ints) {
+				return errors.New("invalid dictionary index")
+			}
+			v.ints = append(v.ints, dict.ints[i])
+		case Float, Double:
+			if i >= len(dict.floats) {
+				return errors.New("invalid dictionary index")
+			}
+			v.floats = append(v.floats, dict.floats[i])
+		default:
+			if i >= len(dict.strings) {
+				return errors.New("invalid dictionary index")
+			}
+			v.strings = append(v.strings, dict.strings[i])
+		}
+	}
+	return nil
+}
+
+// append appends the jth value of v to the column
+func (c *Column) append(v *values, j int) {
+	switch c.Type {
+	case Boolean:
+		c.bools = append(c.bools, v.bools[j])
+	case Int32, Int64:
+		c.ints = append(c.ints, v.ints[j])
+	case Float, Double:
+		c.floats = append(c.floats, v.floats[j])
+	default:
+		c.strings = append(c.strings, v.strings[j])
+	}
+	if c.valid != nil {
+		c.valid = append(c.valid, true)
+	}
+	c.n++
+}
+
+// appendNull appends a null to the column
+func (c *Column) appendNull() {
+	if c.valid == nil {
+		c.valid = make([]bool, c.n, c.n+1)
+		for i := range c.valid {
+			c.valid[i] = true
+		}
+	}
+	switch c.Type {
+	case Boolean:
+		c.bools = append(c.bools, false)
+	case Int32, Int64:
+		c.ints = append(c.ints, 0)
+	case Float, Double:
+		c.floats = append(c.floats, 0)
+	default:
+		c.strings = append(c.strings, "")
+	}
+	c.valid = append(c.valid, false)
+	c.n++
+}
+
+// decompress decompresses a page compressed with the codec
+func decompress(codec int64, buf []byte, uncompressedSize int64) ([]byte, error) {
+	switch codec {
+	case codecUncompressed:
+		return buf, nil
+	case codecSnappy:
+		return snappyDecode(buf)
+	case codecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(buf))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unsupported compression codec %d", codec)
+}
+
+// Maximum uncompressed size of a snappy block, to bound allocations on corrupt data
+const maxSnappySize = 1 << 30
+
+// snappyDecode decodes a snappy block, see https://github.com/google/snappy/blob/main/format_description.txt
+func snappyDecode(src []byte) ([]byte, error) {
+	size, k := binary.Uvarint(src)
+	if k <= 0 || size > maxSnappySize {
+		return nil, errors.New("invalid snappy block")
+	}
+	src = src[k:]
+	dst := make([]byte, 0, size)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			// Literal, with its length in the tag or in the following 1 to 4 bytes
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				extra := length - 59
+				if len(src) < extra {
+					return nil, errTruncated
+				}
+				length = 0
+				for i := 0; i < extra; i++ {
+					length |= int(src[i]) << (8 * uint(i))
+				}
+				src = src[extra:]
+			}
+			length++
+			if length > len(src) {
+				return nil, errTruncated
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, errTruncated
+			}
+			length = 4 + int(tag>>2)&7
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case 2:
+			if len(src) < 3 {
+				return nil, errTruncated
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			if len(src) < 5 {
+				return nil, errTruncated
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		// Copies may overlap their output, so they are made a byte at a time
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+length) > size {
+			return nil, errors.New("invalid snappy copy")
+		}
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, errors.New("invalid snappy block length")
+	}
+	return dst, nil
+}
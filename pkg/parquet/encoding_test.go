@@ -0,0 +1,71 @@
+package parquet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeHybrid(t *testing.T) {
+	tests := []struct {
+		name     string
+		buf      []byte
+		bitWidth int
+		n        int
+		want     []uint32
+	}{
+		{"rle run", []byte{3 << 1, 5}, 3, 3, []uint32{5, 5, 5}},
+		{"rle runs", []byte{2 << 1, 1, 1 << 1, 0, 1 << 1, 1}, 1, 4, []uint32{1, 1, 0, 1}},
+		// 8 values of 3 bits: 0 1 2 3 4 5 6 7, see the example of the parquet encodings documentation
+		{"bit packed", []byte{1<<1 | 1, 0x88, 0xc6, 0xfa}, 3, 8, []uint32{0, 1, 2, 3, 4, 5, 6, 7}},
+		{"bit packed padding", []byte{1<<1 | 1, 0x88, 0xc6, 0xfa}, 3, 5, []uint32{0, 1, 2, 3, 4}},
+		{"rle then bit packed", []byte{2 << 1, 0x2c, 0x01, 1<<1 | 1, 0xff, 0, 0, 0, 0, 0, 0, 0, 0}, 9, 4, []uint32{300, 300, 255, 0}},
+		{"zero width", []byte{1<<1 | 1}, 0, 3, []uint32{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeHybrid(tt.buf, tt.bitWidth, tt.n)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := decodeHybrid([]byte{3 << 1, 5}, 3, 4)
+	require.Error(t, err)
+	_, err = decodeHybrid([]byte{1 << 1}, 1, 1)
+	require.Error(t, err)
+}
+
+func TestSnappyDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+		want string
+	}{
+		{"literal", []byte{5, 4 << 2, 'h', 'e', 'l', 'l', 'o'}, "hello"},
+		// "ab" then a copy of 6 bytes at offset 2 with a 1 byte offset
+		{"overlapping copy", []byte{8, 1 << 2, 'a', 'b', (6-4)<<2 | 1, 2}, "abababab"},
+		// "abc" then a copy of 3 bytes at offset 3 with a 2 bytes offset
+		{"copy 2 bytes offset", []byte{6, 2 << 2, 'a', 'b', 'c', (3-1)<<2 | 2, 3, 0}, "abcabc"},
+		// "xyz" then a copy of 2 bytes at offset 2 with a 4 bytes offset
+		{"copy 4 bytes offset", []byte{5, 2 << 2, 'x', 'y', 'z', (2-1)<<2 | 3, 2, 0, 0, 0}, "xyzyz"},
+		{"long literal", append([]byte{61, 60 << 2, 60}, []byte("0123456789012345678901234567890123456789012345678901234567890")...), "0123456789012345678901234567890123456789012345678901234567890"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := snappyDecode(tt.buf)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(got))
+		})
+	}
+
+	for _, buf := range [][]byte{
+		{6, 4 << 2, 'h', 'e', 'l', 'l', 'o'},
+		{5, 5 << 2, 'h', 'e', 'l', 'l', 'o'},
+		{4, (4-4)<<2 | 1, 1},
+		{8, 1 << 2, 'a', 'b', (6-4)<<2 | 1, 3},
+	} {
+		_, err := snappyDecode(buf)
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,399 @@
+// Package parquettest writes small parquet files to test readers with. It writes flat schemas with PLAIN or
+// dictionary encoded values, in data pages v1 or v2, uncompressed, gzip or snappy compressed.
+package parquettest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"math"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/parquet"
+)
+
+// Column is a column of a test file. Values are bool, int64, float64 or string depending on the type, or nil for a
+// null of an optional column.
+type Column struct {
+	Name     string
+	Type     parquet.Type
+	Optional bool
+	Values   []interface{}
+}
+
+// Codecs of the parquet format
+const (
+	Uncompressed = 0
+	Snappy       = 1
+	Gzip         = 2
+)
+
+// Options selects how a file is written
+type Options struct {
+	// RowGroupSize is the number of rows of each row group. Zero writes a single row group
+	RowGroupSize int
+	// Dictionary writes a dictionary page and dictionary encoded data pages
+	Dictionary bool
+	// DataPageV2 writes data pages v2 instead of v1
+	DataPageV2 bool
+	// Codec compresses the pages
+	Codec int
+}
+
+// Write returns a parquet file of the columns, which must have the same number of values
+func Write(columns []Column, opts Options) []byte {
+	numRows := 0
+	if len(columns) > 0 {
+		numRows = len(columns[0].Values)
+	}
+	groupSize := opts.RowGroupSize
+	if groupSize <= 0 {
+		groupSize = numRows
+	}
+
+	file := append([]byte{}, "PAR1"...)
+	var rowGroups [][]byte
+	for start := 0; start < numRows || (start == 0 && numRows == 0); start += groupSize {
+		end := start + groupSize
+		if end > numRows {
+			end = numRows
+		}
+		var chunks [][]byte
+		for _, c := range columns {
+			offset := int64(len(file))
+			chunk, dictionary := writeColumnChunk(c, c.Values[start:end], opts)
+			file = append(file, chunk...)
+			meta := &thriftWriter{}
+			meta.i32(1, int32(c.Type))
+			meta.list(2, tI32, 1, func(w *thriftWriter) { w.varint(zigzag(0)) })
+			meta.list(3, tBinary, 1, func(w *thriftWriter) { w.varint(uint64(len(c.Name))); w.buf = append(w.buf, c.Name...) })
+			meta.i32(4, int32(opts.Codec))
+			meta.i64(5, int64(end-start))
+			meta.i64(6, int64(len(chunk)))
+			meta.i64(7, int64(len(chunk)))
+			meta.i64(9, offset+dictionary)
+			if opts.Dictionary {
+				meta.i64(11, offset)
+			}
+			meta.stop()
+			columnChunk := &thriftWriter{}
+			columnChunk.i64(2, offset)
+			columnChunk.structField(3, meta.buf)
+			columnChunk.stop()
+			chunks = append(chunks, columnChunk.buf)
+		}
+		rowGroup := &thriftWriter{}
+		rowGroup.structList(1, chunks)
+		rowGroup.i64(2, 0)
+		rowGroup.i64(3, int64(end-start))
+		rowGroup.stop()
+		rowGroups = append(rowGroups, rowGroup.buf)
+		if numRows == 0 {
+			break
+		}
+	}
+
+	schema := make([][]byte, 0, len(columns)+1)
+	root := &thriftWriter{}
+	root.binary(4, []byte("schema"))
+	root.i32(5, int32(len(columns)))
+	root.stop()
+	schema = append(schema, root.buf)
+	for _, c := range columns {
+		element := &thriftWriter{}
+		element.i32(1, int32(c.Type))
+		repetition := int32(0)
+		if c.Optional {
+			repetition = 1
+		}
+		element.i32(3, repetition)
+		element.binary(4, []byte(c.Name))
+		element.stop()
+		schema = append(schema, element.buf)
+	}
+	meta := &thriftWriter{}
+	meta.i32(1, 1)
+	meta.structList(2, schema)
+	meta.i64(3, int64(numRows))
+	meta.structList(4, rowGroups)
+	meta.stop()
+
+	file = append(file, meta.buf...)
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(meta.buf)))
+	file = append(file, size[:]...)
+	return append(file, "PAR1"...)
+}
+
+// writeColumnChunk returns the pages of the values, and the offset of the data page in them
+func writeColumnChunk(c Column, values []interface{}, opts Options) ([]byte, int64) {
+	var chunk []byte
+	var levels []uint32
+	var nonNull []interface{}
+	for _, v := range values {
+		if v == nil {
+			levels = append(levels, 0)
+		} else {
+			levels = append(levels, 1)
+			nonNull = append(nonNull, v)
+		}
+	}
+
+	var data []byte
+	encoding := int32(0)
+	if opts.Dictionary {
+		var dict []interface{}
+		indices := make([]uint32, len(nonNull))
+		seen := make(map[interface{}]uint32)
+		for i, v := range nonNull {
+			index, ok := seen[v]
+			if !ok {
+				index = uint32(len(dict))
+				seen[v] = index
+				dict = append(dict, v)
+			}
+			indices[i] = index
+		}
+		page := compress(opts.Codec, plain(c.Type, dict))
+		header := &thriftWriter{}
+		header.i32(1, 2)
+		header.i32(2, int32(len(plain(c.Type, dict))))
+		header.i32(3, int32(len(page)))
+		dictHeader := &thriftWriter{}
+		dictHeader.i32(1, int32(len(dict)))
+		dictHeader.i32(2, 0)
+		dictHeader.stop()
+		header.structField(7, dictHeader.buf)
+		header.stop()
+		chunk = append(append(chunk, header.buf...), page...)
+
+		bitWidth := 0
+		for 1<<uint(bitWidth) < len(dict) {
+			bitWidth++
+		}
+		data = append([]byte{byte(bitWidth)}, bitPacked(indices, bitWidth)...)
+		encoding = 8
+	} else {
+		data = plain(c.Type, nonNull)
+	}
+	dataOffset := int64(len(chunk))
+
+	var defLevels []byte
+	if c.Optional {
+		defLevels = rle(levels)
+	}
+	header := &thriftWriter{}
+	if opts.DataPageV2 {
+		page := compress(opts.Codec, data)
+		header.i32(1, 3)
+		header.i32(2, int32(len(defLevels)+len(data)))
+		header.i32(3, int32(len(defLevels)+len(page)))
+		pageHeader := &thriftWriter{}
+		pageHeader.i32(1, int32(len(values)))
+		pageHeader.i32(2, int32(len(values)-len(nonNull)))
+		pageHeader.i32(3, int32(len(values)))
+		pageHeader.i32(4, encoding)
+		pageHeader.i32(5, int32(len(defLevels)))
+		pageHeader.i32(6, 0)
+		pageHeader.stop()
+		header.structField(8, pageHeader.buf)
+		header.stop()
+		chunk = append(append(append(chunk, header.buf...), defLevels...), page...)
+	} else {
+		if c.Optional {
+			var length [4]byte
+			binary.LittleEndian.PutUint32(length[:], uint32(len(defLevels)))
+			data = append(append(length[:], defLevels...), data...)
+		}
+		page := compress(opts.Codec, data)
+		header.i32(1, 0)
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(page)))
+		pageHeader := &thriftWriter{}
+		pageHeader.i32(1, int32(len(values)))
+		pageHeader.i32(2, encoding)
+		pageHeader.i32(3, 3)
+		pageHeader.i32(4, 3)
+		pageHeader.stop()
+		header.structField(5, pageHeader.buf)
+		header.stop()
+		chunk = append(append(chunk, header.buf...), page...)
+	}
+	return chunk, dataOffset
+}
+
+// plain returns the PLAIN encoding of the values
+func plain(typ parquet.Type, values []interface{}) []byte {
+	var buf []byte
+	if typ == parquet.Boolean {
+		buf = make([]byte, (len(values)+7)/8)
+		for i, v := range values {
+			if v.(bool) {
+				buf[i/8] |= 1 << uint(i%8)
+			}
+		}
+		return buf
+	}
+	for _, v := range values {
+		var b [8]byte
+		switch typ {
+		case parquet.Int32:
+			binary.LittleEndian.PutUint32(b[:], uint32(v.(int64)))
+			buf = append(buf, b[:4]...)
+		case parquet.Int64:
+			binary.LittleEndian.PutUint64(b[:], uint64(v.(int64)))
+			buf = append(buf, b[:]...)
+		case parquet.Float:
+			binary.LittleEndian.PutUint32(b[:], math.Float32bits(float32(v.(float64))))
+			buf = append(buf, b[:4]...)
+		case parquet.Double:
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(v.(float64)))
+			buf = append(buf, b[:]...)
+		case parquet.ByteArray:
+			binary.LittleEndian.PutUint32(b[:], uint32(len(v.(string))))
+			buf = append(append(buf, b[:4]...), v.(string)...)
+		}
+	}
+	return buf
+}
+
+// rle returns the values encoded as RLE runs of bit width 1
+func rle(values []uint32) []byte {
+	var buf []byte
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		buf = appendUvarint(buf, uint64(j-i)<<1)
+		buf = append(buf, byte(values[i]))
+		i = j
+	}
+	return buf
+}
+
+// bitPacked returns the values encoded as a single bit-packed run
+func bitPacked(values []uint32, bitWidth int) []byte {
+	groups := (len(values) + 7) / 8
+	buf := appendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups*bitWidth)
+	for i, v := range values {
+		for b := 0; b < bitWidth; b++ {
+			if v>>uint(b)&1 == 1 {
+				pos := i*bitWidth + b
+				packed[pos/8] |= 1 << uint(pos%8)
+			}
+		}
+	}
+	return append(buf, packed...)
+}
+
+// compress compresses the page with the codec. Snappy blocks are only made of literals.
+func compress(codec int, buf []byte) []byte {
+	switch codec {
+	case Gzip:
+		var out bytes.Buffer
+		w := gzip.NewWriter(&out)
+		w.Write(buf)
+		w.Close()
+		return out.Bytes()
+	case Snappy:
+		out := appendUvarint(nil, uint64(len(buf)))
+		for len(buf) > 0 {
+			n := len(buf)
+			if n > 256 {
+				n = 256
+			}
+			if n <= 60 {
+				out = append(out, byte(n-1)<<2)
+			} else {
+				out = append(out, 60<<2, byte(n-1))
+			}
+			out = append(out, buf[:n]...)
+			buf = buf[n:]
+		}
+		return out
+	}
+	return buf
+}
+
+// Types of the thrift compact protocol
+const (
+	tI32    = 5
+	tI64    = 6
+	tBinary = 8
+	tList   = 9
+	tStruct = 12
+)
+
+// thriftWriter encodes a thrift struct with the compact protocol. Fields must be written in increasing ID order.
+type thriftWriter struct {
+	buf    []byte
+	lastID int16
+}
+
+func (w *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - w.lastID; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.varint(zigzag(int64(id)))
+	}
+	w.lastID = id
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	w.buf = appendUvarint(w.buf, v)
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.fieldHeader(id, tI32)
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.fieldHeader(id, tI64)
+	w.varint(zigzag(v))
+}
+
+func (w *thriftWriter) binary(id int16, v []byte) {
+	w.fieldHeader(id, tBinary)
+	w.varint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *thriftWriter) structField(id int16, encoded []byte) {
+	w.fieldHeader(id, tStruct)
+	w.buf = append(w.buf, encoded...)
+}
+
+func (w *thriftWriter) list(id int16, elemType byte, n int, elems func(w *thriftWriter)) {
+	w.fieldHeader(id, tList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|elemType)
+	} else {
+		w.buf = append(w.buf, 0xf0|elemType)
+		w.varint(uint64(n))
+	}
+	elems(w)
+}
+
+func (w *thriftWriter) structList(id int16, encoded [][]byte) {
+	w.list(id, tStruct, len(encoded), func(w *thriftWriter) {
+		for _, s := range encoded {
+			w.buf = append(w.buf, s...)
+		}
+	})
+}
+
+func (w *thriftWriter) stop() {
+	w.buf = append(w.buf, 0)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
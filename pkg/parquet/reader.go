@@ -0,0 +1,337 @@
+// Package parquet reads columns of parquet files, see https://parquet.apache.org/docs/file-format/. It only supports
+// what the datacube outputs need: flat schemas of required or optional columns, PLAIN and dictionary encodings,
+// data pages v1 and v2, and uncompressed, snappy or gzip column chunks.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Field IDs of the thrift structs of the parquet format
+const (
+	fileMetaDataSchema    = 2
+	fileMetaDataNumRows   = 3
+	fileMetaDataRowGroups = 4
+
+	schemaElementType           = 1
+	schemaElementTypeLength     = 2
+	schemaElementRepetitionType = 3
+	schemaElementName           = 4
+	schemaElementNumChildren    = 5
+
+	rowGroupColumns = 1
+	rowGroupNumRows = 3
+
+	columnChunkMetaData = 3
+
+	columnMetaDataCodec                 = 4
+	columnMetaDataNumValues             = 5
+	columnMetaDataTotalCompressedSize   = 7
+	columnMetaDataDataPageOffset        = 9
+	columnMetaDataDictionaryPageOffset  = 11
+	pageHeaderType                      = 1
+	pageHeaderUncompressedPageSize      = 2
+	pageHeaderCompressedPageSize        = 3
+	pageHeaderDataPageHeader            = 5
+	pageHeaderDictionaryPageHeader      = 7
+	pageHeaderDataPageHeaderV2          = 8
+	dataPageHeaderNumValues             = 1
+	dataPageHeaderEncoding              = 2
+	dictionaryPageHeaderNumValues       = 1
+	dataPageHeaderV2NumValues           = 1
+	dataPageHeaderV2Encoding            = 4
+	dataPageHeaderV2DefinitionLevelsLen = 5
+	dataPageHeaderV2RepetitionLevelsLen = 6
+	dataPageHeaderV2IsCompressed        = 7
+)
+
+// Values of the enums of the parquet format
+const (
+	repetitionOptional = 1
+	repetitionRepeated = 2
+
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// magic starts and ends parquet files
+var magic = []byte("PAR1")
+
+// Number of bytes read from the end of the file to get the footer, which is read again if it is larger
+const footerReadSize = 64 << 10
+
+// ErrNotParquet is returned when opening a file that isn't a parquet file
+var ErrNotParquet = errors.New("not a parquet file")
+
+// columnSchema describes a leaf column
+type columnSchema struct {
+	name       string
+	typ        Type
+	typeLength int
+	optional   bool
+}
+
+// File is a parquet file opened for reading columns
+type File struct {
+	r         io.ReaderAt
+	columns   []columnSchema
+	rowGroups []tStructValue
+	numRows   int64
+}
+
+// Open reads the footer of the parquet file of the given size read by r
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	if size < int64(2*len(magic)+4) {
+		return nil, ErrNotParquet
+	}
+	tailSize := size
+	if tailSize > footerReadSize {
+		tailSize = footerReadSize
+	}
+	tail, err := readAt(r, size-tailSize, tailSize)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tail[len(tail)-len(magic):], magic) {
+		return nil, ErrNotParquet
+	}
+	footerSize := int64(binary.LittleEndian.Uint32(tail[len(tail)-8:]))
+	if footerSize+8+int64(len(magic)) > size {
+		return nil, errors.New("invalid footer length")
+	}
+	var footer []byte
+	if footerSize+8 <= tailSize {
+		footer = tail[tailSize-8-footerSize : tailSize-8]
+	} else if footer, err = readAt(r, size-8-footerSize, footerSize); err != nil {
+		return nil, err
+	}
+	meta, _, err := readStruct(footer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid footer: %v", err)
+	}
+
+	f := &File{r: r, numRows: meta.int(fileMetaDataNumRows)}
+	schema := meta.list(fileMetaDataSchema)
+	if len(schema) == 0 {
+		return nil, errors.New("missing schema")
+	}
+	for _, e := range schema[1:] {
+		element, ok := e.(tStructValue)
+		if !ok {
+			return nil, errors.New("invalid schema")
+		}
+		name := element.string(schemaElementName)
+		if element.int(schemaElementNumChildren) > 0 || !element.has(schemaElementType) {
+			return nil, fmt.Errorf("column %s: nested columns are not supported", name)
+		}
+		repetition := element.int(schemaElementRepetitionType)
+		if repetition == repetitionRepeated {
+			return nil, fmt.Errorf("column %s: repeated columns are not supported", name)
+		}
+		f.columns = append(f.columns, columnSchema{
+			name:       name,
+			typ:        Type(element.int(schemaElementType)),
+			typeLength: int(element.int(schemaElementTypeLength)),
+			optional:   repetition == repetitionOptional,
+		})
+	}
+	for _, rg := range meta.list(fileMetaDataRowGroups) {
+		rowGroup, ok := rg.(tStructValue)
+		if !ok || len(rowGroup.list(rowGroupColumns)) != len(f.columns) {
+			return nil, errors.New("invalid row group")
+		}
+		f.rowGroups = append(f.rowGroups, rowGroup)
+	}
+	return f, nil
+}
+
+// Columns returns the names of the columns
+func (f *File) Columns() []string {
+	names := make([]string, len(f.columns))
+	for i, c := range f.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// NumRows returns the number of rows
+func (f *File) NumRows() int64 {
+	return f.numRows
+}
+
+// NumRowGroups returns the number of row groups
+func (f *File) NumRowGroups() int {
+	return len(f.rowGroups)
+}
+
+// RowGroupNumRows returns the number of rows of the i-th row group
+func (f *File) RowGroupNumRows(i int) int64 {
+	return f.rowGroups[i].int(rowGroupNumRows)
+}
+
+// ReadColumns reads and decodes the named columns, only fetching their column chunks
+func (f *File) ReadColumns(names ...string) ([]*Column, error) {
+	return f.readColumns(f.rowGroups, names)
+}
+
+// ReadRowGroupColumns reads and decodes the named columns of the i-th row group, only fetching their column chunks
+func (f *File) ReadRowGroupColumns(i int, names ...string) ([]*Column, error) {
+	if i < 0 || i >= len(f.rowGroups) {
+		return nil, fmt.Errorf("row group %d does not exist", i)
+	}
+	return f.readColumns(f.rowGroups[i:i+1], names)
+}
+
+func (f *File) readColumns(rowGroups []tStructValue, names []string) ([]*Column, error) {
+	columns := make([]*Column, len(names))
+	for i, name := range names {
+		index := -1
+		for j, c := range f.columns {
+			if c.name == name {
+				index = j
+				break
+			}
+		}
+		if index == -1 {
+			return nil, fmt.Errorf("column %s does not exist", name)
+		}
+		schema := f.columns[index]
+		if schema.typ == Int96 {
+			return nil, fmt.Errorf("column %s: INT96 columns are not supported", name)
+		}
+		column := &Column{Name: name, Type: schema.typ}
+		for _, rowGroup := range rowGroups {
+			if err := f.readColumnChunk(rowGroup, index, column); err != nil {
+				return nil, fmt.Errorf("column %s: %v", name, err)
+			}
+		}
+		columns[i] = column
+	}
+	return columns, nil
+}
+
+// readColumnChunk fetches the column chunk of the row group and appends its values to the column
+func (f *File) readColumnChunk(rowGroup tStructValue, index int, column *Column) error {
+	chunk, ok := rowGroup.list(rowGroupColumns)[index].(tStructValue)
+	if !ok {
+		return errors.New("invalid column chunk")
+	}
+	meta := chunk.structValue(columnChunkMetaData)
+	if meta == nil {
+		return errors.New("column chunks in other files are not supported")
+	}
+	start := meta.int(columnMetaDataDataPageOffset)
+	// Some writers set the dictionary page offset to 0 when there is no dictionary
+	if offset := meta.int(columnMetaDataDictionaryPageOffset); offset > 0 && offset < start {
+		start = offset
+	}
+	buf, err := readAt(f.r, start, meta.int(columnMetaDataTotalCompressedSize))
+	if err != nil {
+		return err
+	}
+	return decodeColumnChunk(buf, f.columns[index], meta.int(columnMetaDataCodec), meta.int(columnMetaDataNumValues), column)
+}
+
+// decodeColumnChunk decodes the pages of a column chunk holding numValues values
+func decodeColumnChunk(buf []byte, schema columnSchema, codec int64, numValues int64, column *Column) error {
+	var dict *values
+	for read := int64(0); read < numValues; {
+		header, n, err := readStruct(buf)
+		if err != nil {
+			return fmt.Errorf("invalid page header: %v", err)
+		}
+		buf = buf[n:]
+		size := header.int(pageHeaderCompressedPageSize)
+		if size < 0 || size > int64(len(buf)) {
+			return errors.New("invalid page size")
+		}
+		page := buf[:size]
+		buf = buf[size:]
+		uncompressedSize := header.int(pageHeaderUncompressedPageSize)
+
+		switch header.int(pageHeaderType) {
+		case pageDictionary:
+			data, err := decompress(codec, page, uncompressedSize)
+			if err != nil {
+				return err
+			}
+			n := int(header.structValue(pageHeaderDictionaryPageHeader).int(dictionaryPageHeaderNumValues))
+			dict = &values{}
+			if err := decodePlain(schema, data, n, dict); err != nil {
+				return err
+			}
+		case pageData:
+			data, err := decompress(codec, page, uncompressedSize)
+			if err != nil {
+				return err
+			}
+			dataHeader := header.structValue(pageHeaderDataPageHeader)
+			n := int(dataHeader.int(dataPageHeaderNumValues))
+			var defLevels []uint32
+			if schema.optional {
+				if len(data) < 4 {
+					return errors.New("invalid definition levels")
+				}
+				length := int(binary.LittleEndian.Uint32(data))
+				if length > len(data)-4 {
+					return errors.New("invalid definition levels")
+				}
+				if defLevels, err = decodeHybrid(data[4:4+length], 1, n); err != nil {
+					return err
+				}
+				data = data[4+length:]
+			}
+			if err := decodeValues(schema, data, dataHeader.int(dataPageHeaderEncoding), n, defLevels, dict, column); err != nil {
+				return err
+			}
+			read += int64(n)
+		case pageDataV2:
+			dataHeader := header.structValue(pageHeaderDataPageHeaderV2)
+			n := int(dataHeader.int(dataPageHeaderV2NumValues))
+			defLength := dataHeader.int(dataPageHeaderV2DefinitionLevelsLen)
+			repLength := dataHeader.int(dataPageHeaderV2RepetitionLevelsLen)
+			if defLength < 0 || repLength != 0 || defLength > int64(len(page)) {
+				return errors.New("invalid levels")
+			}
+			var defLevels []uint32
+			var err error
+			if schema.optional {
+				if defLevels, err = decodeHybrid(page[:defLength], 1, n); err != nil {
+					return err
+				}
+			}
+			data := page[defLength:]
+			if dataHeader.bool(dataPageHeaderV2IsCompressed, true) {
+				if data, err = decompress(codec, data, uncompressedSize-defLength); err != nil {
+					return err
+				}
+			}
+			if err := decodeValues(schema, data, dataHeader.int(dataPageHeaderV2Encoding), n, defLevels, dict, column); err != nil {
+				return err
+			}
+			read += int64(n)
+		}
+	}
+	return nil
+}
+
+// readAt reads length bytes at offset
+func readAt(r io.ReaderAt, offset int64, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, errors.New("invalid offset")
+	}
+	buf := make([]byte, length)
+	n, err := r.ReadAt(buf, offset)
+	if int64(n) == length {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
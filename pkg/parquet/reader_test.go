@@ -0,0 +1,189 @@
+package parquet_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/parquet"
+	"gitlab.uncharted.software/WM/wm-go/pkg/parquet/parquettest"
+)
+
+func testColumns() []parquettest.Column {
+	return []parquettest.Column{
+		{Name: "id", Type: parquet.ByteArray, Values: []interface{}{"Ethiopia", "Ethiopia__Afar", "Ethiopia__Amhara", "Ethiopia__Afar", "Kenya"}},
+		{Name: "timestamp", Type: parquet.Int64, Values: []interface{}{int64(1577836800000), int64(1580515200000), int64(1583020800000), int64(1580515200000), int64(1577836800000)}},
+		{Name: "s_sum_t_mean", Type: parquet.Double, Optional: true, Values: []interface{}{1.5, nil, -3.25, 1.5, nil}},
+		{Name: "s_mean_t_mean", Type: parquet.Float, Values: []interface{}{0.5, 2.0, 3.0, 0.5, 4.0}},
+		{Name: "count", Type: parquet.Int32, Optional: true, Values: []interface{}{nil, int64(-2), int64(3), nil, int64(5)}},
+		{Name: "flag", Type: parquet.Boolean, Values: []interface{}{true, false, true, true, false}},
+	}
+}
+
+func TestReadColumns(t *testing.T) {
+	for _, opts := range []parquettest.Options{
+		{},
+		{Dictionary: true},
+		{DataPageV2: true},
+		{DataPageV2: true, Dictionary: true, Codec: parquettest.Snappy},
+		{Codec: parquettest.Gzip, RowGroupSize: 2},
+		{Codec: parquettest.Snappy, RowGroupSize: 1, Dictionary: true},
+	} {
+		t.Run(fmt.Sprintf("%+v", opts), func(t *testing.T) {
+			columns := testColumns()
+			buf := parquettest.Write(columns, opts)
+			f, err := parquet.Open(bytes.NewReader(buf), int64(len(buf)))
+			require.NoError(t, err)
+			require.Equal(t, []string{"id", "timestamp", "s_sum_t_mean", "s_mean_t_mean", "count", "flag"}, f.Columns())
+			require.Equal(t, int64(5), f.NumRows())
+
+			read, err := f.ReadColumns("flag", "id", "s_sum_t_mean", "count", "timestamp", "s_mean_t_mean")
+			require.NoError(t, err)
+			require.Len(t, read, 6)
+			for _, c := range read {
+				require.Equal(t, 5, c.Len())
+			}
+			flag, id, sum, count, timestamp, mean := read[0], read[1], read[2], read[3], read[4], read[5]
+
+			require.Equal(t, "Ethiopia__Amhara", id.String(2))
+			require.Equal(t, "false", flag.String(1))
+
+			ts, err := timestamp.Int64(1)
+			require.NoError(t, err)
+			require.Equal(t, int64(1580515200000), ts)
+
+			require.False(t, sum.IsNull(2))
+			v, err := sum.Float64(2)
+			require.NoError(t, err)
+			require.Equal(t, -3.25, v)
+			require.True(t, sum.IsNull(1))
+			require.True(t, sum.IsNull(4))
+			require.Equal(t, "", sum.String(4))
+			_, err = sum.Float64(1)
+			require.Error(t, err)
+
+			v, err = mean.Float64(4)
+			require.NoError(t, err)
+			require.Equal(t, 4.0, v)
+			n, err := mean.Int64(1)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), n)
+			_, err = mean.Int64(0)
+			require.Error(t, err)
+
+			require.True(t, count.IsNull(0))
+			require.Equal(t, "-2", count.String(1))
+			require.Equal(t, "5", count.String(4))
+
+			_, err = id.Float64(0)
+			require.Error(t, err)
+		})
+	}
+}
+
+// The files of testdata hold the rows of testColumns, written by github.com/xitongsys/parquet-go
+func TestReadTestdata(t *testing.T) {
+	for _, test := range []struct {
+		file      string
+		rowGroups int
+	}{
+		{"plain.parquet", 1},
+		{"dictionary_snappy.parquet", 1},
+		{"gzip_row_groups.parquet", 2},
+		{"data_page_v2_snappy.parquet", 1},
+	} {
+		t.Run(test.file, func(t *testing.T) {
+			buf, err := os.ReadFile("testdata/" + test.file)
+			require.NoError(t, err)
+			f, err := parquet.Open(bytes.NewReader(buf), int64(len(buf)))
+			require.NoError(t, err)
+			require.Equal(t, []string{"id", "timestamp", "s_sum_t_mean", "s_mean_t_mean", "count", "flag"}, f.Columns())
+			require.Equal(t, int64(5), f.NumRows())
+			require.Equal(t, test.rowGroups, f.NumRowGroups())
+
+			for _, want := range testColumns() {
+				read, err := f.ReadColumns(want.Name)
+				require.NoError(t, err)
+				c := read[0]
+				require.Equal(t, want.Type, c.Type)
+				require.Equal(t, len(want.Values), c.Len())
+				for i, v := range want.Values {
+					switch v := v.(type) {
+					case nil:
+						require.True(t, c.IsNull(i))
+					case string:
+						require.Equal(t, v, c.String(i))
+					case int64:
+						n, err := c.Int64(i)
+						require.NoError(t, err)
+						require.Equal(t, v, n)
+					case float64:
+						x, err := c.Float64(i)
+						require.NoError(t, err)
+						require.Equal(t, v, x)
+					case bool:
+						require.Equal(t, fmt.Sprint(v), c.String(i))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadRowGroupColumns(t *testing.T) {
+	buf := parquettest.Write(testColumns(), parquettest.Options{RowGroupSize: 2})
+	f, err := parquet.Open(bytes.NewReader(buf), int64(len(buf)))
+	require.NoError(t, err)
+	require.Equal(t, 3, f.NumRowGroups())
+	require.Equal(t, int64(2), f.RowGroupNumRows(1))
+	require.Equal(t, int64(1), f.RowGroupNumRows(2))
+
+	read, err := f.ReadRowGroupColumns(1, "id", "count")
+	require.NoError(t, err)
+	require.Equal(t, 2, read[0].Len())
+	require.Equal(t, "Ethiopia__Amhara", read[0].String(0))
+	require.True(t, read[1].IsNull(1))
+
+	_, err = f.ReadRowGroupColumns(3, "id")
+	require.Error(t, err)
+}
+
+func TestReadColumnsErrors(t *testing.T) {
+	buf := parquettest.Write(testColumns(), parquettest.Options{})
+	f, err := parquet.Open(bytes.NewReader(buf), int64(len(buf)))
+	require.NoError(t, err)
+	_, err = f.ReadColumns("id", "missing")
+	require.Error(t, err)
+
+	_, err = parquet.Open(bytes.NewReader([]byte("id,value\na,1\n")), 13)
+	require.Equal(t, parquet.ErrNotParquet, err)
+
+	// Truncated file, the footer length points before the start of the file
+	_, err = parquet.Open(bytes.NewReader(buf[len(buf)-12:]), 12)
+	require.Error(t, err)
+
+	// Corrupt column chunk
+	corrupt := append([]byte{}, buf...)
+	for i := 4; i < 20; i++ {
+		corrupt[i] = 0xff
+	}
+	f, err = parquet.Open(bytes.NewReader(corrupt), int64(len(corrupt)))
+	require.NoError(t, err)
+	_, err = f.ReadColumns("id")
+	require.Error(t, err)
+}
+
+func TestReadEmptyFile(t *testing.T) {
+	buf := parquettest.Write([]parquettest.Column{
+		{Name: "id", Type: parquet.ByteArray},
+		{Name: "value", Type: parquet.Double, Optional: true},
+	}, parquettest.Options{})
+	f, err := parquet.Open(bytes.NewReader(buf), int64(len(buf)))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), f.NumRows())
+	columns, err := f.ReadColumns("value")
+	require.NoError(t, err)
+	require.Equal(t, 0, columns[0].Len())
+}
@@ -0,0 +1,216 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Types of the thrift compact protocol
+const (
+	tStop      = 0
+	tBoolTrue  = 1
+	tBoolFalse = 2
+	tByte      = 3
+	tI16       = 4
+	tI32       = 5
+	tI64       = 6
+	tDouble    = 7
+	tBinary    = 8
+	tList      = 9
+	tSet       = 10
+	tMap       = 11
+	tStruct    = 12
+)
+
+var errInvalidThrift = errors.New("invalid thrift data")
+
+// tStructValue is a decoded thrift struct, mapping field IDs to values. Values are bool, int64, float64, []byte,
+// []interface{} or tStructValue. Maps are skipped.
+type tStructValue map[int16]interface{}
+
+func (s tStructValue) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s tStructValue) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s tStructValue) bool(id int16, defaultValue bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return defaultValue
+}
+
+func (s tStructValue) string(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s tStructValue) structValue(id int16) tStructValue {
+	v, _ := s[id].(tStructValue)
+	return v
+}
+
+func (s tStructValue) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
+
+// thriftDecoder decodes thrift compact protocol structs
+type thriftDecoder struct {
+	buf []byte
+	pos int
+}
+
+// readStruct decodes a struct, and returns it with the number of bytes it used
+func readStruct(buf []byte) (tStructValue, int, error) {
+	d := &thriftDecoder{buf: buf}
+	s, err := d.readStruct(0)
+	return s, d.pos, err
+}
+
+// Maximum nesting of structs and lists, to bound the recursion on corrupt data
+const maxThriftDepth = 64
+
+func (d *thriftDecoder) readStruct(depth int) (tStructValue, error) {
+	if depth > maxThriftDepth {
+		return nil, errInvalidThrift
+	}
+	s := make(tStructValue)
+	var id int16
+	for {
+		header, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		typ := header & 0x0f
+		if typ == tStop {
+			return s, nil
+		}
+		if delta := header >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			v, err := d.readVarint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(zigzag(v))
+		}
+		var value interface{}
+		switch typ {
+		case tBoolTrue:
+			value = true
+		case tBoolFalse:
+			value = false
+		default:
+			if value, err = d.readValue(typ, depth); err != nil {
+				return nil, err
+			}
+		}
+		if value != nil {
+			s[id] = value
+		}
+	}
+}
+
+// readValue decodes a value of the type. Booleans are only read this way as list elements.
+func (d *thriftDecoder) readValue(typ byte, depth int) (interface{}, error) {
+	switch typ {
+	case tBoolTrue, tBoolFalse:
+		b, err := d.readByte()
+		return b == tBoolTrue, err
+	case tByte:
+		b, err := d.readByte()
+		return int64(int8(b)), err
+	case tI16, tI32, tI64:
+		v, err := d.readVarint()
+		return zigzag(v), err
+	case tDouble:
+		if d.pos+8 > len(d.buf) {
+			return nil, errInvalidThrift
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(d.buf[d.pos:]))
+		d.pos += 8
+		return v, nil
+	case tBinary:
+		n, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(d.buf)-d.pos) {
+			return nil, errInvalidThrift
+		}
+		v := d.buf[d.pos : d.pos+int(n)]
+		d.pos += int(n)
+		return v, nil
+	case tList, tSet:
+		header, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		n := uint64(header >> 4)
+		if n == 15 {
+			if n, err = d.readVarint(); err != nil {
+				return nil, err
+			}
+		}
+		if n > uint64(len(d.buf)-d.pos) {
+			return nil, errInvalidThrift
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			if list[i], err = d.readValue(header&0x0f, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case tMap:
+		n, err := d.readVarint()
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		types, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < n; i++ {
+			if _, err := d.readValue(types>>4, depth+1); err != nil {
+				return nil, err
+			}
+			if _, err := d.readValue(types&0x0f, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case tStruct:
+		return d.readStruct(depth + 1)
+	}
+	return nil, errInvalidThrift
+}
+
+func (d *thriftDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.buf) {
+		return 0, errInvalidThrift
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *thriftDecoder) readVarint() (uint64, error) {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	if n <= 0 {
+		return 0, errInvalidThrift
+	}
+	d.pos += n
+	return v, nil
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"math"
+	"sort"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// Functions aggregating the values of several regions at a timestamp
+const (
+	aggMean                   = "mean"
+	aggSum                    = "sum"
+	aggMin                    = "min"
+	aggMax                    = "max"
+	aggMedian                 = "median"
+	aggCount                  = "count"
+	aggPercentile             = "percentile"
+	aggPopulationWeightedMean = "population_weighted_mean"
+)
+
+var aggregateFuncs = []string{aggMean, aggSum, aggMin, aggMax, aggMedian, aggCount, aggPercentile, aggPopulationWeightedMean}
+
+// How the regions without a value at a timestamp are aggregated
+const (
+	// missingSkip aggregates the values of the regions with a value
+	missingSkip = "skip"
+	// missingZero aggregates the missing values as 0
+	missingZero = "zero"
+	// missingDrop leaves out the timestamps at which any region has no value
+	missingDrop = "drop"
+)
+
+var missingOptions = []string{missingSkip, missingZero, missingDrop}
+
+// timeseriesAggregation defines how the timeseries of several regions are aggregated
+type timeseriesAggregation struct {
+	agg string
+	// percentile, between 0 and 100, of the percentile function
+	percentile float64
+	missing    string
+}
+
+// aggregateTimeseries aggregates the timeseries of several regions at each of their timestamps, returned in order. The
+// weights are the timeseries of the weights of the regions, only used by the population weighted mean.
+func aggregateTimeseries(series [][]*wm.TimeseriesValue, weights [][]*wm.TimeseriesValue, aggregation timeseriesAggregation) []*wm.TimeseriesValue {
+	byTimestamp := func(timeseries []*wm.TimeseriesValue) map[int64]float64 {
+		values := make(map[int64]float64, len(timeseries))
+		for _, v := range timeseries {
+			values[v.Timestamp] = v.Value
+		}
+		return values
+	}
+	values := make([]map[int64]float64, len(series))
+	var timestamps []int64
+	for i, timeseries := range series {
+		values[i] = byTimestamp(timeseries)
+		for _, v := range timeseries {
+			timestamps = append(timestamps, v.Timestamp)
+		}
+	}
+	regionWeights := make([]map[int64]float64, len(weights))
+	for i, timeseries := range weights {
+		regionWeights[i] = byTimestamp(timeseries)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	result := make([]*wm.TimeseriesValue, 0)
+	for k, timestamp := range timestamps {
+		if k > 0 && timestamps[k-1] == timestamp {
+			continue
+		}
+		var points, pointWeights []float64
+		complete := true
+		for i := range series {
+			v, ok := values[i][timestamp]
+			if !ok {
+				if aggregation.missing == missingDrop {
+					complete = false
+					break
+				}
+				if aggregation.missing != missingZero {
+					continue
+				}
+			}
+			if aggregation.agg == aggPopulationWeightedMean {
+				// The regions without a weight can't be weighted
+				w, ok := regionWeights[i][timestamp]
+				if !ok {
+					continue
+				}
+				pointWeights = append(pointWeights, w)
+			}
+			points = append(points, v)
+		}
+		if !complete {
+			continue
+		}
+		if value, ok := aggregate(points, pointWeights, aggregation); ok {
+			result = append(result, &wm.TimeseriesValue{Timestamp: timestamp, Value: value})
+		}
+	}
+	return result
+}
+
+// aggregate returns the aggregate of the values, if they have one
+func aggregate(values []float64, weights []float64, aggregation timeseriesAggregation) (float64, bool) {
+	if aggregation.agg == aggCount {
+		return float64(len(values)), true
+	}
+	if len(values) == 0 {
+		return 0, false
+	}
+	switch aggregation.agg {
+	case aggSum, aggMean:
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		if aggregation.agg == aggMean {
+			return sum / float64(len(values)), true
+		}
+		return sum, true
+	case aggMin, aggMax:
+		result := values[0]
+		for _, v := range values {
+			if aggregation.agg == aggMin {
+				result = math.Min(result, v)
+			} else {
+				result = math.Max(result, v)
+			}
+		}
+		return result, true
+	case aggMedian:
+		return percentile(values, 50), true
+	case aggPercentile:
+		return percentile(values, aggregation.percentile), true
+	case aggPopulationWeightedMean:
+		var sum, total float64
+		for i, v := range values {
+			sum += v * weights[i]
+			total += weights[i]
+		}
+		return sum / total, total != 0
+	}
+	return 0, false
+}
+
+// percentile returns the p-th percentile of the values, linearly interpolated between the closest ranks
+func percentile(values []float64, p float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower == len(sorted)-1 {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[lower+1]-sorted[lower])*(rank-float64(lower))
+}
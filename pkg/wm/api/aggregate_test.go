@@ -0,0 +1,49 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestAggregateTimeseries(t *testing.T) {
+	// Unsorted, with the second region missing timestamp 1 and the third one timestamp 3
+	series := [][]*wm.TimeseriesValue{
+		{{Timestamp: 3, Value: 4}, {Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 2}},
+		{{Timestamp: 2, Value: 6}, {Timestamp: 3, Value: 8}},
+		{{Timestamp: 1, Value: 3}, {Timestamp: 2, Value: 10}},
+	}
+	weights := [][]*wm.TimeseriesValue{
+		{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 1}, {Timestamp: 3, Value: 1}},
+		{{Timestamp: 1, Value: 3}, {Timestamp: 2, Value: 3}, {Timestamp: 3, Value: 3}},
+		// The third region has no population data
+		nil,
+	}
+	values := func(v1, v2, v3 float64) []*wm.TimeseriesValue {
+		return []*wm.TimeseriesValue{{Timestamp: 1, Value: v1}, {Timestamp: 2, Value: v2}, {Timestamp: 3, Value: v3}}
+	}
+	tests := []struct {
+		name        string
+		aggregation timeseriesAggregation
+		want        []*wm.TimeseriesValue
+	}{
+		{"mean", timeseriesAggregation{agg: aggMean, missing: missingSkip}, values(2, 6, 6)},
+		{"sum", timeseriesAggregation{agg: aggSum, missing: missingSkip}, values(4, 18, 12)},
+		{"min", timeseriesAggregation{agg: aggMin, missing: missingSkip}, values(1, 2, 4)},
+		{"max", timeseriesAggregation{agg: aggMax, missing: missingSkip}, values(3, 10, 8)},
+		{"median", timeseriesAggregation{agg: aggMedian, missing: missingSkip}, values(2, 6, 6)},
+		{"count", timeseriesAggregation{agg: aggCount, missing: missingSkip}, values(2, 3, 2)},
+		{"percentile", timeseriesAggregation{agg: aggPercentile, percentile: 25, missing: missingSkip}, values(1.5, 4, 5)},
+		{"population weighted mean", timeseriesAggregation{agg: aggPopulationWeightedMean, missing: missingSkip}, values(1, 5, 7)},
+		{"missing as zero", timeseriesAggregation{agg: aggMean, missing: missingZero}, values(4.0/3, 6, 4)},
+		{"missing dropping the timestamp", timeseriesAggregation{agg: aggSum, missing: missingDrop}, []*wm.TimeseriesValue{{Timestamp: 2, Value: 18}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, aggregateTimeseries(series, weights, tt.aggregation))
+		})
+	}
+
+	require.Equal(t, []*wm.TimeseriesValue{}, aggregateTimeseries(nil, nil, timeseriesAggregation{agg: aggMean, missing: missingSkip}))
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -19,12 +20,17 @@ const (
 	paramModelID     = "modelID"
 	paramRunID       = "runID"
 	paramTileSetName = "tileSetName"
+	paramAsset       = "asset"
 )
 
 type api struct {
-	dataOutput wm.DataOutput
-	vectorTile wm.VectorTile
-	logger     *zap.SugaredLogger
+	dataOutput     wm.DataOutput
+	vectorTile     wm.VectorTile
+	datacubeSearch wm.DatacubeSearch
+	modelMetadata  wm.ModelMetadata
+	logger         *zap.SugaredLogger
+	maxConcurrency int
+	openAPI        []byte
 }
 
 // New returns a chi router with the various endpoints defined.
@@ -35,9 +41,12 @@ func New(cfg *Config) (chi.Router, error) {
 	}
 
 	a := api{
-		dataOutput: cfg.DataOutput,
-		vectorTile: cfg.VectorTile,
-		logger:     cfg.Logger,
+		dataOutput:     cfg.DataOutput,
+		vectorTile:     cfg.VectorTile,
+		datacubeSearch: cfg.DatacubeSearch,
+		modelMetadata:  cfg.ModelMetadata,
+		logger:         cfg.Logger,
+		maxConcurrency: cfg.MaxConcurrency,
 	}
 
 	r := chi.NewRouter()
@@ -65,6 +74,25 @@ func New(cfg *Config) (chi.Router, error) {
 		r.Get("/output/qualifier-data", a.wh(a.getDataOutputQualifierData))
 		r.Get("/output/qualifier-regional", a.wh(a.getDataOutputQualifierRegional))
 		r.Get("/output/pipeline-results", a.wh(a.getDataOutputPipelineResults))
+		r.Get("/output/runs", a.wh(a.getDataOutputRuns))
+		r.Get("/output/resolutions", a.wh(a.getDataOutputResolutions))
+		r.Get("/output/features", a.wh(a.getDataOutputFeatures))
+		r.Get("/output/aggregations", a.wh(a.getDataOutputAggregations))
+		r.Get("/output/timestamps", a.wh(a.getDataOutputTimestamps))
+
+		r.Get("/openapi.json", a.wh(a.getOpenAPI))
+		r.Get("/docs", a.wh(a.getSwaggerUI))
+		r.Get(fmt.Sprintf("/docs/{%s}", paramAsset), a.wh(a.getSwaggerUIAsset))
+
+		// Datacube search endpoints are only served when a search service is configured
+		if a.datacubeSearch != nil {
+			r.Get("/datacubes", a.wh(a.getDatacubes))
+			r.Get("/datacubes/facets", a.wh(a.getDatacubeFacets))
+		}
+		if a.modelMetadata != nil {
+			r.Get(fmt.Sprintf("/models/{%s}/parameters", paramModelID), a.wh(a.getModelParameters))
+			r.Get(fmt.Sprintf("/models/{%s}/runs", paramModelID), a.wh(a.getModelRuns))
+		}
 	})
 
 	r.Route("/maas/output/tiles", func(r chi.Router) {
@@ -77,6 +105,15 @@ func New(cfg *Config) (chi.Router, error) {
 		r.Get(fmt.Sprintf("/{%s}/{%s:[0-9]+}/{%s:[0-9]+}/{%s:[0-9]+}", paramTileSetName, paramZoom, paramX, paramY), a.wh(a.getVectorTile))
 	})
 
+	// The OpenAPI document describes the routes defined above, so it is generated last
+	doc, err := newOpenAPIDocument(r)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if a.openAPI, err = json.Marshal(doc); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+
 	return r, nil
 }
 
@@ -87,6 +124,11 @@ func (a *api) wh(handler func(http.ResponseWriter, *http.Request) error) func(ht
 		if err == nil {
 			return
 		}
+		if r.Context().Err() != nil {
+			// The client went away or the request timed out, so there is nobody to respond to
+			a.logger.Debug(err)
+			return
+		}
 
 		// Handle error
 		errCode := wm.ErrorCode(err)
@@ -102,12 +144,14 @@ func (a *api) wh(handler func(http.ResponseWriter, *http.Request) error) func(ht
 			status = http.StatusConflict
 		case wm.EINTERNAL:
 			status = http.StatusInternalServerError
+		case wm.EUNAVAILABLE:
+			status = http.StatusServiceUnavailable
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(status)
 		w.Write([]byte(errMessage))
-		if errCode == wm.EINTERNAL {
+		if errCode == wm.EINTERNAL || errCode == wm.EUNAVAILABLE {
 			// Log error if it's an internal server error
 			a.logger.Error(err)
 		} else {
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"net/http"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/arrow"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// Schemas of the Arrow responses. Clients rely on them, so columns may only be appended.
+var (
+	// bulkTimeseriesArrowFields has a row for each point of each timeseries. A timeseries without points still has
+	// a row, with null timestamp and value, so that all the keys and errors are listed. The error is null unless
+	// the timeseries failed.
+	bulkTimeseriesArrowFields = []arrow.Field{
+		{Name: "key", Type: arrow.Utf8},
+		{Name: "timestamp", Type: arrow.Int64, Nullable: true},
+		{Name: "value", Type: arrow.Float64, Nullable: true},
+		{Name: "error", Type: arrow.Utf8, Nullable: true},
+	}
+
+	// bulkRegionalArrowFields has a row for each region of each admin level of each timestamp, followed by the
+	// rows of the aggregates over the selected timestamps and over all the timestamps. The aggregate is null for
+	// the data of a timestamp, and "select_agg" or "all_agg" for the aggregates, whose timestamp is null. A
+	// timestamp without regions still has a row, with null admin level, region ID and value. The error is null
+	// unless the timestamp failed.
+	bulkRegionalArrowFields = []arrow.Field{
+		{Name: "aggregate", Type: arrow.Utf8, Nullable: true},
+		{Name: "timestamp", Type: arrow.Utf8, Nullable: true},
+		{Name: "admin_level", Type: arrow.Utf8, Nullable: true},
+		{Name: "region_id", Type: arrow.Utf8, Nullable: true},
+		{Name: "value", Type: arrow.Float64, Nullable: true},
+		{Name: "error", Type: arrow.Utf8, Nullable: true},
+	}
+)
+
+// newArrowWriter sets the headers of an Arrow stream response and returns a writer of its record batches
+func newArrowWriter(w http.ResponseWriter, fields []arrow.Field) *arrow.Writer {
+	w.Header().Set("Content-Type", arrow.MediaType)
+	return arrow.NewWriter(w, fields)
+}
+
+// writeBulkTimeseriesArrow writes the keyed timeseries as a single record batch
+func writeBulkTimeseriesArrow(aw *arrow.Writer, timeseries []*wm.ModelOutputKeyedTimeSeries) error {
+	op := "writeBulkTimeseriesArrow"
+	var keys, errs arrow.Utf8Column
+	var timestamps arrow.Int64Column
+	var values arrow.Float64Column
+	for _, ts := range timeseries {
+		if len(ts.Timeseries) == 0 {
+			keys.Append(ts.Key)
+			timestamps.AppendNull()
+			values.AppendNull()
+			appendOptional(&errs, ts.Error)
+		}
+		for _, point := range ts.Timeseries {
+			keys.Append(ts.Key)
+			timestamps.Append(point.Timestamp)
+			values.Append(point.Value)
+			appendOptional(&errs, ts.Error)
+		}
+	}
+	if err := aw.Write(&keys, &timestamps, &values, &errs); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	if err := aw.Close(); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
+// writeBulkRegionalArrow writes the regional data of the timestamps and their aggregates as a single record batch
+func writeBulkRegionalArrow(aw *arrow.Writer, data *wm.ModelOutputBulkAggregateRegionalAdmins) error {
+	op := "writeBulkRegionalArrow"
+	var aggregates, timestamps, adminLevels, regionIDs, errs arrow.Utf8Column
+	var values arrow.Float64Column
+	appendRegions := func(aggregate string, timestamp string, regional *wm.ModelOutputRegionalAdmins, errMessage string) {
+		rows := 0
+		if regional != nil {
+			for _, level := range []struct {
+				name wm.AdminLevel
+				data []wm.ModelOutputAdminData
+			}{
+				{wm.AdminLevelCountry, regional.Country},
+				{wm.AdminLevel1, regional.Admin1},
+				{wm.AdminLevel2, regional.Admin2},
+				{wm.AdminLevel3, regional.Admin3},
+			} {
+				for _, region := range level.data {
+					appendOptional(&aggregates, aggregate)
+					appendOptional(&timestamps, timestamp)
+					adminLevels.Append(string(level.name))
+					regionIDs.Append(region.ID)
+					values.Append(region.Value)
+					appendOptional(&errs, errMessage)
+					rows++
+				}
+			}
+		}
+		if rows == 0 {
+			appendOptional(&aggregates, aggregate)
+			appendOptional(&timestamps, timestamp)
+			adminLevels.AppendNull()
+			regionIDs.AppendNull()
+			values.AppendNull()
+			appendOptional(&errs, errMessage)
+		}
+	}
+
+	if data.ModelOutputBulkRegionalAdmins != nil {
+		for _, regional := range *data.ModelOutputBulkRegionalAdmins {
+			appendRegions("", regional.Timestamp, regional.ModelOutputRegionalAdmins, regional.Error)
+		}
+	}
+	if data.SelectAgg != nil {
+		appendRegions("select_agg", "", data.SelectAgg, "")
+	}
+	if data.AllAgg != nil {
+		appendRegions("all_agg", "", data.AllAgg, "")
+	}
+	if err := aw.Write(&aggregates, &timestamps, &adminLevels, &regionIDs, &values, &errs); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	if err := aw.Close(); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
+// appendOptional appends v to the column, or null if it is empty
+func appendOptional(c *arrow.Utf8Column, v string) {
+	if v != "" {
+		c.Append(v)
+	} else {
+		c.AppendNull()
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/arrow"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// arrowStream returns the stream of a single record batch of the columns
+func arrowStream(t *testing.T, fields []arrow.Field, columns ...arrow.Column) []byte {
+	var buf bytes.Buffer
+	aw := arrow.NewWriter(&buf, fields)
+	require.NoError(t, aw.Write(columns...))
+	require.NoError(t, aw.Close())
+	return buf.Bytes()
+}
+
+func TestWriteBulkTimeseriesArrow(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeBulkTimeseriesArrow(arrow.NewWriter(&buf, bulkTimeseriesArrowFields), []*wm.ModelOutputKeyedTimeSeries{
+		{Key: "a", Timeseries: []*wm.TimeseriesValue{{Timestamp: 1, Value: 0.5}, {Timestamp: 2, Value: 1.5}}},
+		{Key: "b", Timeseries: []*wm.TimeseriesValue{}, Error: "Invalid region"},
+	})
+	require.NoError(t, err)
+
+	var keys, errs arrow.Utf8Column
+	var timestamps arrow.Int64Column
+	var values arrow.Float64Column
+	keys.Append("a")
+	timestamps.Append(1)
+	values.Append(0.5)
+	errs.AppendNull()
+	keys.Append("a")
+	timestamps.Append(2)
+	values.Append(1.5)
+	errs.AppendNull()
+	keys.Append("b")
+	timestamps.AppendNull()
+	values.AppendNull()
+	errs.Append("Invalid region")
+	require.Equal(t, arrowStream(t, bulkTimeseriesArrowFields, &keys, &timestamps, &values, &errs), buf.Bytes())
+}
+
+func TestWriteBulkRegionalArrow(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeBulkRegionalArrow(arrow.NewWriter(&buf, bulkRegionalArrowFields), &wm.ModelOutputBulkAggregateRegionalAdmins{
+		ModelOutputBulkRegionalAdmins: &[]wm.ModelOutputBulkRegionalAdmins{
+			{Timestamp: "1", ModelOutputRegionalAdmins: &wm.ModelOutputRegionalAdmins{
+				Country: []wm.ModelOutputAdminData{{ID: "Ethiopia", Value: 1}},
+				Admin1:  []wm.ModelOutputAdminData{{ID: "Ethiopia__Afar", Value: 2}},
+			}},
+			{Timestamp: "2", ModelOutputRegionalAdmins: &wm.ModelOutputRegionalAdmins{}, Error: "Missing data"},
+		},
+		SelectAgg: &wm.ModelOutputRegionalAdmins{Country: []wm.ModelOutputAdminData{{ID: "Ethiopia", Value: 1}}},
+	})
+	require.NoError(t, err)
+
+	var aggregates, timestamps, adminLevels, regionIDs, errs arrow.Utf8Column
+	var values arrow.Float64Column
+	for _, row := range []struct {
+		aggregate, timestamp, adminLevel, regionID string
+		value                                      *float64
+		err                                        string
+	}{
+		{"", "1", "country", "Ethiopia", floatPtr(1), ""},
+		{"", "1", "admin1", "Ethiopia__Afar", floatPtr(2), ""},
+		{"", "2", "", "", nil, "Missing data"},
+		{"select_agg", "", "country", "Ethiopia", floatPtr(1), ""},
+	} {
+		appendOptional(&aggregates, row.aggregate)
+		appendOptional(&timestamps, row.timestamp)
+		appendOptional(&adminLevels, row.adminLevel)
+		appendOptional(&regionIDs, row.regionID)
+		if row.value != nil {
+			values.Append(*row.value)
+		} else {
+			values.AppendNull()
+		}
+		appendOptional(&errs, row.err)
+	}
+	require.Equal(t, arrowStream(t, bulkRegionalArrowFields, &aggregates, &timestamps, &adminLevels, &regionIDs, &values, &errs), buf.Bytes())
+}
+
+func TestGetFormatArrow(t *testing.T) {
+	r := &http.Request{URL: &url.URL{}, Header: http.Header{"Accept": {arrow.MediaType + ", application/json;q=0.5"}}}
+	format, err := getFormat(r, formatArrow)
+	require.NoError(t, err)
+	require.Equal(t, formatArrow, format)
+
+	r = &http.Request{URL: &url.URL{RawQuery: "format=arrow"}}
+	format, err = getFormat(r, formatArrow)
+	require.NoError(t, err)
+	require.Equal(t, formatArrow, format)
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
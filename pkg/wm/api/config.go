@@ -10,8 +10,17 @@ type Config struct {
 	DataOutput wm.DataOutput
 	VectorTile wm.VectorTile
 	Logger     *zap.SugaredLogger
+
+	// DatacubeSearch and ModelMetadata are optional, the datacube and model endpoints are not served without them
+	DatacubeSearch wm.DatacubeSearch
+	ModelMetadata  wm.ModelMetadata
+
+	// MaxConcurrency is the maximum number of items of a bulk request fetched concurrently
+	MaxConcurrency int
 }
 
+const defaultMaxConcurrency = 16
+
 // init validates the config and fills in defaults for missing optional
 // parameters.
 func (cfg *Config) init() error {
@@ -25,5 +34,8 @@ func (cfg *Config) init() error {
 	if cfg.VectorTile == nil {
 		return &wm.Error{Op: op, Message: "Logger cannot be nil"}
 	}
+	if cfg.MaxConcurrency <= 0 {
+		cfg.MaxConcurrency = defaultMaxConcurrency
+	}
 	return nil
 }
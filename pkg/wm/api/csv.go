@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// Columns of the CSV responses
+var (
+	timeseriesCSVHeader          = []string{"timestamp", "region_id", "value"}
+	regionalCSVHeader            = []string{"timestamp", "region_id", "admin_level", "country", "admin1", "admin2", "admin3", "value"}
+	rawDataCSVHeader             = []string{"timestamp", "country", "admin1", "admin2", "admin3", "lat", "lng", "value"}
+	sparklineCSVHeader           = []string{"index", "value"}
+	qualifierTimeseriesCSVHeader = []string{"timestamp", "region_id", "qualifier", "value"}
+	qualifierRegionalCSVHeader   = []string{"timestamp", "region_id", "admin_level", "country", "admin1", "admin2", "admin3", "qualifier", "value"}
+)
+
+// newCSVWriter sets the headers of a CSV attachment response and returns a writer of its rows. The rows are
+// written to the response as the writer buffer fills up, so large outputs are streamed.
+func newCSVWriter(w http.ResponseWriter, filename string) *csv.Writer {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	return csv.NewWriter(w)
+}
+
+// writeTimeseriesCSV writes the timeseries of the region, or of the whole output if regionID is empty
+func writeTimeseriesCSV(cw *csv.Writer, regionID string, timeseries []*wm.TimeseriesValue) error {
+	op := "writeTimeseriesCSV"
+	if err := cw.Write(timeseriesCSVHeader); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	for _, point := range timeseries {
+		if err := cw.Write([]string{formatInt(point.Timestamp), regionID, formatFloat(point.Value)}); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
+// writeRegionalCSV writes the regional data of all the admin levels at the timestamp, with one column per admin level
+func writeRegionalCSV(cw *csv.Writer, timestamp string, data *wm.ModelOutputRegionalAdmins) error {
+	op := "writeRegionalCSV"
+	if err := cw.Write(regionalCSVHeader); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	for _, level := range []struct {
+		name wm.AdminLevel
+		data []wm.ModelOutputAdminData
+	}{
+		{wm.AdminLevelCountry, data.Country},
+		{wm.AdminLevel1, data.Admin1},
+		{wm.AdminLevel2, data.Admin2},
+		{wm.AdminLevel3, data.Admin3},
+	} {
+		for _, d := range level.data {
+			row := append([]string{timestamp, d.ID, string(level.name)}, regionColumns(d.ID)...)
+			if err := cw.Write(append(row, formatFloat(d.Value))); err != nil {
+				return &wm.Error{Op: op, Err: err}
+			}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
+// writeSparklineCSV writes the values of the sparkline with their index
+func writeSparklineCSV(cw *csv.Writer, sparkline []float64) error {
+	op := "writeSparklineCSV"
+	if err := cw.Write(sparklineCSVHeader); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	for i, v := range sparkline {
+		if err := cw.Write([]string{strconv.Itoa(i), formatFloat(v)}); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
+// writeQualifierTimeseriesCSV writes the timeseries of each qualifier value, for the region or the whole output if
+// regionID is empty
+func writeQualifierTimeseriesCSV(cw *csv.Writer, regionID string, data []*wm.ModelOutputQualifierTimeseries) error {
+	op := "writeQualifierTimeseriesCSV"
+	if err := cw.Write(qualifierTimeseriesCSVHeader); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	for _, timeseries := range data {
+		for _, point := range timeseries.Timeseries {
+			if err := cw.Write([]string{formatInt(point.Timestamp), regionID, timeseries.Name, formatFloat(point.Value)}); err != nil {
+				return &wm.Error{Op: op, Err: err}
+			}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
+// writeQualifierRegionalCSV writes the regional data of all the admin levels at the timestamp, with one row per
+// region and qualifier value. Qualifier values are sorted within a region.
+func writeQualifierRegionalCSV(cw *csv.Writer, timestamp string, data *wm.ModelOutputRegionalQualifiers) error {
+	op := "writeQualifierRegionalCSV"
+	if err := cw.Write(qualifierRegionalCSVHeader); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	for _, level := range []struct {
+		name wm.AdminLevel
+		data []wm.ModelOutputRegionQualifierBreakdown
+	}{
+		{wm.AdminLevelCountry, data.Country},
+		{wm.AdminLevel1, data.Admin1},
+		{wm.AdminLevel2, data.Admin2},
+		{wm.AdminLevel3, data.Admin3},
+	} {
+		for _, d := range level.data {
+			names := make([]string, 0, len(d.Values))
+			for name := range d.Values {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			row := append([]string{timestamp, d.ID, string(level.name)}, regionColumns(d.ID)...)
+			for _, name := range names {
+				if err := cw.Write(append(row[:len(row):len(row)], name, formatFloat(d.Values[name]))); err != nil {
+					return &wm.Error{Op: op, Err: err}
+				}
+			}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
+// regionColumns returns the names of the country and admin regions of the region id. Region ids join the names of
+// the regions of each level, eg. Ethiopia__Oromia
+func regionColumns(regionID string) []string {
+	regions := make([]string, 4)
+	copy(regions, strings.Split(regionID, "__"))
+	return regions
+}
+
+// writeRawDataCSVHeader writes the header of the raw data points, followed by the qualifier columns
+func writeRawDataCSVHeader(cw *csv.Writer, qualifiers []string) error {
+	op := "writeRawDataCSVHeader"
+	if err := cw.Write(append(append([]string{}, rawDataCSVHeader...), qualifiers...)); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
+// writeRawDataCSVRow writes the raw data point with the values of the qualifier columns. Missing coordinates, values
+// and qualifiers are left empty.
+func writeRawDataCSVRow(cw *csv.Writer, qualifiers []string, point *wm.ModelOutputRawDataPoint) error {
+	op := "writeRawDataCSVRow"
+	row := []string{
+		formatInt(point.Timestamp),
+		point.Country,
+		point.Admin1,
+		point.Admin2,
+		point.Admin3,
+		formatOptionalFloat(point.Lat),
+		formatOptionalFloat(point.Lng),
+		formatOptionalFloat(point.Value),
+	}
+	for _, q := range qualifiers {
+		row = append(row, point.Qualifiers[q])
+	}
+	if err := cw.Write(row); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
+func formatInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatOptionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatFloat(*v)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestWriteRegionalCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeRegionalCSV(csv.NewWriter(&buf), "0", &wm.ModelOutputRegionalAdmins{
+		Country: []wm.ModelOutputAdminData{{ID: "Ethiopia", Value: 1.5}},
+		Admin1:  []wm.ModelOutputAdminData{{ID: "Ethiopia__Oromia", Value: 2}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "timestamp,region_id,admin_level,country,admin1,admin2,admin3,value\n"+
+		"0,Ethiopia,country,Ethiopia,,,,1.5\n"+
+		"0,Ethiopia__Oromia,admin1,Ethiopia,Oromia,,,2\n", buf.String())
+}
+
+func TestWriteRawDataCSV(t *testing.T) {
+	lat, value := 9.1, 0.5
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	qualifiers := []string{"crop", "season"}
+	require.NoError(t, writeRawDataCSVHeader(cw, qualifiers))
+	require.NoError(t, writeRawDataCSVRow(cw, qualifiers, &wm.ModelOutputRawDataPoint{Timestamp: 1, Country: "Ethiopia", Lat: &lat, Value: &value, Qualifiers: map[string]string{"crop": "maize"}}))
+	require.NoError(t, writeRawDataCSVRow(cw, qualifiers, &wm.ModelOutputRawDataPoint{Timestamp: 2, Country: "Ethiopia", Admin1: "Afar, Zone 1", Qualifiers: map[string]string{"season": "meher"}}))
+	cw.Flush()
+	require.Equal(t, "timestamp,country,admin1,admin2,admin3,lat,lng,value,crop,season\n"+
+		"1,Ethiopia,,,,9.1,,0.5,maize,\n"+
+		"2,Ethiopia,\"Afar, Zone 1\",,,,,,,meher\n", buf.String())
+}
+
+func TestWriteSparklineCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeSparklineCSV(csv.NewWriter(&buf), []float64{1.5, 2}))
+	require.Equal(t, "index,value\n0,1.5\n1,2\n", buf.String())
+}
+
+func TestWriteQualifierTimeseriesCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeQualifierTimeseriesCSV(csv.NewWriter(&buf), "Ethiopia", []*wm.ModelOutputQualifierTimeseries{
+		{Name: "maize", Timeseries: []*wm.TimeseriesValue{{Timestamp: 1, Value: 1}}},
+		{Name: "teff", Timeseries: []*wm.TimeseriesValue{{Timestamp: 1, Value: 4}, {Timestamp: 2, Value: 3}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "timestamp,region_id,qualifier,value\n"+
+		"1,Ethiopia,maize,1\n"+
+		"1,Ethiopia,teff,4\n"+
+		"2,Ethiopia,teff,3\n", buf.String())
+}
+
+func TestWriteQualifierRegionalCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeQualifierRegionalCSV(csv.NewWriter(&buf), "0", &wm.ModelOutputRegionalQualifiers{
+		Country: []wm.ModelOutputRegionQualifierBreakdown{{ID: "Ethiopia", Values: map[string]float64{"teff": 2, "maize": 1}}},
+		Admin1:  []wm.ModelOutputRegionQualifierBreakdown{{ID: "Ethiopia__Oromia", Values: map[string]float64{"maize": 0.5}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "timestamp,region_id,admin_level,country,admin1,admin2,admin3,qualifier,value\n"+
+		"0,Ethiopia,country,Ethiopia,,,,maize,1\n"+
+		"0,Ethiopia,country,Ethiopia,,,,teff,2\n"+
+		"0,Ethiopia__Oromia,admin1,Ethiopia,Oromia,,,maize,0.5\n", buf.String())
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func (a *api) getDatacubes(w http.ResponseWriter, r *http.Request) error {
+	op := "api.getDatacubes"
+	filters, err := getFilters(r, wm.ContextDatacube)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	sort, err := getSort(r, datacubeFields)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	offset, limit, err := getPagination(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	result, err := a.datacubeSearch.SearchDatacubes(r.Context(), wm.DatacubeSearchOptions{
+		Filters: filters,
+		Search:  getSearch(r),
+		Sort:    sort,
+		Offset:  offset,
+		Limit:   limit,
+	})
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	render.JSON(w, r, result)
+	return nil
+}
+
+func (a *api) getDatacubeFacets(w http.ResponseWriter, r *http.Request) error {
+	op := "api.getDatacubeFacets"
+	filters, err := getFilters(r, wm.ContextDatacube)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	// Facet all the fields unless a list is given
+	var names []string
+	if r.URL.Query().Get("facets") != "" {
+		if names, err = getFacetNames(r); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+	} else {
+		for name, field := range datacubeFields {
+			if field != wm.FieldDatacubeSearch {
+				names = append(names, name)
+			}
+		}
+	}
+	fields := make([]wm.Field, 0, len(names))
+	for _, name := range names {
+		field, ok := datacubeFields[name]
+		if !ok || field == wm.FieldDatacubeSearch {
+			return &wm.Error{Op: op, Code: wm.EINVALID, Message: fmt.Sprintf("Invalid facet field: %s", name)}
+		}
+		fields = append(fields, field)
+	}
+
+	facets, err := a.datacubeSearch.GetDatacubeFacets(r.Context(), wm.DatacubeFacetsOptions{
+		Filters: filters,
+		Search:  getSearch(r),
+		Fields:  fields,
+	})
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	result := make(map[string][]wm.Facet, len(names))
+	for i, name := range names {
+		result[name] = facets[fields[i]]
+		if result[name] == nil {
+			result[name] = []wm.Facet{}
+		}
+	}
+	render.JSON(w, r, result)
+	return nil
+}
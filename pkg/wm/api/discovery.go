@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// namesPage is a page of a list of names
+type namesPage struct {
+	Total  int      `json:"total"`
+	Offset int      `json:"offset"`
+	Limit  int      `json:"limit"`
+	Items  []string `json:"items"`
+}
+
+// newNamesPage returns the page of names at given offset
+func newNamesPage(names []string, offset int, limit int) *namesPage {
+	page := &namesPage{Total: len(names), Offset: offset, Limit: limit, Items: []string{}}
+	if offset < len(names) {
+		end := offset + limit
+		if end > len(names) {
+			end = len(names)
+		}
+		page.Items = names[offset:end]
+	}
+	return page
+}
+
+func (a *api) getDataOutputRuns(w http.ResponseWriter, r *http.Request) error {
+	return a.listNames(w, r, "api.getDataOutputRuns", []string{"data_id"}, a.dataOutput.GetRuns)
+}
+
+func (a *api) getDataOutputResolutions(w http.ResponseWriter, r *http.Request) error {
+	return a.listNames(w, r, "api.getDataOutputResolutions", []string{"data_id", "run_id"}, a.dataOutput.GetResolutions)
+}
+
+func (a *api) getDataOutputFeatures(w http.ResponseWriter, r *http.Request) error {
+	return a.listNames(w, r, "api.getDataOutputFeatures", []string{"data_id", "run_id"}, a.dataOutput.GetFeatures)
+}
+
+func (a *api) getDataOutputAggregations(w http.ResponseWriter, r *http.Request) error {
+	return a.listNames(w, r, "api.getDataOutputAggregations", []string{"data_id", "run_id", "resolution", "feature"}, a.dataOutput.GetAggregations)
+}
+
+// listNames renders a page of the names returned by list, after checking that the required query parameters are set
+func (a *api) listNames(w http.ResponseWriter, r *http.Request, op string, required []string,
+	list func(ctx context.Context, params wm.DatacubeParams) ([]string, error)) error {
+	if err := checkRequiredParams(r, required...); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	offset, limit, err := getPagination(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	names, err := list(r.Context(), getDatacubeParams(r))
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	render.JSON(w, r, newNamesPage(names, offset, limit))
+	return nil
+}
+
+func (a *api) getDataOutputTimestamps(w http.ResponseWriter, r *http.Request) error {
+	op := "api.getDataOutputTimestamps"
+	if err := checkRequiredParams(r, "data_id", "run_id", "resolution", "feature"); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	timestamps, err := a.dataOutput.GetTimestamps(r.Context(), getDatacubeParams(r))
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	render.JSON(w, r, timestamps)
+	return nil
+}
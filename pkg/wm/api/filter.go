@@ -152,9 +152,14 @@ func parseValues(field wm.Field, raw []byte) ([]string, []int, wm.Range, error)
 		wm.FieldIndicatorDataset,
 		wm.FieldIndicatorUnit:
 		strVals, err = parseStringValues(raw)
-	case
-		wm.FieldDatacubePeriod,
-		wm.FieldDatacubeConceptScore:
+	case wm.FieldDatacubePeriod:
+		// Either a list of values, eg. [2019, 2020], or a range, eg. [[2019, 2020]]
+		if _, dataType, _, _ := jsonparser.Get(raw, "[0]"); dataType == jsonparser.Number {
+			intVals, err = parseIntValues(raw)
+		} else {
+			rng, err = parseRange(raw)
+		}
+	case wm.FieldDatacubeConceptScore:
 		rng, err = parseRange(raw)
 	default:
 		err = errors.New("parseValues failed: Unhandled values")
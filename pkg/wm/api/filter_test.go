@@ -117,6 +117,14 @@ func TestParseValues(t *testing.T) {
 			nil,
 			wm.Range{Minimum: 2010, Maximum: 2020, IsClosed: false},
 		},
+		{
+			wm.FieldDatacubePeriod,
+			`[2019,2020]`,
+			false,
+			nil,
+			[]int{2019, 2020},
+			wm.Range{},
+		},
 		{
 			wm.FieldDatacubePeriod,
 			`"broken"`,
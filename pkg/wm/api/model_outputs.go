@@ -1,9 +1,15 @@
 package api
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"net/http"
+	"sort"
+	"sync"
 
 	"github.com/go-chi/render"
+	"gitlab.uncharted.software/WM/wm-go/pkg/fanout"
 	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
 )
 
@@ -43,11 +49,6 @@ func (msr *modelOutputKeyedTimeseries) Render(w http.ResponseWriter, r *http.Req
 	return nil
 }
 
-type timeseriesResultChan struct {
-	result chan []*wm.TimeseriesValue
-	err    chan error
-}
-
 type modelOutputTimeseriesValue struct {
 	*wm.TimeseriesValue
 }
@@ -73,11 +74,6 @@ func (msr *modelOutputBulkRegionalData) Render(w http.ResponseWriter, r *http.Re
 	return nil
 }
 
-type regionalDataResultChan struct {
-	result chan *wm.ModelOutputRegionalAdmins
-	err    chan error
-}
-
 type modelOutputRegionalData struct {
 	*wm.ModelOutputRegionalAdmins
 }
@@ -133,7 +129,7 @@ func (msr *modelOutputQualifierValuesResponse) Render(w http.ResponseWriter, r *
 func (a *api) getRegionalDataOutputStats(w http.ResponseWriter, r *http.Request) error {
 	op := "api.getRegionalDataOutputStats"
 	params := getDatacubeParams(r)
-	stats, err := a.dataOutput.GetRegionalOutputStats(params)
+	stats, err := a.dataOutput.GetRegionalOutputStats(r.Context(), params)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
@@ -145,7 +141,7 @@ func (a *api) getDataOutputStats(w http.ResponseWriter, r *http.Request) error {
 	op := "api.getDataOutputStats"
 	params := getDatacubeParams(r)
 	timestamp := getTimestamp(r)
-	stats, err := a.dataOutput.GetOutputStats(params, timestamp)
+	stats, err := a.dataOutput.GetOutputStats(r.Context(), params, timestamp)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
@@ -163,7 +159,10 @@ func getTimeseriesParamsForRegions(r *http.Request) ([]*wm.FullTimeseriesParams,
 		return nil, err
 	}
 	params := getDatacubeParams(r)
-	transform := getTransform(r)
+	transform, err := getTransformConfig(r)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(regionIDs) == 0 {
 		regionIDs = append(regionIDs, "")
@@ -173,8 +172,14 @@ func getTimeseriesParamsForRegions(r *http.Request) ([]*wm.FullTimeseriesParams,
 		timeseriesParams[i] = &wm.FullTimeseriesParams{
 			DatacubeParams: params,
 			RegionID:       regionIDs[i],
-			Transform:      transform,
+			Transform:      transform.Transform,
+			Window:         transform.Window,
+			BaselineStart:  transform.BaselineStart,
+			BaselineEnd:    transform.BaselineEnd,
 			Key:            regionIDs[i],
+			Denominator:    transform.Denominator,
+			Alignment:      transform.Alignment,
+			ScaleFactor:    transform.ScaleFactor,
 		}
 	}
 	return timeseriesParams, nil
@@ -182,21 +187,40 @@ func getTimeseriesParamsForRegions(r *http.Request) ([]*wm.FullTimeseriesParams,
 
 func (a *api) getAggregateDataOutputTimeseries(w http.ResponseWriter, r *http.Request) error {
 	op := "api.getAggregateDataOutputTimeseries"
-	agg := getAgg(r)
+	aggregation, err := getTimeseriesAggregation(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	format, err := getFormat(r, formatCSV)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
 	timeseriesParams, err := getTimeseriesParamsForRegions(r)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
-	keyedTimeSeries, err := a.getBulkTimeseries(timeseriesParams)
+	keyedTimeSeries, err := a.getBulkTimeseries(r.Context(), timeseriesParams, false)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
 
-	var aggTimeSeries []*wm.TimeseriesValue
-	if agg == "mean" {
-		timeToValue := map[int64]*[2]float64{}
-		sumAggregationForTimeseries(keyedTimeSeries, timeToValue)
-		aggTimeSeries = applyMeanForTimeseries(timeToValue)
+	series := make([][]*wm.TimeseriesValue, len(keyedTimeSeries))
+	for i, timeseries := range keyedTimeSeries {
+		series[i] = timeseries.Timeseries
+	}
+	var weights [][]*wm.TimeseriesValue
+	if aggregation.agg == aggPopulationWeightedMean {
+		weights, err = a.getPopulationWeights(r.Context(), timeseriesParams, series)
+		if err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+	}
+	aggTimeSeries := aggregateTimeseries(series, weights, aggregation)
+	if format == formatCSV {
+		if err := writeTimeseriesCSV(newCSVWriter(w, "aggregate-timeseries.csv"), "", aggTimeSeries); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+		return nil
 	}
 
 	list := []render.Renderer{}
@@ -207,28 +231,41 @@ func (a *api) getAggregateDataOutputTimeseries(w http.ResponseWriter, r *http.Re
 	return nil
 }
 
-func sumAggregationForTimeseries(keyedTimeSeries []*wm.ModelOutputKeyedTimeSeries, aggDict map[int64]*[2]float64) {
-	for _, region := range keyedTimeSeries {
-		for _, timeseries := range region.Timeseries {
-			val, ok := aggDict[timeseries.Timestamp]
-			if ok {
-				val[0] += timeseries.Value
-				val[1]++
-			} else {
-				aggDict[timeseries.Timestamp] = &[2]float64{timeseries.Value, 1}
+// getPopulationWeights returns the population of each region at all the timestamps of the timeseries
+func (a *api) getPopulationWeights(ctx context.Context, timeseriesParams []*wm.FullTimeseriesParams, series [][]*wm.TimeseriesValue) ([][]*wm.TimeseriesValue, error) {
+	var timestamps []int64
+	seen := make(map[int64]bool)
+	for _, timeseries := range series {
+		for _, v := range timeseries {
+			if !seen[v.Timestamp] {
+				seen[v.Timestamp] = true
+				timestamps = append(timestamps, v.Timestamp)
 			}
 		}
 	}
-}
-
-func applyMeanForTimeseries(countryAgg map[int64]*[2]float64) []*wm.TimeseriesValue {
-	aggregations := make([]*wm.TimeseriesValue, len(countryAgg))
-	i := 0
-	for key, val := range countryAgg {
-		aggregations[i] = &wm.TimeseriesValue{Timestamp: key, Value: val[0] / val[1]}
-		i++
+	weights := make([][]*wm.TimeseriesValue, len(timeseriesParams))
+	if len(timestamps) == 0 {
+		return weights, nil
 	}
-	return aggregations
+	errs, err := a.runBulk(ctx, len(timeseriesParams), false, func(ctx context.Context, i int) error {
+		regionID := timeseriesParams[i].RegionID
+		if regionID == "" {
+			return &wm.Error{Code: wm.EINVALID, Message: "The population_weighted_mean aggregation requires regions"}
+		}
+		var err error
+		weights[i], err = a.dataOutput.GetPopulationTimeseries(ctx, regionID, timestamps)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// A region without population data can't be weighted, and is left out. Other errors fail the request in runBulk
+	for i, err := range errs {
+		if wm.ErrorCode(err) == wm.ENOTFOUND {
+			weights[i] = nil
+		}
+	}
+	return weights, nil
 }
 
 func (a *api) getBulkDataOutputRegionTimeseries(w http.ResponseWriter, r *http.Request) error {
@@ -238,7 +275,7 @@ func (a *api) getBulkDataOutputRegionTimeseries(w http.ResponseWriter, r *http.R
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
-	keyedTimeSeries, err := a.getBulkTimeseries(timeseriesParams)
+	keyedTimeSeries, err := a.getBulkTimeseries(r.Context(), timeseriesParams, getPartial(r))
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
@@ -248,6 +285,7 @@ func (a *api) getBulkDataOutputRegionTimeseries(w http.ResponseWriter, r *http.R
 		list = append(list, &modelOutputRegionalTimeseries{&wm.ModelOutputRegionalTimeSeries{
 			RegionID:   timeseries.Key,
 			Timeseries: timeseries.Timeseries,
+			Error:      timeseries.Error,
 		}})
 	}
 	render.RenderList(w, r, list)
@@ -260,11 +298,21 @@ func (a *api) getBulkDataOutputGenericTimeseries(w http.ResponseWriter, r *http.
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
+	format, err := getFormat(r, formatArrow)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
 
-	keyedTimeSeries, err := a.getBulkTimeseries(timeseriesParams)
+	keyedTimeSeries, err := a.getBulkTimeseries(r.Context(), timeseriesParams, getPartial(r))
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
+	if format == formatArrow {
+		if err := writeBulkTimeseriesArrow(newArrowWriter(w, bulkTimeseriesArrowFields), keyedTimeSeries); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+		return nil
+	}
 
 	list := []render.Renderer{}
 	for _, timeseries := range keyedTimeSeries {
@@ -274,50 +322,101 @@ func (a *api) getBulkDataOutputGenericTimeseries(w http.ResponseWriter, r *http.
 	return nil
 }
 
-func (a *api) getBulkTimeseries(timeseriesParams []*wm.FullTimeseriesParams) ([]*wm.ModelOutputKeyedTimeSeries, error) {
-	keyedTimeSeries := make([]*wm.ModelOutputKeyedTimeSeries, len(timeseriesParams))
-	resultChannels := make(map[string]timeseriesResultChan)
-	for i := 0; i < len(keyedTimeSeries); i++ {
+func (a *api) getBulkTimeseries(ctx context.Context, timeseriesParams []*wm.FullTimeseriesParams, partial bool) ([]*wm.ModelOutputKeyedTimeSeries, error) {
+	results := make([][]*wm.TimeseriesValue, len(timeseriesParams))
+	errs, err := a.runBulk(ctx, len(timeseriesParams), partial, func(ctx context.Context, i int) error {
 		params := timeseriesParams[i]
-		rc := a.getTimeSeriesAsync(params.RegionID, params.DatacubeParams, params.Transform)
-		resultChannels[params.Key] = rc
+		transform := wm.TransformConfig{
+			Transform:     params.Transform,
+			Window:        params.Window,
+			BaselineStart: params.BaselineStart,
+			BaselineEnd:   params.BaselineEnd,
+			ScaleFactor:   params.ScaleFactor,
+			Alignment:     params.Alignment,
+		}
+		if params.Denominator != nil {
+			denominator := withDenominatorDefaults(*params.Denominator, params.DatacubeParams)
+			transform.Denominator = &denominator
+		}
+		var err error
+		results[i], err = a.getTimeSeries(ctx, params.RegionID, params.DatacubeParams, transform)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	for i := 0; i < len(keyedTimeSeries); i++ {
-		key := timeseriesParams[i].Key
-		timeseries := <-resultChannels[key].result
-		err := <-resultChannels[key].err
-		if err != nil {
-			if wm.ErrorCode(err) == wm.ENOTFOUND {
-				keyedTimeSeries[i] = &wm.ModelOutputKeyedTimeSeries{
-					Key:        key,
-					Timeseries: []*wm.TimeseriesValue{},
-				}
-				continue
-			}
-			return nil, err
-		}
+	keyedTimeSeries := make([]*wm.ModelOutputKeyedTimeSeries, len(timeseriesParams))
+	for i, params := range timeseriesParams {
 		keyedTimeSeries[i] = &wm.ModelOutputKeyedTimeSeries{
-			Key:        key,
-			Timeseries: timeseries,
+			Key:        params.Key,
+			Timeseries: results[i],
+			Error:      bulkErrorMessage(errs[i]),
+		}
+		if errs[i] != nil {
+			keyedTimeSeries[i].Timeseries = []*wm.TimeseriesValue{}
 		}
 	}
-
 	return keyedTimeSeries, nil
 }
 
+// runBulk runs the n tasks of a bulk request, with at most a.maxConcurrency of them at a time. Unless partial is set,
+// the first task failing with an error other than ENOTFOUND cancels the remaining tasks and is returned as the error of
+// the whole request. Otherwise, the errors of the tasks are returned so that they can be reported alongside each result.
+func (a *api) runBulk(ctx context.Context, n int, partial bool, fn func(ctx context.Context, i int) error) ([]error, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var failOnce sync.Once
+	var failErr error
+	errs := fanout.Run(ctx, n, a.maxConcurrency, func(ctx context.Context, i int) error {
+		err := fn(ctx, i)
+		if err != nil && !partial && wm.ErrorCode(err) != wm.ENOTFOUND {
+			failOnce.Do(func() {
+				failErr = err
+				cancel()
+			})
+		}
+		return err
+	})
+	if failErr != nil {
+		return nil, failErr
+	}
+	return errs, nil
+}
+
+// bulkErrorMessage returns the message reported for a failed item of a bulk request.
+// Missing data is not reported as an error, the item is just empty
+func bulkErrorMessage(err error) string {
+	if err == nil || wm.ErrorCode(err) == wm.ENOTFOUND {
+		return ""
+	}
+	return wm.ErrorMessage(err)
+}
+
 func (a *api) getDataOutputTimeseries(w http.ResponseWriter, r *http.Request) error {
 	op := "api.getDataOutputTimeseries"
 	params := getDatacubeParams(r)
 	regionID := getRegionID(r)
-	transform := getTransform(r)
-	var timeseries []*wm.TimeseriesValue
-	var err error
+	transform, err := getTransformConfig(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	format, err := getFormat(r, formatCSV)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
 
-	timeseries, err = a.getTimeSeries(regionID, params, transform)
+	timeseries, err := a.getTimeSeries(r.Context(), regionID, params, transform)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
+	if format == formatCSV {
+		if err := writeTimeseriesCSV(newCSVWriter(w, "timeseries.csv"), regionID, timeseries); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+		return nil
+	}
 	list := []render.Renderer{}
 	for _, point := range timeseries {
 		list = append(list, &modelOutputTimeseriesValue{point})
@@ -333,7 +432,7 @@ func (a *api) getDataOutputExtrema(w http.ResponseWriter, r *http.Request) error
 	var extrema *wm.RegionalExtremaSelected
 	var err error
 
-	extrema, err = a.dataOutput.GetOutputExtrema(params)
+	extrema, err = a.dataOutput.GetOutputExtrema(r.Context(), params)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
@@ -342,37 +441,24 @@ func (a *api) getDataOutputExtrema(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
-func (a *api) getTimeSeriesAsync(regionID string, params wm.DatacubeParams, transform wm.Transform) timeseriesResultChan {
-	rc := make(chan []*wm.TimeseriesValue)
-	ec := make(chan error)
-	go func() {
-		r, err := a.getTimeSeries(regionID, params, transform)
-		rc <- r
-		ec <- err
-	}()
-	return timeseriesResultChan{
-		result: rc,
-		err:    ec,
-	}
-}
-
-func (a *api) getTimeSeries(regionID string, params wm.DatacubeParams, transform wm.Transform) ([]*wm.TimeseriesValue, error) {
+// getTimeSeries returns the timeseries of the region, or the global timeseries if regionID is empty. The global
+// timeseries only supports the transforms that don't depend on the region.
+func (a *api) getTimeSeries(ctx context.Context, regionID string, params wm.DatacubeParams, transform wm.TransformConfig) ([]*wm.TimeseriesValue, error) {
 	var timeseries []*wm.TimeseriesValue
 	var err error
 
 	if regionID == "" {
-		timeseries, err = a.dataOutput.GetOutputTimeseries(params)
-		if err != nil {
-			return nil, err
-		}
-		return timeseries, nil
+		timeseries, err = a.dataOutput.GetOutputTimeseries(ctx, params)
+	} else {
+		timeseries, err = a.dataOutput.GetOutputTimeseriesByRegion(ctx, params, regionID)
 	}
-	timeseries, err = a.dataOutput.GetOutputTimeseriesByRegion(params, regionID)
 	if err != nil {
 		return nil, err
 	}
-	if transform != "" {
-		timeseries, err = a.dataOutput.TransformOutputTimeseriesByRegion(timeseries, wm.TransformConfig{Transform: transform, RegionID: regionID, DatacubeParams: &params})
+	if transform.Transform != "" && (regionID != "" || transform.Transform.SupportsGlobal()) {
+		transform.RegionID = regionID
+		transform.DatacubeParams = &params
+		timeseries, err = a.dataOutput.TransformOutputTimeseriesByRegion(ctx, timeseries, transform)
 		if err != nil {
 			return nil, err
 		}
@@ -389,12 +475,22 @@ func (a *api) getDataOutputSparkline(w http.ResponseWriter, r *http.Request) err
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
+	format, err := getFormat(r, formatCSV)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
 
 	var sparkline []float64
-	sparkline, err = a.dataOutput.GetOutputSparkline(params, wm.TemporalResolution(rawRes), rawLastTs)
+	sparkline, err = a.dataOutput.GetOutputSparkline(r.Context(), params, wm.TemporalResolution(rawRes), rawLastTs)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
+	if format == formatCSV {
+		if err := writeSparklineCSV(newCSVWriter(w, "sparkline.csv"), sparkline); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+		return nil
+	}
 	list := []render.Renderer{}
 	for _, point := range sparkline {
 		list = append(list, modelOutputSparklineValue(point))
@@ -409,107 +505,69 @@ func (a *api) getBulkDataOutputRegional(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
+	format, err := getFormat(r, formatArrow)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
 	params := getDatacubeParams(r)
-	transform := getTransform(r)
+	transform, err := getTransformConfig(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
 	aggForSelect := getAggForSelect(r)
 	aggForAll := getAggForAll(r)
+	partial := getPartial(r)
 	bulkData := wm.ModelOutputBulkAggregateRegionalAdmins{}
 
-	bulkRegionalData := make([]wm.ModelOutputBulkRegionalAdmins, len(timestamps.Timestamps))
-	var totalBulkRegionalData []wm.ModelOutputBulkRegionalAdmins
-
-	selectResultChannels := make(map[string]regionalDataResultChan)
-	restResultChannels := make(map[string]regionalDataResultChan)
-
-	for _, timestamp := range timestamps.Timestamps {
-		rc := a.getRegionAggregationAsync(params, timestamp, transform)
-		selectResultChannels[timestamp] = rc
-	}
-
-	// Only timestamps not in timestamps.Timestamps
-	for _, timestamp := range timestamps.AllTimestamps {
-		_, ok := selectResultChannels[timestamp]
-		if !ok {
-			rc := a.getRegionAggregationAsync(params, timestamp, transform)
-			restResultChannels[timestamp] = rc
+	// Fetch each distinct timestamp once, the selected timestamps are a subset of all timestamps
+	var fetchTimestamps []string
+	seen := make(map[string]bool)
+	for _, timestamps := range [][]string{timestamps.Timestamps, timestamps.AllTimestamps} {
+		for _, timestamp := range timestamps {
+			if !seen[timestamp] {
+				seen[timestamp] = true
+				fetchTimestamps = append(fetchTimestamps, timestamp)
+			}
 		}
 	}
-
-	for i, timestamp := range timestamps.Timestamps {
-		data := <-selectResultChannels[timestamp].result
-		err := <-selectResultChannels[timestamp].err
-		if err != nil {
-			if wm.ErrorCode(err) == wm.ENOTFOUND {
-				bulkRegionalData[i] = wm.ModelOutputBulkRegionalAdmins{
-					Timestamp: timestamp,
-					ModelOutputRegionalAdmins: &wm.ModelOutputRegionalAdmins{
-						Country: []wm.ModelOutputAdminData{},
-						Admin1:  []wm.ModelOutputAdminData{},
-						Admin2:  []wm.ModelOutputAdminData{},
-						Admin3:  []wm.ModelOutputAdminData{},
-					},
-				}
-				continue
+	results := make([]*wm.ModelOutputRegionalAdmins, len(fetchTimestamps))
+	errs, err := a.runBulk(r.Context(), len(fetchTimestamps), partial, func(ctx context.Context, i int) error {
+		var err error
+		results[i], err = a.getRegionAggregation(ctx, params, fetchTimestamps[i], transform)
+		return err
+	})
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	regionalData := make(map[string]wm.ModelOutputBulkRegionalAdmins)
+	for i, timestamp := range fetchTimestamps {
+		data := results[i]
+		if errs[i] != nil {
+			data = &wm.ModelOutputRegionalAdmins{
+				Country: []wm.ModelOutputAdminData{},
+				Admin1:  []wm.ModelOutputAdminData{},
+				Admin2:  []wm.ModelOutputAdminData{},
+				Admin3:  []wm.ModelOutputAdminData{},
 			}
-			return &wm.Error{Op: op, Err: err}
 		}
-		bulkRegionalData[i] = wm.ModelOutputBulkRegionalAdmins{
+		regionalData[timestamp] = wm.ModelOutputBulkRegionalAdmins{
 			Timestamp:                 timestamp,
 			ModelOutputRegionalAdmins: data,
+			Error:                     bulkErrorMessage(errs[i]),
 		}
 	}
+
+	bulkRegionalData := make([]wm.ModelOutputBulkRegionalAdmins, len(timestamps.Timestamps))
+	for i, timestamp := range timestamps.Timestamps {
+		bulkRegionalData[i] = regionalData[timestamp]
+	}
 	bulkData.ModelOutputBulkRegionalAdmins = &bulkRegionalData
+
+	var totalBulkRegionalData []wm.ModelOutputBulkRegionalAdmins
 	if len(timestamps.AllTimestamps) != 0 {
-		// avoid looking through subset of timestamps an unnecessary amount of times
-		subsetTimeStamps := map[string]wm.ModelOutputBulkRegionalAdmins{}
-		for _, regionalData := range bulkRegionalData {
-			subsetTimeStamps[regionalData.Timestamp] = regionalData
-		}
-		// hold only data that wouldn't already be in bulkRegionalData
 		totalBulkRegionalData = make([]wm.ModelOutputBulkRegionalAdmins, len(timestamps.AllTimestamps))
 		for i, timestamp := range timestamps.AllTimestamps {
-			channels, inRest := restResultChannels[timestamp]
-			val, inSubset := subsetTimeStamps[timestamp]
-			if inRest {
-				data := <-channels.result
-				err := <-channels.err
-				if err != nil {
-					if wm.ErrorCode(err) == wm.ENOTFOUND {
-						totalBulkRegionalData[i] = wm.ModelOutputBulkRegionalAdmins{
-							Timestamp: timestamp,
-							ModelOutputRegionalAdmins: &wm.ModelOutputRegionalAdmins{
-								Country: []wm.ModelOutputAdminData{},
-								Admin1:  []wm.ModelOutputAdminData{},
-								Admin2:  []wm.ModelOutputAdminData{},
-								Admin3:  []wm.ModelOutputAdminData{},
-							},
-						}
-						continue
-					}
-					return &wm.Error{Op: op, Err: err}
-				}
-				totalBulkRegionalData[i] = wm.ModelOutputBulkRegionalAdmins{
-					Timestamp:                 timestamp,
-					ModelOutputRegionalAdmins: data,
-				}
-			} else if inSubset {
-				// copy it over to apply whatever aggregation we will need to
-				totalBulkRegionalData[i] = wm.ModelOutputBulkRegionalAdmins{
-					Timestamp:                 val.Timestamp,
-					ModelOutputRegionalAdmins: val.ModelOutputRegionalAdmins,
-				}
-			} else {
-				// should never happen
-				totalBulkRegionalData[i] = wm.ModelOutputBulkRegionalAdmins{
-					Timestamp: timestamp,
-					ModelOutputRegionalAdmins: &wm.ModelOutputRegionalAdmins{
-						Country: []wm.ModelOutputAdminData{},
-						Admin1:  []wm.ModelOutputAdminData{},
-						Admin2:  []wm.ModelOutputAdminData{},
-						Admin3:  []wm.ModelOutputAdminData{},
-					},
-				}
-			}
+			totalBulkRegionalData[i] = regionalData[timestamp]
 		}
 	}
 
@@ -521,6 +579,12 @@ func (a *api) getBulkDataOutputRegional(w http.ResponseWriter, r *http.Request)
 		bulkData.AllAgg = getMeanForBulkRegionalData(totalBulkRegionalData)
 	}
 
+	if format == formatArrow {
+		if err := writeBulkRegionalArrow(newArrowWriter(w, bulkRegionalArrowFields), &bulkData); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+		return nil
+	}
 	render.Render(w, r, &modelOutputBulkRegionalData{&bulkData})
 	return nil
 }
@@ -570,11 +634,24 @@ func (a *api) getDataOutputRegional(w http.ResponseWriter, r *http.Request) erro
 	op := "api.getDataOutputRegional"
 	params := getDatacubeParams(r)
 	timestamp := getTimestamp(r)
-	transform := getTransform(r)
-	data, err := a.getRegionAggregation(params, timestamp, transform)
+	transform, err := getTransformConfig(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	format, err := getFormat(r, formatCSV)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	data, err := a.getRegionAggregation(r.Context(), params, timestamp, transform)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
+	if format == formatCSV {
+		if err := writeRegionalCSV(newCSVWriter(w, "regional-data.csv"), timestamp, data); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+		return nil
+	}
 	render.Render(w, r, &modelOutputRegionalData{data})
 	return nil
 }
@@ -583,44 +660,54 @@ func (a *api) getRegionAggregationByAdminLevel(w http.ResponseWriter, r *http.Re
 	op := "api.getRegionAggregationByAdminLevel"
 	params := getDatacubeParams(r)
 	timestamp := getTimestamp(r)
-	transform := getTransform(r)
 	adminLevel := getAdminLevel(r)
+	transform, err := getTransformConfig(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	format, err := getFormat(r, formatCSV)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
 
-	data, err := a.dataOutput.GetRegionAggregationByAdminLevel(params, timestamp, adminLevel)
+	data, err := a.dataOutput.GetRegionAggregationByAdminLevel(r.Context(), params, timestamp, adminLevel)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
-	if transform != "" {
-		data, err = a.dataOutput.TransformRegionAggregationByAdminLevel(data, wm.TransformConfig{Transform: transform, DatacubeParams: &params})
+	if transform.Transform != "" {
+		transform.DatacubeParams = &params
+		data, err = a.dataOutput.TransformRegionAggregationByAdminLevel(r.Context(), data, transform)
 		if err != nil {
 			return &wm.Error{Op: op, Err: err}
 		}
 	}
+	if format == formatCSV {
+		admins := &wm.ModelOutputRegionalAdmins{}
+		if data != nil {
+			levels := *data
+			admins = &wm.ModelOutputRegionalAdmins{
+				Country: levels[wm.AdminLevelCountry],
+				Admin1:  levels[wm.AdminLevel1],
+				Admin2:  levels[wm.AdminLevel2],
+				Admin3:  levels[wm.AdminLevel3],
+			}
+		}
+		if err := writeRegionalCSV(newCSVWriter(w, "regional-aggregation.csv"), timestamp, admins); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+		return nil
+	}
 	render.JSON(w, r, &data)
 	return nil
 }
 
-func (a *api) getRegionAggregationAsync(params wm.DatacubeParams, timestamp string, transform wm.Transform) regionalDataResultChan {
-	rc := make(chan *wm.ModelOutputRegionalAdmins)
-	ec := make(chan error)
-	go func() {
-		r, err := a.getRegionAggregation(params, timestamp, transform)
-		rc <- r
-		ec <- err
-	}()
-	return regionalDataResultChan{
-		result: rc,
-		err:    ec,
-	}
-}
-
-func (a *api) getRegionAggregation(params wm.DatacubeParams, timestamp string, transform wm.Transform) (*wm.ModelOutputRegionalAdmins, error) {
-	data, err := a.dataOutput.GetRegionAggregation(params, timestamp)
+func (a *api) getRegionAggregation(ctx context.Context, params wm.DatacubeParams, timestamp string, transform wm.TransformConfig) (*wm.ModelOutputRegionalAdmins, error) {
+	data, err := a.dataOutput.GetRegionAggregation(ctx, params, timestamp)
 	if err != nil {
 		return nil, err
 	}
-	if transform != "" {
-		data, err = a.dataOutput.TransformRegionAggregation(data, timestamp, wm.TransformConfig{Transform: transform})
+	if transform.Transform != "" {
+		data, err = a.dataOutput.TransformRegionAggregation(ctx, data, timestamp, transform)
 		if err != nil {
 			return nil, err
 		}
@@ -628,10 +715,45 @@ func (a *api) getRegionAggregation(params wm.DatacubeParams, timestamp string, t
 	return data, nil
 }
 
+// Default and maximum number of points of a raw data page
+const (
+	defaultRawDataPageLimit = 1000
+	maxRawDataPageLimit     = 10000
+)
+
+// Number of raw data points streamed between flushes of the response
+const rawDataFlushInterval = 1000
+
+// rawDataPageResponse is a page of raw data points
+type rawDataPageResponse struct {
+	Points []*modelOutputRawDataPoint `json:"points"`
+	// NextCursor is the cursor of the next page, empty for the last page
+	NextCursor string `json:"next_cursor"`
+}
+
 func (a *api) getDataOutputRaw(w http.ResponseWriter, r *http.Request) error {
 	op := "api.getDataOutputRaw"
 	params := getDatacubeParams(r)
-	data, err := a.dataOutput.GetRawData(params)
+	format, err := getFormat(r, formatCSV, formatNDJSON)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	filter, err := getRawDataFilter(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	if format == formatNDJSON {
+		return a.streamDataOutputRaw(w, r, params, filter)
+	}
+	q := r.URL.Query()
+	if format == formatJSON && (q.Get("cursor") != "" || q.Get("offset") != "" || q.Get("limit") != "") {
+		return a.getDataOutputRawPage(w, r, params, filter)
+	}
+
+	if format == formatCSV {
+		return a.streamDataOutputRawCSV(w, r, params, filter)
+	}
+	data, err := a.dataOutput.GetRawData(r.Context(), params, filter)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
@@ -643,10 +765,118 @@ func (a *api) getDataOutputRaw(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// getDataOutputRawPage responds with a page of raw data points and the cursor of the next page
+func (a *api) getDataOutputRawPage(w http.ResponseWriter, r *http.Request, params wm.DatacubeParams, filter wm.RawDataFilter) error {
+	op := "api.getDataOutputRawPage"
+	offset, limit, err := getPaginationWithMax(r, defaultRawDataPageLimit, maxRawDataPageLimit)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	opts := wm.RawDataOptions{Filter: filter, Cursor: r.URL.Query().Get("cursor"), Offset: offset, Limit: limit}
+	page := rawDataPageResponse{Points: []*modelOutputRawDataPoint{}}
+	page.NextCursor, err = a.dataOutput.StreamRawData(r.Context(), params, opts, func(point *wm.ModelOutputRawDataPoint) error {
+		page.Points = append(page.Points, newModelOutputRawDataPoint(point))
+		return nil
+	})
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	render.JSON(w, r, page)
+	return nil
+}
+
+// streamDataOutputRaw writes the raw data points as newline delimited JSON as they are decoded. All the points are
+// written unless there is a limit, the cursor of the next page is sent in the X-Next-Cursor trailer.
+func (a *api) streamDataOutputRaw(w http.ResponseWriter, r *http.Request, params wm.DatacubeParams, filter wm.RawDataFilter) error {
+	op := "api.streamDataOutputRaw"
+	offset, limit, err := getPaginationWithMax(r, 0, maxRawDataPageLimit)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	opts := wm.RawDataOptions{Filter: filter, Cursor: r.URL.Query().Get("cursor"), Offset: offset, Limit: limit}
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	written := 0
+	nextCursor, err := a.dataOutput.StreamRawData(r.Context(), params, opts, func(point *wm.ModelOutputRawDataPoint) error {
+		if written == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Trailer", "X-Next-Cursor")
+			w.WriteHeader(http.StatusOK)
+		}
+		if err := enc.Encode(newModelOutputRawDataPoint(point)); err != nil {
+			return err
+		}
+		written++
+		if flusher != nil && written%rawDataFlushInterval == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if written == 0 {
+			return &wm.Error{Op: op, Err: err}
+		}
+		// The response has already started, so the error ends the stream as a last line
+		a.logger.Error(err)
+		enc.Encode(map[string]string{"error": wm.ErrorMessage(err)})
+		return nil
+	}
+	if written == 0 {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Trailer", "X-Next-Cursor")
+	}
+	w.Header().Set("X-Next-Cursor", nextCursor)
+	return nil
+}
+
+// streamDataOutputRawCSV writes all the raw data points as CSV as they are decoded, followed by a column for each
+// of the qualifier columns of the raw data in alphabetical order
+func (a *api) streamDataOutputRawCSV(w http.ResponseWriter, r *http.Request, params wm.DatacubeParams, filter wm.RawDataFilter) error {
+	op := "api.streamDataOutputRawCSV"
+	qualifiers, err := a.dataOutput.GetRawDataQualifiers(r.Context(), params)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	sort.Strings(qualifiers)
+	// The response starts with the first point, so that errors before it are still reported
+	var cw *csv.Writer
+	start := func() error {
+		cw = newCSVWriter(w, "raw-data.csv")
+		return writeRawDataCSVHeader(cw, qualifiers)
+	}
+	_, err = a.dataOutput.StreamRawData(r.Context(), params, wm.RawDataOptions{Filter: filter}, func(point *wm.ModelOutputRawDataPoint) error {
+		if cw == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return writeRawDataCSVRow(cw, qualifiers, point)
+	})
+	if err != nil {
+		if cw == nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+		// The response has already started, so the error truncates it
+		a.logger.Error(err)
+		cw.Flush()
+		return nil
+	}
+	if cw == nil {
+		if err := start(); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
+}
+
 func (a *api) getDataOutputRegionLists(w http.ResponseWriter, r *http.Request) error {
 	op := "api.getDataOutputRegionLists"
 	params := getRegionListsParams(r)
-	data, err := a.dataOutput.GetRegionLists(params)
+	data, err := a.dataOutput.GetRegionLists(r.Context(), params)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
@@ -657,7 +887,7 @@ func (a *api) getDataOutputRegionLists(w http.ResponseWriter, r *http.Request) e
 func (a *api) getDataOutputQualifierCounts(w http.ResponseWriter, r *http.Request) error {
 	op := "api.getDataOutputQualifierCounts"
 	params := getQualifierInfoParams(r)
-	data, err := a.dataOutput.GetQualifierCounts(params)
+	data, err := a.dataOutput.GetQualifierCounts(r.Context(), params)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
@@ -669,7 +899,7 @@ func (a *api) getDataOutputQualifierLists(w http.ResponseWriter, r *http.Request
 	op := "api.getDataOutputQualifierLists"
 	params := getQualifierInfoParams(r)
 	qualifiers := getQualifierNames(r)
-	data, err := a.dataOutput.GetQualifierLists(params, qualifiers)
+	data, err := a.dataOutput.GetQualifierLists(r.Context(), params, qualifiers)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
@@ -683,25 +913,39 @@ func (a *api) getDataOutputQualifierTimeseries(w http.ResponseWriter, r *http.Re
 	regionID := getRegionID(r)
 	qualifier := getQualifierName(r)
 	qualifierOptions := getQualifierOptions(r)
-	transform := getTransform(r)
+	transform, err := getTransformConfig(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	format, err := getFormat(r, formatCSV)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
 
 	var data []*wm.ModelOutputQualifierTimeseries
-	var err error
 	if regionID == "" {
-		data, err = a.dataOutput.GetQualifierTimeseries(params, qualifier, qualifierOptions)
+		data, err = a.dataOutput.GetQualifierTimeseries(r.Context(), params, qualifier, qualifierOptions)
 	} else {
-		data, err = a.dataOutput.GetQualifierTimeseriesByRegion(params, qualifier, qualifierOptions, regionID)
-		if transform != "" {
-			data, err = a.dataOutput.TransformOutputQualifierTimeseriesByRegion(data, wm.TransformConfig{Transform: transform, RegionID: regionID})
-			if err != nil {
-				return &wm.Error{Op: op, Err: err}
-			}
-		}
+		data, err = a.dataOutput.GetQualifierTimeseriesByRegion(r.Context(), params, qualifier, qualifierOptions, regionID)
 	}
-
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
+	// The global timeseries only supports some transforms
+	if transform.Transform != "" && (regionID != "" || transform.Transform.SupportsGlobal()) {
+		transform.RegionID = regionID
+		transform.DatacubeParams = &params
+		data, err = a.dataOutput.TransformOutputQualifierTimeseriesByRegion(r.Context(), data, transform)
+		if err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+	}
+	if format == formatCSV {
+		if err := writeQualifierTimeseriesCSV(newCSVWriter(w, "qualifier-timeseries.csv"), regionID, data); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+		return nil
+	}
 	list := []render.Renderer{}
 	for _, timeseries := range data {
 		list = append(list, &modelOutputQualifierTimeseriesResponse{timeseries})
@@ -715,7 +959,7 @@ func (a *api) getDataOutputQualifierData(w http.ResponseWriter, r *http.Request)
 	params := getDatacubeParams(r)
 	timestamp := getTimestamp(r)
 	qualifiers := getQualifierNames(r)
-	data, err := a.dataOutput.GetQualifierData(params, timestamp, qualifiers)
+	data, err := a.dataOutput.GetQualifierData(r.Context(), params, timestamp, qualifiers)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
@@ -732,17 +976,33 @@ func (a *api) getDataOutputQualifierRegional(w http.ResponseWriter, r *http.Requ
 	params := getDatacubeParams(r)
 	timestamp := getTimestamp(r)
 	qualifier := getQualifierName(r)
-	transform := getTransform(r)
-	data, err := a.dataOutput.GetQualifierRegional(params, timestamp, qualifier)
+	transform, err := getTransformConfig(r)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
-	if transform != "" {
-		data, err = a.dataOutput.TransformQualifierRegional(data, timestamp, wm.TransformConfig{Transform: transform})
+	format, err := getFormat(r, formatCSV)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	data, err := a.dataOutput.GetQualifierRegional(r.Context(), params, timestamp, qualifier)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	if transform.Transform != "" {
+		data, err = a.dataOutput.TransformQualifierRegional(r.Context(), data, timestamp, transform)
 		if err != nil {
 			return &wm.Error{Op: op, Err: err}
 		}
 	}
+	if format == formatCSV {
+		if data == nil {
+			data = &wm.ModelOutputRegionalQualifiers{}
+		}
+		if err := writeQualifierRegionalCSV(newCSVWriter(w, "qualifier-regional.csv"), timestamp, data); err != nil {
+			return &wm.Error{Op: op, Err: err}
+		}
+		return nil
+	}
 	render.JSON(w, r, data)
 	return nil
 }
@@ -750,7 +1010,7 @@ func (a *api) getDataOutputQualifierRegional(w http.ResponseWriter, r *http.Requ
 func (a *api) getDataOutputPipelineResults(w http.ResponseWriter, r *http.Request) error {
 	op := "api.getDataOutputPipelineResults"
 	params := getPipelineResultParams(r)
-	data, err := a.dataOutput.GetPipelineResults(params)
+	data, err := a.dataOutput.GetPipelineResults(r.Context(), params)
 	if err != nil {
 		return &wm.Error{Op: op, Err: err}
 	}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// regionTimeseriesOutput serves region timeseries, failing for the regions listed in errs
+type regionTimeseriesOutput struct {
+	wm.DataOutput
+	errs map[string]error
+	// values of the regions, 1 by default
+	values map[string]float64
+}
+
+func (o *regionTimeseriesOutput) GetOutputTimeseriesByRegion(ctx context.Context, params wm.DatacubeParams, regionID string) ([]*wm.TimeseriesValue, error) {
+	if err, ok := o.errs[regionID]; ok {
+		return nil, err
+	}
+	value, ok := o.values[regionID]
+	if !ok {
+		value = 1
+	}
+	return []*wm.TimeseriesValue{{Timestamp: 0, Value: value}}, nil
+}
+
+func TestGetBulkTimeseries(t *testing.T) {
+	a := &api{
+		dataOutput: &regionTimeseriesOutput{errs: map[string]error{
+			"Missing":  &wm.Error{Code: wm.ENOTFOUND},
+			"Invalid":  &wm.Error{Code: wm.EINVALID, Message: "Invalid region"},
+			"Invalid2": &wm.Error{Code: wm.EINVALID, Message: "Invalid region"},
+		}},
+		maxConcurrency: 2,
+	}
+	params := func(regionIDs ...string) []*wm.FullTimeseriesParams {
+		var result []*wm.FullTimeseriesParams
+		for _, id := range regionIDs {
+			result = append(result, &wm.FullTimeseriesParams{RegionID: id, Key: id})
+		}
+		return result
+	}
+
+	// Missing data is returned as empty timeseries
+	result, err := a.getBulkTimeseries(context.Background(), params("Ethiopia", "Missing"), false)
+	require.NoError(t, err)
+	require.Equal(t, []*wm.ModelOutputKeyedTimeSeries{
+		{Key: "Ethiopia", Timeseries: []*wm.TimeseriesValue{{Timestamp: 0, Value: 1}}},
+		{Key: "Missing", Timeseries: []*wm.TimeseriesValue{}},
+	}, result)
+
+	// Other errors fail the request
+	_, err = a.getBulkTimeseries(context.Background(), params("Ethiopia", "Invalid", "Missing", "Invalid2"), false)
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+
+	// unless partial results are requested
+	result, err = a.getBulkTimeseries(context.Background(), params("Ethiopia", "Invalid", "Missing"), true)
+	require.NoError(t, err)
+	require.Equal(t, []*wm.ModelOutputKeyedTimeSeries{
+		{Key: "Ethiopia", Timeseries: []*wm.TimeseriesValue{{Timestamp: 0, Value: 1}}},
+		{Key: "Invalid", Timeseries: []*wm.TimeseriesValue{}, Error: "Invalid region"},
+		{Key: "Missing", Timeseries: []*wm.TimeseriesValue{}},
+	}, result)
+}
+
+// populationOutput serves region timeseries and constant populations, without population data for the other regions
+type populationOutput struct {
+	regionTimeseriesOutput
+	population map[string]float64
+}
+
+func (o *populationOutput) GetPopulationTimeseries(ctx context.Context, regionID string, timestamps []int64) ([]*wm.TimeseriesValue, error) {
+	population, ok := o.population[regionID]
+	if !ok {
+		return nil, &wm.Error{Code: wm.ENOTFOUND}
+	}
+	var result []*wm.TimeseriesValue
+	for _, ts := range timestamps {
+		result = append(result, &wm.TimeseriesValue{Timestamp: ts, Value: population})
+	}
+	return result, nil
+}
+
+func TestGetAggregateDataOutputTimeseries(t *testing.T) {
+	a := &api{
+		dataOutput: &populationOutput{
+			regionTimeseriesOutput: regionTimeseriesOutput{values: map[string]float64{"Ethiopia": 2, "Kenya": 6, "Somalia": 100}},
+			population:             map[string]float64{"Ethiopia": 1, "Kenya": 3},
+		},
+		maxConcurrency: 2,
+	}
+	r := httptest.NewRequest("POST", "/maas/output/aggregate-timeseries?agg=population_weighted_mean",
+		strings.NewReader(`{"region_ids": ["Ethiopia", "Kenya", "Somalia"]}`))
+	w := httptest.NewRecorder()
+	require.NoError(t, a.getAggregateDataOutputTimeseries(w, r))
+	// Somalia has no population data, and is left out
+	require.JSONEq(t, `[{"timestamp": 0, "value": 5}]`, w.Body.String())
+}
+
+// rawDataOutput streams the points of timestamps 0 to n-1
+type rawDataOutput struct {
+	wm.DataOutput
+	n int
+}
+
+func (o *rawDataOutput) StreamRawData(ctx context.Context, params wm.DatacubeParams, opts wm.RawDataOptions, fn func(point *wm.ModelOutputRawDataPoint) error) (string, error) {
+	start := opts.Offset
+	if opts.Cursor != "" {
+		start += len(opts.Cursor)
+	}
+	for i := start; i < o.n; i++ {
+		if opts.Limit > 0 && i == start+opts.Limit {
+			return strings.Repeat("x", i), nil
+		}
+		if err := fn(&wm.ModelOutputRawDataPoint{Timestamp: int64(i), Qualifiers: map[string]string{"crop": "maize"}}); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func (o *rawDataOutput) GetRawDataQualifiers(ctx context.Context, params wm.DatacubeParams) ([]string, error) {
+	return []string{"crop"}, nil
+}
+
+func TestGetDataOutputRawPages(t *testing.T) {
+	a := &api{dataOutput: &rawDataOutput{n: 3}}
+	get := func(query string, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/maas/output/raw-data?"+query, nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		require.NoError(t, a.getDataOutputRaw(w, r))
+		return w
+	}
+
+	w := get("limit=2", "")
+	require.JSONEq(t, `{"points": [
+		{"timestamp": 0, "country": "", "admin1": "", "admin2": "", "admin3": "", "lat": null, "lng": null, "value": null, "crop": "maize"},
+		{"timestamp": 1, "country": "", "admin1": "", "admin2": "", "admin3": "", "lat": null, "lng": null, "value": null, "crop": "maize"}
+	], "next_cursor": "xx"}`, w.Body.String())
+
+	w = get("cursor=xx", "")
+	require.JSONEq(t, `{"points": [
+		{"timestamp": 2, "country": "", "admin1": "", "admin2": "", "admin3": "", "lat": null, "lng": null, "value": null, "crop": "maize"}
+	], "next_cursor": ""}`, w.Body.String())
+
+	w = get("offset=1", "application/x-ndjson")
+	require.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	require.Equal(t, ""+
+		`{"admin1":"","admin2":"","admin3":"","country":"","crop":"maize","lat":null,"lng":null,"timestamp":1,"value":null}`+"\n"+
+		`{"admin1":"","admin2":"","admin3":"","country":"","crop":"maize","lat":null,"lng":null,"timestamp":2,"value":null}`+"\n",
+		w.Body.String())
+	require.Equal(t, "", w.Result().Trailer.Get("X-Next-Cursor"))
+
+	w = get("format=ndjson&limit=1", "")
+	require.Equal(t, 1, strings.Count(w.Body.String(), "\n"))
+	require.Equal(t, "x", w.Result().Trailer.Get("X-Next-Cursor"))
+
+	// CSV exports stream all the points
+	w = get("format=csv", "")
+	require.Equal(t, "timestamp,country,admin1,admin2,admin3,lat,lng,value,crop\n"+
+		"0,,,,,,,,maize\n1,,,,,,,,maize\n2,,,,,,,,maize\n", w.Body.String())
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func (a *api) getModelParameters(w http.ResponseWriter, r *http.Request) error {
+	op := "api.getModelParameters"
+	params, err := a.modelMetadata.GetModelParameters(r.Context(), chi.URLParam(r, paramModelID))
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	render.JSON(w, r, params)
+	return nil
+}
+
+func (a *api) getModelRuns(w http.ResponseWriter, r *http.Request) error {
+	op := "api.getModelRuns"
+	params, err := getRunParameters(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	// Runs can only be sorted by creation time, newest first by default
+	if sortBy := r.URL.Query().Get("sort_by"); sortBy != "" && sortBy != "timestamp" {
+		return &wm.Error{Op: op, Code: wm.EINVALID, Message: "Invalid 'sort_by' parameter value, runs can only be sorted by 'timestamp'"}
+	}
+	order, err := getOrder(r, wm.SortOrderDesc)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	offset, limit, err := getPagination(r)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	result, err := a.modelMetadata.GetModelRuns(r.Context(), chi.URLParam(r, paramModelID), wm.ModelRunSearchOptions{
+		Parameters: params,
+		Status:     r.URL.Query().Get("status"),
+		Order:      order,
+		Offset:     offset,
+		Limit:      limit,
+	})
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	render.JSON(w, r, result)
+	return nil
+}
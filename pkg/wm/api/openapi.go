@@ -0,0 +1,703 @@
+package api
+
+import (
+	"embed"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"gitlab.uncharted.software/WM/wm-go/pkg/arrow"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// Paths of the OpenAPI document and of the Swagger UI page rendering it
+const (
+	openAPIPath   = "/maas/openapi.json"
+	swaggerUIPath = "/maas/docs"
+)
+
+// The OpenAPI 3 document is generated from the routes of the router, documented by routeDocs, and from the types of
+// the request and response bodies. Only the subset of the specification needed to describe the API is modelled.
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*jsonSchema `json:"schemas"`
+}
+
+type openAPIOperation struct {
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string      `json:"name"`
+	In          string      `json:"in"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Schema      *jsonSchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]*openAPIHeader   `json:"headers,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Description string      `json:"description,omitempty"`
+	Schema      *jsonSchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *jsonSchema `json:"schema"`
+}
+
+// jsonSchema is an OpenAPI 3.0 schema object. The empty schema accepts any value.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Nullable             bool                   `json:"nullable,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+}
+
+// routeDoc documents a route. Bodies are given as a value of their type, and are described by the schema of the type.
+type routeDoc struct {
+	summary     string
+	description string
+	params      []*openAPIParameter
+	body        interface{}
+	// response is the JSON response body, or responseSchema its schema when it can't be derived from a type
+	response       interface{}
+	responseSchema func(g *schemaGenerator) *jsonSchema
+	// formats lists the media types of the other formats of the response
+	formats []string
+	headers map[string]*openAPIHeader
+}
+
+func queryParam(name string, description string, schema *jsonSchema) *openAPIParameter {
+	return &openAPIParameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func required(p *openAPIParameter) *openAPIParameter {
+	copy := *p
+	copy.Required = true
+	return &copy
+}
+
+func params(groups ...[]*openAPIParameter) []*openAPIParameter {
+	var all []*openAPIParameter
+	for _, g := range groups {
+		all = append(all, g...)
+	}
+	return all
+}
+
+var (
+	stringSchema  = &jsonSchema{Type: "string"}
+	integerSchema = &jsonSchema{Type: "integer", Format: "int64"}
+	numberSchema  = &jsonSchema{Type: "number", Format: "double"}
+	booleanSchema = &jsonSchema{Type: "boolean"}
+	stringsSchema = &jsonSchema{Type: "array", Items: stringSchema}
+	// jsonString is the schema of a parameter holding a JSON value
+	jsonString = &jsonSchema{Type: "string", Format: "json"}
+)
+
+// Query parameters shared by the routes
+var (
+	paramDocDataID      = queryParam("data_id", "ID of the datacube", stringSchema)
+	paramDocRunID       = queryParam("run_id", "ID of the model run, or 'indicator' for indicators", stringSchema)
+	paramDocFeature     = queryParam("feature", "Name of the output feature", stringSchema)
+	paramDocResolution  = queryParam("resolution", "Temporal resolution of the output", enumSchema(wm.TemporalResolutionOptionMonth, wm.TemporalResolutionOptionYear))
+	paramDocTemporalAgg = queryParam("temporal_agg", "Temporal aggregation function", enumSchema(wm.AggregationOptionMean, wm.AggregationOptionSum))
+	paramDocSpatialAgg  = queryParam("spatial_agg", "Spatial aggregation function", enumSchema(wm.AggregationOptionMean, wm.AggregationOptionSum))
+	paramDocAdminLevel  = queryParam("admin_level", "Admin level of the regions", enumSchema(wm.AdminLevelCountry, wm.AdminLevel1, wm.AdminLevel2, wm.AdminLevel3))
+	paramDocTransform   = queryParam("transform", "Transform applied to the values", enumSchema(transformValues...))
+	paramDocWindow      = queryParam("window", "Number of periods of the rolling_mean and rolling_sum transforms", integerSchema)
+	paramDocAlignment   = queryParam("alignment", "Alignment of the denominator of the ratio transform, latest by default", enumSchema(wm.AlignLatest, wm.AlignInterpolate, wm.AlignExact))
+	paramDocTimestamp   = queryParam("timestamp", "Epoch timestamp in milliseconds", stringSchema)
+	paramDocRegionID    = queryParam("region_id", "ID of the region, its admin regions joined by '__', eg. Ethiopia__Afar. The whole output if missing", stringSchema)
+	paramDocPartial     = queryParam("partial", "Report the failed items of a bulk request instead of failing as a whole", booleanSchema)
+	paramDocQualifier   = queryParam("qualifier", "Name of the qualifier", stringSchema)
+	paramDocQualifiers  = queryParam("qlf[]", "Names of the qualifiers", stringsSchema)
+	paramDocOffset      = queryParam("offset", "Number of items to skip", integerSchema)
+	paramDocLimit       = queryParam("limit", "Maximum number of items to return", integerSchema)
+	paramDocSearch      = queryParam("search", "Search term matched against the text fields", stringSchema)
+	paramDocFilters     = queryParam("filters", "JSON object of the filter clauses, see docs/maas_api.md", jsonString)
+	paramDocOrder       = queryParam("order", "Sort order", enumSchema(wm.SortOrderAsc, wm.SortOrderDesc))
+	paramDocSpecs       = queryParam("specs", "JSON list of the outputs of the tile", jsonString)
+	paramDocExpression  = queryParam("expression", "Expression combining the value properties of the outputs", stringSchema)
+	paramDocDebug       = queryParam("debug", "Respond with the JSON representation of the tile", booleanSchema)
+
+	datacubeParamDocs = []*openAPIParameter{paramDocDataID, paramDocRunID, paramDocFeature, paramDocResolution, paramDocTemporalAgg, paramDocSpatialAgg}
+	paginationDocs    = []*openAPIParameter{paramDocOffset, paramDocLimit}
+	baselineParamDocs = []*openAPIParameter{
+		queryParam("baseline_start", "Epoch timestamp in milliseconds of the start of the baseline period of the baseline_index transform", integerSchema),
+		queryParam("baseline_end", "Epoch timestamp in milliseconds of the end, inclusive, of the baseline period of the baseline_index transform", integerSchema),
+	}
+	ratioParamDocs = []*openAPIParameter{
+		queryParam("scale_factor", "Factor the values of the ratio transform are multiplied by", numberSchema),
+		queryParam("denominator_data_id", "Data ID of the denominator of the ratio transform", stringSchema),
+		queryParam("denominator_run_id", "Run ID of the denominator of the ratio transform", stringSchema),
+		queryParam("denominator_feature", "Feature of the denominator of the ratio transform", stringSchema),
+		queryParam("denominator_resolution", "Temporal resolution of the denominator, the resolution parameter by default", paramDocResolution.Schema),
+		queryParam("denominator_temporal_agg", "Temporal aggregation of the denominator, the temporal_agg parameter by default", paramDocTemporalAgg.Schema),
+		queryParam("denominator_spatial_agg", "Spatial aggregation of the denominator, the spatial_agg parameter by default", paramDocSpatialAgg.Schema),
+		paramDocAlignment,
+	}
+)
+
+// transformValues are the transforms accepted by the transform query parameter
+var transformValues = []interface{}{wm.TransformPerCapita, wm.TransformPerCapita1K, wm.TransformPerCapita1M, wm.TransformNormalization,
+	wm.TransformRollingMean, wm.TransformRollingSum, wm.TransformCumulativeSum, wm.TransformPctChange, wm.TransformYoYPctChange,
+	wm.TransformBaselineIndex, wm.TransformZScore, wm.TransformRegionalZScore, wm.TransformRatio}
+
+func formatParam(formats ...string) *openAPIParameter {
+	values := []interface{}{formatJSON}
+	for _, f := range formats {
+		values = append(values, f)
+	}
+	return queryParam("format", "Format of the response, which can also be requested with the Accept header", enumSchema(values...))
+}
+
+// stringValues returns the values as arguments of enumSchema
+func stringValues(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
+
+// enumSchema returns the schema of a string taking one of the values
+func enumSchema(values ...interface{}) *jsonSchema {
+	s := &jsonSchema{Type: "string"}
+	for _, v := range values {
+		s.Enum = append(s.Enum, fmt.Sprint(v))
+	}
+	return s
+}
+
+// rawDataFilterDocs documents the query parameters of getRawDataFilter
+var rawDataFilterDocs = []*openAPIParameter{
+	queryParam("start_time", "Minimum epoch timestamp in milliseconds", integerSchema),
+	queryParam("end_time", "Maximum epoch timestamp in milliseconds", integerSchema),
+	queryParam("country[]", "Countries of the points", stringsSchema),
+	queryParam("admin1[]", "Admin 1 regions of the points", stringsSchema),
+	queryParam("admin2[]", "Admin 2 regions of the points", stringsSchema),
+	queryParam("admin3[]", "Admin 3 regions of the points", stringsSchema),
+	queryParam("bbox", "Bounding box of the points, as min_lng,min_lat,max_lng,max_lat", stringSchema),
+	queryParam("qualifiers", `JSON object of the accepted values of qualifiers, eg. {"crop":["maize"]}`, jsonString),
+	queryParam("min_value", "Minimum value", numberSchema),
+	queryParam("max_value", "Maximum value", numberSchema),
+	queryParam("cursor", "Cursor of the page, returned with the previous page", stringSchema),
+}
+
+// routeDocs documents the routes by method and path, with the path parameters named without their patterns
+var routeDocs = map[string]routeDoc{
+	"GET " + openAPIPath: {
+		summary:  "OpenAPI document of the API",
+		response: map[string]interface{}{},
+	},
+	"GET " + swaggerUIPath: {
+		summary: "Swagger UI page rendering the OpenAPI document",
+		formats: []string{"text/html"},
+	},
+	"GET " + swaggerUIPath + "/{" + paramAsset + "}": {
+		summary: "Swagger UI assets loaded by the Swagger UI page",
+		formats: []string{"text/css", "text/javascript"},
+	},
+	"GET /maas/output/region-lists": {
+		summary:  "Regions of the runs of a datacube, by admin level",
+		params:   []*openAPIParameter{paramDocDataID, queryParam("run_ids[]", "IDs of the runs", stringsSchema), paramDocFeature},
+		response: wm.RegionListOutput{},
+	},
+	"GET /maas/output/qualifier-counts": {
+		summary:  "Number of values of the qualifiers of an output",
+		params:   []*openAPIParameter{paramDocDataID, paramDocRunID, paramDocFeature},
+		response: wm.QualifierCountsOutput{},
+	},
+	"GET /maas/output/qualifier-lists": {
+		summary:  "Values of the qualifiers of an output",
+		params:   []*openAPIParameter{paramDocDataID, paramDocRunID, paramDocFeature, paramDocQualifiers},
+		response: wm.QualifierListsOutput{},
+	},
+	"GET /maas/output/timeseries": {
+		summary:  "Timeseries of an output, or of one of its regions",
+		params:   params(datacubeParamDocs, []*openAPIParameter{paramDocRegionID, paramDocTransform, paramDocWindow, formatParam(formatCSV)}, baselineParamDocs, ratioParamDocs),
+		response: []wm.TimeseriesValue{},
+		formats:  []string{"text/csv"},
+	},
+	"GET /maas/output/extrema": {
+		summary:  "Minimum and maximum regional values of an output",
+		params:   params(datacubeParamDocs, []*openAPIParameter{paramDocAdminLevel}),
+		response: wm.RegionalExtremaSelected{},
+	},
+	"GET /maas/output/sparkline": {
+		summary: "Values of the timeseries of an output",
+		params: params(datacubeParamDocs, []*openAPIParameter{
+			queryParam("raw_res", "Temporal resolution of the raw data, to correct an incomplete last value", stringSchema),
+			queryParam("raw_latest_ts", "Latest timestamp of the raw data, to correct an incomplete last value", integerSchema),
+			formatParam(formatCSV),
+		}),
+		response: []float64{},
+		formats:  []string{"text/csv"},
+	},
+	"POST /maas/output/bulk-timeseries/regions": {
+		summary:  "Timeseries of regions of an output",
+		params:   params(datacubeParamDocs, []*openAPIParameter{paramDocTransform, paramDocWindow, paramDocPartial}, baselineParamDocs, ratioParamDocs),
+		body:     regionIDsBody{},
+		response: []wm.ModelOutputRegionalTimeSeries{},
+	},
+	"POST /maas/output/bulk-timeseries/generic": {
+		summary:  "Timeseries of any outputs and regions",
+		params:   []*openAPIParameter{paramDocPartial, formatParam(formatArrow)},
+		body:     timeseriesParamsBody{},
+		response: []wm.ModelOutputKeyedTimeSeries{},
+		formats:  []string{arrow.MediaType},
+	},
+	"POST /maas/output/aggregate-timeseries": {
+		summary: "Timeseries aggregated over regions of an output",
+		description: "The values of the regions are aggregated at each timestamp, returned in order. The population weighted " +
+			"mean leaves out the regions without population data.",
+		params: params(datacubeParamDocs, []*openAPIParameter{paramDocTransform, paramDocWindow,
+			required(queryParam("agg", "Aggregation function", enumSchema(stringValues(aggregateFuncs)...))),
+			queryParam("percentile", "Percentile, between 0 and 100, of the percentile aggregation", numberSchema),
+			queryParam("missing", "Aggregation of the regions without a value at a timestamp: skip them, count them as 0, "+
+				"or drop the timestamp. skip by default", enumSchema(stringValues(missingOptions)...)),
+			formatParam(formatCSV),
+		}, baselineParamDocs, ratioParamDocs),
+		body:     regionIDsBody{},
+		response: []wm.TimeseriesValue{},
+		formats:  []string{"text/csv"},
+	},
+	"GET /maas/output/stats": {
+		summary:  "Minimum and maximum grid values of an output by zoom level",
+		params:   params(datacubeParamDocs, []*openAPIParameter{paramDocTimestamp}),
+		response: []wm.OutputStatWithZoom{},
+	},
+	"GET /maas/output/regional-data": {
+		summary:  "Regional values of an output at a timestamp, for all the admin levels",
+		params:   params(datacubeParamDocs, []*openAPIParameter{paramDocTimestamp, paramDocTransform, formatParam(formatCSV)}, ratioParamDocs),
+		response: wm.ModelOutputRegionalAdmins{},
+		formats:  []string{"text/csv"},
+	},
+	"POST /maas/output/bulk-regional-data": {
+		summary: "Regional values of an output at several timestamps, and their aggregates",
+		params: params(datacubeParamDocs, []*openAPIParameter{paramDocTransform,
+			queryParam("aggForSelect", "Aggregation function of the selected timestamps", enumSchema("mean")),
+			queryParam("aggForAll", "Aggregation function of all the timestamps", enumSchema("mean")),
+			paramDocPartial, formatParam(formatArrow)}, ratioParamDocs),
+		body:     wm.Timestamps{},
+		response: wm.ModelOutputBulkAggregateRegionalAdmins{},
+		formats:  []string{arrow.MediaType},
+	},
+	"GET /maas/output/regional-stats": {
+		summary:  "Minimum and maximum regional values of an output by admin level",
+		params:   datacubeParamDocs,
+		response: wm.ModelRegionalOutputStat{},
+	},
+	"GET /maas/output/regional-aggregation": {
+		summary:  "Regional values of an output at a timestamp, for one admin level",
+		params:   params(datacubeParamDocs, []*openAPIParameter{paramDocTimestamp, paramDocTransform, paramDocAdminLevel, formatParam(formatCSV)}, baselineParamDocs),
+		response: wm.ModelOutputRegional{},
+		formats:  []string{"text/csv"},
+	},
+	"GET /maas/output/raw-data": {
+		summary: "Raw data points of an output",
+		description: "All the matching points are returned unless a cursor, offset or limit is given, in which case a page " +
+			"of points is returned with the cursor of the next page. Points are streamed as NDJSON with format=ndjson, " +
+			"with the cursor of the next page in the X-Next-Cursor trailer.",
+		params: params(datacubeParamDocs, rawDataFilterDocs, paginationDocs, []*openAPIParameter{formatParam(formatCSV, formatNDJSON)}),
+		responseSchema: func(g *schemaGenerator) *jsonSchema {
+			return &jsonSchema{OneOf: []*jsonSchema{
+				{Type: "array", Items: g.schema(reflect.TypeOf(modelOutputRawDataPoint{}))},
+				g.schema(reflect.TypeOf(rawDataPageResponse{})),
+			}}
+		},
+		formats: []string{"text/csv", "application/x-ndjson"},
+		headers: map[string]*openAPIHeader{"X-Next-Cursor": {Description: "Cursor of the next page of a NDJSON stream, sent as a trailer", Schema: stringSchema}},
+	},
+	"GET /maas/output/qualifier-timeseries": {
+		summary: "Timeseries of an output broken down by the values of a qualifier",
+		params: params(datacubeParamDocs, []*openAPIParameter{paramDocRegionID, paramDocQualifier,
+			queryParam("q_opt[]", "Values of the qualifier", stringsSchema), paramDocTransform, paramDocWindow, formatParam(formatCSV)},
+			baselineParamDocs, ratioParamDocs),
+		response: []wm.ModelOutputQualifierTimeseries{},
+		formats:  []string{"text/csv"},
+	},
+	"GET /maas/output/qualifier-data": {
+		summary:  "Values of an output at a timestamp broken down by the values of qualifiers",
+		params:   params(datacubeParamDocs, []*openAPIParameter{paramDocTimestamp, paramDocQualifiers}),
+		response: []wm.ModelOutputQualifierBreakdown{},
+	},
+	"GET /maas/output/qualifier-regional": {
+		summary:  "Regional values of an output at a timestamp broken down by the values of a qualifier",
+		params:   params(datacubeParamDocs, []*openAPIParameter{paramDocTimestamp, paramDocQualifier, paramDocTransform, formatParam(formatCSV)}, ratioParamDocs),
+		response: wm.ModelOutputRegionalQualifiers{},
+		formats:  []string{"text/csv"},
+	},
+	"GET /maas/output/pipeline-results": {
+		summary:  "Results of the pipeline processing a run",
+		params:   []*openAPIParameter{paramDocDataID, paramDocRunID},
+		response: wm.PipelineResultsOutput{},
+	},
+	"GET /maas/output/runs": {
+		summary:  "Runs with outputs of a datacube",
+		params:   params([]*openAPIParameter{required(paramDocDataID)}, paginationDocs),
+		response: namesPage{},
+	},
+	"GET /maas/output/resolutions": {
+		summary:  "Temporal resolutions of the outputs of a run",
+		params:   params([]*openAPIParameter{required(paramDocDataID), required(paramDocRunID)}, paginationDocs),
+		response: namesPage{},
+	},
+	"GET /maas/output/features": {
+		summary:  "Features of a run, with outputs at the resolution if set",
+		params:   params([]*openAPIParameter{required(paramDocDataID), required(paramDocRunID), paramDocResolution}, paginationDocs),
+		response: namesPage{},
+	},
+	"GET /maas/output/aggregations": {
+		summary:  "Spatial and temporal aggregations of an output, eg. s_sum_t_mean",
+		params:   params([]*openAPIParameter{required(paramDocDataID), required(paramDocRunID), required(paramDocResolution), required(paramDocFeature)}, paginationDocs),
+		response: namesPage{},
+	},
+	"GET /maas/output/timestamps": {
+		summary:  "Timestamps of an output, with regional data at the admin level if set",
+		params:   []*openAPIParameter{required(paramDocDataID), required(paramDocRunID), required(paramDocResolution), required(paramDocFeature), paramDocAdminLevel},
+		response: []int64{},
+	},
+	"GET /maas/datacubes": {
+		summary: "Datacubes matching a search",
+		params: params([]*openAPIParameter{paramDocFilters, paramDocSearch,
+			queryParam("sort_by", "Field to sort the datacubes by, by relevance if missing", stringSchema), paramDocOrder}, paginationDocs),
+		response: wm.DatacubeSearchResult{},
+	},
+	"GET /maas/datacubes/facets": {
+		summary:  "Facets of the datacubes matching a search",
+		params:   []*openAPIParameter{paramDocFilters, paramDocSearch, queryParam("facets", "JSON list of the fields to facet, all the fields if missing", jsonString)},
+		response: wm.Facets{},
+	},
+	"GET /maas/models/{modelID}/parameters": {
+		summary:  "Parameters of a model",
+		response: []wm.ModelParameter{},
+	},
+	"GET /maas/models/{modelID}/runs": {
+		summary: "Runs of a model",
+		params: params([]*openAPIParameter{
+			queryParam("parameters", `JSON object of the accepted values of parameters, eg. {"rainfall":[1, 1.5]}`, jsonString),
+			queryParam("status", "Status of the runs, eg. SUCCESS", stringSchema),
+			queryParam("sort_by", "Runs can only be sorted by timestamp", enumSchema("timestamp")),
+			paramDocOrder}, paginationDocs),
+		response: wm.ModelRunSearchResult{},
+	},
+	"GET /maas/output/tiles/{zoom}/{x}/{y}": {
+		summary: "Grid tile of outputs",
+		params:  []*openAPIParameter{required(paramDocSpecs), paramDocExpression, paramDocDebug},
+		formats: []string{contentTypeMVT},
+	},
+	"GET /maas/tiles/grid-output/{zoom}/{x}/{y}": {
+		summary: "Grid tile of outputs",
+		params:  []*openAPIParameter{required(paramDocSpecs), paramDocExpression, paramDocDebug},
+		formats: []string{contentTypeMVT},
+	},
+	"GET /maas/tiles/{tileSetName}/{zoom}/{x}/{y}": {
+		summary: "Vector tile of a tile set",
+		params:  []*openAPIParameter{paramDocDebug},
+		formats: []string{contentTypeMVT},
+	},
+}
+
+// routeParamRegex matches the parameters of chi route patterns, eg. {zoom:[0-9]+}
+var routeParamRegex = regexp.MustCompile(`\{([^}:]+)(?::([^}]+))?\}`)
+
+// newOpenAPIDocument returns the OpenAPI document of the routes of the router
+func newOpenAPIDocument(routes chi.Routes) (*openAPIDocument, error) {
+	op := "newOpenAPIDocument"
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "WM Go API",
+			Description: "Datacube outputs, datacube search and model metadata. Errors respond with their message as the body.",
+			Version:     "1.0.0",
+		},
+		Paths: make(map[string]map[string]*openAPIOperation),
+	}
+	g := newSchemaGenerator()
+	err := chi.Walk(routes, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		// Routes of mounted routers are walked with the wildcard of the mount, eg. /maas/*/output/timeseries
+		route = strings.Replace(route, "/*/", "/", -1)
+		var pathParams []*openAPIParameter
+		path := routeParamRegex.ReplaceAllStringFunc(route, func(s string) string {
+			m := routeParamRegex.FindStringSubmatch(s)
+			schema := &jsonSchema{Type: "string"}
+			if m[2] != "" {
+				schema.Pattern = "^" + m[2] + "$"
+			}
+			pathParams = append(pathParams, &openAPIParameter{Name: m[1], In: "path", Required: true, Schema: schema})
+			return "{" + m[1] + "}"
+		})
+		rd := routeDocs[method+" "+path]
+		operation := &openAPIOperation{
+			Summary:     rd.summary,
+			Description: rd.description,
+			Parameters:  append(pathParams, rd.params...),
+			Responses:   map[string]*openAPIResponse{"default": {Description: "Error, with the error message as the body"}},
+		}
+		if parts := strings.SplitN(strings.TrimPrefix(path, "/maas/"), "/", 2); len(parts) > 0 {
+			operation.Tags = []string{parts[0]}
+		}
+		if rd.body != nil {
+			operation.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+				"application/json": {Schema: g.schema(reflect.TypeOf(rd.body))},
+			}}
+		}
+		response := &openAPIResponse{Description: "OK", Headers: rd.headers, Content: map[string]openAPIMediaType{}}
+		if rd.responseSchema != nil {
+			response.Content["application/json"] = openAPIMediaType{Schema: rd.responseSchema(g)}
+		} else if rd.response != nil {
+			response.Content["application/json"] = openAPIMediaType{Schema: g.schema(reflect.TypeOf(rd.response))}
+		}
+		for _, mediaType := range rd.formats {
+			schema := &jsonSchema{Type: "string", Format: "binary"}
+			if strings.HasPrefix(mediaType, "text/") || mediaType == "application/x-ndjson" {
+				schema = stringSchema
+			}
+			response.Content[mediaType] = openAPIMediaType{Schema: schema}
+		}
+		operation.Responses["200"] = response
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(method)] = operation
+		return nil
+	})
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	doc.Components.Schemas = g.schemas
+	return doc, nil
+}
+
+// schemaGenerator derives schemas from Go types, following the rules of encoding/json. Named struct and map types are
+// added to the components and referenced.
+type schemaGenerator struct {
+	schemas map[string]*jsonSchema
+	names   map[reflect.Type]string
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{schemas: make(map[string]*jsonSchema), names: make(map[reflect.Type]string)}
+}
+
+// rawDataPointSchema is the schema of a raw data point, which has the values of its qualifiers as extra properties
+var rawDataPointSchema = &jsonSchema{
+	Type: "object",
+	Properties: map[string]*jsonSchema{
+		"timestamp": integerSchema,
+		"country":   stringSchema,
+		"admin1":    stringSchema,
+		"admin2":    stringSchema,
+		"admin3":    stringSchema,
+		"lat":       {Type: "number", Format: "double", Nullable: true},
+		"lng":       {Type: "number", Format: "double", Nullable: true},
+		"value":     {Type: "number", Format: "double", Nullable: true},
+	},
+	AdditionalProperties: stringSchema,
+}
+
+// schemaOverrides are the schemas of the types that can't be derived from the type, like the enumerated string types
+var schemaOverrides = map[reflect.Type]*jsonSchema{
+	reflect.TypeOf(modelOutputRawDataPoint{}):       rawDataPointSchema,
+	reflect.TypeOf(wm.AdminLevel("")):               paramDocAdminLevel.Schema,
+	reflect.TypeOf(wm.AggregationOption("")):        paramDocSpatialAgg.Schema,
+	reflect.TypeOf(wm.TemporalResolutionOption("")): paramDocResolution.Schema,
+	reflect.TypeOf(wm.Transform("")):                paramDocTransform.Schema,
+	reflect.TypeOf(wm.TemporalAlignment("")):        paramDocAlignment.Schema,
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schema(t reflect.Type) *jsonSchema {
+	if s, ok := schemaOverrides[t]; ok {
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if s.Ref == "" && s.Type != "" && s.Type != "object" && s.Type != "array" {
+			nullable := *s
+			nullable.Nullable = true
+			return &nullable
+		}
+		return s
+	case reflect.Bool:
+		return booleanSchema
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return integerSchema
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &jsonSchema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &jsonSchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return numberSchema
+	case reflect.String:
+		return stringSchema
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &jsonSchema{Type: "string", Format: "byte"}
+		}
+		return &jsonSchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return g.named(t, func() *jsonSchema {
+			return &jsonSchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+		})
+	case reflect.Struct:
+		if t == timeType {
+			return &jsonSchema{Type: "string", Format: "date-time"}
+		}
+		return g.named(t, func() *jsonSchema {
+			s := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema)}
+			g.addFields(s, t)
+			return s
+		})
+	}
+	// Interfaces accept any value
+	return &jsonSchema{}
+}
+
+// named returns a reference to the component schema of a named type, adding it if needed. Unnamed types are inlined.
+func (g *schemaGenerator) named(t reflect.Type, build func() *jsonSchema) *jsonSchema {
+	if t.Name() == "" {
+		return build()
+	}
+	name, ok := g.names[t]
+	if !ok {
+		name = strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, taken := g.schemas[name]; taken {
+			// Prefix the types of other packages with the package name, eg. WmModelOutputRawDataPoint
+			pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+			name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+		}
+		g.names[t] = name
+		// Set before building, so that recursive types reference themselves
+		g.schemas[name] = &jsonSchema{}
+		*g.schemas[name] = *build()
+	}
+	return &jsonSchema{Ref: "#/components/schemas/" + name}
+}
+
+// addFields adds the properties of the fields of the struct, flattening the untagged embedded structs
+func (g *schemaGenerator) addFields(s *jsonSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.addFields(s, ft)
+			continue
+		}
+		if f.PkgPath != "" {
+			// Unexported
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schema(f.Type)
+	}
+}
+
+// getOpenAPI writes the OpenAPI document of the API
+func (a *api) getOpenAPI(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(a.openAPI)
+	return err
+}
+
+// getSwaggerUI writes the Swagger UI page rendering the OpenAPI document
+func (a *api) getSwaggerUI(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := fmt.Fprintf(w, swaggerUIPage, openAPIPath)
+	return err
+}
+
+// swaggerUIAssets holds the assets of swagger-ui-dist, see swaggerui/README.md
+//
+//go:embed swaggerui/swagger-ui.css swaggerui/swagger-ui-bundle.js
+var swaggerUIAssets embed.FS
+
+// getSwaggerUIAsset writes an asset of Swagger UI
+func (a *api) getSwaggerUIAsset(w http.ResponseWriter, r *http.Request) error {
+	op := "api.getSwaggerUIAsset"
+	name := chi.URLParam(r, paramAsset)
+	asset, err := swaggerUIAssets.ReadFile("swaggerui/" + name)
+	if err != nil {
+		return &wm.Error{Code: wm.ENOTFOUND, Op: op, Message: fmt.Sprintf("Asset %s not found", name), Err: err}
+	}
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(name)))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	_, err = w.Write(asset)
+	return err
+}
+
+// swaggerUIPage is the Swagger UI page, loading the embedded Swagger UI assets
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>WM Go API</title>
+  <link rel="stylesheet" href="` + swaggerUIPath + `/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="` + swaggerUIPath + `/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = function () {
+      window.ui = SwaggerUIBundle({ url: "%s", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`
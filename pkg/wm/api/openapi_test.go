@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+	"go.uber.org/zap"
+)
+
+type fakeServices struct {
+	wm.DataOutput
+	wm.VectorTile
+	wm.DatacubeSearch
+	wm.ModelMetadata
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	services := &fakeServices{}
+	r, err := New(&Config{
+		DataOutput:     services,
+		VectorTile:     services,
+		DatacubeSearch: services,
+		ModelMetadata:  services,
+		Logger:         zap.NewNop().Sugar(),
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", openAPIPath, nil))
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var doc openAPIDocument
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+
+	// Every route is documented, and every documented route exists
+	routes := map[string]bool{}
+	for path, operations := range doc.Paths {
+		for method, operation := range operations {
+			route := strings.ToUpper(method) + " " + path
+			routes[route] = true
+			_, documented := routeDocs[route]
+			require.True(t, documented, route)
+			require.NotEmpty(t, operation.Summary, route)
+			require.Contains(t, operation.Responses, "200", route)
+		}
+	}
+	for route := range routeDocs {
+		require.True(t, routes[route], route)
+	}
+
+	tile := doc.Paths["/maas/tiles/{tileSetName}/{zoom}/{x}/{y}"]["get"]
+	require.Equal(t, "tileSetName", tile.Parameters[0].Name)
+	require.Equal(t, "path", tile.Parameters[0].In)
+	require.Equal(t, "^[0-9]+$", tile.Parameters[1].Schema.Pattern)
+
+	// Component schemas follow the json tags, and every reference resolves
+	timeseries := doc.Components.Schemas["ModelOutputKeyedTimeSeries"]
+	require.NotNil(t, timeseries)
+	require.Contains(t, timeseries.Properties, "timeseries")
+	require.Contains(t, doc.Components.Schemas["FullTimeseriesParams"].Properties, "data_id")
+	var checkRefs func(s *jsonSchema)
+	checkRefs = func(s *jsonSchema) {
+		if s == nil {
+			return
+		}
+		if s.Ref != "" {
+			require.Contains(t, doc.Components.Schemas, strings.TrimPrefix(s.Ref, "#/components/schemas/"))
+		}
+		checkRefs(s.Items)
+		checkRefs(s.AdditionalProperties)
+		for _, p := range s.Properties {
+			checkRefs(p)
+		}
+		for _, o := range s.OneOf {
+			checkRefs(o)
+		}
+	}
+	for _, s := range doc.Components.Schemas {
+		checkRefs(s)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", swaggerUIPath, nil))
+	require.Equal(t, 200, w.Code)
+	require.Contains(t, w.Body.String(), `url: "`+openAPIPath+`"`)
+	require.NotContains(t, w.Body.String(), "https://")
+
+	// The assets of the page are served by the API
+	for _, asset := range []string{"/swagger-ui.css", "/swagger-ui-bundle.js"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", swaggerUIPath+asset, nil))
+		require.Equal(t, 200, w.Code, asset)
+		require.Contains(t, w.Body.String(), "swagger-ui")
+	}
+	require.Contains(t, w.Header().Get("Content-Type"), "javascript")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", swaggerUIPath+"/missing.js", nil))
+	require.Equal(t, 404, w.Code)
+}
@@ -2,10 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"gitlab.uncharted.software/WM/wm-go/pkg/arrow"
 	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
 )
 
@@ -61,6 +65,73 @@ func getTransform(r *http.Request) wm.Transform {
 	return wm.Transform(transform)
 }
 
+// getTransformConfig returns the transform query parameters
+func getTransformConfig(r *http.Request) (wm.TransformConfig, error) {
+	config := wm.TransformConfig{Transform: getTransform(r)}
+	if val := r.URL.Query().Get("window"); val != "" {
+		v, err := strconv.Atoi(val)
+		if err != nil || v <= 0 {
+			return config, &wm.Error{Code: wm.EINVALID, Message: "Invalid 'window' parameter value, it must be a positive integer"}
+		}
+		config.Window = v
+	}
+	for _, p := range []struct {
+		name  string
+		value *int64
+	}{{"baseline_start", &config.BaselineStart}, {"baseline_end", &config.BaselineEnd}} {
+		val := r.URL.Query().Get(p.name)
+		if val == "" {
+			if config.Transform == wm.TransformBaselineIndex {
+				return config, &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Missing '%s' parameter for the baseline_index transform", p.name)}
+			}
+			continue
+		}
+		v, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return config, &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Invalid '%s' parameter value", p.name)}
+		}
+		*p.value = v
+	}
+	if val := r.URL.Query().Get("scale_factor"); val != "" {
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil || v == 0 {
+			return config, &wm.Error{Code: wm.EINVALID, Message: "Invalid 'scale_factor' parameter value, it must be a non zero number"}
+		}
+		config.ScaleFactor = v
+	}
+	if config.Transform == wm.TransformRatio {
+		if err := checkRequiredParams(r, "denominator_data_id", "denominator_run_id", "denominator_feature"); err != nil {
+			return config, err
+		}
+		denominator := withDenominatorDefaults(wm.DatacubeParams{
+			DataID:          r.URL.Query().Get("denominator_data_id"),
+			RunID:           r.URL.Query().Get("denominator_run_id"),
+			Feature:         r.URL.Query().Get("denominator_feature"),
+			Resolution:      wm.TemporalResolutionOption(r.URL.Query().Get("denominator_resolution")),
+			TemporalAggFunc: wm.AggregationOption(r.URL.Query().Get("denominator_temporal_agg")),
+			SpatialAggFunc:  wm.AggregationOption(r.URL.Query().Get("denominator_spatial_agg")),
+		}, getDatacubeParams(r))
+		config.Denominator = &denominator
+		config.Alignment = wm.TemporalAlignment(r.URL.Query().Get("alignment"))
+	}
+	return config, nil
+}
+
+// withDenominatorDefaults returns the denominator of a ratio transform, with the resolution and agg functions of the
+// params of the data by default
+func withDenominatorDefaults(denominator wm.DatacubeParams, params wm.DatacubeParams) wm.DatacubeParams {
+	if denominator.Resolution == "" {
+		denominator.Resolution = params.Resolution
+	}
+	if denominator.TemporalAggFunc == "" {
+		denominator.TemporalAggFunc = params.TemporalAggFunc
+	}
+	if denominator.SpatialAggFunc == "" {
+		denominator.SpatialAggFunc = params.SpatialAggFunc
+	}
+	return denominator
+}
+
 func getAdminLevel(r *http.Request) wm.AdminLevel {
 	adminLevel := r.URL.Query().Get("admin_level")
 	return wm.AdminLevel(adminLevel)
@@ -70,6 +141,268 @@ func getAgg(r *http.Request) string {
 	return r.URL.Query().Get("agg")
 }
 
+// getTimeseriesAggregation returns the query parameters of the aggregation of the timeseries of several regions
+func getTimeseriesAggregation(r *http.Request) (timeseriesAggregation, error) {
+	aggregation := timeseriesAggregation{agg: getAgg(r), missing: r.URL.Query().Get("missing")}
+	if !isOneOf(aggregation.agg, aggregateFuncs) {
+		return aggregation, &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Invalid 'agg' parameter value, it must be one of %s", strings.Join(aggregateFuncs, ", "))}
+	}
+	if aggregation.missing == "" {
+		aggregation.missing = missingSkip
+	} else if !isOneOf(aggregation.missing, missingOptions) {
+		return aggregation, &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Invalid 'missing' parameter value, it must be one of %s", strings.Join(missingOptions, ", "))}
+	}
+	if aggregation.agg == aggPercentile {
+		v, err := strconv.ParseFloat(r.URL.Query().Get("percentile"), 64)
+		if err != nil || v < 0 || v > 100 {
+			return aggregation, &wm.Error{Code: wm.EINVALID, Message: "Invalid 'percentile' parameter value, it must be a number between 0 and 100"}
+		}
+		aggregation.percentile = v
+	}
+	return aggregation, nil
+}
+
+func isOneOf(value string, values []string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequiredParams returns an EINVALID error if any of the query parameters is missing
+func checkRequiredParams(r *http.Request, names ...string) error {
+	for _, name := range names {
+		if r.URL.Query().Get(name) == "" {
+			return &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Missing '%s' parameter", name)}
+		}
+	}
+	return nil
+}
+
+// Default and maximum number of items of a page
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// getPagination returns the offset and limit query parameters
+func getPagination(r *http.Request) (int, int, error) {
+	return getPaginationWithMax(r, defaultPageLimit, maxPageLimit)
+}
+
+// getPaginationWithMax returns the offset and limit query parameters, the limit defaulting to defaultLimit and being
+// at most maxLimit
+func getPaginationWithMax(r *http.Request, defaultLimit int, maxLimit int) (int, int, error) {
+	offset, limit := 0, defaultLimit
+	if val := r.URL.Query().Get("offset"); val != "" {
+		v, err := strconv.Atoi(val)
+		if err != nil || v < 0 {
+			return 0, 0, &wm.Error{Code: wm.EINVALID, Message: "Invalid 'offset' parameter value"}
+		}
+		offset = v
+	}
+	if val := r.URL.Query().Get("limit"); val != "" {
+		v, err := strconv.Atoi(val)
+		if err != nil || v <= 0 || v > maxLimit {
+			return 0, 0, &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Invalid 'limit' parameter value, it must be between 1 and %d", maxLimit)}
+		}
+		limit = v
+	}
+	return offset, limit, nil
+}
+
+func getSearch(r *http.Request) string {
+	return r.URL.Query().Get("search")
+}
+
+// getSort returns the sort_by and order query parameters. sort_by must be one of the fields, the results are
+// sorted by relevance if it is missing
+func getSort(r *http.Request, fields map[string]wm.Field) ([]wm.SortBy, error) {
+	name := r.URL.Query().Get("sort_by")
+	if name == "" {
+		return nil, nil
+	}
+	field, ok := fields[name]
+	if !ok {
+		return nil, &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Invalid 'sort_by' parameter value: %s", name)}
+	}
+	order, err := getOrder(r, wm.SortOrderAsc)
+	if err != nil {
+		return nil, err
+	}
+	return []wm.SortBy{{Field: field, Order: order}}, nil
+}
+
+// getOrder returns the order query parameter, or defaultOrder if it is missing
+func getOrder(r *http.Request, defaultOrder wm.SortOrder) (wm.SortOrder, error) {
+	order := wm.SortOrder(r.URL.Query().Get("order"))
+	switch order {
+	case "":
+		return defaultOrder, nil
+	case wm.SortOrderAsc, wm.SortOrderDesc:
+		return order, nil
+	}
+	return "", &wm.Error{Code: wm.EINVALID, Message: "Invalid 'order' parameter value, it must be 'asc' or 'desc'"}
+}
+
+// getRunParameters returns the parameters query parameter, a JSON object listing the accepted values of
+// parameters, eg. {"rainfall":[1, 1.5],"crop":["teff"]}
+func getRunParameters(r *http.Request) (map[string][]string, error) {
+	return getValuesParam(r, "parameters")
+}
+
+// getValuesParam returns a query parameter holding a JSON object that maps names to lists of accepted values.
+// Numbers and booleans are returned as strings.
+func getValuesParam(r *http.Request, param string) (map[string][]string, error) {
+	raw := r.URL.Query().Get(param)
+	if raw == "" {
+		return nil, nil
+	}
+	invalid := &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Invalid '%s' parameter value", param)}
+	var values map[string][]interface{}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, invalid
+	}
+	params := make(map[string][]string, len(values))
+	for name, vals := range values {
+		params[name] = make([]string, 0, len(vals))
+		for _, v := range vals {
+			switch val := v.(type) {
+			case string:
+				params[name] = append(params[name], val)
+			case float64:
+				params[name] = append(params[name], strconv.FormatFloat(val, 'f', -1, 64))
+			case bool:
+				params[name] = append(params[name], strconv.FormatBool(val))
+			default:
+				return nil, invalid
+			}
+		}
+	}
+	return params, nil
+}
+
+// getRawDataFilter returns the filter of raw data points given by the start_time, end_time, country[], admin1[],
+// admin2[], admin3[], bbox, qualifiers, min_value and max_value query parameters
+func getRawDataFilter(r *http.Request) (wm.RawDataFilter, error) {
+	q := r.URL.Query()
+	filter := wm.RawDataFilter{
+		Country: q["country[]"],
+		Admin1:  q["admin1[]"],
+		Admin2:  q["admin2[]"],
+		Admin3:  q["admin3[]"],
+	}
+	var err error
+	for param, dst := range map[string]**int64{"start_time": &filter.StartTime, "end_time": &filter.EndTime} {
+		if val := q.Get(param); val != "" {
+			v, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return filter, &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Invalid '%s' parameter value", param)}
+			}
+			*dst = &v
+		}
+	}
+	for param, dst := range map[string]**float64{"min_value": &filter.MinValue, "max_value": &filter.MaxValue} {
+		if val := q.Get(param); val != "" {
+			v, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return filter, &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Invalid '%s' parameter value", param)}
+			}
+			*dst = &v
+		}
+	}
+	if val := q.Get("bbox"); val != "" {
+		if filter.Bound, err = parseBBox(val); err != nil {
+			return filter, err
+		}
+	}
+	if filter.Qualifiers, err = getValuesParam(r, "qualifiers"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseBBox parses a bounding box given as min_lng,min_lat,max_lng,max_lat
+func parseBBox(val string) (*wm.Bound, error) {
+	invalid := &wm.Error{Code: wm.EINVALID, Message: "Invalid 'bbox' parameter value, it must be min_lng,min_lat,max_lng,max_lat"}
+	parts := strings.Split(val, ",")
+	if len(parts) != 4 {
+		return nil, invalid
+	}
+	var coords [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, invalid
+		}
+		coords[i] = v
+	}
+	if coords[0] > coords[2] || coords[1] > coords[3] {
+		return nil, invalid
+	}
+	return &wm.Bound{
+		TopLeft:     wm.Point{Lat: coords[3], Lon: coords[0]},
+		BottomRight: wm.Point{Lat: coords[1], Lon: coords[2]},
+	}, nil
+}
+
+// Available response formats
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+	formatArrow  = "arrow"
+)
+
+// formatMediaTypes maps the media types of the Accept header to the response formats
+var formatMediaTypes = map[string]string{
+	"*/*":                  formatJSON,
+	"application/json":     formatJSON,
+	"text/csv":             formatCSV,
+	"application/x-ndjson": formatNDJSON,
+	arrow.MediaType:        formatArrow,
+}
+
+// getFormat returns the format of the response, given by the format query parameter or else by the first acceptable
+// media type of the Accept header, ignoring media types with q=0. JSON is the default, and the only other allowed
+// formats are the given ones.
+func getFormat(r *http.Request, formats ...string) (string, error) {
+	allowed := func(format string) bool {
+		for _, f := range formats {
+			if f == format {
+				return true
+			}
+		}
+		return format == formatJSON
+	}
+	if format := r.URL.Query().Get("format"); format != "" {
+		if !allowed(format) {
+			return "", &wm.Error{Code: wm.EINVALID, Message: fmt.Sprintf("Invalid 'format' parameter value: %s", format)}
+		}
+		return format, nil
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		if format, ok := formatMediaTypes[mediaType]; ok && allowed(format) {
+			return format, nil
+		}
+	}
+	return formatJSON, nil
+}
+
+// getPartial returns whether a bulk request should report failed items instead of failing as a whole
+func getPartial(r *http.Request) bool {
+	return r.URL.Query().Get("partial") == "true"
+}
+
 func getRegionID(r *http.Request) string {
 	return r.URL.Query().Get("region_id")
 }
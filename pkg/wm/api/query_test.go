@@ -182,3 +182,206 @@ func TestGetTileDataSpecs(t *testing.T) {
 		}
 	}
 }
+
+func TestGetPagination(t *testing.T) {
+	for _, test := range []struct {
+		query  string
+		isErr  bool
+		offset int
+		limit  int
+	}{
+		{"", false, 0, defaultPageLimit},
+		{"offset=20&limit=10", false, 20, 10},
+		{"offset=-1", true, 0, 0},
+		{"limit=0", true, 0, 0},
+		{"limit=100000", true, 0, 0},
+		{"limit=abc", true, 0, 0},
+	} {
+		offset, limit, err := getPagination(&http.Request{URL: &url.URL{RawQuery: test.query}})
+		if test.isErr {
+			if wm.ErrorCode(err) != wm.EINVALID {
+				t.Errorf("getPagination(%q) returned error %v instead of an EINVALID error", test.query, err)
+			}
+			continue
+		}
+		if err != nil || offset != test.offset || limit != test.limit {
+			t.Errorf("getPagination(%q) returned %d, %d, %v instead of %d, %d", test.query, offset, limit, err, test.offset, test.limit)
+		}
+	}
+}
+
+func TestNewNamesPage(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	for _, test := range []struct {
+		offset int
+		limit  int
+		want   []string
+	}{
+		{0, 2, []string{"a", "b"}},
+		{2, 2, []string{"c"}},
+		{3, 2, []string{}},
+	} {
+		page := newNamesPage(names, test.offset, test.limit)
+		if page.Total != 3 || !reflect.DeepEqual(page.Items, test.want) {
+			t.Errorf("newNamesPage(%d, %d) returned %s instead of %v", test.offset, test.limit, spew.Sdump(page), test.want)
+		}
+	}
+}
+
+func TestGetSort(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		isErr bool
+		want  []wm.SortBy
+	}{
+		{``, false, nil},
+		{`sort_by=model`, false, []wm.SortBy{{Field: wm.FieldDatacubeModel, Order: wm.SortOrderAsc}}},
+		{`sort_by=period&order=desc`, false, []wm.SortBy{{Field: wm.FieldDatacubePeriod, Order: wm.SortOrderDesc}}},
+		{`sort_by=unknown`, true, nil},
+		{`sort_by=model&order=up`, true, nil},
+	} {
+		got, err := getSort(&http.Request{URL: &url.URL{RawQuery: test.query}}, datacubeFields)
+		if err != nil {
+			if !test.isErr {
+				t.Errorf("getSort returned err:\n%v\nfor:\n%s", err, test.query)
+			}
+		} else if test.isErr || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("getSort returned:\n%v\ninstead of:\n%v\nfor:\n%s", got, test.want, test.query)
+		}
+	}
+}
+
+func TestGetRunParameters(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		isErr bool
+		want  map[string][]string
+	}{
+		{``, false, nil},
+		{`parameters={"rainfall":[1,1.5],"crop":["teff"]}`, false, map[string][]string{"rainfall": {"1", "1.5"}, "crop": {"teff"}}},
+		{`parameters=["rainfall"]`, true, nil},
+		{`parameters={"rainfall":[{"value":1}]}`, true, nil},
+	} {
+		got, err := getRunParameters(&http.Request{URL: &url.URL{RawQuery: test.query}})
+		if err != nil {
+			if !test.isErr {
+				t.Errorf("getRunParameters returned err:\n%v\nfor:\n%s", err, test.query)
+			}
+		} else if test.isErr || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("getRunParameters returned:\n%v\ninstead of:\n%v\nfor:\n%s", got, test.want, test.query)
+		}
+	}
+}
+
+func TestGetRawDataFilter(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	i := func(v int64) *int64 { return &v }
+	for _, test := range []struct {
+		query string
+		isErr bool
+		want  wm.RawDataFilter
+	}{
+		{``, false, wm.RawDataFilter{}},
+		{`start_time=1&end_time=2&min_value=-1.5&max_value=3`, false, wm.RawDataFilter{StartTime: i(1), EndTime: i(2), MinValue: f(-1.5), MaxValue: f(3)}},
+		{`country[]=Ethiopia&country[]=Kenya&admin1[]=Afar`, false, wm.RawDataFilter{Country: []string{"Ethiopia", "Kenya"}, Admin1: []string{"Afar"}}},
+		{`bbox=38,8,40.5,10`, false, wm.RawDataFilter{Bound: &wm.Bound{TopLeft: wm.Point{Lat: 10, Lon: 38}, BottomRight: wm.Point{Lat: 8, Lon: 40.5}}}},
+		{`qualifiers={"crop":["maize"]}`, false, wm.RawDataFilter{Qualifiers: map[string][]string{"crop": {"maize"}}}},
+		{`start_time=abc`, true, wm.RawDataFilter{}},
+		{`max_value=abc`, true, wm.RawDataFilter{}},
+		{`bbox=38,8,40`, true, wm.RawDataFilter{}},
+		{`bbox=41,8,40,10`, true, wm.RawDataFilter{}},
+		{`qualifiers=["crop"]`, true, wm.RawDataFilter{}},
+	} {
+		got, err := getRawDataFilter(&http.Request{URL: &url.URL{RawQuery: test.query}})
+		if err != nil {
+			if !test.isErr {
+				t.Errorf("getRawDataFilter returned err:\n%v\nfor:\n%s", err, test.query)
+			}
+		} else if test.isErr || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("getRawDataFilter returned:\n%v\ninstead of:\n%v\nfor:\n%s", spew.Sdump(got), spew.Sdump(test.want), test.query)
+		}
+	}
+}
+
+func TestGetTransformConfig(t *testing.T) {
+	denominator := &wm.DatacubeParams{DataID: "area", RunID: "run", Feature: "cropland", Resolution: "month", TemporalAggFunc: "sum", SpatialAggFunc: "mean"}
+	for _, test := range []struct {
+		query string
+		isErr bool
+		want  wm.TransformConfig
+	}{
+		{`transform=rolling_sum&window=3`, false, wm.TransformConfig{Transform: wm.TransformRollingSum, Window: 3}},
+		{`transform=ratio&scale_factor=1000&denominator_data_id=area&denominator_run_id=run&denominator_feature=cropland&resolution=month&temporal_agg=sum&denominator_spatial_agg=mean&spatial_agg=max&alignment=exact`,
+			false, wm.TransformConfig{Transform: wm.TransformRatio, ScaleFactor: 1000, Denominator: denominator, Alignment: wm.AlignExact}},
+		{`transform=ratio&denominator_data_id=area&denominator_run_id=run`, true, wm.TransformConfig{}},
+		{`transform=ratio&scale_factor=0`, true, wm.TransformConfig{}},
+		{`window=0`, true, wm.TransformConfig{}},
+	} {
+		got, err := getTransformConfig(&http.Request{URL: &url.URL{RawQuery: test.query}})
+		if err != nil {
+			if !test.isErr {
+				t.Errorf("getTransformConfig returned err:\n%v\nfor:\n%s", err, test.query)
+			}
+		} else if test.isErr || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("getTransformConfig returned:\n%v\ninstead of:\n%v\nfor:\n%s", spew.Sdump(got), spew.Sdump(test.want), test.query)
+		}
+	}
+}
+
+func TestGetTimeseriesAggregation(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		isErr bool
+		want  timeseriesAggregation
+	}{
+		{`agg=sum`, false, timeseriesAggregation{agg: aggSum, missing: missingSkip}},
+		{`agg=percentile&percentile=90&missing=drop`, false, timeseriesAggregation{agg: aggPercentile, percentile: 90, missing: missingDrop}},
+		{``, true, timeseriesAggregation{}},
+		{`agg=mode`, true, timeseriesAggregation{}},
+		{`agg=mean&missing=fill`, true, timeseriesAggregation{}},
+		{`agg=percentile`, true, timeseriesAggregation{}},
+		{`agg=percentile&percentile=101`, true, timeseriesAggregation{}},
+	} {
+		got, err := getTimeseriesAggregation(&http.Request{URL: &url.URL{RawQuery: test.query}})
+		if err != nil {
+			if !test.isErr {
+				t.Errorf("getTimeseriesAggregation returned err:\n%v\nfor:\n%s", err, test.query)
+			}
+		} else if test.isErr || got != test.want {
+			t.Errorf("getTimeseriesAggregation returned:\n%v\ninstead of:\n%v\nfor:\n%s", got, test.want, test.query)
+		}
+	}
+}
+
+func TestGetFormat(t *testing.T) {
+	for _, test := range []struct {
+		query  string
+		accept string
+		isErr  bool
+		want   string
+	}{
+		{``, ``, false, formatJSON},
+		{`format=csv`, ``, false, formatCSV},
+		{``, `text/csv`, false, formatCSV},
+		{``, `application/json, text/csv;q=0.9`, false, formatJSON},
+		{``, `application/json, text/csv`, false, formatJSON},
+		{``, `text/csv;q=0, application/json`, false, formatJSON},
+		{``, `*/*, text/csv`, false, formatJSON},
+		{``, `text/html, text/csv`, false, formatCSV},
+		{`format=json`, `text/csv`, false, formatJSON},
+		{`format=xml`, ``, true, ""},
+		{`format=ndjson`, ``, true, ""},
+		{``, `application/x-ndjson`, false, formatJSON},
+		{``, `application/vnd.apache.arrow.stream`, false, formatJSON},
+	} {
+		r := &http.Request{URL: &url.URL{RawQuery: test.query}, Header: http.Header{"Accept": {test.accept}}}
+		got, err := getFormat(r, formatCSV)
+		if err != nil {
+			if !test.isErr {
+				t.Errorf("getFormat returned err:\n%v\nfor:\n%s %s", err, test.query, test.accept)
+			}
+		} else if test.isErr || got != test.want {
+			t.Errorf("getFormat returned %q instead of %q for: %s %s", got, test.want, test.query, test.accept)
+		}
+	}
+}
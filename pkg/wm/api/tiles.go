@@ -24,7 +24,7 @@ func (a *api) getVectorTile(w http.ResponseWriter, r *http.Request) error {
 	}
 	debug := r.URL.Query().Get("debug")
 	tileSet := chi.URLParam(r, paramTileSetName)
-	tile, err := a.vectorTile.GetVectorTile(zxy[0], zxy[1], zxy[2], tileSet)
+	tile, err := a.vectorTile.GetVectorTile(r.Context(), zxy[0], zxy[1], zxy[2], tileSet)
 	if err != nil {
 		return nil
 	}
@@ -63,7 +63,7 @@ func (a *api) getTile(w http.ResponseWriter, r *http.Request) error {
 		zxy[i] = uint32(v)
 	}
 
-	tile, err := a.dataOutput.GetTile(zxy[0], zxy[1], zxy[2], specs, expression)
+	tile, err := a.dataOutput.GetTile(r.Context(), zxy[0], zxy[1], zxy[2], specs, expression)
 	if err != nil {
 		return nil
 	}
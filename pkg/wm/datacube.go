@@ -0,0 +1,55 @@
+package wm
+
+import "context"
+
+// Datacube is a datacube document as stored in the search index. See docs/maas_api.md for its fields.
+type Datacube map[string]interface{}
+
+// SortOrder is a type for sort orders
+type SortOrder string
+
+// Available sort orders
+const (
+	SortOrderAsc  SortOrder = "asc"
+	SortOrderDesc SortOrder = "desc"
+)
+
+// SortBy defines a field to sort the results by
+type SortBy struct {
+	Field Field
+	Order SortOrder
+}
+
+// DatacubeSearchOptions defines the datacubes to search for and the page of results to return
+type DatacubeSearchOptions struct {
+	Filters []*Filter
+	// Search is a search term matched against the text fields
+	Search string
+	// Sort orders the results, by relevance if empty
+	Sort   []SortBy
+	Offset int
+	Limit  int
+}
+
+// DatacubeSearchResult is a page of datacubes matching a search
+type DatacubeSearchResult struct {
+	// Total is the number of matching datacubes
+	Total     int         `json:"total"`
+	Datacubes []*Datacube `json:"datacubes"`
+}
+
+// DatacubeFacetsOptions defines the datacubes to count and the fields to facet them by
+type DatacubeFacetsOptions struct {
+	Filters []*Filter
+	Search  string
+	Fields  []Field
+}
+
+// DatacubeSearch defines the methods that a datacube search service must implement
+type DatacubeSearch interface {
+	// SearchDatacubes returns the page of datacubes matching the search options
+	SearchDatacubes(ctx context.Context, opts DatacubeSearchOptions) (*DatacubeSearchResult, error)
+
+	// GetDatacubeFacets returns the facets of the datacubes matching the options for each of the fields
+	GetDatacubeFacets(ctx context.Context, opts DatacubeFacetsOptions) (Facets, error)
+}
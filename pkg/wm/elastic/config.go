@@ -3,6 +3,11 @@ package elastic
 // Config defines the parameters needed to instantiate a KB.
 type Config struct {
 	Addr string
+	// DatacubeIndex, RunIndex and ParameterIndex are the names of the indices of the datacube,
+	// model run and model parameter documents
+	DatacubeIndex  string
+	RunIndex       string
+	ParameterIndex string
 }
 
 // init fills in defaults for missing config parameters.
@@ -10,4 +15,13 @@ func (cfg *Config) init() {
 	if cfg.Addr == "" {
 		cfg.Addr = "http://localhost:9200"
 	}
+	if cfg.DatacubeIndex == "" {
+		cfg.DatacubeIndex = "data-datacube"
+	}
+	if cfg.RunIndex == "" {
+		cfg.RunIndex = "data-model-run"
+	}
+	if cfg.ParameterIndex == "" {
+		cfg.ParameterIndex = "data-model-parameter"
+	}
 }
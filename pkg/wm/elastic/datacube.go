@@ -0,0 +1,105 @@
+package elastic
+
+import (
+	"context"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// searchResponse is the part of an ES search response holding the matching documents
+type searchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source *wm.Datacube `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// SearchDatacubes returns the page of datacubes matching the search options
+func (es *ES) SearchDatacubes(ctx context.Context, opts wm.DatacubeSearchOptions) (*wm.DatacubeSearchResult, error) {
+	op := "ES.SearchDatacubes"
+	body, err := buildDatacubeSearchBody(opts)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	var resBody searchResponse
+	if err := es.search(ctx, es.datacubeIndex, body, &resBody); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	result := &wm.DatacubeSearchResult{
+		Total:     resBody.Hits.Total.Value,
+		Datacubes: make([]*wm.Datacube, 0, len(resBody.Hits.Hits)),
+	}
+	for _, hit := range resBody.Hits.Hits {
+		result.Datacubes = append(result.Datacubes, hit.Source)
+	}
+	return result, nil
+}
+
+// buildDatacubeSearchBody builds the ES search request body for the datacube search options
+func buildDatacubeSearchBody(opts wm.DatacubeSearchOptions) (map[string]interface{}, error) {
+	op := "buildDatacubeSearchBody"
+	query, err := buildDatacubeQuery(opts.Filters, opts.Search)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	sort, err := buildSort(opts.Sort)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+
+	body := map[string]interface{}{
+		"query":            query,
+		"from":             opts.Offset,
+		"size":             opts.Limit,
+		"track_total_hits": true,
+	}
+	if len(sort) > 0 {
+		body["sort"] = sort
+	}
+	return body, nil
+}
+
+// buildDatacubeQuery builds the ES query matching the datacubes with the filters and the search term
+func buildDatacubeQuery(filters []*wm.Filter, search string) (map[string]interface{}, error) {
+	op := "buildDatacubeQuery"
+	if search != "" {
+		// The search term is matched like a _search filter so that it contributes to the score
+		filters = append(filters[:len(filters):len(filters)], &wm.Filter{
+			Field:        wm.FieldDatacubeSearch,
+			Operand:      wm.OperandOr,
+			StringValues: []string{search},
+		})
+	}
+	query, err := buildBoolQuery(queryOptions{filters: filters})
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if len(query) == 0 {
+		query["match_all"] = map[string]interface{}{}
+	}
+	return query, nil
+}
+
+// buildSort builds the ES sort clauses. Nested and search fields can't be sorted by.
+func buildSort(sortBy []wm.SortBy) ([]interface{}, error) {
+	op := "buildSort"
+	var sort []interface{}
+	for _, s := range sortBy {
+		fieldName, ok := fieldNames[s.Field]
+		if !ok || nestedPath[s.Field] != "" || isSearchField[s.Field] {
+			return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: "Unsupported sort field"}
+		}
+		order := s.Order
+		if order == "" {
+			order = wm.SortOrderAsc
+		}
+		sort = append(sort, map[string]interface{}{
+			fieldName: map[string]interface{}{"order": order},
+		})
+	}
+	return sort, nil
+}
@@ -0,0 +1,61 @@
+package elastic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestBuildDatacubeSearchBody(t *testing.T) {
+	tests := []struct {
+		description string
+		input       wm.DatacubeSearchOptions
+		expect      string
+		isErr       bool
+	}{
+		{
+			"Build a search for all datacubes",
+			wm.DatacubeSearchOptions{Limit: 10},
+			`{"from":0,"query":{"match_all":{}},"size":10,"track_total_hits":true}`,
+			false,
+		},
+		{
+			"Build a search with a search term, filters and sorting",
+			wm.DatacubeSearchOptions{
+				Filters: []*wm.Filter{
+					{
+						Field:        wm.FieldDatacubeModel,
+						StringValues: []string{"m1"},
+						Operand:      wm.OperandOr,
+					},
+				},
+				Search: "rainfall",
+				Sort:   []wm.SortBy{{Field: wm.FieldDatacubeModel, Order: wm.SortOrderDesc}},
+				Offset: 20,
+				Limit:  10,
+			},
+			`{"from":20,"query":{"bool":{"filter":[{"bool":{"should":[{"term":{"model":"m1"}}]}}],"must":[{"bool":{"should":[{"match":{"_search":"rainfall"}}]}}]}},"size":10,"sort":[{"model":{"order":"desc"}}],"track_total_hits":true}`,
+			false,
+		},
+		{
+			"Fail to sort by a nested field",
+			wm.DatacubeSearchOptions{
+				Sort: []wm.SortBy{{Field: wm.FieldDatacubeConceptScore, Order: wm.SortOrderAsc}},
+			},
+			`null`,
+			true,
+		},
+	}
+	for _, test := range tests {
+		body, err := buildDatacubeSearchBody(test.input)
+		if (err != nil) != test.isErr {
+			t.Errorf("%s\nbuildDatacubeSearchBody returned err:\n%v\nfor input %v", test.description, err, spew.Sdump(test.input))
+		}
+		result, _ := json.Marshal(body)
+		if string(result) != test.expect {
+			t.Errorf("%s\nbuildDatacubeSearchBody returned: \n%s\ninstead of:\n%s\n for input %v", test.description, result, test.expect, spew.Sdump(test.input))
+		}
+	}
+}
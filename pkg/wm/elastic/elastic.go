@@ -1,6 +1,9 @@
 package elastic
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/elastic/go-elasticsearch/v7"
@@ -9,7 +12,10 @@ import (
 
 // ES wraps the client and serves as the basis of the wm.KnowledgeBase interface.
 type ES struct {
-	client *elasticsearch.Client
+	client         *elasticsearch.Client
+	datacubeIndex  string
+	runIndex       string
+	parameterIndex string
 }
 
 // New instantiates and returns a new KB using the provided Config.
@@ -36,5 +42,35 @@ func New(cfg *Config) (*ES, error) {
 	defer res.Body.Close()
 	fmt.Printf("ES Client:\n%v\n", res)
 
-	return &ES{client}, nil
+	return &ES{
+		client:         client,
+		datacubeIndex:  cfg.DatacubeIndex,
+		runIndex:       cfg.RunIndex,
+		parameterIndex: cfg.ParameterIndex,
+	}, nil
+}
+
+// search runs the search request body on the index and decodes the response into res
+func (es *ES) search(ctx context.Context, index string, body map[string]interface{}, res interface{}) error {
+	op := "ES.search"
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	r, err := es.client.Search(
+		es.client.Search.WithContext(ctx),
+		es.client.Search.WithIndex(index),
+		es.client.Search.WithBody(bytes.NewReader(buf)),
+	)
+	if err != nil {
+		return transportError(ctx, op, err)
+	}
+	defer r.Body.Close()
+	if r.IsError() {
+		return responseError(op, r.StatusCode, read(r.Body))
+	}
+	if err := json.NewDecoder(r.Body).Decode(res); err != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return nil
 }
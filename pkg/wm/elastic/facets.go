@@ -0,0 +1,134 @@
+package elastic
+
+import (
+	"context"
+	"strconv"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// Maximum number of buckets of a term facet
+const termsFacetSize = 500
+
+// histogramIntervals holds the bucket interval of the fields faceted with histograms, the others are faceted by terms
+var histogramIntervals = map[wm.Field]float64{
+	wm.FieldDatacubeConceptScore: 0.1,
+}
+
+// facetsResponse is the part of an ES search response holding the facet aggregations
+type facetsResponse struct {
+	Aggregations map[string]*facetAgg `json:"aggregations"`
+}
+
+type facetAgg struct {
+	Buckets []struct {
+		Key      interface{} `json:"key"`
+		DocCount int         `json:"doc_count"`
+		// Count of the datacubes of the nested documents in the bucket
+		Datacubes *struct {
+			DocCount int `json:"doc_count"`
+		} `json:"datacubes"`
+	} `json:"buckets"`
+	// Aggregation of a nested field
+	Values *facetAgg `json:"values"`
+}
+
+// GetDatacubeFacets returns the facets of the datacubes matching the options for each of the fields
+func (es *ES) GetDatacubeFacets(ctx context.Context, opts wm.DatacubeFacetsOptions) (wm.Facets, error) {
+	op := "ES.GetDatacubeFacets"
+	body, err := buildDatacubeFacetsBody(opts)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	var resBody facetsResponse
+	if err := es.search(ctx, es.datacubeIndex, body, &resBody); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	return parseFacets(opts.Fields, resBody), nil
+}
+
+// buildDatacubeFacetsBody builds the ES search request body counting the matching datacubes for each facet field
+func buildDatacubeFacetsBody(opts wm.DatacubeFacetsOptions) (map[string]interface{}, error) {
+	op := "buildDatacubeFacetsBody"
+	query, err := buildDatacubeQuery(opts.Filters, opts.Search)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	aggs := make(map[string]interface{})
+	for _, field := range opts.Fields {
+		agg, err := buildFacetAgg(field)
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		aggs[facetAggName(field)] = agg
+	}
+	return map[string]interface{}{
+		"query": query,
+		"size":  0,
+		"aggs":  aggs,
+	}, nil
+}
+
+// buildFacetAgg builds the ES aggregation of the field facet. Buckets of nested fields count the datacubes
+// rather than the nested documents.
+func buildFacetAgg(field wm.Field) (map[string]interface{}, error) {
+	op := "buildFacetAgg"
+	fieldName, ok := fieldNames[field]
+	if !ok || isSearchField[field] {
+		return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: "Unsupported facet field"}
+	}
+	var agg map[string]interface{}
+	if interval, ok := histogramIntervals[field]; ok {
+		agg = map[string]interface{}{
+			"histogram": map[string]interface{}{"field": fieldName, "interval": interval, "min_doc_count": 1},
+		}
+	} else {
+		agg = map[string]interface{}{
+			"terms": map[string]interface{}{"field": fieldName, "size": termsFacetSize},
+		}
+	}
+	path := nestedPath[field]
+	if path == "" {
+		return agg, nil
+	}
+	agg["aggs"] = map[string]interface{}{
+		"datacubes": map[string]interface{}{"reverse_nested": map[string]interface{}{}},
+	}
+	return map[string]interface{}{
+		"nested": map[string]interface{}{"path": path},
+		"aggs":   map[string]interface{}{"values": agg},
+	}, nil
+}
+
+// parseFacets converts the facet aggregations of the response
+func parseFacets(fields []wm.Field, res facetsResponse) wm.Facets {
+	facets := make(wm.Facets)
+	for _, field := range fields {
+		agg := res.Aggregations[facetAggName(field)]
+		if agg != nil && agg.Values != nil {
+			agg = agg.Values
+		}
+		facets[field] = []wm.Facet{}
+		if agg == nil {
+			continue
+		}
+		interval, isHistogram := histogramIntervals[field]
+		for _, b := range agg.Buckets {
+			facet := wm.Facet{ID: b.Key, Count: b.DocCount}
+			if b.Datacubes != nil {
+				facet.Count = b.Datacubes.DocCount
+			}
+			if start, ok := b.Key.(float64); ok && isHistogram {
+				end := start + interval
+				facet.StartValue = &start
+				facet.EndValue = &end
+			}
+			facets[field] = append(facets[field], facet)
+		}
+	}
+	return facets
+}
+
+func facetAggName(field wm.Field) string {
+	return "facet_" + strconv.Itoa(int(field))
+}
@@ -0,0 +1,64 @@
+package elastic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestBuildFacetAgg(t *testing.T) {
+	tests := []struct {
+		description string
+		input       wm.Field
+		expect      string
+	}{
+		{
+			"Build a terms facet",
+			wm.FieldDatacubeCountry,
+			`{"terms":{"field":"country","size":500}}`,
+		},
+		{
+			"Build a nested terms facet",
+			wm.FieldDatacubeConceptName,
+			`{"aggs":{"values":{"aggs":{"datacubes":{"reverse_nested":{}}},"terms":{"field":"concepts.name","size":500}}},"nested":{"path":"concepts"}}`,
+		},
+		{
+			"Build a nested histogram facet",
+			wm.FieldDatacubeConceptScore,
+			`{"aggs":{"values":{"aggs":{"datacubes":{"reverse_nested":{}}},"histogram":{"field":"concepts.score","interval":0.1,"min_doc_count":1}}},"nested":{"path":"concepts"}}`,
+		},
+	}
+	for _, test := range tests {
+		agg, err := buildFacetAgg(test.input)
+		require.NoError(t, err, test.description)
+		result, _ := json.Marshal(agg)
+		require.Equal(t, test.expect, string(result), test.description)
+	}
+
+	_, err := buildFacetAgg(wm.FieldDatacubeSearch)
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+}
+
+func TestParseFacets(t *testing.T) {
+	raw := `{"aggregations":{
+		"facet_13":{"buckets":[{"key":"Ethiopia","doc_count":43},{"key":"South Sudan","doc_count":2}]},
+		"facet_12":{"doc_count":30,"values":{"buckets":[{"key":0.5,"doc_count":20,"datacubes":{"doc_count":8}}]}}
+	}}`
+	var res facetsResponse
+	require.NoError(t, json.Unmarshal([]byte(raw), &res))
+
+	start, end := 0.5, 0.6
+	facets := parseFacets([]wm.Field{wm.FieldDatacubeCountry, wm.FieldDatacubeConceptScore, wm.FieldDatacubeSource}, res)
+	require.Equal(t, wm.Facets{
+		wm.FieldDatacubeCountry: {
+			{ID: "Ethiopia", Count: 43},
+			{ID: "South Sudan", Count: 2},
+		},
+		wm.FieldDatacubeConceptScore: {
+			{ID: 0.5, Count: 8, StartValue: &start, EndValue: &end},
+		},
+		wm.FieldDatacubeSource: {},
+	}, facets)
+}
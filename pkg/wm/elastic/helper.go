@@ -2,7 +2,10 @@ package elastic
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
+	"net/http"
 	"text/template"
 
 	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
@@ -26,3 +29,24 @@ func read(r io.Reader) string {
 	b.ReadFrom(r)
 	return b.String()
 }
+
+// transportError returns the error of a request that didn't get a response from ES
+func transportError(ctx context.Context, op string, err error) error {
+	if ctx.Err() != nil {
+		return &wm.Error{Op: op, Err: err}
+	}
+	return &wm.Error{Op: op, Code: wm.EUNAVAILABLE, Message: "Search service is temporarily unavailable", Err: err}
+}
+
+// responseError returns the error of a request that ES responded to with an error status
+func responseError(op string, status int, body string) error {
+	err := fmt.Errorf("elasticsearch responded with status %d: %s", status, body)
+	switch {
+	case status == http.StatusBadRequest:
+		return &wm.Error{Op: op, Code: wm.EINVALID, Message: "Invalid search query", Err: err}
+	case status == http.StatusTooManyRequests || status >= 500:
+		return &wm.Error{Op: op, Code: wm.EUNAVAILABLE, Message: "Search service is temporarily unavailable", Err: err}
+	default:
+		return &wm.Error{Op: op, Err: err}
+	}
+}
@@ -0,0 +1,115 @@
+package elastic
+
+import (
+	"context"
+	"sort"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// Maximum number of parameters of a model
+const maxModelParameters = 1000
+
+// GetModelParameters returns the parameters of the model
+func (es *ES) GetModelParameters(ctx context.Context, modelID string) ([]*wm.ModelParameter, error) {
+	op := "ES.GetModelParameters"
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"model": modelID}},
+				},
+			},
+		},
+		"size": maxModelParameters,
+	}
+	var res struct {
+		Hits struct {
+			Hits []struct {
+				Source *wm.ModelParameter `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := es.search(ctx, es.parameterIndex, body, &res); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	params := make([]*wm.ModelParameter, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		params = append(params, hit.Source)
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params, nil
+}
+
+// GetModelRuns returns the page of the runs of the model matching the search options
+func (es *ES) GetModelRuns(ctx context.Context, modelID string, opts wm.ModelRunSearchOptions) (*wm.ModelRunSearchResult, error) {
+	op := "ES.GetModelRuns"
+	var res struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Source *wm.ModelRun `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := es.search(ctx, es.runIndex, buildModelRunSearchBody(modelID, opts), &res); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	result := &wm.ModelRunSearchResult{
+		Total: res.Hits.Total.Value,
+		Runs:  make([]*wm.ModelRun, 0, len(res.Hits.Hits)),
+	}
+	for _, hit := range res.Hits.Hits {
+		result.Runs = append(result.Runs, hit.Source)
+	}
+	return result, nil
+}
+
+// buildModelRunSearchBody builds the ES search request body for the runs of the model matching the options.
+// Each parameter filter matches the runs having a nested parameter with the name and any of the values.
+func buildModelRunSearchBody(modelID string, opts wm.ModelRunSearchOptions) map[string]interface{} {
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"model": modelID}},
+	}
+	if opts.Status != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"status": opts.Status}})
+	}
+	// Sort the names for a deterministic query
+	names := make([]string, 0, len(opts.Parameters))
+	for name := range opts.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		filters = append(filters, map[string]interface{}{
+			"nested": map[string]interface{}{
+				"path": "parameters",
+				"query": map[string]interface{}{
+					"bool": map[string]interface{}{
+						"filter": []interface{}{
+							map[string]interface{}{"term": map[string]interface{}{"parameters.name": name}},
+							map[string]interface{}{"terms": map[string]interface{}{"parameters.value": opts.Parameters[name]}},
+						},
+					},
+				},
+			},
+		})
+	}
+	order := opts.Order
+	if order == "" {
+		order = wm.SortOrderDesc
+	}
+	return map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": filters},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"timestamp": map[string]interface{}{"order": order}},
+		},
+		"from":             opts.Offset,
+		"size":             opts.Limit,
+		"track_total_hits": true,
+	}
+}
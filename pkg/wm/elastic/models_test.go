@@ -0,0 +1,42 @@
+package elastic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestBuildModelRunSearchBody(t *testing.T) {
+	tests := []struct {
+		description string
+		input       wm.ModelRunSearchOptions
+		expect      string
+	}{
+		{
+			"Build a search for the newest runs of the model",
+			wm.ModelRunSearchOptions{Limit: 10},
+			`{"from":0,"query":{"bool":{"filter":[{"term":{"model":"DSSAT"}}]}},"size":10,"sort":[{"timestamp":{"order":"desc"}}],"track_total_hits":true}`,
+		},
+		{
+			"Build a search filtering the runs by status and parameter values",
+			wm.ModelRunSearchOptions{
+				Parameters: map[string][]string{"rainfall": {"1", "1.5"}, "crop": {"teff"}},
+				Status:     "SUCCESS",
+				Order:      wm.SortOrderAsc,
+				Offset:     10,
+				Limit:      10,
+			},
+			`{"from":10,"query":{"bool":{"filter":[{"term":{"model":"DSSAT"}},{"term":{"status":"SUCCESS"}},` +
+				`{"nested":{"path":"parameters","query":{"bool":{"filter":[{"term":{"parameters.name":"crop"}},{"terms":{"parameters.value":["teff"]}}]}}}},` +
+				`{"nested":{"path":"parameters","query":{"bool":{"filter":[{"term":{"parameters.name":"rainfall"}},{"terms":{"parameters.value":["1","1.5"]}}]}}}}]}},` +
+				`"size":10,"sort":[{"timestamp":{"order":"asc"}}],"track_total_hits":true}`,
+		},
+	}
+	for _, test := range tests {
+		result, err := json.Marshal(buildModelRunSearchBody("DSSAT", test.input))
+		require.NoError(t, err)
+		require.Equal(t, test.expect, string(result), test.description)
+	}
+}
@@ -74,9 +74,6 @@ func buildClause(filter *wm.Filter) (map[string]interface{}, error) {
 		return nil, &wm.Error{Op: op, Message: "Unrecognized field"}
 	}
 	var queries []interface{}
-	if filter.IsNot {
-		return nil, &wm.Error{Op: op, Message: "Not yet Implemented"}
-	}
 	if filter.StringValues != nil {
 		// Build terms
 		for _, value := range filter.StringValues {
@@ -85,7 +82,11 @@ func buildClause(filter *wm.Filter) (map[string]interface{}, error) {
 			})
 		}
 	} else if filter.IntValues != nil {
-		return nil, &wm.Error{Op: op, Message: "Not yet Implemented"}
+		for _, value := range filter.IntValues {
+			queries = append(queries, map[string]interface{}{
+				"term": map[string]interface{}{fieldName: value},
+			})
+		}
 	} else {
 		// Build range
 		lt := "lt"
@@ -104,9 +105,21 @@ func buildClause(filter *wm.Filter) (map[string]interface{}, error) {
 			clauseType: queries,
 		},
 	}
+	if filter.IsNot {
+		return negate(f), nil
+	}
 	return f, nil
 }
 
+// negate wraps the clause in a must_not clause
+func negate(clause map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must_not": []interface{}{clause},
+		},
+	}
+}
+
 // buildNestedFilter builds ES nested filter query with given filters.
 // Provided filters must have fields with same parent field
 func buildNestedClause(path string, filters []*wm.Filter) (map[string]interface{}, error) {
@@ -149,9 +162,13 @@ func buildQueryClauses(filters []*wm.Filter) ([]interface{}, error) {
 	nested := make(map[string][]*wm.Filter)
 	var normals []*wm.Filter
 
+	var negatedNested []*wm.Filter
+
 	for _, filter := range filters {
 		path := nestedPath[filter.Field]
-		if path != "" {
+		if path != "" && filter.IsNot {
+			negatedNested = append(negatedNested, filter)
+		} else if path != "" {
 			nested[path] = append(nested[path], filter)
 		} else {
 			normals = append(normals, filter)
@@ -170,6 +187,18 @@ func buildQueryClauses(filters []*wm.Filter) ([]interface{}, error) {
 		}
 		results = append(results, nestedFilter)
 	}
+
+	// A negated nested filter excludes the documents having any matching nested object, so the negation
+	// goes outside of the nested query. Negating inside would match documents having any non matching one.
+	for _, filter := range negatedNested {
+		positive := *filter
+		positive.IsNot = false
+		nestedFilter, err := buildNestedClause(nestedPath[filter.Field], []*wm.Filter{&positive})
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		results = append(results, negate(nestedFilter))
+	}
 	return results, nil
 }
 
@@ -48,6 +48,25 @@ func TestBuildClause(t *testing.T) {
 			},
 			`{"bool":{"must":[{"range":{"period":{"gte":0,"lte":3}}}]}}`,
 		},
+		{
+			"Build a negated filter",
+			&wm.Filter{
+				Field:        wm.FieldDatacubeCountry,
+				StringValues: []string{"Ethiopia"},
+				Operand:      wm.OperandOr,
+				IsNot:        true,
+			},
+			`{"bool":{"must_not":[{"bool":{"should":[{"term":{"country":"Ethiopia"}}]}}]}}`,
+		},
+		{
+			"Build a filter with integer values",
+			&wm.Filter{
+				Field:     wm.FieldDatacubePeriod,
+				IntValues: []int{2019, 2020},
+				Operand:   wm.OperandOr,
+			},
+			`{"bool":{"should":[{"term":{"period":2019}},{"term":{"period":2020}}]}}`,
+		},
 	}
 	for _, test := range tests {
 		f, _ := buildClause(test.input)
@@ -197,6 +216,20 @@ func TestBuildQuery(t *testing.T) {
 			},
 			`{"bool":{"filter":[{"bool":{"should":[{"term":{"id":"id1"}},{"term":{"id":"id2"}}]}},{"bool":{"must":[{"range":{"period":{"gte":0.1,"lte":0.3}}}]}}],"minimum_should_match":1,"should":[{"match":{"f1":"testSearchTerm"}},{"match":{"f2":"testSearchTerm"}},{"match":{"f3":"testSearchTerm"}}]}}`,
 		},
+		{
+			"Build a query with a negated nested filter",
+			queryOptions{
+				filters: []*wm.Filter{
+					{
+						Field:        wm.FieldDatacubeConceptName,
+						StringValues: []string{"c1"},
+						Operand:      wm.OperandOr,
+						IsNot:        true,
+					},
+				},
+			},
+			`{"bool":{"filter":[{"bool":{"must_not":[{"nested":{"path":"concepts","query":{"bool":{"filter":[{"bool":{"should":[{"term":{"concepts.name":"c1"}}]}}]}}}}]}}]}}`,
+		},
 	}
 	for _, test := range tests {
 		f, _ := buildQuery(test.input)
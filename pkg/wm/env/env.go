@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -14,15 +15,56 @@ type Specification struct {
 	Addr string `default:":4200"`
 	Mode string `default:"dev"`
 
-	AwsS3Id     string `required:"true" envconfig:"AWS_S3_ID"`
-	AwsS3Secret string `required:"true" envconfig:"AWS_S3_SECRET"`
-	AwsS3Token  string `required:"true" envconfig:"AWS_S3_TOKEN"`
-	AwsS3URL    string `required:"true" envconfig:"AWS_S3_URL"`
+	// DatacubeBackend is either "elastic" or "memory". The memory backend loads the datacubes of the JSON files
+	// of DatacubeDir. The endpoints served by elasticsearch are disabled if ElasticURL is empty
+	DatacubeBackend       string `default:"elastic" envconfig:"DATACUBE_BACKEND"`
+	DatacubeDir           string `envconfig:"DATACUBE_DIR"`
+	ElasticURL            string `envconfig:"ELASTIC_URL"`
+	ElasticDatacubeIndex  string `default:"data-datacube" envconfig:"ELASTIC_DATACUBE_INDEX"`
+	ElasticRunIndex       string `default:"data-model-run" envconfig:"ELASTIC_RUN_INDEX"`
+	ElasticParameterIndex string `default:"data-model-parameter" envconfig:"ELASTIC_PARAMETER_INDEX"`
+
+	// StorageBackend is either "s3" or "local"
+	StorageBackend  string `default:"s3" envconfig:"STORAGE_BACKEND"`
+	LocalStorageDir string `envconfig:"LOCAL_STORAGE_DIR"`
+
+	// AWS settings are only required by the "s3" storage backend
+	AwsS3Id     string `envconfig:"AWS_S3_ID"`
+	AwsS3Secret string `envconfig:"AWS_S3_SECRET"`
+	AwsS3Token  string `envconfig:"AWS_S3_TOKEN"`
+	AwsS3URL    string `envconfig:"AWS_S3_URL"`
 
 	OutputBucket          string `default:"tiles-v3" envconfig:"TILE_OUTPUT_BUCKET"`
 	VectorTileBucket      string `default:"vector-tiles" envconfig:"VECTORTILE_BUCKET"`
 	ModelOutputBucket     string `default:"new-models" envconfig:"MODELS_BUCKET"`
 	IndicatorOutputBucket string `default:"new-indicators" envconfig:"INDICATORS_BUCKET"`
+
+	// In memory cache of storage objects and parsed results. CacheBuckets limits caching to the listed buckets
+	CacheEnabled  bool          `default:"true" envconfig:"CACHE_ENABLED"`
+	CacheMaxBytes int64         `default:"268435456" envconfig:"CACHE_MAX_BYTES"`
+	CacheTTL      time.Duration `default:"10m" envconfig:"CACHE_TTL"`
+	CacheBuckets  []string      `envconfig:"CACHE_BUCKETS"`
+
+	// StorageMaxConcurrency limits the concurrent storage requests of the whole service,
+	// RequestMaxConcurrency limits the files fetched concurrently on behalf of a single request
+	StorageMaxConcurrency int `default:"64" envconfig:"STORAGE_MAX_CONCURRENCY"`
+	RequestMaxConcurrency int `default:"16" envconfig:"REQUEST_MAX_CONCURRENCY"`
+
+	// Retries of storage requests failing with transient errors. The breaker fails requests fast for
+	// StorageBreakerCooldown once StorageBreakerThreshold attempts failed in a row, 0 disables it
+	StorageRetryAttempts    int           `default:"3" envconfig:"STORAGE_RETRY_ATTEMPTS"`
+	StorageRetryBaseDelay   time.Duration `default:"100ms" envconfig:"STORAGE_RETRY_BASE_DELAY"`
+	StorageRetryMaxDelay    time.Duration `default:"2s" envconfig:"STORAGE_RETRY_MAX_DELAY"`
+	StorageBreakerThreshold int           `default:"10" envconfig:"STORAGE_BREAKER_THRESHOLD"`
+	StorageBreakerCooldown  time.Duration `default:"30s" envconfig:"STORAGE_BREAKER_COOLDOWN"`
+
+	// Population output of the per capita transforms, with yearly data. Its available years are cached for
+	// PopulationCacheTTL, 0 caches them until restart
+	PopulationDataID      string        `default:"430d621b-c4cd-4cb2-8d21-1c590522602c" envconfig:"POPULATION_DATA_ID"`
+	PopulationRunID       string        `default:"indicator" envconfig:"POPULATION_RUN_ID"`
+	PopulationFeature     string        `default:"Population Count" envconfig:"POPULATION_FEATURE"`
+	PopulationInterpolate bool          `default:"false" envconfig:"POPULATION_INTERPOLATE"`
+	PopulationCacheTTL    time.Duration `default:"24h" envconfig:"POPULATION_CACHE_TTL"`
 }
 
 // Load imports the environment variables and returns them in an Specification.
@@ -42,6 +84,9 @@ func Load(envFile string) (*Specification, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error processing environment config: %v", err)
 	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
 
 	settings, err := json.MarshalIndent(s, "", "    ")
 	if err != nil {
@@ -51,3 +96,35 @@ func Load(envFile string) (*Specification, error) {
 
 	return &s, err
 }
+
+// validate checks the settings required by the selected backends.
+func (s *Specification) validate() error {
+	switch s.StorageBackend {
+	case "s3":
+		if s.AwsS3URL == "" || s.AwsS3Id == "" || s.AwsS3Secret == "" {
+			return fmt.Errorf("AWS_S3_URL, AWS_S3_ID and AWS_S3_SECRET are required for the s3 storage backend")
+		}
+	case "local":
+		if s.LocalStorageDir == "" {
+			return fmt.Errorf("LOCAL_STORAGE_DIR is required for the local storage backend")
+		}
+	default:
+		return fmt.Errorf("invalid storage backend: %s", s.StorageBackend)
+	}
+	switch s.DatacubeBackend {
+	case "elastic":
+	case "memory":
+		if s.DatacubeDir == "" {
+			return fmt.Errorf("DATACUBE_DIR is required for the memory datacube backend")
+		}
+	default:
+		return fmt.Errorf("invalid datacube backend: %s", s.DatacubeBackend)
+	}
+	if s.StorageMaxConcurrency <= 0 || s.RequestMaxConcurrency <= 0 {
+		return fmt.Errorf("STORAGE_MAX_CONCURRENCY and REQUEST_MAX_CONCURRENCY must be positive")
+	}
+	if s.StorageRetryAttempts <= 0 {
+		return fmt.Errorf("STORAGE_RETRY_ATTEMPTS must be positive")
+	}
+	return nil
+}
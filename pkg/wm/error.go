@@ -9,10 +9,11 @@ import (
 
 // Defines application error codes.
 const (
-	ECONFLICT = "conflict"  // action cannot be performed
-	EINTERNAL = "internal"  // internal error
-	EINVALID  = "invalid"   // validation failed
-	ENOTFOUND = "not_found" // entity does not exist
+	ECONFLICT    = "conflict"    // action cannot be performed
+	EINTERNAL    = "internal"    // internal error
+	EINVALID     = "invalid"     // validation failed
+	ENOTFOUND    = "not_found"   // entity does not exist
+	EUNAVAILABLE = "unavailable" // dependency is temporarily unavailable
 )
 
 // Error defines a standard application error.
@@ -1,5 +1,7 @@
 package wm
 
+import "context"
+
 // TemporalResolution defines the temporal resolution type
 type TemporalResolution string
 
@@ -58,7 +60,17 @@ type FullTimeseriesParams struct {
 	DatacubeParams
 	RegionID  string    `json:"region_id"`
 	Transform Transform `json:"transform"`
-	Key       string    `json:"key"`
+	// Window is the number of periods of the rolling transforms
+	Window int `json:"window"`
+	// BaselineStart and BaselineEnd are the epoch milliseconds bounds, inclusive, of the period of the baseline index transform
+	BaselineStart int64  `json:"baseline_start"`
+	BaselineEnd   int64  `json:"baseline_end"`
+	Key           string `json:"key"`
+	// Denominator, Alignment and ScaleFactor configure the ratio transform. Unset fields of the denominator default to
+	// the params of the timeseries
+	Denominator *DatacubeParams   `json:"denominator"`
+	Alignment   TemporalAlignment `json:"alignment"`
+	ScaleFactor float64           `json:"scale_factor"`
 }
 
 // RegionListParams represent parameters needed to fetch region lists representing the hierarchy
@@ -116,6 +128,37 @@ type ModelOutputRawDataPoint struct {
 	Qualifiers map[string]string `json:"qualifiers"`
 }
 
+// RawDataFilter restricts raw data points to the ones matching all of its set fields
+type RawDataFilter struct {
+	// StartTime and EndTime are the inclusive bounds of the timestamps
+	StartTime *int64
+	EndTime   *int64
+	// Country, Admin1, Admin2 and Admin3 list the accepted region names at each admin level
+	Country []string
+	Admin1  []string
+	Admin2  []string
+	Admin3  []string
+	// Bound is the inclusive bounding box of the points, points without coordinates are excluded
+	Bound *Bound
+	// Qualifiers lists the accepted values of qualifiers
+	Qualifiers map[string][]string
+	// MinValue and MaxValue are the inclusive bounds of the values, points without a value are excluded
+	MinValue *float64
+	MaxValue *float64
+}
+
+// RawDataOptions defines a page of raw data points
+type RawDataOptions struct {
+	Filter RawDataFilter
+	// Cursor is the position of the first point of the page, as returned for the previous page. The page starts at
+	// the first point if empty.
+	Cursor string
+	// Offset is the number of points to skip from the cursor
+	Offset int
+	// Limit is the maximum number of points of the page, there is no limit if it is zero
+	Limit int
+}
+
 // ModelOutputQualifierTimeseries represent a timeseries for one qualifier value
 type ModelOutputQualifierTimeseries struct {
 	Name       string             `json:"name"`
@@ -126,12 +169,14 @@ type ModelOutputQualifierTimeseries struct {
 type ModelOutputKeyedTimeSeries struct {
 	Key        string             `json:"key"`
 	Timeseries []*TimeseriesValue `json:"timeseries"`
+	Error      string             `json:"error,omitempty"`
 }
 
 // ModelOutputRegionalTimeSeries holds regional time series values
 type ModelOutputRegionalTimeSeries struct {
 	RegionID   string             `json:"region_id"`
 	Timeseries []*TimeseriesValue `json:"timeseries"`
+	Error      string             `json:"error,omitempty"`
 }
 
 // ModelOutputRegionQualifierBreakdown represent a list of qualifier breakdown values for a specific region
@@ -214,6 +259,7 @@ type ModelOutputBulkAggregateRegionalAdmins struct {
 type ModelOutputBulkRegionalAdmins struct {
 	Timestamp                  string `json:"timestamp"`
 	*ModelOutputRegionalAdmins `json:"data"`
+	Error                      string `json:"error,omitempty"`
 }
 
 // ModelOutputRegional represent regional data for one or more admin levels. Each admin level field is optional.
@@ -250,89 +296,162 @@ const (
 	TransformPerCapita1K   Transform = "percapita1k"
 	TransformPerCapita1M   Transform = "percapita1m"
 	TransformNormalization Transform = "normalization"
+	TransformRollingMean   Transform = "rolling_mean"
+	TransformRollingSum    Transform = "rolling_sum"
+	TransformCumulativeSum Transform = "cumsum"
+	TransformPctChange     Transform = "pct_change"
+	TransformYoYPctChange  Transform = "yoy_pct_change"
+	// TransformBaselineIndex expresses values as a percentage of their mean over the baseline period
+	TransformBaselineIndex Transform = "baseline_index"
+	// TransformZScore standardizes values against the history of their timeseries or region
+	TransformZScore Transform = "zscore"
+	// TransformRegionalZScore standardizes values against the values of all the regions of the admin level at the
+	// same timestamp
+	TransformRegionalZScore Transform = "regional_zscore"
+	// TransformRatio divides values by the values of a denominator datacube
+	TransformRatio Transform = "ratio"
 )
 
+// TemporalAlignment is how the denominator of a ratio is aligned with the timestamps of the data
+type TemporalAlignment string
+
+// Available temporal alignments
+const (
+	// AlignLatest uses the latest denominator up to the timestamp, or the first one for timestamps before all of them
+	AlignLatest TemporalAlignment = "latest"
+	// AlignInterpolate linearly interpolates the denominator between its timestamps
+	AlignInterpolate TemporalAlignment = "interpolate"
+	// AlignExact only uses the denominator at the same timestamp
+	AlignExact TemporalAlignment = "exact"
+)
+
+// IsTimeseries returns whether the transform only applies to timeseries, and not to regional data at one timestamp
+func (t Transform) IsTimeseries() bool {
+	switch t {
+	case TransformRollingMean, TransformRollingSum, TransformCumulativeSum, TransformPctChange, TransformYoYPctChange:
+		return true
+	}
+	return false
+}
+
+// SupportsGlobal returns whether the transform applies to the global timeseries, which isn't the timeseries of a region
+func (t Transform) SupportsGlobal() bool {
+	return t.IsTimeseries() || t == TransformBaselineIndex || t == TransformZScore
+}
+
 // TransformConfig defines transform configuration
 type TransformConfig struct {
 	Transform      Transform       `json:"transform"`
 	RegionID       string          `json:"region_id"`
 	ScaleFactor    float64         `json:"scale_factor"`
+	Window         int             `json:"window"`
+	BaselineStart  int64           `json:"baseline_start"`
+	BaselineEnd    int64           `json:"baseline_end"`
 	DatacubeParams *DatacubeParams `json:"datacube_params"`
+	// Denominator and Alignment are the datacube of the ratio transform and how it is aligned with the data
+	Denominator *DatacubeParams   `json:"denominator"`
+	Alignment   TemporalAlignment `json:"alignment"`
 }
 
 // DataOutput defines the methods that output database implementation needs to satisfy
 type DataOutput interface {
 	// GetTile returns mapbox vector tile
-	GetTile(zoom, x, y uint32, specs GridTileOutputSpecs, expression string) (*Tile, error)
+	GetTile(ctx context.Context, zoom, x, y uint32, specs GridTileOutputSpecs, expression string) (*Tile, error)
 
 	// GetOutputStats returns datacube output stats
-	GetOutputStats(params DatacubeParams, timestamp string) ([]*OutputStatWithZoom, error)
+	GetOutputStats(ctx context.Context, params DatacubeParams, timestamp string) ([]*OutputStatWithZoom, error)
 
 	// GetRegionalOutputStats returns regional output statistics
-	GetRegionalOutputStats(params DatacubeParams) (*ModelRegionalOutputStat, error)
+	GetRegionalOutputStats(ctx context.Context, params DatacubeParams) (*ModelRegionalOutputStat, error)
 
 	// GetOutputTimeseries returns datacube output timeseries
-	GetOutputTimeseries(params DatacubeParams) ([]*TimeseriesValue, error)
+	GetOutputTimeseries(ctx context.Context, params DatacubeParams) ([]*TimeseriesValue, error)
 
 	// GetOutputExtrema returns extrema json
-	GetOutputExtrema(params DatacubeParams) (*RegionalExtremaSelected, error)
+	GetOutputExtrema(ctx context.Context, params DatacubeParams) (*RegionalExtremaSelected, error)
 
 	// GetOutputSparkline returns datacube output sparkline
-	GetOutputSparkline(params DatacubeParams, rawRes TemporalResolution, rawLatestTimestamp int64) ([]float64, error)
+	GetOutputSparkline(ctx context.Context, params DatacubeParams, rawRes TemporalResolution, rawLatestTimestamp int64) ([]float64, error)
 
 	// GetOutputTimeseriesByRegion returns timeseries data for a specific region
-	GetOutputTimeseriesByRegion(params DatacubeParams, regionID string) ([]*TimeseriesValue, error)
+	GetOutputTimeseriesByRegion(ctx context.Context, params DatacubeParams, regionID string) ([]*TimeseriesValue, error)
 
 	// GetRegionAggregation returns regional data for ALL admin regions at ONE timestamp
-	GetRegionAggregation(params DatacubeParams, timestamp string) (*ModelOutputRegionalAdmins, error)
+	GetRegionAggregation(ctx context.Context, params DatacubeParams, timestamp string) (*ModelOutputRegionalAdmins, error)
 
 	// GetRegionAggregation returns regional data for ALL admin regions at ONE timestamp
-	GetRegionAggregationByAdminLevel(params DatacubeParams, timestamp string, adminLevel AdminLevel) (*ModelOutputRegional, error)
+	GetRegionAggregationByAdminLevel(ctx context.Context, params DatacubeParams, timestamp string, adminLevel AdminLevel) (*ModelOutputRegional, error)
+
+	// GetRawData returns datacube raw data matching the filter
+	GetRawData(ctx context.Context, params DatacubeParams, filter RawDataFilter) ([]*ModelOutputRawDataPoint, error)
 
-	// GetRawData returns datacube raw data
-	GetRawData(params DatacubeParams) ([]*ModelOutputRawDataPoint, error)
+	// GetRawDataQualifiers returns the names of the qualifier columns of the datacube raw data
+	GetRawDataQualifiers(ctx context.Context, params DatacubeParams) ([]string, error)
+
+	// StreamRawData calls fn with each datacube raw data point of the page matching the filter as it is decoded,
+	// and returns the cursor of the next page, or an empty cursor if it was the last one
+	StreamRawData(ctx context.Context, params DatacubeParams, opts RawDataOptions, fn func(point *ModelOutputRawDataPoint) error) (string, error)
 
 	// GetRegionLists returns region hierarchies in list form
-	GetRegionLists(params RegionListParams) (*RegionListOutput, error)
+	GetRegionLists(ctx context.Context, params RegionListParams) (*RegionListOutput, error)
 
 	// GetQualifierCounts returns region hierarchy output
-	GetQualifierCounts(params QualifierInfoParams) (*QualifierCountsOutput, error)
+	GetQualifierCounts(ctx context.Context, params QualifierInfoParams) (*QualifierCountsOutput, error)
 
 	// GetQualifierLists returns region hierarchy output
-	GetQualifierLists(params QualifierInfoParams, qualifiers []string) (*QualifierListsOutput, error)
+	GetQualifierLists(ctx context.Context, params QualifierInfoParams, qualifiers []string) (*QualifierListsOutput, error)
+
+	// GetRuns returns the run ids of the datacube
+	GetRuns(ctx context.Context, params DatacubeParams) ([]string, error)
+
+	// GetResolutions returns the temporal resolutions available for the datacube run
+	GetResolutions(ctx context.Context, params DatacubeParams) ([]string, error)
+
+	// GetFeatures returns the features of the datacube run
+	GetFeatures(ctx context.Context, params DatacubeParams) ([]string, error)
+
+	// GetAggregations returns the spatial and temporal aggregation combinations available for the feature
+	GetAggregations(ctx context.Context, params DatacubeParams) ([]string, error)
+
+	// GetTimestamps returns the timestamps of the feature output, either with regional data at the admin level or of the global timeseries
+	GetTimestamps(ctx context.Context, params DatacubeParams) ([]int64, error)
 
 	// GetPipelineResults returns the pipeline results file
-	GetPipelineResults(params PipelineResultsParams) (*PipelineResultsOutput, error)
+	GetPipelineResults(ctx context.Context, params PipelineResultsParams) (*PipelineResultsOutput, error)
 
 	// GetQualifierTimeseries returns datacube output timeseries broken down by qualifiers
-	GetQualifierTimeseries(params DatacubeParams, qualifier string, qualifierOptions []string) ([]*ModelOutputQualifierTimeseries, error)
+	GetQualifierTimeseries(ctx context.Context, params DatacubeParams, qualifier string, qualifierOptions []string) ([]*ModelOutputQualifierTimeseries, error)
 
 	// GetQualifierTimeseriesByRegion returns datacube output timeseries broken down by qualifiers for a specific region
-	GetQualifierTimeseriesByRegion(params DatacubeParams, qualifier string, qualifierOptions []string, regionID string) ([]*ModelOutputQualifierTimeseries, error)
+	GetQualifierTimeseriesByRegion(ctx context.Context, params DatacubeParams, qualifier string, qualifierOptions []string, regionID string) ([]*ModelOutputQualifierTimeseries, error)
 
 	// GetQualifierData returns datacube output data broken down by qualifiers for ONE timestamp
-	GetQualifierData(params DatacubeParams, timestamp string, qualifiers []string) ([]*ModelOutputQualifierBreakdown, error)
+	GetQualifierData(ctx context.Context, params DatacubeParams, timestamp string, qualifiers []string) ([]*ModelOutputQualifierBreakdown, error)
 
 	// GetQualifierRegional returns datacube output data broken down by qualifiers for ONE timestamp
-	GetQualifierRegional(params DatacubeParams, timestamp string, qualifier string) (*ModelOutputRegionalQualifiers, error)
+	GetQualifierRegional(ctx context.Context, params DatacubeParams, timestamp string, qualifier string) (*ModelOutputRegionalQualifiers, error)
+
+	// GetPopulationTimeseries returns the population of the region at each of the timestamps, or ENOTFOUND if the region
+	// has no population data
+	GetPopulationTimeseries(ctx context.Context, regionID string, timestamps []int64) ([]*TimeseriesValue, error)
 
 	// TransformOutputTimeseriesByRegion returns transformed timeseries data
-	TransformOutputTimeseriesByRegion(timeseries []*TimeseriesValue, config TransformConfig) ([]*TimeseriesValue, error)
+	TransformOutputTimeseriesByRegion(ctx context.Context, timeseries []*TimeseriesValue, config TransformConfig) ([]*TimeseriesValue, error)
 
 	// TransformRegionAggregation returns transformed regional data for ALL admin regions at ONE timestamp
-	TransformRegionAggregation(data *ModelOutputRegionalAdmins, timestamp string, config TransformConfig) (*ModelOutputRegionalAdmins, error)
+	TransformRegionAggregation(ctx context.Context, data *ModelOutputRegionalAdmins, timestamp string, config TransformConfig) (*ModelOutputRegionalAdmins, error)
 
 	// TransformOutputQualifierTimeseriesByRegion returns transformed qualifier timeseries data
-	TransformOutputQualifierTimeseriesByRegion(data []*ModelOutputQualifierTimeseries, config TransformConfig) ([]*ModelOutputQualifierTimeseries, error)
+	TransformOutputQualifierTimeseriesByRegion(ctx context.Context, data []*ModelOutputQualifierTimeseries, config TransformConfig) ([]*ModelOutputQualifierTimeseries, error)
 
 	// TransformQualifierRegional returns transformed qualifier regional data for ALL admin regions at ONE timestamp
-	TransformQualifierRegional(data *ModelOutputRegionalQualifiers, timestamp string, config TransformConfig) (*ModelOutputRegionalQualifiers, error)
+	TransformQualifierRegional(ctx context.Context, data *ModelOutputRegionalQualifiers, timestamp string, config TransformConfig) (*ModelOutputRegionalQualifiers, error)
 
 	// TransformRegionAggregationByAdminLevel returns transformed regional data for given admin level at given timestamp
-	TransformRegionAggregationByAdminLevel(data *ModelOutputRegional, config TransformConfig) (*ModelOutputRegional, error)
+	TransformRegionAggregationByAdminLevel(ctx context.Context, data *ModelOutputRegional, config TransformConfig) (*ModelOutputRegional, error)
 }
 
 // VectorTile defines methods that tile storage/database needs to satisfy
 type VectorTile interface {
-	GetVectorTile(zoom, x, y uint32, tilesetName string) ([]byte, error)
+	GetVectorTile(ctx context.Context, zoom, x, y uint32, tilesetName string) ([]byte, error)
 }
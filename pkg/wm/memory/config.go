@@ -0,0 +1,19 @@
+package memory
+
+import "gitlab.uncharted.software/WM/wm-go/pkg/wm"
+
+// Config defines the parameters needed to instantiate an in-memory datacube search.
+type Config struct {
+	// Dir is the directory of the JSON files holding the datacube documents. A file holds either
+	// documents, arrays of documents or a mix of both, one after the other.
+	Dir string
+}
+
+// init validates the config.
+func (cfg *Config) init() error {
+	op := "Config.init"
+	if cfg.Dir == "" {
+		return &wm.Error{Op: op, Message: "Dir cannot be empty"}
+	}
+	return nil
+}
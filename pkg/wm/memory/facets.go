@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// Maximum number of buckets of a term facet
+const termsFacetSize = 500
+
+// histogramIntervals holds the bucket interval of the fields faceted with histograms, the others are faceted by terms
+var histogramIntervals = map[wm.Field]float64{
+	wm.FieldDatacubeConceptScore: 0.1,
+}
+
+// GetDatacubeFacets returns the facets of the datacubes matching the options for each of the fields.
+// Like the ES facets, the buckets count datacubes, even for nested fields.
+func (s *Search) GetDatacubeFacets(ctx context.Context, opts wm.DatacubeFacetsOptions) (wm.Facets, error) {
+	op := "Search.GetDatacubeFacets"
+	for _, field := range opts.Fields {
+		if _, ok := fieldNames[field]; !ok || field == wm.FieldDatacubeSearch {
+			return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: "Unsupported facet field"}
+		}
+	}
+	matches, err := s.match(opts.Filters, opts.Search)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+
+	facets := make(wm.Facets)
+	for _, field := range opts.Fields {
+		interval, isHistogram := histogramIntervals[field]
+		counts := make(map[interface{}]int)
+		for _, m := range matches {
+			keys := make(map[interface{}]bool)
+			for _, v := range values(map[string]interface{}(*s.datacubes[m.index]), fieldNames[field]) {
+				switch val := v.(type) {
+				case string, bool:
+					if !isHistogram {
+						keys[val] = true
+					}
+				case float64:
+					if isHistogram {
+						keys[math.Floor(val/interval)*interval] = true
+					} else {
+						keys[val] = true
+					}
+				}
+			}
+			for k := range keys {
+				counts[k]++
+			}
+		}
+
+		buckets := make([]wm.Facet, 0, len(counts))
+		for k, count := range counts {
+			facet := wm.Facet{ID: k, Count: count}
+			if isHistogram {
+				start := k.(float64)
+				end := start + interval
+				facet.StartValue = &start
+				facet.EndValue = &end
+			}
+			buckets = append(buckets, facet)
+		}
+		if isHistogram {
+			sort.Slice(buckets, func(i, j int) bool { return compare(buckets[i].ID, buckets[j].ID) < 0 })
+		} else {
+			// Like ES terms aggregations, by descending count then by key
+			sort.Slice(buckets, func(i, j int) bool {
+				if buckets[i].Count != buckets[j].Count {
+					return buckets[i].Count > buckets[j].Count
+				}
+				return compare(buckets[i].ID, buckets[j].ID) < 0
+			})
+			if len(buckets) > termsFacetSize {
+				buckets = buckets[:termsFacetSize]
+			}
+		}
+		facets[field] = buckets
+	}
+	return facets, nil
+}
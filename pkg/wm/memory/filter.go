@@ -0,0 +1,337 @@
+package memory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// fieldNames is a filterable field type to document field name mapping, the same as the ES one
+var fieldNames = map[wm.Field]string{
+	wm.FieldDatacubeID:           "id",
+	wm.FieldDatacubeType:         "type",
+	wm.FieldDatacubeModel:        "model",
+	wm.FieldDatacubeModelID:      "model_id",
+	wm.FieldDatacubeCategory:     "category",
+	wm.FieldDatacubeLabel:        "label",
+	wm.FieldDatacubeMaintainer:   "maintainer",
+	wm.FieldDatacubeSource:       "source",
+	wm.FieldDatacubeOutputName:   "output_name",
+	wm.FieldDatacubeOutputUnits:  "output_units",
+	wm.FieldDatacubeParameters:   "parameters",
+	wm.FieldDatacubeConceptName:  "concepts.name",
+	wm.FieldDatacubeConceptScore: "concepts.score",
+	wm.FieldDatacubeCountry:      "country",
+	wm.FieldDatacubeAdmin1:       "admin1",
+	wm.FieldDatacubeAdmin2:       "admin2",
+	wm.FieldDatacubePeriod:       "period",
+	wm.FieldDatacubeVariable:     "variable",
+	wm.FieldDatacubeSearch:       "_search",
+}
+
+const (
+	conceptsPath = "concepts"
+)
+
+// Available nested fields and its path mapping
+var nestedPath = map[wm.Field]string{
+	wm.FieldDatacubeConceptName:  conceptsPath,
+	wm.FieldDatacubeConceptScore: conceptsPath,
+}
+
+// matchDatacube returns whether the datacube at index i matches all the filters, and its relevance score.
+// Like in ES, the non negated filters of the same nested path must all match the same nested object.
+func (s *Search) matchDatacube(i int, doc map[string]interface{}, filters []*wm.Filter) (int, bool) {
+	score := 0
+	nested := make(map[string][]*wm.Filter)
+	for _, filter := range filters {
+		path := nestedPath[filter.Field]
+		if path != "" && !filter.IsNot {
+			nested[path] = append(nested[path], filter)
+			continue
+		}
+		var ok bool
+		if path != "" {
+			ok = !matchNested(doc, path, []*wm.Filter{filter})
+		} else if filter.Field == wm.FieldDatacubeSearch {
+			var filterScore int
+			filterScore, ok = s.matchText(i, filter)
+			if filter.IsNot {
+				ok = !ok
+			} else {
+				score += filterScore
+			}
+		} else {
+			ok = matchFilter(doc, fieldNames[filter.Field], filter) != filter.IsNot
+		}
+		if !ok {
+			return 0, false
+		}
+	}
+	for path, fs := range nested {
+		if !matchNested(doc, path, fs) {
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// matchNested returns whether any of the nested objects at path matches all the filters, ignoring their negation
+func matchNested(doc map[string]interface{}, path string, filters []*wm.Filter) bool {
+	for _, v := range values(doc, path) {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		all := true
+		for _, filter := range filters {
+			if !matchFilter(obj, strings.TrimPrefix(fieldNames[filter.Field], path+"."), filter) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFilter returns whether the field of the object matches the values of the filter, ignoring its negation.
+// String and integer values are matched like ES term queries, so a value matches a field holding an array
+// if any of its elements equals it, and a period if it falls within it. The range is matched like an ES
+// range query, intersecting periods.
+func matchFilter(obj map[string]interface{}, name string, filter *wm.Filter) bool {
+	vals := values(obj, name)
+	var results []bool
+	if filter.StringValues != nil {
+		for _, v := range filter.StringValues {
+			results = append(results, containsTerm(vals, v))
+		}
+	} else if filter.IntValues != nil {
+		for _, v := range filter.IntValues {
+			results = append(results, containsTerm(vals, strconv.Itoa(v)))
+		}
+	} else {
+		results = append(results, intersectsRange(vals, filter.Range))
+	}
+	if len(results) == 0 {
+		// An empty ES bool query matches everything
+		return true
+	}
+	for _, ok := range results {
+		if ok && filter.Operand == wm.OperandOr {
+			return true
+		}
+		if !ok && filter.Operand == wm.OperandAnd {
+			return false
+		}
+	}
+	return filter.Operand == wm.OperandAnd
+}
+
+// matchText matches the values of a _search filter like ES match queries on the text of the datacube at index i
+// and returns the number of occurrences of the matched tokens as relevance score
+func (s *Search) matchText(i int, filter *wm.Filter) (int, bool) {
+	score := 0
+	var results []bool
+	for _, v := range filter.StringValues {
+		ok := false
+		for _, token := range tokenize(v) {
+			if n := s.tokens[i][token]; n > 0 {
+				score += n
+				ok = true
+			}
+		}
+		results = append(results, ok)
+	}
+	for _, ok := range results {
+		if ok && filter.Operand == wm.OperandOr {
+			return score, true
+		}
+		if !ok && filter.Operand == wm.OperandAnd {
+			return 0, false
+		}
+	}
+	return score, filter.Operand == wm.OperandAnd || len(results) == 0
+}
+
+// containsTerm returns whether any of the values equals the term, or is a period containing it
+func containsTerm(vals []interface{}, term string) bool {
+	for _, v := range vals {
+		if p, ok := v.(map[string]interface{}); ok {
+			if t, err := strconv.ParseFloat(term, 64); err == nil && intersects(p, t, t, true) {
+				return true
+			}
+			continue
+		}
+		if s, ok := v.(string); ok && s == term {
+			return true
+		}
+		if f, ok := v.(float64); ok {
+			if t, err := strconv.ParseFloat(term, 64); err == nil && f == t {
+				return true
+			}
+		}
+		if b, ok := v.(bool); ok && strconv.FormatBool(b) == term {
+			return true
+		}
+	}
+	return false
+}
+
+// intersectsRange returns whether any of the values falls within the range, or is a period intersecting it
+func intersectsRange(vals []interface{}, r wm.Range) bool {
+	for _, v := range vals {
+		if p, ok := v.(map[string]interface{}); ok {
+			if intersects(p, r.Minimum, r.Maximum, r.IsClosed) {
+				return true
+			}
+			continue
+		}
+		f, ok := toFloat(v)
+		if ok && f >= r.Minimum && (f < r.Maximum || (r.IsClosed && f == r.Maximum)) {
+			return true
+		}
+	}
+	return false
+}
+
+// intersects returns whether the period, eg. { "gte": 1, "lte": 2 }, intersects the range from min to max
+func intersects(period map[string]interface{}, min float64, max float64, isClosed bool) bool {
+	gte, ok := toFloat(period["gte"])
+	if !ok {
+		return false
+	}
+	lte, ok := toFloat(period["lte"])
+	if !ok {
+		return false
+	}
+	if isClosed {
+		return gte <= max && lte >= min
+	}
+	return gte < max && lte >= min
+}
+
+// toFloat converts numbers and numeric strings
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// values returns the values at the dotted path of the object, flattening arrays. An empty path returns all the
+// leaf values of the object.
+func values(obj interface{}, path string) []interface{} {
+	switch val := obj.(type) {
+	case []interface{}:
+		var result []interface{}
+		for _, v := range val {
+			result = append(result, values(v, path)...)
+		}
+		return result
+	case map[string]interface{}:
+		if path == "" {
+			var result []interface{}
+			for _, v := range val {
+				result = append(result, values(v, "")...)
+			}
+			return result
+		}
+		name, rest := path, ""
+		if i := strings.Index(path, "."); i >= 0 {
+			name, rest = path[:i], path[i+1:]
+		}
+		child, ok := val[name]
+		if !ok {
+			return nil
+		}
+		if rest == "" {
+			// Keep the objects of the path, eg. the periods or the nested objects
+			if arr, ok := child.([]interface{}); ok {
+				return arr
+			}
+			return []interface{}{child}
+		}
+		return values(child, rest)
+	case nil:
+		return nil
+	}
+	if path != "" {
+		return nil
+	}
+	return []interface{}{obj}
+}
+
+// tokenize splits the text into lower case words, roughly like the ES standard analyzer
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// sortLess returns the less function sorting the matches by the fields. Like in ES, arrays are sorted by their
+// lowest value in ascending order and by their highest in descending order, and datacubes missing the field last.
+func sortLess(datacubes []*wm.Datacube, matches []match, sortBy []wm.SortBy) (func(i, j int) bool, error) {
+	op := "sortLess"
+	for _, s := range sortBy {
+		if _, ok := fieldNames[s.Field]; !ok || nestedPath[s.Field] != "" || s.Field == wm.FieldDatacubeSearch {
+			return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: "Unsupported sort field"}
+		}
+	}
+	key := func(i int, s wm.SortBy) interface{} {
+		var result interface{}
+		for _, v := range values(map[string]interface{}(*datacubes[matches[i].index]), fieldNames[s.Field]) {
+			if _, ok := v.(map[string]interface{}); ok {
+				continue
+			}
+			if result == nil || (compare(v, result) < 0) == (s.Order != wm.SortOrderDesc) {
+				result = v
+			}
+		}
+		return result
+	}
+	return func(i, j int) bool {
+		for _, s := range sortBy {
+			a, b := key(i, s), key(j, s)
+			if a == nil || b == nil {
+				if (a == nil) != (b == nil) {
+					return b == nil
+				}
+				continue
+			}
+			c := compare(a, b)
+			if s.Order == wm.SortOrderDesc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	}, nil
+}
+
+// compare compares numbers numerically and other values as strings
+func compare(a interface{}, b interface{}) int {
+	fa, aok := a.(float64)
+	fb, bok := b.(float64)
+	if aok && bok {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
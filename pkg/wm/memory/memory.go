@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// Search is a wm.DatacubeSearch holding the datacubes in memory. It evaluates the filters the way the
+// elastic package translates them into ES queries, so that both return the same datacubes.
+type Search struct {
+	datacubes []*wm.Datacube
+	// tokens holds the number of occurrences of each text token of the datacube at the same index
+	tokens []map[string]int
+}
+
+// New loads the datacubes of the JSON files of the configured directory and returns a Search over them.
+func New(cfg *Config) (*Search, error) {
+	op := "memory.New"
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	if err := cfg.init(); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	files, err := filepath.Glob(filepath.Join(cfg.Dir, "*.json"))
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	var datacubes []*wm.Datacube
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		docs, err := parseDatacubes(buf)
+		if err != nil {
+			return nil, &wm.Error{Op: op, Message: "Invalid datacube file " + file, Err: err}
+		}
+		datacubes = append(datacubes, docs...)
+	}
+	return NewFromDatacubes(datacubes), nil
+}
+
+// NewFromDatacubes returns a Search over the datacubes
+func NewFromDatacubes(datacubes []*wm.Datacube) *Search {
+	s := &Search{datacubes: datacubes, tokens: make([]map[string]int, len(datacubes))}
+	for i, d := range datacubes {
+		s.tokens[i] = make(map[string]int)
+		for _, v := range values(map[string]interface{}(*d), "") {
+			if str, ok := v.(string); ok {
+				for _, token := range tokenize(str) {
+					s.tokens[i][token]++
+				}
+			}
+		}
+	}
+	return s
+}
+
+// parseDatacubes parses the sequence of datacube documents or arrays of documents
+func parseDatacubes(buf []byte) ([]*wm.Datacube, error) {
+	var datacubes []*wm.Datacube
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return datacubes, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if raw = bytes.TrimSpace(raw); len(raw) > 0 && raw[0] == '[' {
+			var docs []*wm.Datacube
+			if err := json.Unmarshal(raw, &docs); err != nil {
+				return nil, err
+			}
+			datacubes = append(datacubes, docs...)
+		} else {
+			var doc wm.Datacube
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				return nil, err
+			}
+			datacubes = append(datacubes, &doc)
+		}
+	}
+}
+
+// SearchDatacubes returns the page of datacubes matching the search options
+func (s *Search) SearchDatacubes(ctx context.Context, opts wm.DatacubeSearchOptions) (*wm.DatacubeSearchResult, error) {
+	op := "Search.SearchDatacubes"
+	matches, err := s.match(opts.Filters, opts.Search)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if len(opts.Sort) > 0 {
+		less, err := sortLess(s.datacubes, matches, opts.Sort)
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		sort.SliceStable(matches, less)
+	} else {
+		// By relevance, like ES
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	}
+
+	result := &wm.DatacubeSearchResult{Total: len(matches), Datacubes: []*wm.Datacube{}}
+	for i := opts.Offset; i < len(matches) && i < opts.Offset+opts.Limit; i++ {
+		result.Datacubes = append(result.Datacubes, s.datacubes[matches[i].index])
+	}
+	return result, nil
+}
+
+// match is a datacube matching a search
+type match struct {
+	index int
+	score int
+}
+
+// match returns the datacubes matching the filters and the search term, in load order
+func (s *Search) match(filters []*wm.Filter, search string) ([]match, error) {
+	op := "Search.match"
+	if search != "" {
+		// The search term is matched like a _search filter, as done by the elastic package
+		filters = append(filters[:len(filters):len(filters)], &wm.Filter{
+			Field:        wm.FieldDatacubeSearch,
+			Operand:      wm.OperandOr,
+			StringValues: []string{search},
+		})
+	}
+	for _, filter := range filters {
+		if _, ok := fieldNames[filter.Field]; !ok {
+			return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: "Unrecognized field"}
+		}
+	}
+	matches := make([]match, 0)
+	for i, d := range s.datacubes {
+		if score, ok := s.matchDatacube(i, map[string]interface{}(*d), filters); ok {
+			matches = append(matches, match{index: i, score: score})
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+const testDatacubes = `[
+	{
+		"id": "dssat", "type": "model", "model": "DSSAT", "category": ["Agriculture", "Economic"],
+		"label": "Decision Support System for Agrotechnology Transfer", "parameters": ["rainfall", "fertilizer"],
+		"concepts": [{"name": "crop_production", "score": 0.65}, {"name": "rainfall", "score": 0.35}],
+		"country": ["Ethiopia"], "period": [{"gte": "1420070400000", "lte": "1454284800000"}]
+	},
+	{
+		"id": "grange", "type": "model", "model": "G-Range", "category": ["Agriculture"],
+		"label": "G-Range rangeland model, rainfall driven", "parameters": ["rainfall", "temperature"],
+		"concepts": [{"name": "crop_production", "score": 0.2}, {"name": "rainfall", "score": 0.9}],
+		"country": ["Ethiopia", "South Sudan"], "period": [{"gte": 1514764800000, "lte": 1546214400000}]
+	}
+]
+{
+	"id": "fao", "type": "indicator", "source": "FAO", "category": ["Economic"],
+	"label": "Food prices", "concepts": [{"name": "food_price", "score": 0.7}],
+	"country": ["South Sudan"], "period": [{"gte": 2019, "lte": 2020}]
+}`
+
+func newTestSearch(t *testing.T) *Search {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "datacubes.json"), []byte(testDatacubes), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("not json"), 0644))
+	s, err := New(&Config{Dir: dir})
+	require.NoError(t, err)
+	return s
+}
+
+func ids(result *wm.DatacubeSearchResult) []string {
+	ids := []string{}
+	for _, d := range result.Datacubes {
+		ids = append(ids, (*d)["id"].(string))
+	}
+	return ids
+}
+
+func TestSearchDatacubes(t *testing.T) {
+	s := newTestSearch(t)
+	for _, test := range []struct {
+		description string
+		opts        wm.DatacubeSearchOptions
+		want        []string
+	}{
+		{
+			"All datacubes",
+			wm.DatacubeSearchOptions{},
+			[]string{"dssat", "grange", "fao"},
+		},
+		{
+			"Or filter on an array field",
+			wm.DatacubeSearchOptions{Filters: []*wm.Filter{
+				{Field: wm.FieldDatacubeCountry, Operand: wm.OperandOr, StringValues: []string{"Ethiopia", "Kenya"}},
+			}},
+			[]string{"dssat", "grange"},
+		},
+		{
+			"And filter on an array field",
+			wm.DatacubeSearchOptions{Filters: []*wm.Filter{
+				{Field: wm.FieldDatacubeCategory, Operand: wm.OperandAnd, StringValues: []string{"Agriculture", "Economic"}},
+			}},
+			[]string{"dssat"},
+		},
+		{
+			"Negated filter",
+			wm.DatacubeSearchOptions{Filters: []*wm.Filter{
+				{Field: wm.FieldDatacubeCountry, Operand: wm.OperandOr, IsNot: true, StringValues: []string{"Ethiopia"}},
+			}},
+			[]string{"fao"},
+		},
+		{
+			"Nested filters match the same nested object",
+			wm.DatacubeSearchOptions{Filters: []*wm.Filter{
+				{Field: wm.FieldDatacubeConceptName, Operand: wm.OperandOr, StringValues: []string{"rainfall"}},
+				{Field: wm.FieldDatacubeConceptScore, Range: wm.Range{Minimum: 0.5, Maximum: 1}},
+			}},
+			[]string{"grange"},
+		},
+		{
+			"Negated nested filter excludes datacubes having any matching nested object",
+			wm.DatacubeSearchOptions{Filters: []*wm.Filter{
+				{Field: wm.FieldDatacubeConceptName, Operand: wm.OperandOr, IsNot: true, StringValues: []string{"rainfall"}},
+			}},
+			[]string{"fao"},
+		},
+		{
+			"Range filter intersecting periods",
+			wm.DatacubeSearchOptions{Filters: []*wm.Filter{
+				{Field: wm.FieldDatacubePeriod, Range: wm.Range{Minimum: 1451606400000, Maximum: 1514764800000, IsClosed: true}},
+			}},
+			[]string{"dssat", "grange"},
+		},
+		{
+			"Integer filter within periods",
+			wm.DatacubeSearchOptions{Filters: []*wm.Filter{
+				{Field: wm.FieldDatacubePeriod, Operand: wm.OperandOr, IntValues: []int{2020}},
+			}},
+			[]string{"fao"},
+		},
+		{
+			"Search term sorted by relevance",
+			wm.DatacubeSearchOptions{Search: "Rainfall"},
+			[]string{"grange", "dssat"},
+		},
+		{
+			"Sorted by descending model, missing last",
+			wm.DatacubeSearchOptions{Sort: []wm.SortBy{{Field: wm.FieldDatacubeModel, Order: wm.SortOrderDesc}}},
+			[]string{"grange", "dssat", "fao"},
+		},
+		{
+			"Page of the results",
+			wm.DatacubeSearchOptions{Offset: 1, Limit: 1},
+			[]string{"grange"},
+		},
+	} {
+		if test.opts.Limit == 0 {
+			test.opts.Limit = 10
+		}
+		result, err := s.SearchDatacubes(context.Background(), test.opts)
+		require.NoError(t, err, test.description)
+		require.Equal(t, test.want, ids(result), test.description)
+	}
+
+	result, err := s.SearchDatacubes(context.Background(), wm.DatacubeSearchOptions{Offset: 1, Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, 3, result.Total)
+
+	_, err = s.SearchDatacubes(context.Background(), wm.DatacubeSearchOptions{
+		Sort: []wm.SortBy{{Field: wm.FieldDatacubeConceptScore}},
+	})
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+}
+
+func TestGetDatacubeFacets(t *testing.T) {
+	s := newTestSearch(t)
+	facets, err := s.GetDatacubeFacets(context.Background(), wm.DatacubeFacetsOptions{
+		Filters: []*wm.Filter{{Field: wm.FieldDatacubeType, Operand: wm.OperandOr, StringValues: []string{"model"}}},
+		Fields:  []wm.Field{wm.FieldDatacubeCountry, wm.FieldDatacubeConceptName, wm.FieldDatacubeConceptScore},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []wm.Facet{{ID: "Ethiopia", Count: 2}, {ID: "South Sudan", Count: 1}}, facets[wm.FieldDatacubeCountry])
+	require.Equal(t, []wm.Facet{{ID: "crop_production", Count: 2}, {ID: "rainfall", Count: 2}}, facets[wm.FieldDatacubeConceptName])
+	var starts []float64
+	for _, f := range facets[wm.FieldDatacubeConceptScore] {
+		require.Equal(t, 1, f.Count)
+		starts = append(starts, *f.StartValue)
+	}
+	require.InDeltaSlice(t, []float64{0.2, 0.3, 0.6, 0.9}, starts, 1e-9)
+}
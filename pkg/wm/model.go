@@ -0,0 +1,75 @@
+package wm
+
+import "context"
+
+// ModelParameter is a parameter of a model
+type ModelParameter struct {
+	Model            string `json:"model"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	Units            string `json:"units,omitempty"`
+	UnitsDescription string `json:"units_description,omitempty"`
+	Type             string `json:"type"`
+	// Minimum and Maximum are numbers, or strings for time parameters, eg. "01-01"
+	Minimum interface{}   `json:"minimum,omitempty"`
+	Maximum interface{}   `json:"maximum,omitempty"`
+	Choices []interface{} `json:"choices,omitempty"`
+	Default interface{}   `json:"default,omitempty"`
+}
+
+// ModelRunParameter is the value of a parameter for a model run
+type ModelRunParameter struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// DateRange is a range of dates, eg. { "gte": "2015-01", "lte": "2016-02" }
+type DateRange struct {
+	Gte interface{} `json:"gte"`
+	Lte interface{} `json:"lte"`
+}
+
+// ModelRun is a run of a model with the parameter values used for the run
+type ModelRun struct {
+	ID         string              `json:"id"`
+	Model      string              `json:"model"`
+	Parameters []ModelRunParameter `json:"parameters"`
+	// Timestamp is the epoch timestamp at which the run was initiated
+	Timestamp        int64      `json:"timestamp"`
+	Country          []string   `json:"country,omitempty"`
+	Admin1           []string   `json:"admin1,omitempty"`
+	Admin2           []string   `json:"admin2,omitempty"`
+	Period           *DateRange `json:"period,omitempty"`
+	Status           string     `json:"status"`
+	Output           string     `json:"output,omitempty"`
+	OutputNormalized string     `json:"output_normalized,omitempty"`
+}
+
+// ModelRunSearchOptions defines the runs of a model to search for and the page of results to return
+type ModelRunSearchOptions struct {
+	// Parameters restricts the runs to the ones with any of the listed values for each of the parameters
+	Parameters map[string][]string
+	// Status restricts the runs to the ones with the status, eg. SUCCESS, if not empty
+	Status string
+	// Order is the order of the runs by timestamp, from newest to oldest by default
+	Order  SortOrder
+	Offset int
+	Limit  int
+}
+
+// ModelRunSearchResult is a page of the runs of a model matching a search
+type ModelRunSearchResult struct {
+	// Total is the number of matching runs
+	Total int         `json:"total"`
+	Runs  []*ModelRun `json:"runs"`
+}
+
+// ModelMetadata defines the methods that a model metadata service must implement
+type ModelMetadata interface {
+	// GetModelParameters returns the parameters of the model
+	GetModelParameters(ctx context.Context, modelID string) ([]*ModelParameter, error)
+
+	// GetModelRuns returns the page of the runs of the model matching the search options
+	GetModelRuns(ctx context.Context, modelID string, opts ModelRunSearchOptions) (*ModelRunSearchResult, error)
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// BlobReader defines the methods an object store needs to satisfy to back a Storage.
+// Missing objects are reported with a wm.ENOTFOUND error.
+type BlobReader interface {
+	// Get returns the content of the object
+	Get(ctx context.Context, bucket string, key string) ([]byte, error)
+
+	// GetRange returns up to length bytes of the object starting at offset. A negative length reads until the end of the object.
+	// A negative offset is an EINVALID error, and an offset at or past the end of the object returns no bytes.
+	GetRange(ctx context.Context, bucket string, key string, offset int64, length int64) ([]byte, error)
+
+	// Stat returns information about the object
+	Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error)
+
+	// List returns the keys and the common prefixes directly under the prefix, using "/" as the delimiter
+	List(ctx context.Context, bucket string, prefix string) (*ListResult, error)
+}
+
+// ObjectInfo holds information about an object
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ListResult is the result of listing a prefix. Keys are the objects directly under the prefix
+// and Prefixes are the common prefixes (ie. sub directories) ending with "/". Both are sorted.
+type ListResult struct {
+	Keys     []string `json:"keys"`
+	Prefixes []string `json:"prefixes"`
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// LocalReader is a BlobReader that serves objects from a directory on disk.
+// Each bucket is a sub directory of the root and keys are relative file paths within the bucket directory,
+// eg. {root}/{bucket}/{dataID}/{runID}/{resolution}/{feature}/...
+type LocalReader struct {
+	root string
+}
+
+// NewLocalReader returns a new LocalReader serving the files under the provided directory.
+func NewLocalReader(dir string) (*LocalReader, error) {
+	op := "NewLocalReader"
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if !info.IsDir() {
+		return nil, &wm.Error{Op: op, Err: fmt.Errorf("%s is not a directory", dir)}
+	}
+	return &LocalReader{filepath.Clean(dir)}, nil
+}
+
+// Get returns the content of the object
+func (r *LocalReader) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	op := "LocalReader.Get"
+	p, err := r.path(bucket, key)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	buf, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, localError(op, key, err)
+	}
+	return buf, nil
+}
+
+// GetRange returns up to length bytes of the object starting at offset
+func (r *LocalReader) GetRange(ctx context.Context, bucket string, key string, offset int64, length int64) ([]byte, error) {
+	op := "LocalReader.GetRange"
+	if offset < 0 {
+		return nil, &wm.Error{Code: wm.EINVALID, Op: op, Message: fmt.Sprintf("Invalid offset: %d", offset)}
+	}
+	p, err := r.path(bucket, key)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, localError(op, key, err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, localError(op, key, err)
+	}
+	var src io.Reader = f
+	if length >= 0 {
+		src = io.LimitReader(f, length)
+	}
+	buf, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, localError(op, key, err)
+	}
+	return buf, nil
+}
+
+// Stat returns information about the object
+func (r *LocalReader) Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error) {
+	op := "LocalReader.Stat"
+	p, err := r.path(bucket, key)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, localError(op, key, err)
+	}
+	if info.IsDir() {
+		return nil, &wm.Error{Code: wm.ENOTFOUND, Message: "Resource not found", Op: op}
+	}
+	return &ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+// List returns the keys and the common prefixes directly under the prefix
+func (r *LocalReader) List(ctx context.Context, bucket string, prefix string) (*ListResult, error) {
+	op := "LocalReader.List"
+	result := &ListResult{Keys: []string{}, Prefixes: []string{}}
+
+	// Split the prefix into the directory to read and the partial name entries should start with
+	dir, namePrefix := path.Split(prefix)
+	p, err := r.path(bucket, dir+".")
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	entries, err := ioutil.ReadDir(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, localError(op, prefix, err)
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), namePrefix) {
+			continue
+		}
+		if entry.IsDir() {
+			result.Prefixes = append(result.Prefixes, dir+entry.Name()+"/")
+		} else {
+			result.Keys = append(result.Keys, dir+entry.Name())
+		}
+	}
+	sort.Strings(result.Keys)
+	sort.Strings(result.Prefixes)
+	return result, nil
+}
+
+// path returns the file path of the object. Keys resolving to a path outside of the bucket directory are rejected.
+func (r *LocalReader) path(bucket string, key string) (string, error) {
+	op := "LocalReader.path"
+	bucketDir := filepath.Join(r.root, filepath.Clean(string(filepath.Separator)+bucket))
+	p := filepath.Join(bucketDir, filepath.FromSlash(key))
+	if bucketDir == r.root || (p != bucketDir && !strings.HasPrefix(p, bucketDir+string(filepath.Separator))) {
+		return "", &wm.Error{Code: wm.EINVALID, Op: op, Message: fmt.Sprintf("Invalid key: %s", key)}
+	}
+	return p, nil
+}
+
+// localError converts a file system error into a wm.Error
+func localError(op string, key string, err error) error {
+	if os.IsNotExist(err) {
+		return &wm.Error{Code: wm.ENOTFOUND, Message: "Resource not found", Op: op, Err: err}
+	}
+	return &wm.Error{Op: op, Err: fmt.Errorf("error reading file for key: %s: %w", key, err)}
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// MemoryReader is a BlobReader holding objects in memory. It's useful for tests and small offline datasets.
+type MemoryReader struct {
+	mu      sync.RWMutex
+	objects map[string]map[string]memoryObject
+}
+
+type memoryObject struct {
+	data         []byte
+	lastModified time.Time
+}
+
+// NewMemoryReader returns a new empty MemoryReader
+func NewMemoryReader() *MemoryReader {
+	return &MemoryReader{objects: make(map[string]map[string]memoryObject)}
+}
+
+// Put stores the object under the given bucket and key, replacing any existing object
+func (r *MemoryReader) Put(bucket string, key string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.objects[bucket]; !ok {
+		r.objects[bucket] = make(map[string]memoryObject)
+	}
+	r.objects[bucket][key] = memoryObject{data: data, lastModified: time.Now()}
+}
+
+func (r *MemoryReader) object(op string, bucket string, key string) (memoryObject, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	obj, ok := r.objects[bucket][key]
+	if !ok {
+		return memoryObject{}, &wm.Error{Code: wm.ENOTFOUND, Message: "Resource not found", Op: op}
+	}
+	return obj, nil
+}
+
+// Get returns the content of the object
+func (r *MemoryReader) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	obj, err := r.object("MemoryReader.Get", bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, obj.data...), nil
+}
+
+// GetRange returns up to length bytes of the object starting at offset
+func (r *MemoryReader) GetRange(ctx context.Context, bucket string, key string, offset int64, length int64) ([]byte, error) {
+	op := "MemoryReader.GetRange"
+	if offset < 0 {
+		return nil, &wm.Error{Code: wm.EINVALID, Op: op, Message: fmt.Sprintf("Invalid offset: %d", offset)}
+	}
+	obj, err := r.object(op, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(obj.data))
+	if offset > size {
+		offset = size
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+	return append([]byte{}, obj.data[offset:end]...), nil
+}
+
+// Stat returns information about the object
+func (r *MemoryReader) Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error) {
+	obj, err := r.object("MemoryReader.Stat", bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{Key: key, Size: int64(len(obj.data)), LastModified: obj.lastModified}, nil
+}
+
+// List returns the keys and the common prefixes directly under the prefix
+func (r *MemoryReader) List(ctx context.Context, bucket string, prefix string) (*ListResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := &ListResult{Keys: []string{}, Prefixes: []string{}}
+	prefixSet := make(map[string]bool)
+	for key := range r.objects[bucket] {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if i := strings.Index(key[len(prefix):], "/"); i >= 0 {
+			prefixSet[key[:len(prefix)+i+1]] = true
+		} else {
+			result.Keys = append(result.Keys, key)
+		}
+	}
+	for p := range prefixSet {
+		result.Prefixes = append(result.Prefixes, p)
+	}
+	sort.Strings(result.Keys)
+	sort.Strings(result.Prefixes)
+	return result, nil
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// s3ErrCodeNotFound is the error code S3 returns for HEAD requests on missing keys
+const s3ErrCodeNotFound = "NotFound"
+
+// s3ErrCodeSlowDown is the error code S3 returns when throttling requests
+const s3ErrCodeSlowDown = "SlowDown"
+
+// s3ErrCodeInvalidRange is the error code S3 returns for ranges starting at or past the end of the object
+const s3ErrCodeInvalidRange = "InvalidRange"
+
+// S3Reader is a BlobReader backed by S3 (or an S3 compatible store such as MinIO)
+type S3Reader struct {
+	client *s3.S3
+}
+
+// NewS3Reader returns a new S3Reader using the provided aws Config.
+func NewS3Reader(cfg *aws.Config) *S3Reader {
+	sess := session.Must(session.NewSession(cfg))
+	return &S3Reader{s3.New(sess)}
+}
+
+// Get returns the content of the object
+func (r *S3Reader) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	op := "S3Reader.Get"
+	return r.get(ctx, op, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+}
+
+// GetRange returns up to length bytes of the object starting at offset
+func (r *S3Reader) GetRange(ctx context.Context, bucket string, key string, offset int64, length int64) ([]byte, error) {
+	op := "S3Reader.GetRange"
+	if offset < 0 {
+		return nil, &wm.Error{Code: wm.EINVALID, Op: op, Message: fmt.Sprintf("Invalid offset: %d", offset)}
+	}
+	if length == 0 {
+		return []byte{}, nil
+	}
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	return r.get(ctx, op, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange),
+	})
+}
+
+func (r *S3Reader) get(ctx context.Context, op string, input *s3.GetObjectInput) ([]byte, error) {
+	resp, err := r.client.GetObjectWithContext(ctx, input)
+	if awsErr, ok := err.(awserr.Error); ok && input.Range != nil && awsErr.Code() == s3ErrCodeInvalidRange {
+		return []byte{}, nil
+	}
+	if err != nil {
+		return nil, s3Error(op, *input.Key, err)
+	}
+	defer resp.Body.Close()
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		// The connection failed mid response, eg. it was reset
+		code := wm.EUNAVAILABLE
+		if ctx.Err() != nil {
+			code = ""
+		}
+		return nil, &wm.Error{Code: code, Op: op, Err: fmt.Errorf("error reading response from s3 request: %w", err)}
+	}
+	return buf, nil
+}
+
+// Stat returns information about the object
+func (r *S3Reader) Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error) {
+	op := "S3Reader.Stat"
+	resp, err := r.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error(op, key, err)
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.Int64Value(resp.ContentLength),
+		LastModified: aws.TimeValue(resp.LastModified),
+	}, nil
+}
+
+// List returns the keys and the common prefixes directly under the prefix
+func (r *S3Reader) List(ctx context.Context, bucket string, prefix string) (*ListResult, error) {
+	op := "S3Reader.List"
+	result := &ListResult{Keys: []string{}, Prefixes: []string{}}
+	err := r.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			result.Keys = append(result.Keys, aws.StringValue(obj.Key))
+		}
+		for _, p := range page.CommonPrefixes {
+			result.Prefixes = append(result.Prefixes, aws.StringValue(p.Prefix))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, s3Error(op, prefix, err)
+	}
+	sort.Strings(result.Keys)
+	sort.Strings(result.Prefixes)
+	return result, nil
+}
+
+// s3Error converts the error returned by the S3 client into a wm.Error
+func s3Error(op string, key string, err error) error {
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, s3ErrCodeNotFound:
+			return &wm.Error{Code: wm.ENOTFOUND, Message: "Resource not found", Op: op, Err: err}
+		}
+	}
+	if isTransientS3Error(err) {
+		return &wm.Error{Code: wm.EUNAVAILABLE, Message: "Storage is temporarily unavailable", Op: op,
+			Err: fmt.Errorf("s3 request returned error for key: %s: %w", key, err)}
+	}
+	return &wm.Error{Op: op, Err: fmt.Errorf("s3 request returned error for key: %s: %w", key, err)}
+}
+
+// isTransientS3Error returns true if the error is likely to go away when retrying the request, such as 5xx responses,
+// throttling (eg. SlowDown) and connection resets
+func isTransientS3Error(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() >= 500 {
+		return true
+	}
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3ErrCodeSlowDown {
+		return true
+	}
+	return request.IsErrorRetryable(err) || request.IsErrorThrottle(err)
+}
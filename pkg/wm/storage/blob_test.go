@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+var testBlobs = map[string]string{
+	"data/run/year/feature/timeseries/global/global.csv":                "timestamp,s_sum_t_sum\n0,1\n",
+	"data/run/year/feature/regional/country/aggs/0/default/default.csv": "id,s_sum_t_sum\nEthiopia,1\n",
+	"data/run/raw/feature/raw/raw.csv":                                  "timestamp,value\n0,1\n",
+	"data/results/results.json":                                         "{}",
+}
+
+func newTestLocalReader(t *testing.T) *LocalReader {
+	root, err := ioutil.TempDir("", "wm-local-reader")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	for key, content := range testBlobs {
+		p := filepath.Join(root, "bucket", filepath.FromSlash(key))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, ioutil.WriteFile(p, []byte(content), 0644))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644))
+
+	reader, err := NewLocalReader(root)
+	require.NoError(t, err)
+	return reader
+}
+
+func newTestMemoryReader(t *testing.T) *MemoryReader {
+	reader := NewMemoryReader()
+	for key, content := range testBlobs {
+		reader.Put("bucket", key, []byte(content))
+	}
+	return reader
+}
+
+// newTestS3Reader returns an S3Reader of a fake S3 server, serving the GET, HEAD and ListObjectsV2 requests of the
+// reader from the test blobs
+func newTestS3Reader(t *testing.T) *S3Reader {
+	objects := newTestMemoryReader(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError := func(status int, code string) {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+		}
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		if len(parts) == 1 {
+			list, err := objects.List(r.Context(), parts[0], r.URL.Query().Get("prefix"))
+			require.NoError(t, err)
+			type prefix struct{ Prefix string }
+			type object struct{ Key string }
+			result := struct {
+				XMLName        xml.Name `xml:"ListBucketResult"`
+				IsTruncated    bool
+				Contents       []object
+				CommonPrefixes []prefix
+			}{}
+			for _, key := range list.Keys {
+				result.Contents = append(result.Contents, object{key})
+			}
+			for _, p := range list.Prefixes {
+				result.CommonPrefixes = append(result.CommonPrefixes, prefix{p})
+			}
+			require.NoError(t, xml.NewEncoder(w).Encode(result))
+			return
+		}
+		buf, err := objects.Get(r.Context(), parts[0], parts[1])
+		if err != nil {
+			writeError(http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(len(buf)))
+			return
+		}
+		if byteRange := r.Header.Get("Range"); byteRange != "" {
+			var start, end int
+			if n, _ := fmt.Sscanf(byteRange, "bytes=%d-%d", &start, &end); n == 1 || end >= len(buf) {
+				end = len(buf) - 1
+			}
+			if start >= len(buf) {
+				writeError(http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(buf)))
+			w.WriteHeader(http.StatusPartialContent)
+			buf = buf[start : end+1]
+		}
+		w.Write(buf)
+	}))
+	t.Cleanup(server.Close)
+	return NewS3Reader(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	})
+}
+
+func TestBlobReaders(t *testing.T) {
+	ctx := context.Background()
+	for name, reader := range map[string]BlobReader{
+		"local":  newTestLocalReader(t),
+		"memory": newTestMemoryReader(t),
+		"s3":     newTestS3Reader(t),
+		"cached": NewCachedReader(newTestMemoryReader(t), NewCache(CacheConfig{MaxBytes: 1 << 20})),
+		// A limit <= 0 means no limit
+		"limited": NewLimitedReader(newTestMemoryReader(t), 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf, err := reader.Get(ctx, "bucket", "data/run/raw/feature/raw/raw.csv")
+			require.NoError(t, err)
+			require.Equal(t, "timestamp,value\n0,1\n", string(buf))
+
+			_, err = reader.Get(ctx, "bucket", "data/run/raw/missing/raw/raw.csv")
+			require.Equal(t, wm.ENOTFOUND, wm.ErrorCode(err))
+
+			buf, err = reader.GetRange(ctx, "bucket", "data/run/raw/feature/raw/raw.csv", 10, 5)
+			require.NoError(t, err)
+			require.Equal(t, "value", string(buf))
+
+			buf, err = reader.GetRange(ctx, "bucket", "data/run/raw/feature/raw/raw.csv", 16, -1)
+			require.NoError(t, err)
+			require.Equal(t, "0,1\n", string(buf))
+
+			// Ranges starting at or past the end of the object are empty, and negative offsets are invalid
+			for _, offset := range []int64{20, 21} {
+				buf, err = reader.GetRange(ctx, "bucket", "data/run/raw/feature/raw/raw.csv", offset, 5)
+				require.NoError(t, err)
+				require.Empty(t, buf)
+				buf, err = reader.GetRange(ctx, "bucket", "data/run/raw/feature/raw/raw.csv", offset, -1)
+				require.NoError(t, err)
+				require.Empty(t, buf)
+			}
+			_, err = reader.GetRange(ctx, "bucket", "data/run/raw/feature/raw/raw.csv", -1, 5)
+			require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+			_, err = reader.GetRange(ctx, "bucket", "data/run/raw/missing/raw/raw.csv", 0, 5)
+			require.Equal(t, wm.ENOTFOUND, wm.ErrorCode(err))
+
+			info, err := reader.Stat(ctx, "bucket", "data/results/results.json")
+			require.NoError(t, err)
+			require.Equal(t, int64(2), info.Size)
+
+			_, err = reader.Stat(ctx, "bucket", "data/results")
+			require.Equal(t, wm.ENOTFOUND, wm.ErrorCode(err))
+
+			list, err := reader.List(ctx, "bucket", "data/")
+			require.NoError(t, err)
+			require.Equal(t, &ListResult{Keys: []string{}, Prefixes: []string{"data/results/", "data/run/"}}, list)
+
+			list, err = reader.List(ctx, "bucket", "data/r")
+			require.NoError(t, err)
+			require.Equal(t, []string{"data/results/", "data/run/"}, list.Prefixes)
+
+			list, err = reader.List(ctx, "bucket", "data/results/")
+			require.NoError(t, err)
+			require.Equal(t, &ListResult{Keys: []string{"data/results/results.json"}, Prefixes: []string{}}, list)
+
+			list, err = reader.List(ctx, "bucket", "missing/")
+			require.NoError(t, err)
+			require.Empty(t, list.Keys)
+			require.Empty(t, list.Prefixes)
+
+			s, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{ModelsBucket: "bucket"}})
+			require.NoError(t, err)
+			series, err := s.GetOutputTimeseries(ctx, wm.DatacubeParams{DataID: "data", RunID: "run", Resolution: "year", Feature: "feature", SpatialAggFunc: "sum", TemporalAggFunc: "sum"})
+			require.NoError(t, err)
+			require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 0, Value: 1}}, series)
+		})
+	}
+}
+
+func TestLocalReaderPath(t *testing.T) {
+	ctx := context.Background()
+	reader := newTestLocalReader(t)
+
+	_, err := reader.Get(ctx, "bucket", "../secret.txt")
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+
+	_, err = reader.Get(ctx, "../", "secret.txt")
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+
+	_, err = NewLocalReader(filepath.Join(reader.root, "secret.txt"))
+	require.Error(t, err)
+}
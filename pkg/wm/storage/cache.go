@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// CacheConfig defines the parameters of a Cache
+type CacheConfig struct {
+	// MaxBytes is the memory budget shared by all cached entries
+	MaxBytes int64
+	// TTL is the maximum age of an entry. Zero means entries only leave the cache when evicted
+	TTL time.Duration
+	// Buckets lists the buckets whose objects and results are cached. Empty means all buckets
+	Buckets []string
+}
+
+// CacheStats holds the cache counters
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// Cache is a concurrency safe LRU cache bounded by the total size of its entries.
+// A nil *Cache is valid and caches nothing.
+type Cache struct {
+	mu      sync.Mutex
+	cfg     CacheConfig
+	buckets map[string]bool
+	ll      *list.List
+	items   map[string]*list.Element
+	bytes   int64
+	stats   CacheStats
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	size    int64
+	expires time.Time
+}
+
+// NewCache returns a new Cache using the provided config
+func NewCache(cfg CacheConfig) *Cache {
+	buckets := make(map[string]bool)
+	for _, b := range cfg.Buckets {
+		buckets[b] = true
+	}
+	return &Cache{
+		cfg:     cfg,
+		buckets: buckets,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// cachesBucket returns true if entries from the bucket should be cached
+func (c *Cache) cachesBucket(bucket string) bool {
+	if c == nil {
+		return false
+	}
+	return len(c.buckets) == 0 || c.buckets[bucket]
+}
+
+// Get returns the value stored under the key, if any
+func (c *Cache) Get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if entry.expires.IsZero() || c.now().Before(entry.expires) {
+			c.ll.MoveToFront(el)
+			c.stats.Hits++
+			return entry.value, true
+		}
+		c.removeElement(el)
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+// Add stores the value under the key. Size is the approximate memory used by the value in bytes.
+// Values larger than the memory budget are not stored.
+func (c *Cache) Add(key string, value interface{}, size int64) {
+	if c == nil || size > c.cfg.MaxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+	entry := &cacheEntry{key: key, value: value, size: size}
+	if c.cfg.TTL > 0 {
+		entry.expires = c.now().Add(c.cfg.TTL)
+	}
+	c.items[key] = c.ll.PushFront(entry)
+	c.bytes += size
+	for c.bytes > c.cfg.MaxBytes {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Purge removes all entries from the cache
+func (c *Cache) Purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *Cache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.ll.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	entry := c.ll.Remove(el).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.bytes -= entry.size
+}
+
+// CachedReader is a BlobReader that keeps the objects fetched from the underlying reader in a Cache
+type CachedReader struct {
+	reader BlobReader
+	cache  *Cache
+}
+
+// NewCachedReader returns a CachedReader that caches the objects of reader in cache
+func NewCachedReader(reader BlobReader, cache *Cache) *CachedReader {
+	return &CachedReader{reader, cache}
+}
+
+func blobCacheKey(bucket string, key string) string {
+	return "blob:" + bucket + "/" + key
+}
+
+// Get returns the content of the object. The returned buffer is a copy, so callers may modify it without affecting the
+// cached object.
+func (r *CachedReader) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	if !r.cache.cachesBucket(bucket) {
+		return r.reader.Get(ctx, bucket, key)
+	}
+	cacheKey := blobCacheKey(bucket, key)
+	if v, ok := r.cache.Get(cacheKey); ok {
+		return append([]byte{}, v.([]byte)...), nil
+	}
+	buf, err := r.reader.Get(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.Add(cacheKey, buf, int64(len(buf)))
+	return append([]byte{}, buf...), nil
+}
+
+// GetRange returns up to length bytes of the object starting at offset. Ranges are served from
+// the cached object if present, but are never cached themselves.
+func (r *CachedReader) GetRange(ctx context.Context, bucket string, key string, offset int64, length int64) ([]byte, error) {
+	op := "CachedReader.GetRange"
+	if offset < 0 {
+		return nil, &wm.Error{Code: wm.EINVALID, Op: op, Message: fmt.Sprintf("Invalid offset: %d", offset)}
+	}
+	if r.cache.cachesBucket(bucket) {
+		if v, ok := r.cache.Get(blobCacheKey(bucket, key)); ok {
+			buf := v.([]byte)
+			size := int64(len(buf))
+			if offset > size {
+				offset = size
+			}
+			end := size
+			if length >= 0 && offset+length < size {
+				end = offset + length
+			}
+			return append([]byte{}, buf[offset:end]...), nil
+		}
+	}
+	return r.reader.GetRange(ctx, bucket, key, offset, length)
+}
+
+// Stat returns information about the object
+func (r *CachedReader) Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error) {
+	return r.reader.Stat(ctx, bucket, key)
+}
+
+// List returns the keys and the common prefixes directly under the prefix
+func (r *CachedReader) List(ctx context.Context, bucket string, prefix string) (*ListResult, error) {
+	return r.reader.List(ctx, bucket, prefix)
+}
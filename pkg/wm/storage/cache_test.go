@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestCacheEviction(t *testing.T) {
+	c := NewCache(CacheConfig{MaxBytes: 10})
+	c.Add("a", "a", 4)
+	c.Add("b", "b", 4)
+	_, ok := c.Get("a")
+	require.True(t, ok)
+
+	// "b" is the least recently used entry and gets evicted
+	c.Add("c", "c", 4)
+	_, ok = c.Get("b")
+	require.False(t, ok)
+	_, ok = c.Get("a")
+	require.True(t, ok)
+
+	// Values larger than the budget are never stored
+	c.Add("d", "d", 11)
+	_, ok = c.Get("d")
+	require.False(t, ok)
+
+	require.Equal(t, CacheStats{Hits: 2, Misses: 2, Evictions: 1, Entries: 2, Bytes: 8}, c.Stats())
+
+	c.Purge()
+	require.Equal(t, 0, c.Stats().Entries)
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewCache(CacheConfig{MaxBytes: 10, TTL: time.Minute})
+	c.now = func() time.Time { return now }
+
+	c.Add("a", "a", 1)
+	now = now.Add(59 * time.Second)
+	_, ok := c.Get("a")
+	require.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok = c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, int64(0), c.Stats().Bytes)
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	c.Add("a", "a", 1)
+	_, ok := c.Get("a")
+	require.False(t, ok)
+	require.False(t, c.cachesBucket("bucket"))
+}
+
+func TestStorageCache(t *testing.T) {
+	ctx := context.Background()
+	reader := NewMemoryReader()
+	reader.Put("models", "data/run/year/feature/timeseries/global/global.csv", []byte("timestamp,s_sum_t_sum\n0,1\n"))
+	reader.Put("indicators", "data/indicator/year/feature/timeseries/global/global.csv", []byte("timestamp,s_sum_t_sum\n0,1\n"))
+
+	cache := NewCache(CacheConfig{MaxBytes: 1 << 20, Buckets: []string{"models"}})
+	s, err := NewFromConfig(&Config{
+		Reader:     NewCachedReader(reader, cache),
+		BucketInfo: &BucketInfo{ModelsBucket: "models", IndicatorsBucket: "indicators"},
+		Cache:      cache,
+	})
+	require.NoError(t, err)
+
+	params := wm.DatacubeParams{DataID: "data", RunID: "run", Resolution: "year", Feature: "feature", SpatialAggFunc: "sum", TemporalAggFunc: "sum"}
+	series, err := s.GetOutputTimeseries(ctx, params)
+	require.NoError(t, err)
+
+	// Callers may modify the returned series without affecting the cached result
+	series[0].Value = 100
+	reader.Put("models", "data/run/year/feature/timeseries/global/global.csv", []byte("timestamp,s_sum_t_sum\n0,2\n"))
+	series, err = s.GetOutputTimeseries(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 0, Value: 1}}, series)
+
+	// The raw object is cached as well
+	buf, err := s.reader.Get(ctx, "models", "data/run/year/feature/timeseries/global/global.csv")
+	require.NoError(t, err)
+	require.Equal(t, "timestamp,s_sum_t_sum\n0,1\n", string(buf))
+	// and returned as a copy
+	buf[0] = 'x'
+	buf, err = s.reader.GetRange(ctx, "models", "data/run/year/feature/timeseries/global/global.csv", 0, 9)
+	require.NoError(t, err)
+	require.Equal(t, "timestamp", string(buf))
+	_, err = s.reader.GetRange(ctx, "models", "data/run/year/feature/timeseries/global/global.csv", -1, 9)
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+
+	// Indicators bucket is not cached. The models entries are the result and the object
+	params.RunID = "indicator"
+	_, err = s.GetOutputTimeseries(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, 2, cache.Stats().Entries)
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// Directories under a run which are not resolutions
+var nonResolutionDirs = map[string]bool{"raw": true, "results": true}
+
+// aggColumnRegex matches the value columns of the output csv files, eg. s_sum_t_mean
+var aggColumnRegex = regexp.MustCompile(`^s_[a-z]+_t_[a-z]+$`)
+
+// Number of bytes read from the start of a csv file to get its header
+const csvHeaderChunkSize = 4096
+
+// GetRuns returns the run ids of the datacube
+func (s *Storage) GetRuns(ctx context.Context, params wm.DatacubeParams) ([]string, error) {
+	op := "Storage.GetRuns"
+	runs := make(map[string]bool)
+	for _, bucket := range []string{s.bucketInfo.ModelsBucket, s.bucketInfo.IndicatorsBucket} {
+		if bucket == "" {
+			continue
+		}
+		names, err := listDirs(ctx, s, bucket, params.DataID+"/")
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		for _, name := range names {
+			runs[name] = true
+		}
+	}
+	return sortedKeys(runs), nil
+}
+
+// GetResolutions returns the temporal resolutions available for the run
+func (s *Storage) GetResolutions(ctx context.Context, params wm.DatacubeParams) ([]string, error) {
+	op := "Storage.GetResolutions"
+	names, err := listDirs(ctx, s, getBucket(s, params.RunID), fmt.Sprintf("%s/%s/", params.DataID, params.RunID))
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	resolutions := make([]string, 0, len(names))
+	for _, name := range names {
+		if !nonResolutionDirs[name] {
+			resolutions = append(resolutions, name)
+		}
+	}
+	return resolutions, nil
+}
+
+// GetFeatures returns the features of the run. If the resolution is set, only the features with outputs at this resolution are returned
+func (s *Storage) GetFeatures(ctx context.Context, params wm.DatacubeParams) ([]string, error) {
+	op := "Storage.GetFeatures"
+	dir := "raw"
+	if params.Resolution != "" {
+		dir = string(params.Resolution)
+	}
+	features, err := listDirs(ctx, s, getBucket(s, params.RunID), fmt.Sprintf("%s/%s/%s/", params.DataID, params.RunID, dir))
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	return features, nil
+}
+
+// GetAggregations returns the available spatial and temporal aggregation combinations of the feature, eg. s_sum_t_mean
+func (s *Storage) GetAggregations(ctx context.Context, params wm.DatacubeParams) ([]string, error) {
+	op := "Storage.GetAggregations"
+	key := fmt.Sprintf("%s/%s/%s/%s/timeseries/global/global.csv",
+		params.DataID, params.RunID, params.Resolution, params.Feature)
+	header, err := getTableHeader(ctx, s, getBucket(s, params.RunID), key)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	aggs := make([]string, 0)
+	for _, col := range header {
+		if aggColumnRegex.MatchString(col) {
+			aggs = append(aggs, col)
+		}
+	}
+	sort.Strings(aggs)
+	return aggs, nil
+}
+
+// GetTimestamps returns the timestamps of the feature output, in ascending order. If the admin level is set,
+// the timestamps with regional data at that level are returned, otherwise the timestamps of the global timeseries
+func (s *Storage) GetTimestamps(ctx context.Context, params wm.DatacubeParams) ([]int64, error) {
+	op := "Storage.GetTimestamps"
+	bucket := getBucket(s, params.RunID)
+	var timestamps []int64
+	if params.AdminLevel != "" {
+		names, err := listDirs(ctx, s, bucket, fmt.Sprintf("%s/%s/%s/%s/regional/%s/aggs/",
+			params.DataID, params.RunID, params.Resolution, params.Feature, params.AdminLevel))
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		timestamps = make([]int64, 0, len(names))
+		for _, name := range names {
+			ts, err := strconv.ParseInt(name, 10, 64)
+			if err != nil {
+				// Not a timestamp directory
+				continue
+			}
+			timestamps = append(timestamps, ts)
+		}
+	} else {
+		key := fmt.Sprintf("%s/%s/%s/%s/timeseries/global/global.csv",
+			params.DataID, params.RunID, params.Resolution, params.Feature)
+		result, err := getParsedFile(ctx, s, bucket, key, "timestamps", &columnSelection{leading: 1}, func(t table) (interface{}, int64, error) {
+			timestamps, err := parseTimestamps(t)
+			return timestamps, int64(len(timestamps)) * 8, err
+		})
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		timestamps = append([]int64{}, result.([]int64)...)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps, nil
+}
+
+// parseTimestamps returns the distinct timestamps of the first column of the table
+func parseTimestamps(t table) ([]int64, error) {
+	op := "parseTimestamps"
+	timestamps := make([]int64, 0)
+	seen := make(map[int64]bool)
+	for row := 0; row < t.len(); row++ {
+		ts, err := t.integer(row, 0)
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		if !seen[ts] {
+			seen[ts] = true
+			timestamps = append(timestamps, ts)
+		}
+	}
+	return timestamps, nil
+}
+
+// getCsvHeader returns the header of the csv file, only fetching the start of the file
+func getCsvHeader(ctx context.Context, s *Storage, bucket string, key string) ([]string, error) {
+	op := "getCsvHeader"
+	buf, err := s.reader.GetRange(ctx, bucket, key, 0, csvHeaderChunkSize)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = bytes.TrimSuffix(buf[:i], []byte("\r"))
+	} else if len(buf) == csvHeaderChunkSize {
+		// Header longer than the chunk, get the whole file
+		if buf, err = getFile(ctx, s, bucket, key); err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+	}
+	header, err := csv.NewReader(bytes.NewReader(buf)).Read()
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: fmt.Errorf("invalid csv header: %s: %w", key, err)}
+	}
+	return header, nil
+}
+
+// listDirs returns the names of the "directories" directly under the prefix
+func listDirs(ctx context.Context, s *Storage, bucket string, prefix string) ([]string, error) {
+	op := "listDirs"
+	list, err := s.reader.List(ctx, bucket, prefix)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	names := make([]string, 0, len(list.Prefixes))
+	for _, p := range list.Prefixes {
+		name := strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/")
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
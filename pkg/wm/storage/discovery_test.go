@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestDiscovery(t *testing.T) {
+	ctx := context.Background()
+	reader := NewMemoryReader()
+	for _, key := range []string{
+		"data/run1/raw/rainfall/raw/raw.csv",
+		"data/run1/raw/crop/raw/raw.csv",
+		"data/run1/month/rainfall/timeseries/global/global.csv",
+		"data/run1/year/rainfall/timeseries/global/global.csv",
+		"data/run1/year/crop/timeseries/global/global.csv",
+		"data/run1/results/results.json",
+		"data/run2/raw/rainfall/raw/raw.csv",
+	} {
+		reader.Put("models", key, []byte("timestamp,s_sum_t_sum,s_mean_t_sum,extra\r\n0,1,1,1\r\n"))
+	}
+	reader.Put("indicators", "data/indicator/raw/rainfall/raw/raw.csv", []byte(""))
+	reader.Put("models", "data/run2/year/rainfall/timeseries/global/global.csv", []byte("timestamp,"+strings.Repeat("x", csvHeaderChunkSize)+",s_sum_t_mean\n0,1,1\n"))
+	s, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{ModelsBucket: "models", IndicatorsBucket: "indicators"}})
+	require.NoError(t, err)
+
+	runs, err := s.GetRuns(ctx, wm.DatacubeParams{DataID: "data"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"indicator", "run1", "run2"}, runs)
+
+	runs, err = s.GetRuns(ctx, wm.DatacubeParams{DataID: "missing"})
+	require.NoError(t, err)
+	require.Equal(t, []string{}, runs)
+
+	resolutions, err := s.GetResolutions(ctx, wm.DatacubeParams{DataID: "data", RunID: "run1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"month", "year"}, resolutions)
+
+	features, err := s.GetFeatures(ctx, wm.DatacubeParams{DataID: "data", RunID: "run1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"crop", "rainfall"}, features)
+
+	features, err = s.GetFeatures(ctx, wm.DatacubeParams{DataID: "data", RunID: "run1", Resolution: "month"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"rainfall"}, features)
+
+	aggs, err := s.GetAggregations(ctx, wm.DatacubeParams{DataID: "data", RunID: "run1", Resolution: "year", Feature: "rainfall"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"s_mean_t_sum", "s_sum_t_sum"}, aggs)
+
+	// Header longer than the first chunk
+	aggs, err = s.GetAggregations(ctx, wm.DatacubeParams{DataID: "data", RunID: "run2", Resolution: "year", Feature: "rainfall"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"s_sum_t_mean"}, aggs)
+
+	_, err = s.GetAggregations(ctx, wm.DatacubeParams{DataID: "data", RunID: "run1", Resolution: "month", Feature: "crop"})
+	require.Equal(t, wm.ENOTFOUND, wm.ErrorCode(err))
+}
+
+func TestGetTimestamps(t *testing.T) {
+	ctx := context.Background()
+	reader := NewMemoryReader()
+	reader.Put("models", "data/run/year/feature/timeseries/global/global.csv", []byte("timestamp,s_sum_t_sum\n2,1\n10,1\n1,1\n"))
+	for _, ts := range []string{"10", "2", "1"} {
+		reader.Put("models", "data/run/year/feature/regional/country/aggs/"+ts+"/default/default.csv", []byte("id,s_sum_t_sum\n"))
+	}
+	reader.Put("models", "data/run/year/feature/regional/admin1/aggs/2/default/default.csv", []byte("id,s_sum_t_sum\n"))
+	s, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{ModelsBucket: "models"}})
+	require.NoError(t, err)
+
+	params := wm.DatacubeParams{DataID: "data", RunID: "run", Resolution: "year", Feature: "feature"}
+	timestamps, err := s.GetTimestamps(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2, 10}, timestamps)
+
+	params.AdminLevel = wm.AdminLevelCountry
+	timestamps, err = s.GetTimestamps(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2, 10}, timestamps)
+
+	params.AdminLevel = wm.AdminLevel1
+	timestamps, err = s.GetTimestamps(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []int64{2}, timestamps)
+
+	params.AdminLevel = wm.AdminLevel2
+	timestamps, err = s.GetTimestamps(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []int64{}, timestamps)
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup deduplicates concurrent calls sharing the same key, so that only the first caller
+// does the work and the others wait for and share its result.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	val     interface{}
+	err     error
+}
+
+// do calls fn and returns its result, unless a call with the same key is already in flight,
+// in which case it waits for that call and returns its result instead. The call runs with its own context,
+// which is cancelled once every caller waiting for it has given up, so one cancelled caller does not fail the others.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(context.Background())
+		c = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go func() {
+			c.val, c.err = fn(callCtx)
+			g.mu.Lock()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			cancel()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Nobody is interested in the result anymore
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			c.cancel()
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// CoalescingReader is a BlobReader that shares a single download of an object between concurrent callers
+type CoalescingReader struct {
+	reader  BlobReader
+	flights flightGroup
+}
+
+// NewCoalescingReader returns a CoalescingReader wrapping reader
+func NewCoalescingReader(reader BlobReader) *CoalescingReader {
+	return &CoalescingReader{reader: reader}
+}
+
+// Get returns the content of the object. The returned slice may be shared with other callers and must not be modified.
+func (r *CoalescingReader) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	v, err := r.flights.do(ctx, bucket+"/"+key, func(ctx context.Context) (interface{}, error) {
+		return r.reader.Get(ctx, bucket, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// GetRange returns up to length bytes of the object starting at offset
+func (r *CoalescingReader) GetRange(ctx context.Context, bucket string, key string, offset int64, length int64) ([]byte, error) {
+	return r.reader.GetRange(ctx, bucket, key, offset, length)
+}
+
+// Stat returns information about the object
+func (r *CoalescingReader) Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error) {
+	return r.reader.Stat(ctx, bucket, key)
+}
+
+// List returns the keys and the common prefixes directly under the prefix
+func (r *CoalescingReader) List(ctx context.Context, bucket string, prefix string) (*ListResult, error) {
+	return r.reader.List(ctx, bucket, prefix)
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// slowReader counts the calls to Get and blocks them until release is closed
+type slowReader struct {
+	BlobReader
+	gets    int32
+	release chan struct{}
+}
+
+func (r *slowReader) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	atomic.AddInt32(&r.gets, 1)
+	<-r.release
+	return r.BlobReader.Get(ctx, bucket, key)
+}
+
+func TestFlightGroup(t *testing.T) {
+	var g flightGroup
+	var calls int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "value", nil
+			})
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), calls)
+	for _, r := range results {
+		require.Equal(t, "value", r)
+	}
+
+	// Calls after the flight completed do the work again
+	v, err := g.do(context.Background(), "key", func(ctx context.Context) (interface{}, error) { return "new value", nil })
+	require.NoError(t, err)
+	require.Equal(t, "new value", v)
+}
+
+func TestFlightGroupCancel(t *testing.T) {
+	var g flightGroup
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.do(ctx1, "key", fn)
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err := g.do(ctx2, "key", fn)
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// The call keeps running while one of the callers is still waiting
+	cancel1()
+	require.Equal(t, context.Canceled, <-errs)
+	select {
+	case <-cancelled:
+		t.Fatal("call was cancelled while a caller was still waiting")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// and is cancelled once all of them have given up
+	cancel2()
+	require.Equal(t, context.Canceled, <-errs)
+	<-cancelled
+}
+
+func TestStorageCoalescing(t *testing.T) {
+	memory := NewMemoryReader()
+	memory.Put("models", "data/run/year/feature/regional/country/aggs/0/default/default.csv", []byte("id,s_sum_t_sum\nEthiopia,1\n"))
+	reader := &slowReader{BlobReader: memory, release: make(chan struct{})}
+	s, err := NewFromConfig(&Config{Reader: NewCoalescingReader(reader), BucketInfo: &BucketInfo{ModelsBucket: "models"}})
+	require.NoError(t, err)
+
+	params := wm.DatacubeParams{DataID: "data", RunID: "run", Resolution: "year", Feature: "feature", SpatialAggFunc: "sum", TemporalAggFunc: "sum"}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := s.GetRegionAggregationByAdminLevel(context.Background(), params, "0", wm.AdminLevelCountry)
+			require.NoError(t, err)
+			require.Equal(t, []wm.ModelOutputAdminData{{ID: "Ethiopia", Value: 1}}, (*data)[wm.AdminLevelCountry])
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(reader.release)
+	wg.Wait()
+	require.Equal(t, int32(1), reader.gets)
+
+	// Different objects are fetched independently
+	_, err = s.reader.Get(context.Background(), "models", "missing")
+	require.Equal(t, wm.ENOTFOUND, wm.ErrorCode(err))
+	require.Equal(t, int32(2), reader.gets)
+}
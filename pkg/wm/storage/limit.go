@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/fanout"
+)
+
+// LimitedReader is a BlobReader that bounds the number of concurrent requests made to the wrapped reader
+type LimitedReader struct {
+	reader BlobReader
+	sem    *fanout.Semaphore
+}
+
+// NewLimitedReader returns a LimitedReader allowing up to max concurrent requests to reader. A max <= 0 means no limit.
+func NewLimitedReader(reader BlobReader, max int) *LimitedReader {
+	return &LimitedReader{reader: reader, sem: fanout.NewSemaphore(max)}
+}
+
+// InFlight returns the number of requests currently made to the wrapped reader
+func (r *LimitedReader) InFlight() int {
+	return r.sem.InUse()
+}
+
+// Get returns the content of the object
+func (r *LimitedReader) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	if err := r.sem.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer r.sem.Release()
+	return r.reader.Get(ctx, bucket, key)
+}
+
+// GetRange returns up to length bytes of the object starting at offset
+func (r *LimitedReader) GetRange(ctx context.Context, bucket string, key string, offset int64, length int64) ([]byte, error) {
+	if err := r.sem.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer r.sem.Release()
+	return r.reader.GetRange(ctx, bucket, key, offset, length)
+}
+
+// Stat returns information about the object
+func (r *LimitedReader) Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error) {
+	if err := r.sem.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer r.sem.Release()
+	return r.reader.Stat(ctx, bucket, key)
+}
+
+// List returns the keys and the common prefixes directly under the prefix
+func (r *LimitedReader) List(ctx context.Context, bucket string, prefix string) (*ListResult, error) {
+	if err := r.sem.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer r.sem.Release()
+	return r.reader.List(ctx, bucket, prefix)
+}
@@ -2,26 +2,18 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"strconv"
 	"strings"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/mitchellh/mapstructure"
+	"gitlab.uncharted.software/WM/wm-go/pkg/fanout"
 	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
 )
 
-type s3ResultChan struct {
-	result chan []byte
-	err    chan error
-}
-
 func getRegionLevels() []string {
 	return []string{"country", "admin1", "admin2", "admin3"}
 }
@@ -46,12 +38,12 @@ func index(vs []string, t string) int {
 }
 
 // GetOutputExtrema - gets min and max statistics
-func (s *Storage) GetOutputExtrema(params wm.DatacubeParams) (*wm.RegionalExtremaSelected, error) {
+func (s *Storage) GetOutputExtrema(ctx context.Context, params wm.DatacubeParams) (*wm.RegionalExtremaSelected, error) {
 	op := "Storage.GetOutputExtrema"
 	key := fmt.Sprintf("%s/%s/%s/%s/regional/%s/stats/default/extrema.json",
 		params.DataID, params.RunID, params.Resolution, params.Feature, params.AdminLevel)
 	bucket := getBucket(s, params.RunID)
-	buf, err := getFileFromS3(s, bucket, aws.String(key))
+	buf, err := getFile(ctx, s, bucket, key)
 
 	if err != nil {
 		return nil, &wm.Error{Op: op, Err: err}
@@ -82,12 +74,12 @@ func (s *Storage) GetOutputExtrema(params wm.DatacubeParams) (*wm.RegionalExtrem
 }
 
 // GetRegionalOutputStats returns regional output statistics
-func (s *Storage) GetRegionalOutputStats(params wm.DatacubeParams) (*wm.ModelRegionalOutputStat, error) {
+func (s *Storage) GetRegionalOutputStats(ctx context.Context, params wm.DatacubeParams) (*wm.ModelRegionalOutputStat, error) {
 	op := "Storage.GetRegionalOutputStats"
 	regionMap := make(map[string]*wm.ModelOutputStat)
 	for _, level := range getRegionLevels() {
 		var regionKey = fmt.Sprintf("regional/%s", level)
-		stats, err := s.getOutputStats(params, regionKey)
+		stats, err := s.getOutputStats(ctx, params, regionKey)
 		if err == nil {
 			regionMap[level] = stats
 		}
@@ -101,12 +93,12 @@ func (s *Storage) GetRegionalOutputStats(params wm.DatacubeParams) (*wm.ModelReg
 }
 
 // GetOutputStats returns datacube output stats
-func (s *Storage) getOutputStats(params wm.DatacubeParams, filename string) (*wm.ModelOutputStat, error) {
+func (s *Storage) getOutputStats(ctx context.Context, params wm.DatacubeParams, filename string) (*wm.ModelOutputStat, error) {
 	op := "Storage.getOutputStats"
 	key := fmt.Sprintf("%s/%s/%s/%s/stats/%s.json",
 		params.DataID, params.RunID, params.Resolution, params.Feature, filename)
 
-	buf, err := getFileFromS3(s, getBucket(s, params.RunID), aws.String(key))
+	buf, err := getFile(ctx, s, getBucket(s, params.RunID), key)
 	if err != nil {
 		return nil, &wm.Error{Op: op, Err: err}
 	}
@@ -136,12 +128,12 @@ func (s *Storage) getOutputStats(params wm.DatacubeParams, filename string) (*wm
 }
 
 // GetOutputStats returns stats for grid output data
-func (s *Storage) GetOutputStats(params wm.DatacubeParams, timestamp string) ([]*wm.OutputStatWithZoom, error) {
+func (s *Storage) GetOutputStats(ctx context.Context, params wm.DatacubeParams, timestamp string) ([]*wm.OutputStatWithZoom, error) {
 	op := "Storage.GetOutputStats"
 	key := fmt.Sprintf("%s/%s/%s/%s/stats/grid/%s.csv",
 		params.DataID, params.RunID, params.Resolution, params.Feature, timestamp)
 
-	buf, err := getFileFromS3(s, getBucket(s, params.RunID), aws.String(key))
+	buf, err := getFile(ctx, s, getBucket(s, params.RunID), key)
 	if err != nil {
 		return nil, &wm.Error{Op: op, Err: err}
 	}
@@ -184,19 +176,19 @@ func (s *Storage) GetOutputStats(params wm.DatacubeParams, timestamp string) ([]
 }
 
 // GetOutputTimeseries returns datacube output timeseries
-func (s *Storage) GetOutputTimeseries(params wm.DatacubeParams) ([]*wm.TimeseriesValue, error) {
+func (s *Storage) GetOutputTimeseries(ctx context.Context, params wm.DatacubeParams) ([]*wm.TimeseriesValue, error) {
 	// op := "Storage.GetOutputTimeseries"
 	key := fmt.Sprintf("%s/%s/%s/%s/timeseries/global/global.csv",
 		params.DataID, params.RunID, params.Resolution, params.Feature)
 
-	return getTimeseriesFromCsv(s, key, params)
+	return getTimeseriesFromCsv(ctx, s, key, params)
 }
 
 // GetOutputSparkline returns a datacube output sparkline
 // If rawRes and rawLatestTimestamp is provided, try correcting incomplete last value
-func (s *Storage) GetOutputSparkline(params wm.DatacubeParams, rawRes wm.TemporalResolution, rawLatestTimestamp int64) ([]float64, error) {
+func (s *Storage) GetOutputSparkline(ctx context.Context, params wm.DatacubeParams, rawRes wm.TemporalResolution, rawLatestTimestamp int64) ([]float64, error) {
 	op := "Storage.GetOutputSparkline"
-	series, err := s.GetOutputTimeseries(params)
+	series, err := s.GetOutputTimeseries(ctx, params)
 	if err != nil {
 		return nil, &wm.Error{Op: op, Err: err}
 	}
@@ -207,7 +199,7 @@ func (s *Storage) GetOutputSparkline(params wm.DatacubeParams, rawRes wm.Tempora
 }
 
 // GetOutputTimeseriesByRegion returns timeseries data for a specific region
-func (s *Storage) GetOutputTimeseriesByRegion(params wm.DatacubeParams, regionID string) ([]*wm.TimeseriesValue, error) {
+func (s *Storage) GetOutputTimeseriesByRegion(ctx context.Context, params wm.DatacubeParams, regionID string) ([]*wm.TimeseriesValue, error) {
 	// op := "Storage.GetOutputTimeseriesByRegion"
 	// Deconstruct Region ID to get admin region levels
 	regions := strings.Split(regionID, "__")
@@ -215,77 +207,41 @@ func (s *Storage) GetOutputTimeseriesByRegion(params wm.DatacubeParams, regionID
 	key := fmt.Sprintf("%s/%s/%s/%s/regional/%s/timeseries/default/%s.csv",
 		params.DataID, params.RunID, params.Resolution, params.Feature, regionLevel, regionID)
 
-	return getTimeseriesFromCsv(s, key, params)
+	return getTimeseriesFromCsv(ctx, s, key, params)
 }
 
 // GetRegionAggregationByAdminLevel returns regional data for given admin level at ONE timestamp
-func (s *Storage) GetRegionAggregationByAdminLevel(params wm.DatacubeParams, timestamp string, adminLevel wm.AdminLevel) (*wm.ModelOutputRegional, error) {
+func (s *Storage) GetRegionAggregationByAdminLevel(ctx context.Context, params wm.DatacubeParams, timestamp string, adminLevel wm.AdminLevel) (*wm.ModelOutputRegional, error) {
 	op := "Storage.GetRegionAggregationByAdminLevel"
 	key := fmt.Sprintf("%s/%s/%s/%s/regional/%s/aggs/%s/default/default.csv",
 		params.DataID, params.RunID, params.Resolution, params.Feature, adminLevel, timestamp)
 
-	buf, err := getFileFromS3(s, getBucket(s, params.RunID), aws.String(key))
+	points, err := getRegionalDataFromCsv(ctx, s, key, params)
 	if err != nil {
 		return nil, &wm.Error{Op: op, Err: err}
 	}
 
 	result := make(wm.ModelOutputRegional)
-	points := make([]wm.ModelOutputAdminData, 0)
-
-	// Read and parse csv
-	r := csv.NewReader(bytes.NewReader(buf))
-	isHeader := true
-	valueCol := fmt.Sprintf("s_%s_t_%s", params.SpatialAggFunc, params.TemporalAggFunc)
-	valueColIndex := -1
-	for {
-		record, err := r.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, &wm.Error{Op: op, Err: err}
-		}
-		// Parse header and find the index of the target value column
-		if isHeader {
-			valueColIndex = index(record, valueCol)
-			if valueColIndex == -1 {
-				return nil, &wm.Error{Code: wm.EINVALID, Op: op, Message: fmt.Sprintf("Invalid agg functions. Spatial: %s, Temporal: %s", params.SpatialAggFunc, params.TemporalAggFunc)}
-			}
-			isHeader = false
-		} else {
-			regionID := record[0]
-			value, err := strconv.ParseFloat(record[valueColIndex], 64)
-			if err != nil {
-				continue
-			}
-			points = append(points, wm.ModelOutputAdminData{
-				ID:    regionID,
-				Value: value,
-			})
-		}
-	}
 	result[adminLevel] = points
-
 	return &result, nil
 }
 
 // GetRegionAggregation returns regional data for ALL admin regions at ONE timestamp
-func (s *Storage) GetRegionAggregation(params wm.DatacubeParams, timestamp string) (*wm.ModelOutputRegionalAdmins, error) {
+func (s *Storage) GetRegionAggregation(ctx context.Context, params wm.DatacubeParams, timestamp string) (*wm.ModelOutputRegionalAdmins, error) {
 	op := "Storage.GetRegionAggregation"
 
-	data := make(map[string][]wm.ModelOutputAdminData)
-	resultChannels := make(map[string]s3ResultChan)
-
-	for _, level := range getRegionLevels() {
+	levels := getRegionLevels()
+	points := make([][]wm.ModelOutputAdminData, len(levels))
+	errs := fanout.Run(ctx, len(levels), s.maxConcurrency, func(ctx context.Context, i int) error {
 		key := fmt.Sprintf("%s/%s/%s/%s/regional/%s/aggs/%s/default/default.csv",
-			params.DataID, params.RunID, params.Resolution, params.Feature, level, timestamp)
-		rc := getFileFromS3Async(s, getBucket(s, params.RunID), aws.String(key))
-		resultChannels[level] = rc
-	}
-	for _, level := range getRegionLevels() {
-		buf := <-resultChannels[level].result
-		err := <-resultChannels[level].err
-		if err != nil {
+			params.DataID, params.RunID, params.Resolution, params.Feature, levels[i], timestamp)
+		var err error
+		points[i], err = getRegionalDataFromCsv(ctx, s, key, params)
+		return err
+	})
+	data := make(map[string][]wm.ModelOutputAdminData)
+	for i, level := range levels {
+		if err := errs[i]; err != nil {
 			if wm.ErrorCode(err) == wm.ENOTFOUND {
 				data[level] = make([]wm.ModelOutputAdminData, 0)
 				continue
@@ -293,42 +249,7 @@ func (s *Storage) GetRegionAggregation(params wm.DatacubeParams, timestamp strin
 				return nil, &wm.Error{Op: op, Err: err}
 			}
 		}
-
-		points := make([]wm.ModelOutputAdminData, 0)
-		// Read and parse csv
-		r := csv.NewReader(bytes.NewReader(buf))
-		isHeader := true
-		valueCol := fmt.Sprintf("s_%s_t_%s", params.SpatialAggFunc, params.TemporalAggFunc)
-		valueColIndex := -1
-		for {
-			record, err := r.Read()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return nil, &wm.Error{Op: op, Err: err}
-			}
-			// Parse header and find the index of the target value column
-			if isHeader {
-				valueColIndex = index(record, valueCol)
-				if valueColIndex == -1 {
-					return nil, &wm.Error{Code: wm.EINVALID, Op: op, Message: fmt.Sprintf("Invalid agg functions. Spatial: %s, Temporal: %s", params.SpatialAggFunc, params.TemporalAggFunc)}
-				}
-				isHeader = false
-			} else {
-				regionID := record[0]
-				value, err := strconv.ParseFloat(record[valueColIndex], 64)
-				if err != nil {
-					continue
-				}
-				points = append(points, wm.ModelOutputAdminData{
-					ID:    regionID,
-					Value: value,
-				})
-			}
-		}
-
-		data[level] = points
+		data[level] = points[i]
 	}
 
 	var regionalData wm.ModelOutputRegionalAdmins
@@ -340,7 +261,7 @@ func (s *Storage) GetRegionAggregation(params wm.DatacubeParams, timestamp strin
 }
 
 // GetRegionLists returns region hierarchies in list form
-func (s *Storage) GetRegionLists(params wm.RegionListParams) (*wm.RegionListOutput, error) {
+func (s *Storage) GetRegionLists(ctx context.Context, params wm.RegionListParams) (*wm.RegionListOutput, error) {
 	op := "Storage.GetRegionLists"
 	var regionalData wm.RegionListOutput
 	// allOutputMap is meant to be a map from strings ie. 'country' to a set (map[string]bool is used as a set)
@@ -348,21 +269,21 @@ func (s *Storage) GetRegionLists(params wm.RegionListParams) (*wm.RegionListOutp
 	for _, region := range getRegionLevels() {
 		allOutputMap[region] = make(map[string]bool)
 	}
-	resultChannels := make(map[string]s3ResultChan)
-	for _, runID := range params.RunIDs {
+	bufs := make([][]byte, len(params.RunIDs))
+	errs := fanout.Run(ctx, len(params.RunIDs), s.maxConcurrency, func(ctx context.Context, i int) error {
+		runID := params.RunIDs[i]
 		key := fmt.Sprintf("%s/%s/raw/%s/info/region_lists.json", params.DataID, runID, params.Feature)
-		rc := getFileFromS3Async(s, getBucket(s, runID), aws.String(key))
-		resultChannels[runID] = rc
-	}
+		var err error
+		bufs[i], err = getFile(ctx, s, getBucket(s, runID), key)
+		return err
+	})
 	// Populate sets in allOutputMap map values with regions
-	for _, runID := range params.RunIDs {
-		buf := <-resultChannels[runID].result
-		err := <-resultChannels[runID].err
-		if err != nil {
+	for i, buf := range bufs {
+		if err := errs[i]; err != nil {
 			return nil, &wm.Error{Op: op, Err: err}
 		}
 		outputMap := make(map[string][]string)
-		err = json.Unmarshal(buf, &outputMap)
+		err := json.Unmarshal(buf, &outputMap)
 		if err != nil {
 			return nil, &wm.Error{Op: op, Err: err}
 		}
@@ -391,12 +312,12 @@ func (s *Storage) GetRegionLists(params wm.RegionListParams) (*wm.RegionListOutp
 }
 
 // GetQualifierCounts returns the number of qualifier values per qualifier
-func (s *Storage) GetQualifierCounts(params wm.QualifierInfoParams) (*wm.QualifierCountsOutput, error) {
+func (s *Storage) GetQualifierCounts(ctx context.Context, params wm.QualifierInfoParams) (*wm.QualifierCountsOutput, error) {
 	op := "Storage.GetQualifierCounts"
 	key := fmt.Sprintf("%s/%s/raw/%s/info/qualifier_counts.json",
 		params.DataID, params.RunID, params.Feature)
 	bucket := getBucket(s, params.RunID)
-	buf, err := getFileFromS3(s, bucket, aws.String(key))
+	buf, err := getFile(ctx, s, bucket, key)
 	if err != nil {
 		return nil, &wm.Error{Op: op, Err: err}
 	}
@@ -409,22 +330,21 @@ func (s *Storage) GetQualifierCounts(params wm.QualifierInfoParams) (*wm.Qualifi
 }
 
 // GetQualifierLists returns the number of qualifier values per qualifier
-func (s *Storage) GetQualifierLists(params wm.QualifierInfoParams, qualifiers []string) (*wm.QualifierListsOutput, error) {
+func (s *Storage) GetQualifierLists(ctx context.Context, params wm.QualifierInfoParams, qualifiers []string) (*wm.QualifierListsOutput, error) {
 	op := "Storage.GetQualifierLists"
 	bucket := getBucket(s, params.RunID)
 
-	resultChannels := make(map[string]s3ResultChan)
-	outputLists := make(map[string][]string)
-	for _, qualifier := range qualifiers {
+	bufs := make([][]byte, len(qualifiers))
+	errs := fanout.Run(ctx, len(qualifiers), s.maxConcurrency, func(ctx context.Context, i int) error {
 		key := fmt.Sprintf("%s/%s/raw/%s/info/qualifiers/%s.json",
-			params.DataID, params.RunID, params.Feature, qualifier)
-		rc := getFileFromS3Async(s, bucket, aws.String(key))
-		resultChannels[qualifier] = rc
-	}
-	for _, qualifier := range qualifiers {
-		buf := <-resultChannels[qualifier].result
-		err := <-resultChannels[qualifier].err
-		if err != nil {
+			params.DataID, params.RunID, params.Feature, qualifiers[i])
+		var err error
+		bufs[i], err = getFile(ctx, s, bucket, key)
+		return err
+	})
+	outputLists := make(map[string][]string)
+	for i, qualifier := range qualifiers {
+		if err := errs[i]; err != nil {
 			if wm.ErrorCode(err) != wm.ENOTFOUND {
 				return nil, &wm.Error{Op: op, Err: err}
 			}
@@ -433,7 +353,7 @@ func (s *Storage) GetQualifierLists(params wm.QualifierInfoParams, qualifiers []
 			continue
 		}
 		var output []string
-		err = json.Unmarshal(buf, &output)
+		err := json.Unmarshal(bufs[i], &output)
 		if err != nil {
 			return nil, &wm.Error{Op: op, Err: err}
 		}
@@ -449,11 +369,11 @@ func (s *Storage) GetQualifierLists(params wm.QualifierInfoParams, qualifiers []
 }
 
 // GetPipelineResults returns the pipeline results file
-func (s *Storage) GetPipelineResults(params wm.PipelineResultsParams) (*wm.PipelineResultsOutput, error) {
+func (s *Storage) GetPipelineResults(ctx context.Context, params wm.PipelineResultsParams) (*wm.PipelineResultsOutput, error) {
 	op := "Storage.GetPipelineResults"
 	key := fmt.Sprintf("%s/%s/results/results.json", params.DataID, params.RunID)
 	bucket := getBucket(s, params.RunID)
-	buf, err := getFileFromS3(s, bucket, aws.String(key))
+	buf, err := getFile(ctx, s, bucket, key)
 	if err != nil {
 		return nil, &wm.Error{Op: op, Err: err}
 	}
@@ -465,109 +385,8 @@ func (s *Storage) GetPipelineResults(params wm.PipelineResultsParams) (*wm.Pipel
 	return &output, nil
 }
 
-// GetRawData returns datacube output or indicator raw data
-func (s *Storage) GetRawData(params wm.DatacubeParams) ([]*wm.ModelOutputRawDataPoint, error) {
-	op := "Storage.GetRawData"
-	key := fmt.Sprintf("%s/%s/raw/%s/raw/raw.csv",
-		params.DataID, params.RunID, params.Feature)
-
-	buf, err := getFileFromS3(s, getBucket(s, params.RunID), aws.String(key))
-	if err != nil {
-		return nil, &wm.Error{Op: op, Err: err}
-	}
-
-	data := make([]*wm.ModelOutputRawDataPoint, 0)
-	requiredColSet := map[string]bool{"timestamp": true, "country": true, "admin1": true, "admin2": true, "admin3": true, "lat": true, "lng": true, "value": true}
-	requiredColsIndexMap := make(map[string]int)
-	qualifierColsIndexMap := make(map[string]int)
-
-	// Parse raw csv data
-	r := csv.NewReader(bytes.NewReader(buf))
-	isHeader := true
-	for {
-		record, err := r.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, &wm.Error{Op: op, Err: err}
-		}
-		// Parse header and find the index of each column
-		if isHeader {
-			for i, v := range record {
-				if requiredColSet[v] {
-					requiredColsIndexMap[v] = i
-				} else {
-					qualifierColsIndexMap[v] = i
-				}
-			}
-			isHeader = false
-		} else {
-			dataPoint := &wm.ModelOutputRawDataPoint{}
-			if index, ok := requiredColsIndexMap["timestamp"]; ok {
-				timstamp, err := strconv.ParseInt(record[index], 10, 64)
-				if err != nil {
-					return nil, &wm.Error{Op: op, Err: err}
-				}
-				dataPoint.Timestamp = timstamp
-			}
-			if index, ok := requiredColsIndexMap["country"]; ok {
-				dataPoint.Country = record[index]
-			}
-			if index, ok := requiredColsIndexMap["admin1"]; ok {
-				dataPoint.Admin1 = record[index]
-			}
-			if index, ok := requiredColsIndexMap["admin2"]; ok {
-				dataPoint.Admin2 = record[index]
-			}
-			if index, ok := requiredColsIndexMap["admin3"]; ok {
-				dataPoint.Admin3 = record[index]
-			}
-			if index, ok := requiredColsIndexMap["lat"]; ok {
-				v := record[index]
-				if v != "" {
-					lat, err := strconv.ParseFloat(v, 64)
-					if err != nil {
-						return nil, &wm.Error{Op: op, Err: err}
-					}
-					dataPoint.Lat = &lat
-				}
-			}
-			if index, ok := requiredColsIndexMap["lng"]; ok {
-				v := record[index]
-				if v != "" {
-					lng, err := strconv.ParseFloat(v, 64)
-					if err != nil {
-						return nil, &wm.Error{Op: op, Err: err}
-					}
-					dataPoint.Lng = &lng
-				}
-			}
-			if index, ok := requiredColsIndexMap["value"]; ok {
-				v := record[index]
-				if v != "" {
-					value, err := strconv.ParseFloat(v, 64)
-					if err != nil {
-						return nil, &wm.Error{Op: op, Err: err}
-					}
-					dataPoint.Value = &value
-				}
-			}
-			// Add extra columns
-			qualifiers := make(map[string]string)
-			for col, index := range qualifierColsIndexMap {
-				qualifiers[col] = record[index]
-			}
-			dataPoint.Qualifiers = qualifiers
-
-			data = append(data, dataPoint)
-		}
-	}
-	return data, nil
-}
-
 // GetQualifierTimeseries returns datacube output timeseries broken down by qualifiers
-func (s *Storage) GetQualifierTimeseries(params wm.DatacubeParams, qualifier string, qualifierOptions []string) ([]*wm.ModelOutputQualifierTimeseries, error) {
+func (s *Storage) GetQualifierTimeseries(ctx context.Context, params wm.DatacubeParams, qualifier string, qualifierOptions []string) ([]*wm.ModelOutputQualifierTimeseries, error) {
 	op := "Storage.GetQualifierTimeseries"
 	key := fmt.Sprintf("%s/%s/%s/%s/timeseries/qualifiers/%s/s_%s_t_%s.csv",
 		params.DataID, params.RunID, params.Resolution, params.Feature, qualifier,
@@ -578,47 +397,30 @@ func (s *Storage) GetQualifierTimeseries(params wm.DatacubeParams, qualifier str
 	// 852076800000,1583.0,0.0,0.0,0.0,313.0
 	// 854755200000,187.0,3.0,0.0,0.0,40.0
 
-	buf, err := getFileFromS3(s, getBucket(s, params.RunID), aws.String(key))
+	t, err := readTable(ctx, s, getBucket(s, params.RunID), key, &columnSelection{leading: 1, names: qualifierOptions})
 	if err != nil {
 		return nil, &wm.Error{Op: op, Err: err}
 	}
 
-	// Read and parse csv
+	// The first column is timestamp, rest are values
+	header := t.columns()
 	var values []*wm.ModelOutputQualifierTimeseries
-	r := csv.NewReader(bytes.NewReader(buf))
-	isHeader := true
-	for {
-		record, err := r.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, &wm.Error{Op: op, Err: err}
-		}
-		// Parse header and find the index of the target value column
-		if isHeader {
-			// The first column is timestamp, rest are values
-			numValues := len(record) - 1
-			if numValues < 1 {
-				break
-			}
-			values = make([]*wm.ModelOutputQualifierTimeseries, numValues)
-			for i := 0; i < numValues; i++ {
-				values[i] = &wm.ModelOutputQualifierTimeseries{
-					Name: record[i+1], Timeseries: make([]*wm.TimeseriesValue, 0)}
-			}
-			isHeader = false
-		} else {
-			timestamp, err := strconv.ParseInt(record[0], 10, 64)
+	for i := 1; i < len(header); i++ {
+		values = append(values, &wm.ModelOutputQualifierTimeseries{
+			Name: header[i], Timeseries: make([]*wm.TimeseriesValue, 0)})
+	}
+	if len(values) > 0 {
+		for row := 0; row < t.len(); row++ {
+			timestamp, err := t.integer(row, 0)
 			if err != nil {
 				return nil, &wm.Error{Op: op, Err: err}
 			}
-			for i := 0; i+1 < len(record) && i < len(values); i++ {
-				value, err := strconv.ParseFloat(record[i+1], 64)
+			for i, timeseries := range values {
+				value, err := t.float(row, i+1)
 				if err != nil {
 					continue
 				}
-				values[i].Timeseries = append(values[i].Timeseries, &wm.TimeseriesValue{
+				timeseries.Timeseries = append(timeseries.Timeseries, &wm.TimeseriesValue{
 					Timestamp: timestamp, Value: value})
 			}
 		}
@@ -627,13 +429,11 @@ func (s *Storage) GetQualifierTimeseries(params wm.DatacubeParams, qualifier str
 	// Filter the qualifier options, only include what's specified in qualifierOptions
 	filteredValues := make([]*wm.ModelOutputQualifierTimeseries, 0)
 	for _, timeseries := range values {
-		if timeseries != nil {
-			for _, name := range qualifierOptions {
-				if timeseries.Name == name {
-					sortTimeseries(timeseries.Timeseries)
-					filteredValues = append(filteredValues, timeseries)
-					break
-				}
+		for _, name := range qualifierOptions {
+			if timeseries.Name == name {
+				sortTimeseries(timeseries.Timeseries)
+				filteredValues = append(filteredValues, timeseries)
+				break
 			}
 		}
 	}
@@ -641,34 +441,25 @@ func (s *Storage) GetQualifierTimeseries(params wm.DatacubeParams, qualifier str
 }
 
 // GetQualifierTimeseriesByRegion returns datacube output timeseries broken down by qualifiers for a specific region
-func (s *Storage) GetQualifierTimeseriesByRegion(params wm.DatacubeParams, qualifier string, qualifierOptions []string, regionID string) ([]*wm.ModelOutputQualifierTimeseries, error) {
+func (s *Storage) GetQualifierTimeseriesByRegion(ctx context.Context, params wm.DatacubeParams, qualifier string, qualifierOptions []string, regionID string) ([]*wm.ModelOutputQualifierTimeseries, error) {
 	op := "Storage.GetQualifierTimeseriesByRegion"
 	// Deconstruct Region ID to get admin region levels
 	regions := strings.Split(regionID, "__")
 	regionLevel := getRegionLevels()[len(regions)-1]
 
-	type resultChan struct {
-		result chan []*wm.TimeseriesValue
-		err    chan error
-	}
-	outputTimeseries := make([]*wm.ModelOutputQualifierTimeseries, 0)
-	chanMap := make(map[string]resultChan)
-	for _, qOpt := range qualifierOptions {
+	results := make([][]*wm.TimeseriesValue, len(qualifierOptions))
+	errs := fanout.Run(ctx, len(qualifierOptions), s.maxConcurrency, func(ctx context.Context, i int) error {
 		key := fmt.Sprintf("%s/%s/%s/%s/regional/%s/timeseries/qualifiers/%s/%s/%s.csv",
 			params.DataID, params.RunID, params.Resolution, params.Feature, regionLevel,
-			qualifier, qOpt, regionID)
-
-		chanMap[qOpt] = resultChan{result: make(chan []*wm.TimeseriesValue), err: make(chan error)}
-		go func(qo string) {
-			series, err := getTimeseriesFromCsv(s, key, params)
-			chanMap[qo].result <- series
-			chanMap[qo].err <- err
-		}(qOpt)
-	}
-	for _, qOpt := range qualifierOptions {
-		series := <-chanMap[qOpt].result
-		err := <-chanMap[qOpt].err
-		if err != nil {
+			qualifier, qualifierOptions[i], regionID)
+		var err error
+		results[i], err = getTimeseriesFromCsv(ctx, s, key, params)
+		return err
+	})
+	outputTimeseries := make([]*wm.ModelOutputQualifierTimeseries, 0)
+	for i, qOpt := range qualifierOptions {
+		series := results[i]
+		if err := errs[i]; err != nil {
 			if wm.ErrorCode(err) != wm.ENOTFOUND {
 				return nil, &wm.Error{Op: op, Err: err}
 			}
@@ -683,59 +474,42 @@ func (s *Storage) GetQualifierTimeseriesByRegion(params wm.DatacubeParams, quali
 }
 
 // GetQualifierData returns datacube output data broken down by qualifiers for ONE timestamp
-func (s *Storage) GetQualifierData(params wm.DatacubeParams, timestamp string, qualifiers []string) ([]*wm.ModelOutputQualifierBreakdown, error) {
+func (s *Storage) GetQualifierData(ctx context.Context, params wm.DatacubeParams, timestamp string, qualifiers []string) ([]*wm.ModelOutputQualifierBreakdown, error) {
 	op := "Storage.GetQualifierData"
 	allQualifiers := make([]*wm.ModelOutputQualifierBreakdown, len(qualifiers))
 
-	resultChannels := make(map[string]s3ResultChan)
-	for _, qualifier := range qualifiers {
+	tables := make([]table, len(qualifiers))
+	errs := fanout.Run(ctx, len(qualifiers), s.maxConcurrency, func(ctx context.Context, i int) error {
 		key := fmt.Sprintf("%s/%s/%s/%s/timeseries/qualifiers/%s/s_%s_t_%s.csv",
-			params.DataID, params.RunID, params.Resolution, params.Feature, qualifier,
+			params.DataID, params.RunID, params.Resolution, params.Feature, qualifiers[i],
 			params.SpatialAggFunc, params.TemporalAggFunc)
 		// Want to return one row
 		// CSV format:
 		// timestamp,Battles,Protests,Riots,Strategic developments,Violence against civilians
 		// 852076800000,1583.0,0.0,0.0,0.0,313.0
 		// 854755200000,187.0,3.0,0.0,0.0,40.0
-		rc := getFileFromS3Async(s, getBucket(s, params.RunID), aws.String(key))
-		resultChannels[qualifier] = rc
-	}
+		var err error
+		tables[i], err = readTable(ctx, s, getBucket(s, params.RunID), key, nil)
+		return err
+	})
 	for qualifierIndex, qualifier := range qualifiers {
-		buf := <-resultChannels[qualifier].result
-		err := <-resultChannels[qualifier].err
-		if err != nil {
+		if errs[qualifierIndex] != nil {
 			allQualifiers[qualifierIndex] = nil
 			continue
 		}
 
-		// Read and parse csv
+		// The first column is timestamp, rest are values
+		t := tables[qualifierIndex]
+		header := t.columns()
 		var values []*wm.ModelOutputQualifierValue
-		r := csv.NewReader(bytes.NewReader(buf))
-		isHeader := true
-		for {
-			record, err := r.Read()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return nil, &wm.Error{Op: op, Err: err}
-			}
-			// Parse header and find the index of the target value column
-			if isHeader {
-				// The first column is timestamp, rest are values
-				numValues := len(record) - 1
-				if numValues < 1 {
-					break
-				}
-				values = make([]*wm.ModelOutputQualifierValue, numValues)
-				for i := 0; i < numValues; i++ {
-					values[i] = &wm.ModelOutputQualifierValue{Name: record[i+1]}
-				}
-				isHeader = false
-			} else {
-				if timestamp == record[0] {
-					for i := 0; i+1 < len(record) && i < len(values); i++ {
-						value, err := strconv.ParseFloat(record[i+1], 64)
+		for i := 1; i < len(header); i++ {
+			values = append(values, &wm.ModelOutputQualifierValue{Name: header[i]})
+		}
+		if len(values) > 0 {
+			for row := 0; row < t.len(); row++ {
+				if timestamp == t.text(row, 0) {
+					for i := range values {
+						value, err := t.float(row, i+1)
 						if err != nil {
 							values[i].Value = nil //set missing values to nil
 						} else {
@@ -748,31 +522,35 @@ func (s *Storage) GetQualifierData(params wm.DatacubeParams, timestamp string, q
 		}
 		allQualifiers[qualifierIndex] = &wm.ModelOutputQualifierBreakdown{Name: qualifier, Options: values}
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
 	return allQualifiers, nil
 }
 
 // GetQualifierRegional returns datacube output data broken down by qualifiers for ONE timestamp
-func (s *Storage) GetQualifierRegional(params wm.DatacubeParams, timestamp string, qualifier string) (*wm.ModelOutputRegionalQualifiers, error) {
+func (s *Storage) GetQualifierRegional(ctx context.Context, params wm.DatacubeParams, timestamp string, qualifier string) (*wm.ModelOutputRegionalQualifiers, error) {
 	op := "Storage.GetQualifierRegional"
 
-	data := make(map[string][]*wm.ModelOutputRegionQualifierBreakdown)
-	resultChannels := make(map[string]s3ResultChan)
-	for _, level := range getRegionLevels() {
+	levels := getRegionLevels()
+	colName := fmt.Sprintf("s_%s_t_%s", params.SpatialAggFunc, params.TemporalAggFunc)
+	tables := make([]table, len(levels))
+	errs := fanout.Run(ctx, len(levels), s.maxConcurrency, func(ctx context.Context, i int) error {
 		key := fmt.Sprintf("%s/%s/%s/%s/regional/%s/aggs/%s/qualifiers/%s.csv",
-			params.DataID, params.RunID, params.Resolution, params.Feature, level, timestamp, qualifier)
+			params.DataID, params.RunID, params.Resolution, params.Feature, levels[i], timestamp, qualifier)
 		// Want to return all values from one column grouped by region
 		// CSV format:
 		// id,qualifier,s_sum_t_mean,s_mean_t_mean,s_sum_t_sum,s_mean_t_sum
 		// Central African Republic__Bangui,Protests,0.0,0.0,0.0,0.0
 		// Central African Republic__Bangui,Violence against civilians,0.0,0.0,0.0,0.0
 		// Central African Republic__Ouham,Violence against civilians,10.0,10.0,10.0,10.0
-		rc := getFileFromS3Async(s, getBucket(s, params.RunID), aws.String(key))
-		resultChannels[level] = rc
-	}
-	for _, level := range getRegionLevels() {
-		buf := <-resultChannels[level].result
-		err := <-resultChannels[level].err
-		if err != nil {
+		var err error
+		tables[i], err = readTable(ctx, s, getBucket(s, params.RunID), key, &columnSelection{leading: 2, names: []string{colName}})
+		return err
+	})
+	data := make(map[string][]*wm.ModelOutputRegionQualifierBreakdown)
+	for i, level := range levels {
+		if err := errs[i]; err != nil {
 			if wm.ErrorCode(err) == wm.ENOTFOUND {
 				data[level] = []*wm.ModelOutputRegionQualifierBreakdown{}
 				continue
@@ -781,40 +559,25 @@ func (s *Storage) GetQualifierRegional(params wm.DatacubeParams, timestamp strin
 			}
 		}
 
-		// Read and parse csv
+		// Find the index of the target value column
+		t := tables[i]
+		valueColIndex := index(t.columns(), colName)
+		if valueColIndex == -1 {
+			return nil, fmt.Errorf("csv: column, %s does not exist", colName)
+		}
 		regionMap := make(map[string]map[string]float64)
-		r := csv.NewReader(bytes.NewReader(buf))
-		colName := fmt.Sprintf("s_%s_t_%s", params.SpatialAggFunc, params.TemporalAggFunc)
-		valueColIndex := -1
-		isHeader := true
-		for {
-			record, err := r.Read()
-			if err == io.EOF {
-				break
-			}
+		for row := 0; row < t.len(); row++ {
+			region := t.text(row, 0)
+			value, err := t.float(row, valueColIndex)
 			if err != nil {
-				return nil, &wm.Error{Op: op, Err: err}
+				continue
 			}
-			// Parse header and find the index of the target value column
-			if isHeader {
-				valueColIndex = index(record, colName)
-				if valueColIndex == -1 {
-					return nil, fmt.Errorf("csv: column, %s does not exist", colName)
-				}
-				isHeader = false
-			} else {
-				region := record[0]
-				value, err := strconv.ParseFloat(record[valueColIndex], 64)
-				if err != nil {
-					continue
-				}
 
-				if regionValues, ok := regionMap[region]; ok {
-					regionValues[record[1]] = value
-				} else {
-					regionMap[region] = map[string]float64{
-						record[1]: value,
-					}
+			if regionValues, ok := regionMap[region]; ok {
+				regionValues[t.text(row, 1)] = value
+			} else {
+				regionMap[region] = map[string]float64{
+					t.text(row, 1): value,
 				}
 			}
 		}
@@ -838,89 +601,129 @@ func (s *Storage) GetQualifierRegional(params wm.DatacubeParams, timestamp strin
 	return &regionalData, nil
 }
 
-func getTimeseriesFromCsv(s *Storage, key string, params wm.DatacubeParams) ([]*wm.TimeseriesValue, error) {
-	op := "getTimeseriesFromCsv"
-	buf, err := getFileFromS3(s, getBucket(s, params.RunID), aws.String(key))
+// getTimeseriesFromCsv returns the timeseries stored in the csv file with given key, or in its parquet equivalent
+func getTimeseriesFromCsv(ctx context.Context, s *Storage, key string, params wm.DatacubeParams) ([]*wm.TimeseriesValue, error) {
+	valueCol := fmt.Sprintf("s_%s_t_%s", params.SpatialAggFunc, params.TemporalAggFunc)
+	sel := &columnSelection{leading: 1, names: []string{valueCol}}
+	result, err := getParsedFile(ctx, s, getBucket(s, params.RunID), key, valueCol, sel, func(t table) (interface{}, int64, error) {
+		series, err := parseTimeseries(t, params)
+		return series, int64(len(series)) * timeseriesValueSize, err
+	})
 	if err != nil {
 		return nil, err
 	}
+	return deepCloneTs(result.([]*wm.TimeseriesValue)), nil
+}
 
-	// Read and parse csv
+// parseTimeseries parses the timeseries table, reading the values from the column matching the agg functions of params
+func parseTimeseries(t table, params wm.DatacubeParams) ([]*wm.TimeseriesValue, error) {
+	op := "parseTimeseries"
 	series := make([]*wm.TimeseriesValue, 0)
-	r := csv.NewReader(bytes.NewReader(buf))
-	isHeader := true
 	valueCol := fmt.Sprintf("s_%s_t_%s", params.SpatialAggFunc, params.TemporalAggFunc)
-	valueColIndex := -1
-	for {
-		record, err := r.Read()
-		if err == io.EOF {
-			break
-		}
+	valueColIndex := index(t.columns(), valueCol)
+	if valueColIndex == -1 {
+		return nil, &wm.Error{Code: wm.EINVALID, Op: op, Message: fmt.Sprintf("Invalid agg functions. Spatial: %s, Temporal: %s", params.SpatialAggFunc, params.TemporalAggFunc)}
+	}
+	for row := 0; row < t.len(); row++ {
+		timestamp, err := t.integer(row, 0)
 		if err != nil {
 			return nil, &wm.Error{Op: op, Err: err}
 		}
-		// Parse header and find the index of the target value column
-		if isHeader {
-			valueColIndex = index(record, valueCol)
-			if valueColIndex == -1 {
-				return nil, &wm.Error{Code: wm.EINVALID, Op: op, Message: fmt.Sprintf("Invalid agg functions. Spatial: %s, Temporal: %s", params.SpatialAggFunc, params.TemporalAggFunc)}
-			}
-			isHeader = false
-		} else {
-			timestamp, err := strconv.ParseInt(record[0], 10, 64)
-			if err != nil {
-				return nil, &wm.Error{Op: op, Err: err}
-			}
-			value, err := strconv.ParseFloat(record[valueColIndex], 64)
-			if err != nil {
-				continue
-			}
-			series = append(series, &wm.TimeseriesValue{
-				Timestamp: timestamp,
-				Value:     value,
-			})
+		value, err := t.float(row, valueColIndex)
+		if err != nil {
+			continue
 		}
+		series = append(series, &wm.TimeseriesValue{
+			Timestamp: timestamp,
+			Value:     value,
+		})
 	}
 	sortTimeseries(series)
 	return series, nil
 }
 
-// getFileFromS3Async returns a struct include result buf and error channels
-func getFileFromS3Async(s *Storage, bucket string, key *string) s3ResultChan {
-	rc := make(chan []byte)
-	ec := make(chan error)
-	go func() {
-		r, err := getFileFromS3(s, bucket, key)
-		rc <- r
-		ec <- err
-	}()
-	return s3ResultChan{
-		result: rc,
-		err:    ec,
+// getRegionalDataFromCsv returns the regional data stored in the csv file with given key, or in its parquet equivalent
+func getRegionalDataFromCsv(ctx context.Context, s *Storage, key string, params wm.DatacubeParams) ([]wm.ModelOutputAdminData, error) {
+	valueCol := fmt.Sprintf("s_%s_t_%s", params.SpatialAggFunc, params.TemporalAggFunc)
+	sel := &columnSelection{leading: 1, names: []string{valueCol}}
+	result, err := getParsedFile(ctx, s, getBucket(s, params.RunID), key, valueCol, sel, func(t table) (interface{}, int64, error) {
+		points, err := parseRegional(t, params)
+		var size int64
+		for _, p := range points {
+			size += int64(len(p.ID)) + adminDataSize
+		}
+		return points, size, err
+	})
+	if err != nil {
+		return nil, err
 	}
+	points := result.([]wm.ModelOutputAdminData)
+	return append(make([]wm.ModelOutputAdminData, 0, len(points)), points...), nil
 }
 
-func getFileFromS3(s *Storage, bucket string, key *string) ([]byte, error) {
-	op := "getFileFromS3"
-	req, resp := s.client.GetObjectRequest(&s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    key,
-	})
-
-	err := req.Send()
-	if err != nil {
-		reqerr, ok := err.(awserr.RequestFailure)
-		if reqerr.Code() == "NoSuchKey" && ok {
-			return nil, &wm.Error{Code: wm.ENOTFOUND, Message: "Resource not found", Op: op}
+// parseRegional parses the regional aggregation table, reading the values from the column matching the agg functions of params
+func parseRegional(t table, params wm.DatacubeParams) ([]wm.ModelOutputAdminData, error) {
+	op := "parseRegional"
+	points := make([]wm.ModelOutputAdminData, 0)
+	valueCol := fmt.Sprintf("s_%s_t_%s", params.SpatialAggFunc, params.TemporalAggFunc)
+	valueColIndex := index(t.columns(), valueCol)
+	if valueColIndex == -1 {
+		return nil, &wm.Error{Code: wm.EINVALID, Op: op, Message: fmt.Sprintf("Invalid agg functions. Spatial: %s, Temporal: %s", params.SpatialAggFunc, params.TemporalAggFunc)}
+	}
+	for row := 0; row < t.len(); row++ {
+		value, err := t.float(row, valueColIndex)
+		if err != nil {
+			continue
 		}
-		return nil, &wm.Error{Op: op, Err: fmt.Errorf("feetching agg file from S3 returned error for key: %s: %w", *key, err)}
+		points = append(points, wm.ModelOutputAdminData{
+			ID:    t.text(row, 0),
+			Value: value,
+		})
 	}
+	return points, nil
+}
 
-	defer resp.Body.Close()
-	buf, err := ioutil.ReadAll(resp.Body)
-
+// getFile fetches the file with given key from the blob reader
+func getFile(ctx context.Context, s *Storage, bucket string, key string) ([]byte, error) {
+	op := "getFile"
+	buf, err := s.reader.Get(ctx, bucket, key)
 	if err != nil {
-		return nil, &wm.Error{Op: op, Err: fmt.Errorf("error reading response from s3 request: %w", err)}
+		return nil, &wm.Error{Op: op, Err: err}
 	}
 	return buf, nil
 }
+
+// Approximate memory used by parsed values, used to account cached results against the cache budget
+const (
+	timeseriesValueSize = 40
+	adminDataSize       = 40
+)
+
+// getParsedFile returns the result of parsing the selected columns of the output file with given csv key, read
+// from its parquet equivalent if there is one. Results are cached by bucket, key and variant, where variant
+// distinguishes different parses of the same file (eg. the value column). Concurrent calls for the same file and
+// variant share one download and one parse. Results are shared, so callers must not modify them.
+func getParsedFile(ctx context.Context, s *Storage, bucket string, key string, variant string, sel *columnSelection, parse func(t table) (interface{}, int64, error)) (interface{}, error) {
+	op := "getParsedFile"
+	cacheKey := "result:" + bucket + "/" + key + "#" + variant
+	useCache := s.cache.cachesBucket(bucket)
+	if useCache {
+		if v, ok := s.cache.Get(cacheKey); ok {
+			return v, nil
+		}
+	}
+	return s.flights.do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		t, err := readTable(ctx, s, bucket, key, sel)
+		if err != nil {
+			return nil, err
+		}
+		result, size, err := parse(t)
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		if useCache {
+			s.cache.Add(cacheKey, result, size)
+		}
+		return result, nil
+	})
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestGetInfoLists(t *testing.T) {
+	ctx := context.Background()
+	reader := NewMemoryReader()
+	reader.Put("models", "data/run1/raw/rain/info/region_lists.json", []byte(`{"country": ["Ethiopia"], "admin1": ["Ethiopia__Afar"]}`))
+	reader.Put("models", "data/run2/raw/rain/info/region_lists.json", []byte(`{"country": ["Ethiopia", "Kenya"]}`))
+	reader.Put("models", "data/run1/raw/rain/info/qualifiers/crop.json", []byte(`["maize", "teff"]`))
+	s, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{ModelsBucket: "models"}, MaxConcurrency: 1})
+	require.NoError(t, err)
+
+	regions, err := s.GetRegionLists(ctx, wm.RegionListParams{DataID: "data", RunIDs: []string{"run1", "run2"}, Feature: "rain"})
+	require.NoError(t, err)
+	sort.Strings(regions.Country)
+	require.Equal(t, []string{"Ethiopia", "Kenya"}, regions.Country)
+	require.Equal(t, []string{"Ethiopia__Afar"}, regions.Admin1)
+
+	_, err = s.GetRegionLists(ctx, wm.RegionListParams{DataID: "data", RunIDs: []string{"run1", "run3"}, Feature: "rain"})
+	require.Equal(t, wm.ENOTFOUND, wm.ErrorCode(err))
+
+	// Missing qualifiers have no values
+	lists, err := s.GetQualifierLists(ctx, wm.QualifierInfoParams{DataID: "data", RunID: "run1", Feature: "rain"}, []string{"crop", "season"})
+	require.NoError(t, err)
+	require.Equal(t, wm.QualifierListsOutput{"crop": {"maize", "teff"}, "season": {}}, *lists)
+}
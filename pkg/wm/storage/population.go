@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// PopulationConfig defines the population output used as the denominator of the per capita transforms
+type PopulationConfig struct {
+	// Params of the population output. Its available years are the timestamps of its country level regional data
+	Params wm.DatacubeParams
+	// Interpolate linearly interpolates the population between the available years. Otherwise the population of the
+	// latest available year up to the timestamp is used
+	Interpolate bool
+	// TTL is the maximum age of the cached years and regional populations, after which new population data is picked
+	// up. Zero means they are kept for the lifetime of the Storage. Files cached by the Cache are only read again once
+	// they expire from it too
+	TTL time.Duration
+}
+
+// DefaultPopulationParams are the params of the default population output
+var DefaultPopulationParams = wm.DatacubeParams{
+	DataID:          "430d621b-c4cd-4cb2-8d21-1c590522602c",
+	RunID:           "indicator",
+	Feature:         "Population Count",
+	Resolution:      "year",
+	TemporalAggFunc: "sum",
+	SpatialAggFunc:  "sum",
+}
+
+func newPopulationSource(cfg PopulationConfig) *denominatorSource {
+	alignment := wm.AlignLatest
+	if cfg.Interpolate {
+		alignment = wm.AlignInterpolate
+	}
+	d := newDenominatorSource("population", cfg.Params, alignment, cfg.TTL)
+	// The population output is configured on the server, missing population data is not the client's fault
+	d.internal = true
+	return d
+}
+
+// GetPopulationTimeseries returns the population of the region at each of the timestamps. It returns an ENOTFOUND
+// error if the region has no population data
+func (s *Storage) GetPopulationTimeseries(ctx context.Context, regionID string, timestamps []int64) ([]*wm.TimeseriesValue, error) {
+	op := "Storage.GetPopulationTimeseries"
+	population, err := s.getAlignedDenominatorTimeseries(ctx, s.population, regionID, timestamps)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	result := make([]*wm.TimeseriesValue, 0, len(timestamps))
+	for _, timestamp := range timestamps {
+		if value, ok := population[timestamp]; ok {
+			result = append(result, &wm.TimeseriesValue{Timestamp: timestamp, Value: value})
+		}
+	}
+	return result, nil
+}
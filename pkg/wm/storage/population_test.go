@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestPerCapitaPopulation(t *testing.T) {
+	ctx := context.Background()
+	reader := NewMemoryReader()
+	prefix := "pop/indicator/year/population/regional/country/"
+	reader.Put("indicators", prefix+"aggs/0/default/default.csv", []byte("id,s_sum_t_sum\nKenya,100\n"))
+	reader.Put("indicators", prefix+"aggs/10/default/default.csv", []byte("id,s_sum_t_sum\nKenya,200\n"))
+	reader.Put("indicators", prefix+"timeseries/default/Kenya.csv", []byte("timestamp,s_sum_t_sum\n0,100\n10,200\n"))
+	population := &PopulationConfig{
+		Params:      wm.DatacubeParams{DataID: "pop", RunID: "indicator", Feature: "population", Resolution: "year", SpatialAggFunc: "sum", TemporalAggFunc: "sum"},
+		Interpolate: true,
+		TTL:         time.Hour,
+	}
+	s, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{IndicatorsBucket: "indicators"}, Population: population})
+	require.NoError(t, err)
+	now := time.Now()
+	s.population.now = func() time.Time { return now }
+
+	config := wm.TransformConfig{Transform: wm.TransformPerCapita, RegionID: "Kenya"}
+	timeseries, err := s.TransformOutputTimeseriesByRegion(ctx, []*wm.TimeseriesValue{{Timestamp: 5, Value: 300}, {Timestamp: 20, Value: 400}}, config)
+	require.NoError(t, err)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 5, Value: 2}, {Timestamp: 20, Value: 2}}, timeseries)
+	weights, err := s.GetPopulationTimeseries(ctx, "Kenya", []int64{5, 20})
+	require.NoError(t, err)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 5, Value: 150}, {Timestamp: 20, Value: 200}}, weights)
+	// A region without population data is not found, but per capita can't be computed without it
+	_, err = s.GetPopulationTimeseries(ctx, "Somalia", []int64{5})
+	require.Equal(t, wm.ENOTFOUND, wm.ErrorCode(err))
+	_, err = s.TransformOutputTimeseriesByRegion(ctx, []*wm.TimeseriesValue{{Timestamp: 5, Value: 300}}, wm.TransformConfig{Transform: wm.TransformPerCapita, RegionID: "Somalia"})
+	require.Equal(t, wm.EINTERNAL, wm.ErrorCode(err))
+
+	regional := func(timestamp string) float64 {
+		data := &wm.ModelOutputRegionalAdmins{Country: []wm.ModelOutputAdminData{{ID: "Kenya", Value: 600}}}
+		result, err := s.TransformRegionAggregation(ctx, data, timestamp, config)
+		require.NoError(t, err)
+		return result.Country[0].Value
+	}
+	require.Equal(t, 4.0, regional("5"))
+	require.Equal(t, 3.0, regional("30"))
+
+	// New years are only used once the cached population expires
+	reader.Put("indicators", prefix+"aggs/20/default/default.csv", []byte("id,s_sum_t_sum\nKenya,600\n"))
+	require.Equal(t, 3.0, regional("30"))
+	now = now.Add(time.Hour)
+	require.Equal(t, 1.0, regional("30"))
+
+	_, err = s.TransformRegionAggregation(ctx, &wm.ModelOutputRegionalAdmins{}, "x", config)
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+}
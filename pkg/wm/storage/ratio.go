@@ -0,0 +1,355 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// denominatorSource serves the data of the denominator of a ratio, caching its available timestamps and its regional
+// data by timestamp
+type denominatorSource struct {
+	// name of the denominator in error messages
+	name      string
+	params    wm.DatacubeParams
+	alignment wm.TemporalAlignment
+	ttl       time.Duration
+	// internal is set for the denominators configured on the server, whose missing data is an internal error
+	internal bool
+	now      func() time.Time
+
+	mu sync.Mutex
+	// generation counts the invalidations, so that data loaded before an invalidation is not cached after it
+	generation uint64
+	// expires is when the cached data expires, zero if it doesn't or if nothing is cached
+	expires    time.Time
+	timestamps []int64
+	regional   map[int64]map[string]float64
+}
+
+func newDenominatorSource(name string, params wm.DatacubeParams, alignment wm.TemporalAlignment, ttl time.Duration) *denominatorSource {
+	return &denominatorSource{
+		name:      name,
+		params:    params,
+		alignment: alignment,
+		ttl:       ttl,
+		now:       time.Now,
+		regional:  make(map[int64]map[string]float64),
+	}
+}
+
+// newRatioDenominator returns the denominator of the ratio transform of the config, which is only cached for the
+// duration of the transform
+func newRatioDenominator(config wm.TransformConfig) (*denominatorSource, error) {
+	op := "newRatioDenominator"
+	d := config.Denominator
+	if d == nil || d.DataID == "" || d.RunID == "" || d.Feature == "" || d.Resolution == "" || d.TemporalAggFunc == "" || d.SpatialAggFunc == "" {
+		return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: "Transform ratio requires a denominator datacube"}
+	}
+	alignment := config.Alignment
+	switch alignment {
+	case "":
+		alignment = wm.AlignLatest
+	case wm.AlignLatest, wm.AlignInterpolate, wm.AlignExact:
+	default:
+		return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: fmt.Sprintf("Invalid alignment %s", alignment)}
+	}
+	return newDenominatorSource("denominator", *d, alignment, 0), nil
+}
+
+func (d *denominatorSource) invalidateLocked() {
+	d.generation++
+	d.expires = time.Time{}
+	d.timestamps = nil
+	d.regional = make(map[int64]map[string]float64)
+}
+
+// lock locks the cache, invalidating it if it expired
+func (d *denominatorSource) lock() {
+	d.mu.Lock()
+	if !d.expires.IsZero() && !d.now().Before(d.expires) {
+		d.invalidateLocked()
+	}
+}
+
+// filledLocked starts the expiry of the cache once something is cached
+func (d *denominatorSource) filledLocked() {
+	if d.expires.IsZero() && d.ttl > 0 {
+		d.expires = d.now().Add(d.ttl)
+	}
+}
+
+// missing returns the error of denominator data that can't be read. Unless the denominator is internal, it keeps the
+// code of err, if any
+func (d *denominatorSource) missing(op string, message string, err error) error {
+	var code string
+	switch {
+	case d.internal:
+		code = wm.EINTERNAL
+	case err == nil:
+		code = wm.ENOTFOUND
+	}
+	return &wm.Error{Op: op, Code: code, Message: message, Err: err}
+}
+
+// getDenominatorTimestamps returns the sorted available timestamps of the denominator
+func (s *Storage) getDenominatorTimestamps(ctx context.Context, d *denominatorSource) ([]int64, error) {
+	op := "Storage.getDenominatorTimestamps"
+	d.lock()
+	timestamps, generation := d.timestamps, d.generation
+	d.mu.Unlock()
+	if timestamps != nil {
+		return timestamps, nil
+	}
+
+	params := d.params
+	params.AdminLevel = wm.AdminLevelCountry
+	timestamps, err := s.GetTimestamps(ctx, params)
+	if err != nil {
+		return nil, d.missing(op, "", err)
+	}
+	if len(timestamps) == 0 {
+		return nil, d.missing(op, fmt.Sprintf("No %s data available", d.name), nil)
+	}
+
+	d.lock()
+	if d.generation == generation {
+		d.timestamps = timestamps
+		d.filledLocked()
+	}
+	d.mu.Unlock()
+	return timestamps, nil
+}
+
+// getDenominatorLookup returns a lookup table that maps region id to the value of the denominator for the region at
+// given available timestamp
+func (s *Storage) getDenominatorLookup(ctx context.Context, d *denominatorSource, timestamp int64) (map[string]float64, error) {
+	op := "Storage.getDenominatorLookup"
+	d.lock()
+	lookup, ok := d.regional[timestamp]
+	generation := d.generation
+	d.mu.Unlock()
+	if ok {
+		return lookup, nil
+	}
+
+	regional, err := s.GetRegionAggregation(ctx, d.params, strconv.FormatInt(timestamp, 10))
+	if err != nil {
+		if wm.ErrorCode(err) == wm.ENOTFOUND {
+			return nil, d.missing(op, "", err)
+		}
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	lookup = make(map[string]float64)
+	for _, data := range [][]wm.ModelOutputAdminData{regional.Country, regional.Admin1, regional.Admin2, regional.Admin3} {
+		for _, v := range data {
+			lookup[v.ID] = v.Value
+		}
+	}
+
+	d.lock()
+	if d.generation == generation {
+		d.regional[timestamp] = lookup
+		d.filledLocked()
+	}
+	d.mu.Unlock()
+	return lookup, nil
+}
+
+// getRegionalDenominator returns a lookup table that maps region id to the value of the denominator for the region
+// aligned with given timestamp. It is empty if the denominator has no value aligned with the timestamp.
+func (s *Storage) getRegionalDenominator(ctx context.Context, d *denominatorSource, timestamp string) (map[string]float64, error) {
+	op := "Storage.getRegionalDenominator"
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: "Invalid timestamp", Err: err}
+	}
+	timestamps, err := s.getDenominatorTimestamps(ctx, d)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+
+	i, j, w, ok := alignAt(timestamps, ts, d.alignment)
+	if !ok {
+		return map[string]float64{}, nil
+	}
+	from, err := s.getDenominatorLookup(ctx, d, timestamps[i])
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if i == j {
+		return from, nil
+	}
+	to, err := s.getDenominatorLookup(ctx, d, timestamps[j])
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	// Regions missing from the later timestamp keep their value at the earlier timestamp
+	lookup := make(map[string]float64, len(from))
+	for id, a := range from {
+		lookup[id] = a
+		if b, ok := to[id]; ok {
+			lookup[id] = a + (b-a)*w
+		}
+	}
+	return lookup, nil
+}
+
+// getDenominatorTimeseries returns the timeseries of the denominator for the region, sorted by timestamp. It returns
+// an ENOTFOUND error if the region has no denominator data, even for an internal denominator.
+func (s *Storage) getDenominatorTimeseries(ctx context.Context, d *denominatorSource, regionID string) ([]*wm.TimeseriesValue, error) {
+	op := "Storage.getDenominatorTimeseries"
+	timeseries, err := s.GetOutputTimeseriesByRegion(ctx, d.params, regionID)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if len(timeseries) == 0 {
+		return nil, &wm.Error{Op: op, Code: wm.ENOTFOUND, Message: fmt.Sprintf("No %s data available for region %s", d.name, regionID)}
+	}
+	sorted := make([]*wm.TimeseriesValue, len(timeseries))
+	copy(sorted, timeseries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+	return sorted, nil
+}
+
+// alignAt returns how to compute the denominator at the timestamp from its values at its sorted timestamps: as the
+// value at i interpolated towards the value at j by the weight w. ok is false if the denominator has no value aligned
+// with the timestamp. Outside of the timestamps, the latest value up to the timestamp, or the first value for a
+// timestamp before all the timestamps, is used by the latest and interpolate alignments.
+func alignAt(timestamps []int64, timestamp int64, alignment wm.TemporalAlignment) (i int, j int, w float64, ok bool) {
+	// Index of the first timestamp after the timestamp
+	n := sort.Search(len(timestamps), func(k int) bool { return timestamps[k] > timestamp })
+	switch {
+	case alignment == wm.AlignExact:
+		return n - 1, n - 1, 0, n > 0 && timestamps[n-1] == timestamp
+	case n == 0:
+		return 0, 0, 0, true
+	case n == len(timestamps) || alignment != wm.AlignInterpolate || timestamps[n-1] == timestamp:
+		return n - 1, n - 1, 0, true
+	}
+	from, to := timestamps[n-1], timestamps[n]
+	return n - 1, n, float64(timestamp-from) / float64(to-from), true
+}
+
+// transformRatioTimeseries divides the values of the timeseries of the region by the aligned values of the denominator
+// for the region. The points without a denominator value, or with a denominator value of 0, are left out.
+func (s *Storage) transformRatioTimeseries(ctx context.Context, timeseries []*wm.TimeseriesValue, d *denominatorSource, regionID string, scaleFactor float64) ([]*wm.TimeseriesValue, error) {
+	op := "Storage.transformRatioTimeseries"
+	timestamps := make([]int64, len(timeseries))
+	for i, v := range timeseries {
+		timestamps[i] = v.Timestamp
+	}
+	denominator, err := s.getAlignedDenominatorTimeseries(ctx, d, regionID, timestamps)
+	if err != nil {
+		if wm.ErrorCode(err) == wm.ENOTFOUND {
+			return nil, d.missing(op, "", err)
+		}
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if scaleFactor == 0 {
+		scaleFactor = 1
+	}
+
+	result := make([]*wm.TimeseriesValue, 0)
+	for _, v := range timeseries {
+		value, ok := denominator[v.Timestamp]
+		if !ok || value == 0 {
+			continue
+		}
+		result = append(result, &wm.TimeseriesValue{Timestamp: v.Timestamp, Value: (v.Value / value) * scaleFactor})
+	}
+	return result, nil
+}
+
+// getAlignedDenominatorTimeseries returns the values of the denominator for the region aligned with the timestamps, by
+// timestamp. The timestamps without an aligned value are left out.
+func (s *Storage) getAlignedDenominatorTimeseries(ctx context.Context, d *denominatorSource, regionID string, timestamps []int64) (map[int64]float64, error) {
+	op := "Storage.getAlignedDenominatorTimeseries"
+	denominator, err := s.getDenominatorTimeseries(ctx, d, regionID)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	available := make([]int64, len(denominator))
+	for i, v := range denominator {
+		available[i] = v.Timestamp
+	}
+
+	result := make(map[int64]float64, len(timestamps))
+	for _, timestamp := range timestamps {
+		if i, j, w, ok := alignAt(available, timestamp, d.alignment); ok {
+			result[timestamp] = denominator[i].Value + (denominator[j].Value-denominator[i].Value)*w
+		}
+	}
+	return result, nil
+}
+
+// transformRatioRegionAggregation divides the value of each region by the aligned value of the denominator for the
+// region. The regions without a denominator value, or with a denominator value of 0, are left out.
+func (s *Storage) transformRatioRegionAggregation(ctx context.Context, data *wm.ModelOutputRegionalAdmins, timestamp string, d *denominatorSource, scaleFactor float64) (*wm.ModelOutputRegionalAdmins, error) {
+	op := "Storage.transformRatioRegionAggregation"
+	lookup, err := s.getRegionalDenominator(ctx, d, timestamp)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if scaleFactor == 0 {
+		scaleFactor = 1
+	}
+
+	resultAdminDataList := [4][]wm.ModelOutputAdminData{}
+	for i, data := range [][]wm.ModelOutputAdminData{data.Country, data.Admin1, data.Admin2, data.Admin3} {
+		for _, v := range data {
+			if value, ok := lookup[v.ID]; ok && value != 0 {
+				resultAdminDataList[i] = append(resultAdminDataList[i], wm.ModelOutputAdminData{ID: v.ID, Value: (v.Value / value) * scaleFactor})
+			}
+		}
+	}
+	result := &wm.ModelOutputRegionalAdmins{
+		Country: resultAdminDataList[0],
+		Admin1:  resultAdminDataList[1],
+		Admin2:  resultAdminDataList[2],
+		Admin3:  resultAdminDataList[3],
+	}
+	return result, nil
+}
+
+// transformRatioQualifierRegional divides the values of each region by the aligned value of the denominator for the
+// region. The regions without a denominator value, or with a denominator value of 0, are left out.
+func (s *Storage) transformRatioQualifierRegional(ctx context.Context, data *wm.ModelOutputRegionalQualifiers, timestamp string, d *denominatorSource, scaleFactor float64) (*wm.ModelOutputRegionalQualifiers, error) {
+	op := "Storage.transformRatioQualifierRegional"
+	lookup, err := s.getRegionalDenominator(ctx, d, timestamp)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if scaleFactor == 0 {
+		scaleFactor = 1
+	}
+
+	divide := func(values map[string]float64, denominator float64) map[string]float64 {
+		result := make(map[string]float64)
+		for k, v := range values {
+			result[k] = (v / denominator) * scaleFactor
+		}
+		return result
+	}
+
+	resultAdminDataList := [4][]wm.ModelOutputRegionQualifierBreakdown{}
+	for i, data := range [][]wm.ModelOutputRegionQualifierBreakdown{data.Country, data.Admin1, data.Admin2, data.Admin3} {
+		for _, v := range data {
+			if value, ok := lookup[v.ID]; ok && value != 0 {
+				resultAdminDataList[i] = append(resultAdminDataList[i], wm.ModelOutputRegionQualifierBreakdown{ID: v.ID, Values: divide(v.Values, value)})
+			}
+		}
+	}
+	result := &wm.ModelOutputRegionalQualifiers{
+		Country: resultAdminDataList[0],
+		Admin1:  resultAdminDataList[1],
+		Admin2:  resultAdminDataList[2],
+		Admin3:  resultAdminDataList[3],
+	}
+	return result, nil
+}
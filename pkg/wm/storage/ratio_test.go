@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestAlignAt(t *testing.T) {
+	timestamps := []int64{10, 20, 40}
+	tests := []struct {
+		timestamp int64
+		alignment wm.TemporalAlignment
+		i, j      int
+		w         float64
+		ok        bool
+	}{
+		{0, wm.AlignInterpolate, 0, 0, 0, true},
+		{10, wm.AlignInterpolate, 0, 0, 0, true},
+		{15, wm.AlignLatest, 0, 0, 0, true},
+		{15, wm.AlignInterpolate, 0, 1, 0.5, true},
+		{25, wm.AlignInterpolate, 1, 2, 0.25, true},
+		{40, wm.AlignInterpolate, 2, 2, 0, true},
+		{50, wm.AlignInterpolate, 2, 2, 0, true},
+		{0, wm.AlignExact, -1, -1, 0, false},
+		{15, wm.AlignExact, 0, 0, 0, false},
+		{20, wm.AlignExact, 1, 1, 0, true},
+	}
+	for _, tt := range tests {
+		i, j, w, ok := alignAt(timestamps, tt.timestamp, tt.alignment)
+		require.Equal(t, []interface{}{tt.i, tt.j, tt.w, tt.ok}, []interface{}{i, j, w, ok}, "%s at %d", tt.alignment, tt.timestamp)
+	}
+}
+
+func TestRatio(t *testing.T) {
+	ctx := context.Background()
+	reader := NewMemoryReader()
+	prefix := "area/run/month/cropland/regional/"
+	reader.Put("models", prefix+"country/aggs/10/default/default.csv", []byte("id,s_mean_t_mean\nKenya,2\nEthiopia,0\n"))
+	reader.Put("models", prefix+"country/aggs/20/default/default.csv", []byte("id,s_mean_t_mean\nKenya,4\n"))
+	reader.Put("models", prefix+"admin1/aggs/10/default/default.csv", []byte("id,s_mean_t_mean\nKenya__Nairobi,1\n"))
+	reader.Put("models", prefix+"country/timeseries/default/Kenya.csv", []byte("timestamp,s_mean_t_mean\n20,4\n10,2\n"))
+	s, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{ModelsBucket: "models"}})
+	require.NoError(t, err)
+	denominator := &wm.DatacubeParams{DataID: "area", RunID: "run", Feature: "cropland", Resolution: "month", SpatialAggFunc: "mean", TemporalAggFunc: "mean"}
+
+	timeseries := []*wm.TimeseriesValue{{Timestamp: 10, Value: 8}, {Timestamp: 15, Value: 9}, {Timestamp: 20, Value: 8}}
+	config := wm.TransformConfig{Transform: wm.TransformRatio, RegionID: "Kenya", Denominator: denominator, ScaleFactor: 10}
+	got, err := s.TransformOutputTimeseriesByRegion(ctx, timeseries, config)
+	require.NoError(t, err)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 10, Value: 40}, {Timestamp: 15, Value: 45}, {Timestamp: 20, Value: 20}}, got)
+	config.Alignment = wm.AlignExact
+	got, err = s.TransformOutputTimeseriesByRegion(ctx, timeseries, config)
+	require.NoError(t, err)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 10, Value: 40}, {Timestamp: 20, Value: 20}}, got)
+
+	// Ethiopia has a denominator of 0, and Somalia none, so they are left out
+	config = wm.TransformConfig{Transform: wm.TransformRatio, Denominator: denominator, Alignment: wm.AlignInterpolate}
+	regional, err := s.TransformRegionAggregation(ctx, &wm.ModelOutputRegionalAdmins{
+		Country: []wm.ModelOutputAdminData{{ID: "Kenya", Value: 6}, {ID: "Ethiopia", Value: 1}, {ID: "Somalia", Value: 1}},
+		Admin1:  []wm.ModelOutputAdminData{{ID: "Kenya__Nairobi", Value: 2}},
+	}, "15", config)
+	require.NoError(t, err)
+	require.Equal(t, &wm.ModelOutputRegionalAdmins{
+		Country: []wm.ModelOutputAdminData{{ID: "Kenya", Value: 2}},
+		Admin1:  []wm.ModelOutputAdminData{{ID: "Kenya__Nairobi", Value: 2}},
+	}, regional)
+
+	qualifiers, err := s.TransformQualifierRegional(ctx, &wm.ModelOutputRegionalQualifiers{
+		Country: []wm.ModelOutputRegionQualifierBreakdown{{ID: "Kenya", Values: map[string]float64{"maize": 3, "rice": 6}}},
+	}, "10", config)
+	require.NoError(t, err)
+	require.Equal(t, []wm.ModelOutputRegionQualifierBreakdown{{ID: "Kenya", Values: map[string]float64{"maize": 1.5, "rice": 3}}}, qualifiers.Country)
+
+	// Without a denominator value at the timestamp, all the regions are left out
+	config.Alignment = wm.AlignExact
+	regional, err = s.TransformRegionAggregation(ctx, &wm.ModelOutputRegionalAdmins{Country: []wm.ModelOutputAdminData{{ID: "Kenya", Value: 6}}}, "15", config)
+	require.NoError(t, err)
+	require.Empty(t, regional.Country)
+
+	for _, config := range []wm.TransformConfig{
+		{Transform: wm.TransformRatio, RegionID: "Kenya"},
+		{Transform: wm.TransformRatio, RegionID: "Kenya", Denominator: &wm.DatacubeParams{DataID: "area"}},
+		{Transform: wm.TransformRatio, RegionID: "Kenya", Denominator: denominator, Alignment: "nearest"},
+	} {
+		_, err = s.TransformOutputTimeseriesByRegion(ctx, timeseries, config)
+		require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+	}
+	_, err = s.TransformOutputTimeseriesByRegion(ctx, timeseries, wm.TransformConfig{Transform: wm.TransformRatio, RegionID: "Somalia", Denominator: denominator})
+	require.Equal(t, wm.ENOTFOUND, wm.ErrorCode(err))
+	_, err = s.TransformRegionAggregationByAdminLevel(ctx, &wm.ModelOutputRegional{}, wm.TransformConfig{Transform: wm.TransformRatio, Denominator: denominator})
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+}
@@ -0,0 +1,571 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/parquet"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// Size of the chunks of a raw data file fetched at a time when streaming it
+const rawDataChunkSize = 1 << 20
+
+// Columns of the raw data csv files, the other columns are qualifiers
+var rawDataColSet = map[string]bool{"timestamp": true, "country": true, "admin1": true, "admin2": true, "admin3": true, "lat": true, "lng": true, "value": true}
+
+// GetRawData returns datacube output or indicator raw data matching the filter
+func (s *Storage) GetRawData(ctx context.Context, params wm.DatacubeParams, filter wm.RawDataFilter) ([]*wm.ModelOutputRawDataPoint, error) {
+	op := "Storage.GetRawData"
+	bucket := getBucket(s, params.RunID)
+	key := rawDataKey(params)
+	data := make([]*wm.ModelOutputRawDataPoint, 0)
+	f, _, err := openParquet(ctx, s, bucket, key)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+
+	var r rawDataReader
+	var header []string
+	if f != nil {
+		tr := newTableRecordReader(f)
+		r, header = tr, tr.names
+	} else {
+		buf, err := getFile(ctx, s, bucket, key)
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		cr := newCSVRecordReader(bytes.NewReader(buf), 0)
+		if header, err = cr.Read(); err == io.EOF {
+			return data, nil
+		} else if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		r = cr
+	}
+	cols := newRawDataColumns(header)
+	if _, err := readRawData(r, cols, len(header), &filter, func(point *wm.ModelOutputRawDataPoint) error {
+		data = append(data, point)
+		return nil
+	}); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	return data, nil
+}
+
+// GetRawDataQualifiers returns the names of the qualifier columns of the raw data in file order, only reading the
+// header of the file
+func (s *Storage) GetRawDataQualifiers(ctx context.Context, params wm.DatacubeParams) ([]string, error) {
+	op := "Storage.GetRawDataQualifiers"
+	header, err := getTableHeader(ctx, s, getBucket(s, params.RunID), rawDataKey(params))
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	qualifiers := make([]string, 0)
+	for _, name := range header {
+		if !rawDataColSet[name] {
+			qualifiers = append(qualifiers, name)
+		}
+	}
+	return qualifiers, nil
+}
+
+// StreamRawData calls fn with each raw data point matching the filter as it is decoded, fetching a csv file a chunk
+// at a time. It starts at the cursor if set, skips opts.Offset points, and stops after opts.Limit points if it is
+// positive. It returns the cursor of the next point, or an empty cursor once all the points have been read. Offsets
+// and cursors count the matching points only, so a cursor is only valid with the same filter. Cursors of a file that
+// has since been rewritten, ie. whose size or modification time changed, are rejected.
+func (s *Storage) StreamRawData(ctx context.Context, params wm.DatacubeParams, opts wm.RawDataOptions, fn func(point *wm.ModelOutputRawDataPoint) error) (string, error) {
+	op := "Storage.StreamRawData"
+	bucket := getBucket(s, params.RunID)
+	key := rawDataKey(params)
+	var cursor rawDataCursor
+	if opts.Cursor != "" {
+		var ok bool
+		if cursor, ok = parseRawDataCursor(opts.Cursor); !ok {
+			return "", &wm.Error{Op: op, Code: wm.EINVALID, Message: "Invalid cursor"}
+		}
+	}
+	f, info, err := openParquet(ctx, s, bucket, key)
+	if err != nil {
+		return "", &wm.Error{Op: op, Err: err}
+	}
+
+	var r rawDataReader
+	var header []string
+	var size int64
+	if f != nil {
+		// The cursor is the row of the next record
+		size = f.NumRows()
+		if opts.Cursor != "" && !cursor.matches(size, info) {
+			return "", &wm.Error{Op: op, Code: wm.EINVALID, Message: "Invalid cursor"}
+		}
+		tr := newTableRecordReader(f)
+		tr.setCursor(cursor.position)
+		r, header = tr, tr.names
+	} else {
+		// The cursor is the byte offset of the next record
+		info, err = s.reader.Stat(ctx, bucket, key)
+		if err != nil {
+			return "", &wm.Error{Op: op, Err: err}
+		}
+		size = info.Size
+		if opts.Cursor != "" && !cursor.matches(size, info) {
+			return "", &wm.Error{Op: op, Code: wm.EINVALID, Message: "Invalid cursor"}
+		}
+		cr := newCSVRecordReader(newRangeReader(ctx, s.reader, bucket, key, cursor.position, size), cursor.position)
+		if cursor.position > 0 {
+			if header, err = getCsvHeader(ctx, s, bucket, key); err != nil {
+				return "", &wm.Error{Op: op, Err: err}
+			}
+		} else if header, err = cr.Read(); err == io.EOF {
+			return "", nil
+		} else if err != nil {
+			return "", &wm.Error{Op: op, Err: err}
+		}
+		r = cr
+	}
+
+	cols := newRawDataColumns(header)
+	skipped, read := 0, 0
+	more, err := readRawData(r, cols, len(header), &opts.Filter, func(point *wm.ModelOutputRawDataPoint) error {
+		if skipped < opts.Offset {
+			skipped++
+			return nil
+		}
+		if opts.Limit > 0 && read >= opts.Limit {
+			return errPageFull
+		}
+		read++
+		return fn(point)
+	})
+	if err != nil {
+		return "", &wm.Error{Op: op, Err: err}
+	}
+	if !more {
+		return "", nil
+	}
+	return rawDataCursor{position: r.cursor(), size: size, modified: info.LastModified.UnixNano()}.encode(), nil
+}
+
+// rawDataCursor is the position of the next record of a raw data file along with the size of the file, both in bytes
+// for csv files and in rows for parquet files, and the modification time of the file in nanoseconds
+type rawDataCursor struct {
+	position int64
+	size     int64
+	modified int64
+}
+
+// matches returns whether the cursor is a cursor of the file with given size and info, ie. the file hasn't been
+// rewritten since
+func (c rawDataCursor) matches(size int64, info *ObjectInfo) bool {
+	return c.size == size && c.modified == info.LastModified.UnixNano()
+}
+
+// encode returns the cursor as an opaque string
+func (c rawDataCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d.%d", c.position, c.size, c.modified)))
+}
+
+// parseRawDataCursor returns the cursor encoded in v, and whether it is valid
+func parseRawDataCursor(v string) (rawDataCursor, bool) {
+	buf, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return rawDataCursor{}, false
+	}
+	parts := strings.Split(string(buf), ".")
+	if len(parts) != 3 {
+		return rawDataCursor{}, false
+	}
+	position, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return rawDataCursor{}, false
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || position <= 0 || position > size {
+		return rawDataCursor{}, false
+	}
+	modified, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return rawDataCursor{}, false
+	}
+	return rawDataCursor{position: position, size: size, modified: modified}, true
+}
+
+// errPageFull stops reading raw data once a page is full
+var errPageFull = errors.New("page full")
+
+// recordError is the error of a record that can't be parsed
+type recordError struct {
+	err error
+}
+
+func (e *recordError) Error() string {
+	return e.err.Error()
+}
+
+// rawDataReader reads the records of a raw data file one at a time, and keeps track of the cursor of the next record
+type rawDataReader interface {
+	Read() ([]string, error)
+	cursor() int64
+	setCursor(cursor int64)
+}
+
+// readRawData calls fn with each raw data point read from r that matches the filter. If fn returns errPageFull,
+// reading stops and the cursor of r is left at the record of the point, and readRawData returns true. Records must
+// have numFields fields. A malformed first record after a cursor is an EINVALID error, as the cursor doesn't point at
+// the start of a record.
+func readRawData(r rawDataReader, cols *rawDataColumns, numFields int, filter *wm.RawDataFilter, fn func(point *wm.ModelOutputRawDataPoint) error) (bool, error) {
+	op := "readRawData"
+	first := r.cursor()
+	malformed := func(start int64, err error) error {
+		if start == first && first > 0 {
+			return &wm.Error{Op: op, Code: wm.EINVALID, Message: "Invalid cursor", Err: err}
+		}
+		return &wm.Error{Op: op, Err: err}
+	}
+	for {
+		start := r.cursor()
+		record, err := r.Read()
+		if err == io.EOF {
+			return false, nil
+		}
+		if _, ok := err.(*recordError); ok {
+			return false, malformed(start, err)
+		}
+		if err != nil {
+			return false, &wm.Error{Op: op, Err: err}
+		}
+		if len(record) != numFields {
+			return false, malformed(start, fmt.Errorf("record at cursor %d: wrong number of fields", start))
+		}
+		point, err := cols.parse(record)
+		if err != nil {
+			return false, malformed(start, err)
+		}
+		if !matchRawDataPoint(filter, point) {
+			continue
+		}
+		if err := fn(point); err == errPageFull {
+			r.setCursor(start)
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+}
+
+// matchRawDataPoint returns whether the point matches all the set fields of the filter
+func matchRawDataPoint(filter *wm.RawDataFilter, point *wm.ModelOutputRawDataPoint) bool {
+	if filter.StartTime != nil && point.Timestamp < *filter.StartTime {
+		return false
+	}
+	if filter.EndTime != nil && point.Timestamp > *filter.EndTime {
+		return false
+	}
+	if !matchAny(filter.Country, point.Country) || !matchAny(filter.Admin1, point.Admin1) ||
+		!matchAny(filter.Admin2, point.Admin2) || !matchAny(filter.Admin3, point.Admin3) {
+		return false
+	}
+	if b := filter.Bound; b != nil {
+		if point.Lat == nil || point.Lng == nil ||
+			*point.Lat > b.TopLeft.Lat || *point.Lat < b.BottomRight.Lat ||
+			*point.Lng < b.TopLeft.Lon || *point.Lng > b.BottomRight.Lon {
+			return false
+		}
+	}
+	for name, values := range filter.Qualifiers {
+		if v, ok := point.Qualifiers[name]; !ok || !matchAny(values, v) {
+			return false
+		}
+	}
+	if filter.MinValue != nil || filter.MaxValue != nil {
+		if point.Value == nil ||
+			(filter.MinValue != nil && *point.Value < *filter.MinValue) ||
+			(filter.MaxValue != nil && *point.Value > *filter.MaxValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny returns whether v is one of the values, or true if there are no values
+func matchAny(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, val := range values {
+		if val == v {
+			return true
+		}
+	}
+	return false
+}
+
+func rawDataKey(params wm.DatacubeParams) string {
+	return fmt.Sprintf("%s/%s/raw/%s/raw/raw.csv", params.DataID, params.RunID, params.Feature)
+}
+
+// rawDataColumns holds the index of the columns of a raw data csv file
+type rawDataColumns struct {
+	required   map[string]int
+	qualifiers map[string]int
+}
+
+func newRawDataColumns(header []string) *rawDataColumns {
+	cols := &rawDataColumns{required: make(map[string]int), qualifiers: make(map[string]int)}
+	for i, v := range header {
+		if rawDataColSet[v] {
+			cols.required[v] = i
+		} else {
+			cols.qualifiers[v] = i
+		}
+	}
+	return cols
+}
+
+// parse returns the raw data point of the record. Empty coordinates and values are left nil.
+func (cols *rawDataColumns) parse(record []string) (*wm.ModelOutputRawDataPoint, error) {
+	op := "rawDataColumns.parse"
+	field := func(name string) string {
+		if index, ok := cols.required[name]; ok && index < len(record) {
+			return record[index]
+		}
+		return ""
+	}
+	optionalFloat := func(name string) (*float64, error) {
+		v := field(name)
+		if v == "" {
+			return nil, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &f, nil
+	}
+
+	dataPoint := &wm.ModelOutputRawDataPoint{
+		Country: field("country"),
+		Admin1:  field("admin1"),
+		Admin2:  field("admin2"),
+		Admin3:  field("admin3"),
+	}
+	var err error
+	if _, ok := cols.required["timestamp"]; ok {
+		if dataPoint.Timestamp, err = strconv.ParseInt(field("timestamp"), 10, 64); err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+	}
+	if dataPoint.Lat, err = optionalFloat("lat"); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if dataPoint.Lng, err = optionalFloat("lng"); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if dataPoint.Value, err = optionalFloat("value"); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	// Add extra columns
+	dataPoint.Qualifiers = make(map[string]string, len(cols.qualifiers))
+	for col, index := range cols.qualifiers {
+		if index < len(record) {
+			dataPoint.Qualifiers[col] = record[index]
+		}
+	}
+	return dataPoint, nil
+}
+
+// rangeReader is an io.Reader over an object, fetching it a chunk at a time from the offset
+type rangeReader struct {
+	ctx    context.Context
+	reader BlobReader
+	bucket string
+	key    string
+	offset int64
+	size   int64
+	buf    []byte
+}
+
+func newRangeReader(ctx context.Context, reader BlobReader, bucket string, key string, offset int64, size int64) *rangeReader {
+	return &rangeReader{ctx: ctx, reader: reader, bucket: bucket, key: key, offset: offset, size: size}
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+		chunk, err := r.reader.GetRange(r.ctx, r.bucket, r.key, r.offset, rawDataChunkSize)
+		if err != nil {
+			return 0, err
+		}
+		if len(chunk) == 0 {
+			return 0, io.EOF
+		}
+		r.offset += int64(len(chunk))
+		r.buf = chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// csvRecordReader reads csv records one at a time and keeps track of the byte offset of the next record in the
+// file, so that reading can resume from there. Empty lines are skipped.
+type csvRecordReader struct {
+	r      *bufio.Reader
+	offset int64
+}
+
+// newCSVRecordReader returns a csvRecordReader reading r, which starts at offset in the file
+func newCSVRecordReader(r io.Reader, offset int64) *csvRecordReader {
+	return &csvRecordReader{r: bufio.NewReader(r), offset: offset}
+}
+
+// Read returns the fields of the next record
+func (cr *csvRecordReader) Read() ([]string, error) {
+	for {
+		var line []byte
+		for {
+			part, err := cr.r.ReadBytes('\n')
+			line = append(line, part...)
+			if err == io.EOF {
+				if len(line) == 0 {
+					return nil, io.EOF
+				}
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			// A newline within a quoted field doesn't end the record
+			if bytes.Count(line, []byte{'"'})%2 == 0 {
+				break
+			}
+		}
+		cr.offset += int64(len(line))
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) > 0 {
+			fields, err := parseCSVLine(line)
+			if err != nil {
+				return nil, &recordError{err}
+			}
+			return fields, nil
+		}
+	}
+}
+
+func (cr *csvRecordReader) cursor() int64 {
+	return cr.offset
+}
+
+// setCursor only updates the offset of the next record, it doesn't move the reader
+func (cr *csvRecordReader) setCursor(cursor int64) {
+	cr.offset = cursor
+}
+
+// tableRecordReader reads the rows of a parquet file as records, decoding one row group at a time. Its cursor is the
+// row of the next record.
+type tableRecordReader struct {
+	f     *parquet.File
+	names []string
+	// starts holds the first row of each row group, followed by the number of rows
+	starts []int64
+	// group is the index of the decoded row group t, or -1 if none is
+	group int
+	t     *parquetTable
+	row   int64
+}
+
+// newTableRecordReader returns a reader of the rows of the parquet file. Row groups are only fetched once read.
+func newTableRecordReader(f *parquet.File) *tableRecordReader {
+	starts := make([]int64, f.NumRowGroups()+1)
+	for i := 0; i < f.NumRowGroups(); i++ {
+		starts[i+1] = starts[i] + f.RowGroupNumRows(i)
+	}
+	return &tableRecordReader{f: f, names: f.Columns(), starts: starts, group: -1}
+}
+
+// Read returns the values of the next row as text, with empty strings for nulls
+func (tr *tableRecordReader) Read() ([]string, error) {
+	numGroups := len(tr.starts) - 1
+	if tr.row < 0 || tr.row >= tr.starts[numGroups] {
+		return nil, io.EOF
+	}
+	if tr.group == -1 || tr.row < tr.starts[tr.group] || tr.row >= tr.starts[tr.group+1] {
+		group := sort.Search(numGroups, func(i int) bool { return tr.starts[i+1] > tr.row })
+		columns, err := tr.f.ReadRowGroupColumns(group, tr.names...)
+		if err != nil {
+			return nil, err
+		}
+		if tr.t, err = newParquetTable(tr.names, columns, tr.starts[group+1]-tr.starts[group]); err != nil {
+			return nil, err
+		}
+		tr.group = group
+	}
+	row := int(tr.row - tr.starts[tr.group])
+	record := make([]string, len(tr.names))
+	for i := range record {
+		record[i] = tr.t.text(row, i)
+	}
+	tr.row++
+	return record, nil
+}
+
+func (tr *tableRecordReader) cursor() int64 {
+	return tr.row
+}
+
+func (tr *tableRecordReader) setCursor(cursor int64) {
+	tr.row = cursor
+}
+
+// parseCSVLine splits a csv record into its fields, unquoting the quoted ones
+func parseCSVLine(line []byte) ([]string, error) {
+	var fields []string
+	for i := 0; ; {
+		if i < len(line) && line[i] == '"' {
+			var field []byte
+			i++
+			for {
+				j := bytes.IndexByte(line[i:], '"')
+				if j < 0 {
+					return nil, errors.New("unterminated quoted field")
+				}
+				field = append(field, line[i:i+j]...)
+				i += j + 1
+				// An escaped quote
+				if i < len(line) && line[i] == '"' {
+					field = append(field, '"')
+					i++
+					continue
+				}
+				break
+			}
+			fields = append(fields, string(field))
+			if i == len(line) {
+				return fields, nil
+			}
+			if line[i] != ',' {
+				return nil, errors.New("extraneous character after quoted field")
+			}
+			i++
+		} else {
+			j := bytes.IndexByte(line[i:], ',')
+			if j < 0 {
+				return append(fields, string(line[i:])), nil
+			}
+			fields = append(fields, string(line[i:i+j]))
+			i += j + 1
+		}
+	}
+}
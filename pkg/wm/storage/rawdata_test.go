@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestStreamRawData(t *testing.T) {
+	ctx := context.Background()
+	reader := NewMemoryReader()
+	reader.Put("models", "data/run/raw/rain/raw/raw.csv", []byte("timestamp,country,admin1,admin2,admin3,lat,lng,value,crop\n"+
+		"1,Ethiopia,Afar,,,9.1,40.5,0.5,maize\n"+
+		"\n"+
+		"2,Ethiopia,\"Afar, Zone 1\",,,,,1.5,\"teff\nwheat\"\r\n"+
+		"3,Kenya,,,,,,,\"\"\"sorghum\"\"\"\n"+
+		"4,Kenya,,,,,,2,"))
+	s, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{ModelsBucket: "models"}})
+	require.NoError(t, err)
+	params := wm.DatacubeParams{DataID: "data", RunID: "run", Feature: "rain"}
+
+	all, err := s.GetRawData(ctx, params, wm.RawDataFilter{})
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	require.Equal(t, "Afar, Zone 1", all[1].Admin1)
+	require.Equal(t, map[string]string{"crop": "teff\nwheat"}, all[1].Qualifiers)
+	require.Nil(t, all[2].Value)
+	require.Equal(t, map[string]string{"crop": `"sorghum"`}, all[2].Qualifiers)
+	require.Equal(t, map[string]string{"crop": ""}, all[3].Qualifiers)
+
+	qualifiers, err := s.GetRawDataQualifiers(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"crop"}, qualifiers)
+
+	stream := func(opts wm.RawDataOptions) ([]int64, string) {
+		var timestamps []int64
+		cursor, err := s.StreamRawData(ctx, params, opts, func(point *wm.ModelOutputRawDataPoint) error {
+			timestamps = append(timestamps, point.Timestamp)
+			return nil
+		})
+		require.NoError(t, err)
+		return timestamps, cursor
+	}
+
+	timestamps, cursor := stream(wm.RawDataOptions{})
+	require.Equal(t, []int64{1, 2, 3, 4}, timestamps)
+	require.Empty(t, cursor)
+
+	// Pages follow the cursors
+	timestamps, cursor = stream(wm.RawDataOptions{Limit: 2})
+	require.Equal(t, []int64{1, 2}, timestamps)
+	require.NotEmpty(t, cursor)
+	timestamps, cursor = stream(wm.RawDataOptions{Cursor: cursor, Limit: 1})
+	require.Equal(t, []int64{3}, timestamps)
+	timestamps, cursor = stream(wm.RawDataOptions{Cursor: cursor, Limit: 1})
+	require.Equal(t, []int64{4}, timestamps)
+	require.Empty(t, cursor)
+
+	// The offset skips points from the cursor
+	timestamps, cursor = stream(wm.RawDataOptions{Offset: 1, Limit: 2})
+	require.Equal(t, []int64{2, 3}, timestamps)
+	timestamps, _ = stream(wm.RawDataOptions{Cursor: cursor, Offset: 1})
+	require.Empty(t, timestamps)
+
+	// A last full page has no next cursor
+	_, cursor = stream(wm.RawDataOptions{Offset: 2, Limit: 2})
+	require.Empty(t, cursor)
+
+	// Offsets and limits count the points matching the filter
+	kenya := wm.RawDataFilter{Country: []string{"Kenya"}}
+	timestamps, cursor = stream(wm.RawDataOptions{Filter: kenya, Limit: 1})
+	require.Equal(t, []int64{3}, timestamps)
+	timestamps, cursor = stream(wm.RawDataOptions{Filter: kenya, Cursor: cursor})
+	require.Equal(t, []int64{4}, timestamps)
+	require.Empty(t, cursor)
+	timestamps, _ = stream(wm.RawDataOptions{Filter: kenya, Offset: 1})
+	require.Equal(t, []int64{4}, timestamps)
+
+	none := func(point *wm.ModelOutputRawDataPoint) error { return nil }
+	_, err = s.StreamRawData(ctx, params, wm.RawDataOptions{Cursor: "abc"}, none)
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+	// A cursor within a record
+	info, err := reader.Stat(ctx, "models", "data/run/raw/rain/raw/raw.csv")
+	require.NoError(t, err)
+	_, err = s.StreamRawData(ctx, params, wm.RawDataOptions{Cursor: rawDataCursor{position: 1, size: info.Size, modified: info.LastModified.UnixNano()}.encode()}, none)
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+	// A cursor of the file before it was rewritten, with the same size or not
+	_, cursor = stream(wm.RawDataOptions{Limit: 1})
+	buf, err := reader.Get(ctx, "models", "data/run/raw/rain/raw/raw.csv")
+	require.NoError(t, err)
+	reader.Put("models", "data/run/raw/rain/raw/raw.csv", buf)
+	_, err = s.StreamRawData(ctx, params, wm.RawDataOptions{Cursor: cursor}, none)
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+	reader.Put("models", "data/run/raw/rain/raw/raw.csv", []byte("timestamp,country,admin1,admin2,admin3,lat,lng,value,crop\n1,Kenya,,,,,,2,\n"))
+	_, err = s.StreamRawData(ctx, params, wm.RawDataOptions{Cursor: cursor}, none)
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+
+	_, err = s.StreamRawData(ctx, wm.DatacubeParams{DataID: "data", RunID: "run", Feature: "missing"}, wm.RawDataOptions{}, none)
+	require.Equal(t, wm.ENOTFOUND, wm.ErrorCode(err))
+}
+
+func TestParseCSVLine(t *testing.T) {
+	for _, test := range []struct {
+		line  string
+		isErr bool
+		want  []string
+	}{
+		{`a,b,c`, false, []string{"a", "b", "c"}},
+		{`a,,`, false, []string{"a", "", ""}},
+		{`"a,b","c""d",""`, false, []string{"a,b", `c"d`, ""}},
+		{"\"a\nb\",c", false, []string{"a\nb", "c"}},
+		{`"a`, true, nil},
+		{`"a"b,c`, true, nil},
+	} {
+		got, err := parseCSVLine([]byte(test.line))
+		if test.isErr {
+			require.Error(t, err, test.line)
+			continue
+		}
+		require.NoError(t, err, test.line)
+		require.Equal(t, test.want, got, test.line)
+	}
+}
+
+func TestMatchRawDataPoint(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	i := func(v int64) *int64 { return &v }
+	point := &wm.ModelOutputRawDataPoint{
+		Timestamp:  10,
+		Country:    "Ethiopia",
+		Admin1:     "Afar",
+		Lat:        f(9),
+		Lng:        f(40),
+		Value:      f(1.5),
+		Qualifiers: map[string]string{"crop": "maize"},
+	}
+	for _, test := range []struct {
+		filter wm.RawDataFilter
+		want   bool
+	}{
+		{wm.RawDataFilter{}, true},
+		{wm.RawDataFilter{StartTime: i(10), EndTime: i(10)}, true},
+		{wm.RawDataFilter{StartTime: i(11)}, false},
+		{wm.RawDataFilter{EndTime: i(9)}, false},
+		{wm.RawDataFilter{Country: []string{"Kenya", "Ethiopia"}, Admin1: []string{"Afar"}}, true},
+		{wm.RawDataFilter{Country: []string{"Kenya"}}, false},
+		{wm.RawDataFilter{Admin2: []string{"Zone 1"}}, false},
+		{wm.RawDataFilter{Bound: &wm.Bound{TopLeft: wm.Point{Lat: 10, Lon: 39}, BottomRight: wm.Point{Lat: 9, Lon: 40}}}, true},
+		{wm.RawDataFilter{Bound: &wm.Bound{TopLeft: wm.Point{Lat: 10, Lon: 41}, BottomRight: wm.Point{Lat: 8, Lon: 42}}}, false},
+		{wm.RawDataFilter{Qualifiers: map[string][]string{"crop": {"teff", "maize"}}}, true},
+		{wm.RawDataFilter{Qualifiers: map[string][]string{"crop": {"teff"}}}, false},
+		{wm.RawDataFilter{Qualifiers: map[string][]string{"season": {"meher"}}}, false},
+		{wm.RawDataFilter{MinValue: f(1.5), MaxValue: f(2)}, true},
+		{wm.RawDataFilter{MinValue: f(2)}, false},
+		{wm.RawDataFilter{MaxValue: f(1)}, false},
+	} {
+		require.Equal(t, test.want, matchRawDataPoint(&test.filter, point), "%+v", test.filter)
+	}
+
+	// Points without coordinates or value don't match bounds on them
+	point = &wm.ModelOutputRawDataPoint{Timestamp: 10}
+	require.False(t, matchRawDataPoint(&wm.RawDataFilter{Bound: &wm.Bound{TopLeft: wm.Point{Lat: 90, Lon: -180}, BottomRight: wm.Point{Lat: -90, Lon: 180}}}, point))
+	require.False(t, matchRawDataPoint(&wm.RawDataFilter{MinValue: f(0)}, point))
+}
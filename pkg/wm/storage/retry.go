@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// RetryConfig defines how a RetryReader retries failed requests and when its circuit breaker opens
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts of a request, including the first one
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubling with each following retry up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// BreakerThreshold is the number of consecutive failed attempts after which the breaker opens and
+	// requests fail fast. Zero disables the breaker
+	BreakerThreshold int
+	// BreakerCooldown is how long the breaker stays open before letting a request through to probe the store
+	BreakerCooldown time.Duration
+}
+
+// init fills in defaults for missing parameters
+func (cfg *RetryConfig) init() {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = 100 * time.Millisecond
+	}
+	if cfg.MaxDelay < cfg.BaseDelay {
+		cfg.MaxDelay = cfg.BaseDelay
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = 30 * time.Second
+	}
+}
+
+// RetryReader is a BlobReader that retries the requests failing with wm.EUNAVAILABLE errors, waiting a jittered,
+// exponentially growing delay between attempts. Once too many attempts failed in a row, its circuit breaker opens
+// and requests fail fast with wm.EUNAVAILABLE until the store recovers.
+type RetryReader struct {
+	reader  BlobReader
+	cfg     RetryConfig
+	breaker *breaker
+}
+
+// NewRetryReader returns a RetryReader wrapping reader
+func NewRetryReader(reader BlobReader, cfg RetryConfig) *RetryReader {
+	cfg.init()
+	return &RetryReader{
+		reader:  reader,
+		cfg:     cfg,
+		breaker: &breaker{threshold: cfg.BreakerThreshold, cooldown: cfg.BreakerCooldown, now: time.Now},
+	}
+}
+
+// Get returns the content of the object
+func (r *RetryReader) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	var buf []byte
+	err := r.do(ctx, "RetryReader.Get", func() error {
+		var err error
+		buf, err = r.reader.Get(ctx, bucket, key)
+		return err
+	})
+	return buf, err
+}
+
+// GetRange returns up to length bytes of the object starting at offset
+func (r *RetryReader) GetRange(ctx context.Context, bucket string, key string, offset int64, length int64) ([]byte, error) {
+	var buf []byte
+	err := r.do(ctx, "RetryReader.GetRange", func() error {
+		var err error
+		buf, err = r.reader.GetRange(ctx, bucket, key, offset, length)
+		return err
+	})
+	return buf, err
+}
+
+// Stat returns information about the object
+func (r *RetryReader) Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error) {
+	var info *ObjectInfo
+	err := r.do(ctx, "RetryReader.Stat", func() error {
+		var err error
+		info, err = r.reader.Stat(ctx, bucket, key)
+		return err
+	})
+	return info, err
+}
+
+// List returns the keys and the common prefixes directly under the prefix
+func (r *RetryReader) List(ctx context.Context, bucket string, prefix string) (*ListResult, error) {
+	var list *ListResult
+	err := r.do(ctx, "RetryReader.List", func() error {
+		var err error
+		list, err = r.reader.List(ctx, bucket, prefix)
+		return err
+	})
+	return list, err
+}
+
+// BreakerOpen returns true if the circuit breaker is currently failing requests fast
+func (r *RetryReader) BreakerOpen() bool {
+	return r.breaker.open()
+}
+
+func (r *RetryReader) do(ctx context.Context, op string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		if !r.breaker.allow() {
+			return &wm.Error{Code: wm.EUNAVAILABLE, Op: op, Message: "Storage is unavailable"}
+		}
+		err := fn()
+		if ctx.Err() != nil {
+			// A cancelled request tells nothing about the health of the store
+			return err
+		}
+		r.breaker.record(err)
+		if wm.ErrorCode(err) != wm.EUNAVAILABLE || attempt >= r.cfg.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(r.delay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// delay returns the delay before retrying after given attempt, picked at random between half and all of the backoff
+func (r *RetryReader) delay(attempt int) time.Duration {
+	backoff := r.cfg.MaxDelay
+	if attempt < 32 && r.cfg.BaseDelay<<(attempt-1) < backoff {
+		backoff = r.cfg.BaseDelay << (attempt - 1)
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// breaker is a circuit breaker counting consecutive wm.EUNAVAILABLE failures
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+// allow returns whether a request can go through. Once the cooldown of an open breaker has passed,
+// a single request is let through and its result decides whether the breaker closes or stays open.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+// record records the result of a request
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wm.ErrorCode(err) != wm.EUNAVAILABLE {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+func (b *breaker) open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && b.failures >= b.threshold && b.now().Before(b.openUntil)
+}
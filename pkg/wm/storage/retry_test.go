@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// failingReader fails the next fails calls to Get with err
+type failingReader struct {
+	BlobReader
+	fails int
+	err   error
+	calls int
+}
+
+func (r *failingReader) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	r.calls++
+	if r.fails > 0 {
+		r.fails--
+		return nil, r.err
+	}
+	return r.BlobReader.Get(ctx, bucket, key)
+}
+
+func TestRetryReader(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryReader()
+	memory.Put("bucket", "key", []byte("data"))
+	unavailable := &wm.Error{Code: wm.EUNAVAILABLE}
+	cfg := RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	// Transient errors are retried
+	reader := &failingReader{BlobReader: memory, fails: 2, err: unavailable}
+	buf, err := NewRetryReader(reader, cfg).Get(ctx, "bucket", "key")
+	require.NoError(t, err)
+	require.Equal(t, "data", string(buf))
+	require.Equal(t, 3, reader.calls)
+
+	// up to MaxAttempts
+	reader = &failingReader{BlobReader: memory, fails: 3, err: unavailable}
+	_, err = NewRetryReader(reader, cfg).Get(ctx, "bucket", "key")
+	require.Equal(t, wm.EUNAVAILABLE, wm.ErrorCode(err))
+	require.Equal(t, 3, reader.calls)
+
+	// Other errors are not
+	reader = &failingReader{BlobReader: memory}
+	_, err = NewRetryReader(reader, cfg).Get(ctx, "bucket", "missing")
+	require.Equal(t, wm.ENOTFOUND, wm.ErrorCode(err))
+	require.Equal(t, 1, reader.calls)
+
+	// Retries stop when the context is done
+	reader = &failingReader{BlobReader: memory, fails: 3, err: unavailable}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = NewRetryReader(reader, cfg).Get(cancelled, "bucket", "key")
+	require.Error(t, err)
+	require.Equal(t, 1, reader.calls)
+}
+
+func TestRetryReaderBreaker(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryReader()
+	memory.Put("bucket", "key", []byte("data"))
+	reader := &failingReader{BlobReader: memory, fails: 4, err: &wm.Error{Code: wm.EUNAVAILABLE}}
+	r := NewRetryReader(reader, RetryConfig{MaxAttempts: 2, BaseDelay: time.Millisecond, BreakerThreshold: 3, BreakerCooldown: time.Minute})
+	now := time.Now()
+	r.breaker.now = func() time.Time { return now }
+
+	_, err := r.Get(ctx, "bucket", "key")
+	require.Equal(t, wm.EUNAVAILABLE, wm.ErrorCode(err))
+	require.False(t, r.BreakerOpen())
+	_, err = r.Get(ctx, "bucket", "key")
+	require.Equal(t, wm.EUNAVAILABLE, wm.ErrorCode(err))
+	require.True(t, r.BreakerOpen())
+	require.Equal(t, 3, reader.calls)
+
+	// Requests fail fast while the breaker is open
+	_, err = r.Get(ctx, "bucket", "key")
+	require.Equal(t, wm.EUNAVAILABLE, wm.ErrorCode(err))
+	require.Equal(t, 3, reader.calls)
+
+	// After the cooldown, a failing probe keeps it open
+	now = now.Add(time.Minute)
+	_, err = r.Get(ctx, "bucket", "key")
+	require.Equal(t, wm.EUNAVAILABLE, wm.ErrorCode(err))
+	require.Equal(t, 4, reader.calls)
+	require.True(t, r.BreakerOpen())
+
+	// and a successful one closes it
+	now = now.Add(time.Minute)
+	buf, err := r.Get(ctx, "bucket", "key")
+	require.NoError(t, err)
+	require.Equal(t, "data", string(buf))
+	require.False(t, r.BreakerOpen())
+}
+
+func TestS3Error(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		code string
+	}{
+		{awserr.New("NoSuchKey", "", nil), wm.ENOTFOUND},
+		{awserr.NewRequestFailure(awserr.New("SlowDown", "", nil), 503, ""), wm.EUNAVAILABLE},
+		{awserr.NewRequestFailure(awserr.New("InternalError", "", nil), 500, ""), wm.EUNAVAILABLE},
+		{awserr.New(request.ErrCodeRequestError, "", syscall.ECONNRESET), wm.EUNAVAILABLE},
+		{awserr.NewRequestFailure(awserr.New("AccessDenied", "", nil), 403, ""), wm.EINTERNAL},
+		{awserr.New(request.CanceledErrorCode, "", errors.New("canceled")), wm.EINTERNAL},
+	} {
+		require.Equal(t, test.code, wm.ErrorCode(s3Error("op", "key", test.err)), test.err.Error())
+	}
+}
@@ -2,8 +2,7 @@ package storage
 
 import (
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
 	"go.uber.org/zap"
 )
 
@@ -15,21 +14,92 @@ type BucketInfo struct {
 	IndicatorsBucket string `json:"indicatorsBucket"`
 }
 
-// Storage wraps the client and serves as the basis of the wm.MaaSData interface.
-type Storage struct {
-	client     *s3.S3
-	bucketInfo *BucketInfo
-	logger     *zap.SugaredLogger
+// Config defines the parameters needed to instantiate a Storage.
+type Config struct {
+	Reader     BlobReader
+	BucketInfo *BucketInfo
+	Logger     *zap.SugaredLogger
+
+	// Cache is used to cache parsed results. It's optional and can be shared with a CachedReader
+	Cache *Cache
+
+	// MaxConcurrency is the maximum number of files fetched concurrently by a single call
+	MaxConcurrency int
+
+	// Population is the population output of the per capita transforms. It defaults to DefaultPopulationParams
+	Population *PopulationConfig
 }
 
-// New instantiates and returns a new Storage instance using the provided Config.
-func New(cfg *aws.Config, bucketInfo *BucketInfo, logger *zap.SugaredLogger) (*Storage, error) {
-	sess := session.Must(session.NewSession(cfg))
-	client := s3.New(sess)
+const defaultMaxConcurrency = 16
+
+// init validates the config and fills in defaults for missing optional
+// parameters.
+func (cfg *Config) init() error {
+	op := "Config.init"
+	if cfg.Reader == nil {
+		return &wm.Error{Op: op, Message: "Reader cannot be nil"}
+	}
+	if cfg.BucketInfo == nil {
+		cfg.BucketInfo = &BucketInfo{}
+	}
+	if cfg.MaxConcurrency <= 0 {
+		cfg.MaxConcurrency = defaultMaxConcurrency
+	}
+	if cfg.Population == nil {
+		cfg.Population = &PopulationConfig{Params: DefaultPopulationParams}
+	}
+	return nil
+}
 
+// Storage wraps the blob reader and serves as the basis of the wm.DataOutput and wm.VectorTile interfaces.
+type Storage struct {
+	reader         BlobReader
+	bucketInfo     *BucketInfo
+	logger         *zap.SugaredLogger
+	cache          *Cache
+	missingParquet *Cache
+	flights        flightGroup
+	maxConcurrency int
+	population     *denominatorSource
+}
+
+// NewFromConfig instantiates and returns a new Storage instance using the provided Config.
+func NewFromConfig(cfg *Config) (*Storage, error) {
+	op := "storage.NewFromConfig"
+	if err := cfg.init(); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
 	return &Storage{
-		client,
-		bucketInfo,
-		logger,
+		reader:         cfg.Reader,
+		bucketInfo:     cfg.BucketInfo,
+		logger:         cfg.Logger,
+		cache:          cfg.Cache,
+		missingParquet: NewCache(CacheConfig{MaxBytes: missingParquetMaxBytes, TTL: missingParquetTTL}),
+		maxConcurrency: cfg.MaxConcurrency,
+		population:     newPopulationSource(*cfg.Population),
 	}, nil
 }
+
+// New instantiates and returns a new S3 backed Storage instance using the provided aws Config.
+func New(cfg *aws.Config, bucketInfo *BucketInfo, logger *zap.SugaredLogger) (*Storage, error) {
+	return NewFromConfig(&Config{
+		Reader:     NewS3Reader(cfg),
+		BucketInfo: bucketInfo,
+		Logger:     logger,
+	})
+}
+
+// NewLocal instantiates and returns a new Storage instance serving the files under the provided directory.
+// The directory is expected to contain a sub directory for each bucket with the same key layout as S3.
+func NewLocal(dir string, bucketInfo *BucketInfo, logger *zap.SugaredLogger) (*Storage, error) {
+	op := "storage.NewLocal"
+	reader, err := NewLocalReader(dir)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	return NewFromConfig(&Config{
+		Reader:     reader,
+		BucketInfo: bucketInfo,
+		Logger:     logger,
+	})
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/parquet"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// table holds the rows of a tabular output file. Outputs are read from the parquet equivalent of their csv file
+// when there is one, ie. the file with the same key and a .parquet extension, otherwise from the csv file.
+type table interface {
+	// columns returns the names of the columns read
+	columns() []string
+	// len returns the number of rows
+	len() int
+	// text returns the value of the cell as text, or an empty string if it is null
+	text(row int, col int) string
+	// float returns the value of the cell as a float
+	float(row int, col int) (float64, error)
+	// integer returns the value of the cell as an integer
+	integer(row int, col int) (int64, error)
+}
+
+// columnSelection selects the columns of a table to read: the first leading columns, and the named columns. Columns
+// keep their order in the file. A nil selection reads all the columns.
+type columnSelection struct {
+	leading int
+	names   []string
+}
+
+// selectColumns returns the names of the selected columns of the header
+func (sel *columnSelection) selectColumns(header []string) []string {
+	if sel == nil {
+		return header
+	}
+	selected := make([]string, 0, sel.leading+len(sel.names))
+	for i, name := range header {
+		if i < sel.leading || index(sel.names, name) != -1 {
+			selected = append(selected, name)
+		}
+	}
+	return selected
+}
+
+// readTable reads the selected columns of the output file with given csv key. Only the selected columns of a parquet
+// file are fetched and decoded, while csv files are read whole.
+func readTable(ctx context.Context, s *Storage, bucket string, key string, sel *columnSelection) (table, error) {
+	op := "readTable"
+	f, _, err := openParquet(ctx, s, bucket, key)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if f != nil {
+		return readParquetTable(f, sel)
+	}
+
+	buf, err := getFile(ctx, s, bucket, key)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	records, err := csv.NewReader(bytes.NewReader(buf)).ReadAll()
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if len(records) == 0 {
+		return &csvTable{}, nil
+	}
+	return &csvTable{header: records[0], records: records[1:]}, nil
+}
+
+// readParquetTable reads the selected columns of the parquet file
+func readParquetTable(f *parquet.File, sel *columnSelection) (table, error) {
+	op := "readParquetTable"
+	names := sel.selectColumns(f.Columns())
+	columns, err := f.ReadColumns(names...)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	t, err := newParquetTable(names, columns, f.NumRows())
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	return t, nil
+}
+
+// newParquetTable returns the table of the columns read from a parquet file, which must all have the given number of
+// rows
+func newParquetTable(names []string, columns []*parquet.Column, rows int64) (*parquetTable, error) {
+	for _, c := range columns {
+		if int64(c.Len()) != rows {
+			return nil, fmt.Errorf("column %s has %d values for %d rows", c.Name, c.Len(), rows)
+		}
+	}
+	return &parquetTable{names: names, cols: columns, rows: int(rows)}, nil
+}
+
+// getTableHeader returns the names of the columns of the output file with given csv key, only fetching the footer of
+// a parquet file or the start of a csv file
+func getTableHeader(ctx context.Context, s *Storage, bucket string, key string) ([]string, error) {
+	op := "getTableHeader"
+	f, _, err := openParquet(ctx, s, bucket, key)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if f != nil {
+		return f.Columns(), nil
+	}
+	return getCsvHeader(ctx, s, bucket, key)
+}
+
+// parquetKey returns the key of the parquet equivalent of the csv file with given key
+func parquetKey(key string) string {
+	return strings.TrimSuffix(key, ".csv") + ".parquet"
+}
+
+// Missing parquet files are remembered in a cache of their own, independent of the object cache, for
+// missingParquetTTL so that a parquet file added later is eventually read
+const (
+	missingParquetMaxBytes = 1 << 20
+	missingParquetTTL      = 5 * time.Minute
+)
+
+// openParquet opens the parquet equivalent of the csv file with given key, and returns it along with its object info.
+// It returns a nil file if there is none. Missing parquet files are cached, so that reading csv outputs doesn't cost
+// an extra request each time.
+func openParquet(ctx context.Context, s *Storage, bucket string, key string) (*parquet.File, *ObjectInfo, error) {
+	op := "openParquet"
+	key = parquetKey(key)
+	missingKey := bucket + "/" + key
+	if _, ok := s.missingParquet.Get(missingKey); ok {
+		return nil, nil, nil
+	}
+	info, err := s.reader.Stat(ctx, bucket, key)
+	if wm.ErrorCode(err) == wm.ENOTFOUND {
+		s.missingParquet.Add(missingKey, true, int64(len(missingKey)))
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, &wm.Error{Op: op, Err: err}
+	}
+	f, err := parquet.Open(&blobReaderAt{ctx: ctx, reader: s.reader, bucket: bucket, key: key}, info.Size)
+	if err != nil {
+		return nil, nil, &wm.Error{Op: op, Err: err}
+	}
+	return f, info, nil
+}
+
+// blobReaderAt is an io.ReaderAt over an object, fetching the ranges that are read
+type blobReaderAt struct {
+	ctx    context.Context
+	reader BlobReader
+	bucket string
+	key    string
+}
+
+func (r *blobReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	buf, err := r.reader.GetRange(r.ctx, r.bucket, r.key, offset, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, buf)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// csvTable is a table read from a csv file
+type csvTable struct {
+	header  []string
+	records [][]string
+}
+
+func (t *csvTable) columns() []string {
+	return t.header
+}
+
+func (t *csvTable) len() int {
+	return len(t.records)
+}
+
+func (t *csvTable) text(row int, col int) string {
+	return t.records[row][col]
+}
+
+func (t *csvTable) float(row int, col int) (float64, error) {
+	return strconv.ParseFloat(t.records[row][col], 64)
+}
+
+func (t *csvTable) integer(row int, col int) (int64, error) {
+	return strconv.ParseInt(t.records[row][col], 10, 64)
+}
+
+// parquetTable is a table read from a parquet file
+type parquetTable struct {
+	names []string
+	cols  []*parquet.Column
+	rows  int
+}
+
+func (t *parquetTable) columns() []string {
+	return t.names
+}
+
+func (t *parquetTable) len() int {
+	return t.rows
+}
+
+func (t *parquetTable) text(row int, col int) string {
+	return t.cols[col].String(row)
+}
+
+func (t *parquetTable) float(row int, col int) (float64, error) {
+	return t.cols[col].Float64(row)
+}
+
+func (t *parquetTable) integer(row int, col int) (int64, error) {
+	return t.cols[col].Int64(row)
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/parquet"
+	"gitlab.uncharted.software/WM/wm-go/pkg/parquet/parquettest"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestParquetOutputs(t *testing.T) {
+	ctx := context.Background()
+	reader := NewMemoryReader()
+	prefix := "data/run/month/rain/"
+	reader.Put("models", prefix+"timeseries/global/global.parquet", parquettest.Write([]parquettest.Column{
+		{Name: "timestamp", Type: parquet.Int64, Values: []interface{}{int64(3), int64(1), int64(2)}},
+		{Name: "s_sum_t_sum", Type: parquet.Double, Optional: true, Values: []interface{}{3.5, 1.5, nil}},
+		{Name: "s_mean_t_sum", Type: parquet.Float, Values: []interface{}{0.5, 0.25, 1.0}},
+	}, parquettest.Options{Dictionary: true, Codec: parquettest.Snappy}))
+	// The parquet file takes precedence over the csv file
+	reader.Put("models", prefix+"timeseries/global/global.csv", []byte("timestamp,s_sum_t_sum\n9,9\n"))
+	reader.Put("models", prefix+"regional/country/aggs/1/default/default.parquet", parquettest.Write([]parquettest.Column{
+		{Name: "id", Type: parquet.ByteArray, Values: []interface{}{"Ethiopia", "Kenya"}},
+		{Name: "s_sum_t_sum", Type: parquet.Double, Optional: true, Values: []interface{}{2.0, nil}},
+	}, parquettest.Options{DataPageV2: true, Codec: parquettest.Gzip}))
+	reader.Put("models", prefix+"regional/admin1/aggs/1/default/default.csv", []byte("id,s_sum_t_sum\nEthiopia__Afar,4\n"))
+	reader.Put("models", prefix+"timeseries/qualifiers/crop/s_sum_t_sum.parquet", parquettest.Write([]parquettest.Column{
+		{Name: "timestamp", Type: parquet.Int64, Values: []interface{}{int64(2), int64(1)}},
+		{Name: "maize", Type: parquet.Double, Optional: true, Values: []interface{}{nil, 1.0}},
+		{Name: "teff", Type: parquet.Double, Values: []interface{}{3.0, 4.0}},
+	}, parquettest.Options{RowGroupSize: 1}))
+	reader.Put("models", prefix+"regional/country/aggs/1/qualifiers/crop.parquet", parquettest.Write([]parquettest.Column{
+		{Name: "id", Type: parquet.ByteArray, Values: []interface{}{"Ethiopia", "Ethiopia", "Kenya"}},
+		{Name: "qualifier", Type: parquet.ByteArray, Values: []interface{}{"maize", "teff", "teff"}},
+		{Name: "s_sum_t_sum", Type: parquet.Double, Optional: true, Values: []interface{}{1.0, 2.0, nil}},
+	}, parquettest.Options{Dictionary: true}))
+	s, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{ModelsBucket: "models"}})
+	require.NoError(t, err)
+	params := wm.DatacubeParams{DataID: "data", RunID: "run", Feature: "rain", Resolution: "month", SpatialAggFunc: "sum", TemporalAggFunc: "sum"}
+
+	series, err := s.GetOutputTimeseries(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 1, Value: 1.5}, {Timestamp: 3, Value: 3.5}}, series)
+
+	meanParams := params
+	meanParams.SpatialAggFunc = "mean"
+	series, err = s.GetOutputTimeseries(ctx, meanParams)
+	require.NoError(t, err)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 1, Value: 0.25}, {Timestamp: 2, Value: 1}, {Timestamp: 3, Value: 0.5}}, series)
+
+	invalidParams := params
+	invalidParams.TemporalAggFunc = "max"
+	_, err = s.GetOutputTimeseries(ctx, invalidParams)
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+
+	aggs, err := s.GetAggregations(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []string{"s_mean_t_sum", "s_sum_t_sum"}, aggs)
+
+	timestamps, err := s.GetTimestamps(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2, 3}, timestamps)
+
+	// Parquet and csv files can be mixed
+	regional, err := s.GetRegionAggregation(ctx, params, "1")
+	require.NoError(t, err)
+	require.Equal(t, []wm.ModelOutputAdminData{{ID: "Ethiopia", Value: 2}}, regional.Country)
+	require.Equal(t, []wm.ModelOutputAdminData{{ID: "Ethiopia__Afar", Value: 4}}, regional.Admin1)
+	require.Empty(t, regional.Admin2)
+
+	qualifierSeries, err := s.GetQualifierTimeseries(ctx, params, "crop", []string{"maize", "teff"})
+	require.NoError(t, err)
+	require.Equal(t, []*wm.ModelOutputQualifierTimeseries{
+		{Name: "maize", Timeseries: []*wm.TimeseriesValue{{Timestamp: 1, Value: 1}}},
+		{Name: "teff", Timeseries: []*wm.TimeseriesValue{{Timestamp: 1, Value: 4}, {Timestamp: 2, Value: 3}}},
+	}, qualifierSeries)
+
+	qualifierData, err := s.GetQualifierData(ctx, params, "2", []string{"crop", "missing"})
+	require.NoError(t, err)
+	require.Len(t, qualifierData, 2)
+	require.Equal(t, "crop", qualifierData[0].Name)
+	require.Len(t, qualifierData[0].Options, 2)
+	require.Nil(t, qualifierData[0].Options[0].Value)
+	require.Equal(t, 3.0, *qualifierData[0].Options[1].Value)
+	require.Nil(t, qualifierData[1])
+
+	qualifierRegional, err := s.GetQualifierRegional(ctx, params, "1", "crop")
+	require.NoError(t, err)
+	require.Equal(t, []wm.ModelOutputRegionQualifierBreakdown{
+		{ID: "Ethiopia", Values: map[string]float64{"maize": 1, "teff": 2}},
+	}, qualifierRegional.Country)
+	require.Empty(t, qualifierRegional.Admin1)
+
+	// Only the selected columns are read
+	tbl, err := readTable(ctx, s, "models", prefix+"regional/country/aggs/1/qualifiers/crop.csv", &columnSelection{leading: 1, names: []string{"s_sum_t_sum"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "s_sum_t_sum"}, tbl.columns())
+	require.Equal(t, 3, tbl.len())
+
+	// Missing parquet files are cached even without an object cache, until they expire
+	cached, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{ModelsBucket: "models"}})
+	require.NoError(t, err)
+	f, _, err := openParquet(ctx, cached, "models", prefix+"raw.csv")
+	require.NoError(t, err)
+	require.Nil(t, f)
+	reader.Put("models", prefix+"raw.parquet", parquettest.Write(nil, parquettest.Options{}))
+	f, _, err = openParquet(ctx, cached, "models", prefix+"raw.csv")
+	require.NoError(t, err)
+	require.Nil(t, f)
+	require.Equal(t, uint64(1), cached.missingParquet.Stats().Hits)
+	now := time.Now()
+	cached.missingParquet.now = func() time.Time { return now.Add(missingParquetTTL) }
+	f, _, err = openParquet(ctx, cached, "models", prefix+"raw.csv")
+	require.NoError(t, err)
+	require.NotNil(t, f)
+}
+
+func TestStreamParquetRawData(t *testing.T) {
+	ctx := context.Background()
+	reader := NewMemoryReader()
+	reader.Put("models", "data/run/raw/rain/raw/raw.parquet", parquettest.Write([]parquettest.Column{
+		{Name: "timestamp", Type: parquet.Int64, Values: []interface{}{int64(1), int64(2), int64(3), int64(4)}},
+		{Name: "country", Type: parquet.ByteArray, Values: []interface{}{"Ethiopia", "Ethiopia", "Kenya", "Kenya"}},
+		{Name: "admin1", Type: parquet.ByteArray, Optional: true, Values: []interface{}{"Afar", "Amhara", nil, nil}},
+		{Name: "lat", Type: parquet.Double, Optional: true, Values: []interface{}{9.1, nil, nil, 0.5}},
+		{Name: "lng", Type: parquet.Double, Optional: true, Values: []interface{}{40.5, nil, nil, 37.25}},
+		{Name: "value", Type: parquet.Double, Optional: true, Values: []interface{}{0.5, 1.5, nil, 2.0}},
+		{Name: "crop", Type: parquet.ByteArray, Values: []interface{}{"maize", "teff", "teff", "sorghum"}},
+	}, parquettest.Options{RowGroupSize: 3, Codec: parquettest.Snappy}))
+	s, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{ModelsBucket: "models"}})
+	require.NoError(t, err)
+	params := wm.DatacubeParams{DataID: "data", RunID: "run", Feature: "rain"}
+
+	all, err := s.GetRawData(ctx, params, wm.RawDataFilter{})
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	require.Equal(t, "Afar", all[0].Admin1)
+	require.Equal(t, 9.1, *all[0].Lat)
+	require.Nil(t, all[1].Lat)
+	require.Nil(t, all[2].Value)
+	require.Equal(t, map[string]string{"crop": "sorghum"}, all[3].Qualifiers)
+
+	filtered, err := s.GetRawData(ctx, params, wm.RawDataFilter{Country: []string{"Kenya"}})
+	require.NoError(t, err)
+	require.Len(t, filtered, 2)
+
+	stream := func(opts wm.RawDataOptions) ([]int64, string) {
+		var timestamps []int64
+		cursor, err := s.StreamRawData(ctx, params, opts, func(point *wm.ModelOutputRawDataPoint) error {
+			timestamps = append(timestamps, point.Timestamp)
+			return nil
+		})
+		require.NoError(t, err)
+		return timestamps, cursor
+	}
+	timestamps, cursor := stream(wm.RawDataOptions{Limit: 3})
+	require.Equal(t, []int64{1, 2, 3}, timestamps)
+	info, err := reader.Stat(ctx, "models", "data/run/raw/rain/raw/raw.parquet")
+	require.NoError(t, err)
+	require.Equal(t, rawDataCursor{position: 3, size: 4, modified: info.LastModified.UnixNano()}.encode(), cursor)
+	timestamps, cursor = stream(wm.RawDataOptions{Cursor: cursor})
+	require.Equal(t, []int64{4}, timestamps)
+	require.Empty(t, cursor)
+
+	// Only the row group of the cursor is decoded
+	f, info, err := openParquet(ctx, s, "models", "data/run/raw/rain/raw/raw.csv")
+	require.NoError(t, err)
+	tr := newTableRecordReader(f)
+	tr.setCursor(3)
+	record, err := tr.Read()
+	require.NoError(t, err)
+	require.Equal(t, []string{"4", "Kenya", "", "0.5", "37.25", "2", "sorghum"}, record)
+	require.Equal(t, 1, tr.group)
+	require.Equal(t, 1, tr.t.len())
+	_, err = tr.Read()
+	require.Equal(t, io.EOF, err)
+
+	_, err = s.StreamRawData(ctx, params, wm.RawDataOptions{Cursor: "x"}, func(point *wm.ModelOutputRawDataPoint) error { return nil })
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+}
@@ -1,16 +1,13 @@
 package storage
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"math"
 	"strings"
 	"time"
 
 	"github.com/Knetic/govaluate"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/paulmach/orb/geojson"
 	"github.com/paulmach/orb/maptile"
 	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
@@ -45,7 +42,7 @@ type geoTilesResult struct {
 }
 
 // GetTile returns the tile containing model run output specified by the spec
-func (s *Storage) GetTile(zoom, x, y uint32, specs wm.GridTileOutputSpecs, expression string) (*wm.Tile, error) {
+func (s *Storage) GetTile(ctx context.Context, zoom, x, y uint32, specs wm.GridTileOutputSpecs, expression string) (*wm.Tile, error) {
 	op := "Storage.GetTile"
 	tile := wm.NewTile(zoom, x, y, tileDataLayerName)
 
@@ -54,7 +51,7 @@ func (s *Storage) GetTile(zoom, x, y uint32, specs wm.GridTileOutputSpecs, expre
 	var results []geoTilesResult
 
 	for _, spec := range specs {
-		res, err := s.getRunOutput(zoom, x, y, spec)
+		res, err := s.getRunOutput(ctx, zoom, x, y, spec)
 		errChs = append(errChs, err)
 		resChs = append(resChs, res)
 	}
@@ -112,10 +109,10 @@ func evaluateExpression(features []*geojson.Feature, expression string) error {
 }
 
 // getRunOutput returns geotiled bucket aggregation result of the model run output specified by the spec, bound and zoom
-func (s *Storage) getRunOutput(zoom, x, y uint32, spec wm.GridTileOutputSpec) (chan geoTilesResult, chan error) {
+func (s *Storage) getRunOutput(ctx context.Context, zoom, x, y uint32, spec wm.GridTileOutputSpec) (chan geoTilesResult, chan error) {
 	op := "Storage.getRunOutput"
-	out := make(chan geoTilesResult)
-	er := make(chan error)
+	out := make(chan geoTilesResult, 1)
+	er := make(chan error, 1)
 	go func() {
 		defer close(er)
 		defer close(out)
@@ -142,33 +139,18 @@ func (s *Storage) getRunOutput(zoom, x, y uint32, spec wm.GridTileOutputSpec) (c
 			bucketName = s.bucketInfo.TileOutputBucket
 		}
 
-		// Retrieve protobuf tile from S3
-		req, resp := s.client.GetObjectRequest(&s3.GetObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(key),
-		})
-
+		// Retrieve protobuf tile from the store
 		//TODO: Need validation and better error handling
-		err := req.Send()
+		buf, err := getFile(ctx, s, bucketName, key)
 		if err != nil {
-			if awsErr, ok := err.(awserr.Error); ok {
-				if awsErr.Code() == s3.ErrCodeNoSuchKey {
-					// Tile not found errors are expected
-					return
-				}
-				er <- &wm.Error{Op: op, Err: err}
+			if wm.ErrorCode(err) == wm.ENOTFOUND {
+				// Tile not found errors are expected
 				return
 			}
 			er <- &wm.Error{Op: op, Err: err}
 			return
 		}
 		var tile pb.Tile
-		defer resp.Body.Close()
-		buf, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			er <- &wm.Error{Op: op, Err: err}
-			return
-		}
 		if err := proto.Unmarshal(buf, &tile); err != nil {
 			er <- &wm.Error{Op: op, Err: err}
 			return
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -28,7 +29,7 @@ func TestTiles(t *testing.T) {
 	specs := wm.GridTileOutputSpecs{
 		wm.GridTileOutputSpec{ModelID: "consumption_model", RunID: "1aee48cd4d5286732367dc223f7b21e97bc23619815f7140763c2f9f7541dfac", Feature: "FEATURE_NAME", Date: "2020-01"},
 	}
-	s.GetTile(9, 322, 244, specs, "")
+	s.GetTile(context.Background(), 9, 322, 244, specs, "")
 	require.NotNil(t, s)
 }
 
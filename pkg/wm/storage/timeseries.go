@@ -30,7 +30,7 @@ func toSparkline(series []*wm.TimeseriesValue) ([]float64, error) {
 
 // deepCloneTs creates a deep copy of the given time series, series
 func deepCloneTs(series []*wm.TimeseriesValue) []*wm.TimeseriesValue {
-	var newSeries []*wm.TimeseriesValue
+	newSeries := make([]*wm.TimeseriesValue, 0, len(series))
 	for _, t := range series {
 		newSeries = append(newSeries, &wm.TimeseriesValue{Timestamp: t.Timestamp, Value: t.Value})
 	}
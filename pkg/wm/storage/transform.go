@@ -1,60 +1,55 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
-	"strconv"
-	"strings"
-	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
 )
 
-var populationRegionalLookupCache map[int]map[string]float64 = make(map[int]map[string]float64)
-
-func getPopulationDataAvailableYears() []int {
-	return []int{2020}
-}
-
-func getPopulationDatacubeParams() wm.DatacubeParams {
-	return wm.DatacubeParams{
-		DataID:          "430d621b-c4cd-4cb2-8d21-1c590522602c",
-		RunID:           "indicator",
-		Feature:         "Population Count",
-		Resolution:      "year",
-		TemporalAggFunc: "sum",
-		SpatialAggFunc:  "sum",
-	}
-}
-
 // TransformOutputTimeseriesByRegion returns transformed timeseries data
-func (s *Storage) TransformOutputTimeseriesByRegion(timeseries []*wm.TimeseriesValue, config wm.TransformConfig) ([]*wm.TimeseriesValue, error) {
+func (s *Storage) TransformOutputTimeseriesByRegion(ctx context.Context, timeseries []*wm.TimeseriesValue, config wm.TransformConfig) ([]*wm.TimeseriesValue, error) {
 	// op := "Storage.TransformOutputTimeseriesByRegion"
 	switch config.Transform {
 	case wm.TransformPerCapita:
-		config.ScaleFactor = 1
-		return s.transformPerCapitaTimeseries(timeseries, config)
+		return s.transformRatioTimeseries(ctx, timeseries, s.population, config.RegionID, 1)
 	case wm.TransformPerCapita1K:
-		config.ScaleFactor = 1_000
-		return s.transformPerCapitaTimeseries(timeseries, config)
+		return s.transformRatioTimeseries(ctx, timeseries, s.population, config.RegionID, 1_000)
 	case wm.TransformPerCapita1M:
-		config.ScaleFactor = 1_000_000
-		return s.transformPerCapitaTimeseries(timeseries, config)
+		return s.transformRatioTimeseries(ctx, timeseries, s.population, config.RegionID, 1_000_000)
+	case wm.TransformRatio:
+		d, err := newRatioDenominator(config)
+		if err != nil {
+			return nil, err
+		}
+		return s.transformRatioTimeseries(ctx, timeseries, d, config.RegionID, config.ScaleFactor)
 	case wm.TransformNormalization:
-		return s.normalizeRegionalTimeseries(timeseries, config)
+		return s.normalizeRegionalTimeseries(ctx, timeseries, config)
+	case wm.TransformRollingMean, wm.TransformRollingSum, wm.TransformCumulativeSum, wm.TransformPctChange, wm.TransformYoYPctChange:
+		return transformTimeseries(timeseries, config)
+	case wm.TransformBaselineIndex:
+		return baselineIndexTimeseries(timeseries, config)
+	case wm.TransformZScore:
+		return zScoreTimeseries(timeseries), nil
+	case wm.TransformRegionalZScore:
+		return s.regionalZScoreTimeseries(ctx, timeseries, config)
 	default:
 		return timeseries, nil
 	}
 }
 
 // TransformOutputQualifierTimeseriesByRegion returns transformed qualifier timeseries data
-func (s *Storage) TransformOutputQualifierTimeseriesByRegion(data []*wm.ModelOutputQualifierTimeseries, config wm.TransformConfig) ([]*wm.ModelOutputQualifierTimeseries, error) {
-	// op := "Storage.TransformOutputQualifierTimeseriesByRegion"
+func (s *Storage) TransformOutputQualifierTimeseriesByRegion(ctx context.Context, data []*wm.ModelOutputQualifierTimeseries, config wm.TransformConfig) ([]*wm.ModelOutputQualifierTimeseries, error) {
+	op := "Storage.TransformOutputQualifierTimeseriesByRegion"
+	if config.Transform == wm.TransformRegionalZScore {
+		// The regional values are not broken down by qualifier
+		return nil, errUnsupportedTransform(op, config.Transform)
+	}
 	result := make([]*wm.ModelOutputQualifierTimeseries, 0)
 	for _, qSeries := range data {
-		series, err := s.TransformOutputTimeseriesByRegion(qSeries.Timeseries, config)
+		series, err := s.TransformOutputTimeseriesByRegion(ctx, qSeries.Timeseries, config)
 		if err != nil {
 			return nil, err
 		}
@@ -65,30 +60,46 @@ func (s *Storage) TransformOutputQualifierTimeseriesByRegion(data []*wm.ModelOut
 }
 
 // TransformRegionAggregationByAdminLevel returns transformed regional data for given admin level at ONE timestamp
-func (s *Storage) TransformRegionAggregationByAdminLevel(data *wm.ModelOutputRegional, config wm.TransformConfig) (*wm.ModelOutputRegional, error) {
-	// op := "Storage.TransformRegionAggregationByAdminLevel"
+func (s *Storage) TransformRegionAggregationByAdminLevel(ctx context.Context, data *wm.ModelOutputRegional, config wm.TransformConfig) (*wm.ModelOutputRegional, error) {
+	op := "Storage.TransformRegionAggregationByAdminLevel"
+	// The ratio needs the timestamp of the data to align the denominator with
+	if config.Transform.IsTimeseries() || config.Transform == wm.TransformRatio {
+		return nil, errUnsupportedTransform(op, config.Transform)
+	}
 	switch config.Transform {
 	case wm.TransformNormalization:
-		return s.normalizeRegionAggregationByAdminLevel(data, config)
+		return s.normalizeRegionAggregationByAdminLevel(ctx, data, config)
+	case wm.TransformBaselineIndex:
+		return s.baselineIndexRegionAggregationByAdminLevel(ctx, data, config)
+	case wm.TransformZScore:
+		return s.zScoreRegionAggregationByAdminLevel(ctx, data, config)
+	case wm.TransformRegionalZScore:
+		return regionalZScoreRegionAggregationByAdminLevel(data), nil
 	default:
 		return data, nil
 	}
 }
 
 // TransformRegionAggregation returns transformed regional data for ALL admin regions at ONE timestamp
-func (s *Storage) TransformRegionAggregation(data *wm.ModelOutputRegionalAdmins, timestamp string, config wm.TransformConfig) (*wm.ModelOutputRegionalAdmins, error) {
-	// op := "Storage.TransformRegionAggregation"
+func (s *Storage) TransformRegionAggregation(ctx context.Context, data *wm.ModelOutputRegionalAdmins, timestamp string, config wm.TransformConfig) (*wm.ModelOutputRegionalAdmins, error) {
+	op := "Storage.TransformRegionAggregation"
+	if !supportsAllAdminLevels(config.Transform) {
+		return nil, errUnsupportedTransform(op, config.Transform)
+	}
 
 	switch config.Transform {
 	case wm.TransformPerCapita:
-		config.ScaleFactor = 1
-		return s.transformPerCapitaRegionAggregation(data, timestamp, config.ScaleFactor)
+		return s.transformRatioRegionAggregation(ctx, data, timestamp, s.population, 1)
 	case wm.TransformPerCapita1K:
-		config.ScaleFactor = 1_000
-		return s.transformPerCapitaRegionAggregation(data, timestamp, config.ScaleFactor)
+		return s.transformRatioRegionAggregation(ctx, data, timestamp, s.population, 1_000)
 	case wm.TransformPerCapita1M:
-		config.ScaleFactor = 1_000_000
-		return s.transformPerCapitaRegionAggregation(data, timestamp, config.ScaleFactor)
+		return s.transformRatioRegionAggregation(ctx, data, timestamp, s.population, 1_000_000)
+	case wm.TransformRatio:
+		d, err := newRatioDenominator(config)
+		if err != nil {
+			return nil, err
+		}
+		return s.transformRatioRegionAggregation(ctx, data, timestamp, d, config.ScaleFactor)
 	case wm.TransformNormalization:
 		return s.normalizeRegionAggregation(data)
 	default:
@@ -97,19 +108,25 @@ func (s *Storage) TransformRegionAggregation(data *wm.ModelOutputRegionalAdmins,
 }
 
 // TransformQualifierRegional returns transformed qualifier regional data for ALL admin regions at ONE timestamp
-func (s *Storage) TransformQualifierRegional(data *wm.ModelOutputRegionalQualifiers, timestamp string, config wm.TransformConfig) (*wm.ModelOutputRegionalQualifiers, error) {
-	// op := "Storage.TransformQualifierRegional"
+func (s *Storage) TransformQualifierRegional(ctx context.Context, data *wm.ModelOutputRegionalQualifiers, timestamp string, config wm.TransformConfig) (*wm.ModelOutputRegionalQualifiers, error) {
+	op := "Storage.TransformQualifierRegional"
+	if !supportsAllAdminLevels(config.Transform) {
+		return nil, errUnsupportedTransform(op, config.Transform)
+	}
 
 	switch config.Transform {
 	case wm.TransformPerCapita:
-		config.ScaleFactor = 1
-		return s.transformPerCapitaQualifierRegional(data, timestamp, config.ScaleFactor)
+		return s.transformRatioQualifierRegional(ctx, data, timestamp, s.population, 1)
 	case wm.TransformPerCapita1K:
-		config.ScaleFactor = 1_000
-		return s.transformPerCapitaQualifierRegional(data, timestamp, config.ScaleFactor)
+		return s.transformRatioQualifierRegional(ctx, data, timestamp, s.population, 1_000)
 	case wm.TransformPerCapita1M:
-		config.ScaleFactor = 1_000_000
-		return s.transformPerCapitaQualifierRegional(data, timestamp, config.ScaleFactor)
+		return s.transformRatioQualifierRegional(ctx, data, timestamp, s.population, 1_000_000)
+	case wm.TransformRatio:
+		d, err := newRatioDenominator(config)
+		if err != nil {
+			return nil, err
+		}
+		return s.transformRatioQualifierRegional(ctx, data, timestamp, d, config.ScaleFactor)
 	case wm.TransformNormalization:
 		return s.normalizeQualifierRegional(data)
 	default:
@@ -117,208 +134,52 @@ func (s *Storage) TransformQualifierRegional(data *wm.ModelOutputRegionalQualifi
 	}
 }
 
-func (s *Storage) normalizeRegionalTimeseries(timeseries []*wm.TimeseriesValue, config wm.TransformConfig) ([]*wm.TimeseriesValue, error) {
-	op := "Storage.normalizeRegionalTimeseries"
-
-	params := config.DatacubeParams
-
-	// Get admin level from region id
-	adminLevels := []wm.AdminLevel{wm.AdminLevelCountry, wm.AdminLevel1, wm.AdminLevel2, wm.AdminLevel3}
-	regionID := config.RegionID
-	adminLevelNum := len(strings.Split(string(regionID), "__")) - 1
-
-	// Fetch min max from precomputed extrema file and get min and max value across the region and timestamp
-	min, max, err := s.getRegionalMinMaxFromS3(params, adminLevels[adminLevelNum])
-	if err != nil {
-		return nil, &wm.Error{Op: op, Err: err}
-	}
-
-	var result []*wm.TimeseriesValue
-	for _, v := range timeseries {
-		result = append(result, &wm.TimeseriesValue{Timestamp: v.Timestamp, Value: normalize(v.Value, min, max)})
+// supportsAllAdminLevels returns whether the transform applies to the regional data of all the admin levels at one
+// timestamp. The timeseries transforms need a timeseries, and the standardization ones are only implemented for
+// timeseries and the regional data of one admin level.
+func supportsAllAdminLevels(transform wm.Transform) bool {
+	switch transform {
+	case wm.TransformBaselineIndex, wm.TransformZScore, wm.TransformRegionalZScore:
+		return false
 	}
-
-	return result, nil
+	return !transform.IsTimeseries()
 }
 
-func (s *Storage) transformPerCapitaTimeseries(timeseries []*wm.TimeseriesValue, config wm.TransformConfig) ([]*wm.TimeseriesValue, error) {
-	op := "Storage.transformPerCapitaTimeseries"
-	populationTimeseries, err := s.GetOutputTimeseriesByRegion(getPopulationDatacubeParams(), config.RegionID)
-	if err != nil {
-		if wm.ErrorCode(err) == wm.ENOTFOUND {
-			// if population data is not found, raise an internal server error
-			return nil, &wm.Error{Code: wm.EINTERNAL, Op: op, Err: err}
-		}
-		return nil, &wm.Error{Op: op, Err: err}
-	}
-
-	var scaleFactor float64 = 1
-	if math.Abs(config.ScaleFactor) > 0 {
-		scaleFactor = config.ScaleFactor
-	}
-
-	// Calculate Per capita with given timeseries and population data
-	result := make([]*wm.TimeseriesValue, 0)
-	for _, v := range timeseries {
-		year := time.UnixMilli(v.Timestamp).UTC().Year()
-		var population float64
-		// find the population of matching or last available year
-		for i, s := range populationTimeseries {
-			py := time.UnixMilli(s.Timestamp).UTC().Year()
-			if year == py {
-				// found the matching year
-				population = populationTimeseries[i].Value
-				break
-			} else if year < py {
-				// could not find the matching year. use the last available year
-				population = populationTimeseries[int(math.Max(0, float64(i-1)))].Value
-				break
-			} else if i == len(populationTimeseries)-1 && py < year {
-				// if given year is greater than available population data year, use the last available year's value
-				population = populationTimeseries[len(populationTimeseries)-1].Value
-			}
-		}
-		valuePercapita := (v.Value / population) * scaleFactor
-		result = append(result, &wm.TimeseriesValue{Timestamp: v.Timestamp, Value: valuePercapita})
-	}
-	return result, nil
+// errUnsupportedTransform returns the error of a transform that doesn't apply to the data
+func errUnsupportedTransform(op string, transform wm.Transform) error {
+	return &wm.Error{Op: op, Code: wm.EINVALID, Message: fmt.Sprintf("Transform %s is not supported for this data", transform)}
 }
 
-func (s *Storage) transformPerCapitaRegionAggregation(data *wm.ModelOutputRegionalAdmins, timestamp string, scaleFactor float64) (*wm.ModelOutputRegionalAdmins, error) {
-	op := "Storage.transformPerCapitaRegionAggregation"
+func (s *Storage) normalizeRegionalTimeseries(ctx context.Context, timeseries []*wm.TimeseriesValue, config wm.TransformConfig) ([]*wm.TimeseriesValue, error) {
+	op := "Storage.normalizeRegionalTimeseries"
 
-	pLookup, err := s.getRegionalPopulation(timestamp)
+	params := config.DatacubeParams
+	adminLevel, err := getRegionAdminLevel(config.RegionID)
 	if err != nil {
 		return nil, &wm.Error{Op: op, Err: err}
 	}
 
-	if scaleFactor == 0 {
-		scaleFactor = 1
-	}
-
-	resultAdminDataList := [4][]wm.ModelOutputAdminData{}
-	for i, d := range [][]wm.ModelOutputAdminData{data.Country, data.Admin1, data.Admin2, data.Admin3} {
-		for _, v := range d {
-			if p, ok := pLookup[v.ID]; ok && p != 0 {
-				resultAdminDataList[i] = append(resultAdminDataList[i], wm.ModelOutputAdminData{ID: v.ID, Value: (v.Value / p) * scaleFactor})
-			}
-		}
-	}
-	result := &wm.ModelOutputRegionalAdmins{
-		Country: resultAdminDataList[0],
-		Admin1:  resultAdminDataList[1],
-		Admin2:  resultAdminDataList[2],
-		Admin3:  resultAdminDataList[3],
-	}
-	return result, nil
-}
-
-func (s *Storage) transformPerCapitaQualifierRegional(data *wm.ModelOutputRegionalQualifiers, timestamp string, scaleFactor float64) (*wm.ModelOutputRegionalQualifiers, error) {
-	op := "Storage.transformPerCapitaQualifierRegional"
-
-	pLookup, err := s.getRegionalPopulation(timestamp)
+	// Fetch min max from precomputed extrema file and get min and max value across the region and timestamp
+	min, max, err := s.getRegionalMinMaxFromS3(ctx, params, adminLevel)
 	if err != nil {
 		return nil, &wm.Error{Op: op, Err: err}
 	}
 
-	if scaleFactor == 0 {
-		scaleFactor = 1
-	}
-
-	calcPerCapita := func(values map[string]float64, population float64, scaleFactor float64) map[string]float64 {
-		newValues := make(map[string]float64)
-		for k, v := range values {
-			newValues[k] = (v / population) * scaleFactor
-		}
-		return newValues
+	var result []*wm.TimeseriesValue
+	for _, v := range timeseries {
+		result = append(result, &wm.TimeseriesValue{Timestamp: v.Timestamp, Value: normalize(v.Value, min, max)})
 	}
 
-	resultAdminDataList := [4][]wm.ModelOutputRegionQualifierBreakdown{}
-	for i, d := range [][]wm.ModelOutputRegionQualifierBreakdown{data.Country, data.Admin1, data.Admin2, data.Admin3} {
-		for _, v := range d {
-			if p, ok := pLookup[v.ID]; ok && p != 0 {
-				resultAdminDataList[i] = append(resultAdminDataList[i], wm.ModelOutputRegionQualifierBreakdown{ID: v.ID, Values: calcPerCapita(v.Values, p, scaleFactor)})
-			}
-		}
-	}
-	result := &wm.ModelOutputRegionalQualifiers{
-		Country: resultAdminDataList[0],
-		Admin1:  resultAdminDataList[1],
-		Admin2:  resultAdminDataList[2],
-		Admin3:  resultAdminDataList[3],
-	}
 	return result, nil
 }
 
-// getRegionalPopulation returns a lookup table that maps region id to population of the region for the year that matches with given timestamp
-func (s *Storage) getRegionalPopulation(timestamp string) (map[string]float64, error) {
-	op := "Storage.getRegionalPopulation"
-
-	year, err := getAvailablePopulationDataYear(timestamp)
-	if err != nil {
-		return nil, &wm.Error{Op: op, Err: err}
-	}
-
-	// Check in memory cache for the data and return it if exists
-	if data, ok := populationRegionalLookupCache[year]; ok {
-		return data, nil
-	}
-
-	pTimestamp := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
-	regionalPopulation, err := s.GetRegionAggregation(getPopulationDatacubeParams(), fmt.Sprintf("%d", pTimestamp))
-	if err != nil {
-		if wm.ErrorCode(err) == wm.ENOTFOUND {
-			// if population data is not found, raise an internal server error
-			return nil, &wm.Error{Code: wm.EINTERNAL, Op: op, Err: err}
-		}
-		return nil, &wm.Error{Op: op, Err: err}
-	}
-
-	// Store population by region id
-	regionPopLookup := make(map[string]float64)
-
-	for _, d := range [][]wm.ModelOutputAdminData{regionalPopulation.Country, regionalPopulation.Admin1, regionalPopulation.Admin2, regionalPopulation.Admin3} {
-		for _, v := range d {
-			regionPopLookup[v.ID] = v.Value
-		}
-	}
-
-	// cache population lookup data by year into memory
-	populationRegionalLookupCache[year] = regionPopLookup
-	return regionPopLookup, nil
-}
-
-// getAvailablePopulationDataYear returns matching or last available year of the population data for given timstamp
-func getAvailablePopulationDataYear(timestamp string) (int, error) {
-	op := "getAvailablePopulationDataYear"
-
-	ts, err := strconv.Atoi(timestamp)
-	if err != nil {
-		return 0, &wm.Error{Op: op, Err: err}
-	}
-	year := time.UnixMilli(int64(ts)).UTC().Year()
-	availableYears := getPopulationDataAvailableYears()
-	// get available year for the population data
-	pYear := availableYears[len(availableYears)-1]
-	for i, y := range availableYears {
-		if year == y {
-			pYear = y
-			break
-		} else if i > 0 && year < y {
-			pYear = availableYears[i-1]
-			break
-		}
-	}
-	return pYear, nil
-}
-
-func (s *Storage) normalizeRegionAggregationByAdminLevel(data *wm.ModelOutputRegional, config wm.TransformConfig) (*wm.ModelOutputRegional, error) {
+func (s *Storage) normalizeRegionAggregationByAdminLevel(ctx context.Context, data *wm.ModelOutputRegional, config wm.TransformConfig) (*wm.ModelOutputRegional, error) {
 	op := "Storage.normalizeRegionAggregationByAdminLevel"
 
 	result := make(wm.ModelOutputRegional)
 
 	for adminLevel := range *data {
-		min, max, err := s.getRegionalMinMaxFromS3(config.DatacubeParams, adminLevel)
+		min, max, err := s.getRegionalMinMaxFromS3(ctx, config.DatacubeParams, adminLevel)
 		if err != nil {
 			return nil, &wm.Error{Op: op, Err: err}
 		}
@@ -368,11 +229,11 @@ func (s *Storage) normalizeQualifierRegional(data *wm.ModelOutputRegionalQualifi
 }
 
 // getRegionalMinMaxFromS3 fetches regional min max values from precomputed extrema file from s3
-func (s *Storage) getRegionalMinMaxFromS3(params *wm.DatacubeParams, adminLevel wm.AdminLevel) (float64, float64, error) {
+func (s *Storage) getRegionalMinMaxFromS3(ctx context.Context, params *wm.DatacubeParams, adminLevel wm.AdminLevel) (float64, float64, error) {
 	op := "Storage.getRegionalMinMaxFromS3"
 	key := fmt.Sprintf("%s/%s/%s/%s/regional/%s/stats/default/extrema.json",
 		params.DataID, params.RunID, params.Resolution, params.Feature, adminLevel)
-	buf, err := getFileFromS3(s, getBucket(s, params.RunID), aws.String(key))
+	buf, err := getFile(ctx, s, getBucket(s, params.RunID), key)
 	if err != nil {
 		return 0, 0, &wm.Error{Op: op, Err: err}
 	}
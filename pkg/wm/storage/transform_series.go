@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// transformTimeseries applies a timeseries transform. The points without a value, like the first points of a rolling
+// window or of a percent change, are left out.
+func transformTimeseries(timeseries []*wm.TimeseriesValue, config wm.TransformConfig) ([]*wm.TimeseriesValue, error) {
+	op := "transformTimeseries"
+	sorted := make([]*wm.TimeseriesValue, len(timeseries))
+	copy(sorted, timeseries)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+
+	switch config.Transform {
+	case wm.TransformRollingMean, wm.TransformRollingSum:
+		if config.Window < 1 {
+			return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: fmt.Sprintf("Transform %s requires a positive 'window'", config.Transform)}
+		}
+		return rollingTimeseries(sorted, config.Window, config.Transform == wm.TransformRollingMean), nil
+	case wm.TransformCumulativeSum:
+		return cumulativeTimeseries(sorted), nil
+	case wm.TransformPctChange:
+		return pctChangeTimeseries(sorted, func(i int, _ int64) (float64, bool) {
+			if i == 0 {
+				return 0, false
+			}
+			return sorted[i-1].Value, true
+		}), nil
+	case wm.TransformYoYPctChange:
+		byTimestamp := make(map[int64]float64, len(sorted))
+		for _, v := range sorted {
+			byTimestamp[v.Timestamp] = v.Value
+		}
+		return pctChangeTimeseries(sorted, func(_ int, timestamp int64) (float64, bool) {
+			v, ok := byTimestamp[time.UnixMilli(timestamp).UTC().AddDate(-1, 0, 0).UnixMilli()]
+			return v, ok
+		}), nil
+	}
+	return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: fmt.Sprintf("Transform %s does not apply to timeseries", config.Transform)}
+}
+
+// rollingTimeseries returns the sums, or the means, of the windows of given number of points ending at each point
+func rollingTimeseries(timeseries []*wm.TimeseriesValue, window int, mean bool) []*wm.TimeseriesValue {
+	result := make([]*wm.TimeseriesValue, 0)
+	var sum float64
+	for i, v := range timeseries {
+		sum += v.Value
+		if i >= window {
+			sum -= timeseries[i-window].Value
+		}
+		if i < window-1 {
+			continue
+		}
+		value := sum
+		if mean {
+			value = sum / float64(window)
+		}
+		result = append(result, &wm.TimeseriesValue{Timestamp: v.Timestamp, Value: value})
+	}
+	return result
+}
+
+// cumulativeTimeseries returns the sums of the values up to each point
+func cumulativeTimeseries(timeseries []*wm.TimeseriesValue) []*wm.TimeseriesValue {
+	result := make([]*wm.TimeseriesValue, 0, len(timeseries))
+	var sum float64
+	for _, v := range timeseries {
+		sum += v.Value
+		result = append(result, &wm.TimeseriesValue{Timestamp: v.Timestamp, Value: sum})
+	}
+	return result
+}
+
+// pctChangeTimeseries returns the percent changes of the values from the values returned by previous, leaving out the
+// points without a previous value or with a previous value of 0
+func pctChangeTimeseries(timeseries []*wm.TimeseriesValue, previous func(i int, timestamp int64) (float64, bool)) []*wm.TimeseriesValue {
+	result := make([]*wm.TimeseriesValue, 0, len(timeseries))
+	for i, v := range timeseries {
+		prev, ok := previous(i, v.Timestamp)
+		if !ok || prev == 0 {
+			continue
+		}
+		result = append(result, &wm.TimeseriesValue{Timestamp: v.Timestamp, Value: (v.Value - prev) / math.Abs(prev) * 100})
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestTransformTimeseries(t *testing.T) {
+	month := func(year int, month time.Month) int64 {
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	}
+	// Unsorted, as the transforms sort the timeseries
+	timeseries := []*wm.TimeseriesValue{
+		{Timestamp: month(2021, 1), Value: 4},
+		{Timestamp: month(2020, 1), Value: 2},
+		{Timestamp: month(2020, 2), Value: 0},
+		{Timestamp: month(2021, 2), Value: 6},
+	}
+	tests := []struct {
+		name   string
+		config wm.TransformConfig
+		want   []*wm.TimeseriesValue
+	}{
+		{"rolling mean", wm.TransformConfig{Transform: wm.TransformRollingMean, Window: 2}, []*wm.TimeseriesValue{
+			{Timestamp: month(2020, 2), Value: 1},
+			{Timestamp: month(2021, 1), Value: 2},
+			{Timestamp: month(2021, 2), Value: 5},
+		}},
+		{"rolling sum", wm.TransformConfig{Transform: wm.TransformRollingSum, Window: 3}, []*wm.TimeseriesValue{
+			{Timestamp: month(2021, 1), Value: 6},
+			{Timestamp: month(2021, 2), Value: 10},
+		}},
+		{"rolling window of 1", wm.TransformConfig{Transform: wm.TransformRollingSum, Window: 1}, []*wm.TimeseriesValue{
+			{Timestamp: month(2020, 1), Value: 2},
+			{Timestamp: month(2020, 2), Value: 0},
+			{Timestamp: month(2021, 1), Value: 4},
+			{Timestamp: month(2021, 2), Value: 6},
+		}},
+		{"window longer than the timeseries", wm.TransformConfig{Transform: wm.TransformRollingMean, Window: 5}, []*wm.TimeseriesValue{}},
+		{"cumulative sum", wm.TransformConfig{Transform: wm.TransformCumulativeSum}, []*wm.TimeseriesValue{
+			{Timestamp: month(2020, 1), Value: 2},
+			{Timestamp: month(2020, 2), Value: 2},
+			{Timestamp: month(2021, 1), Value: 6},
+			{Timestamp: month(2021, 2), Value: 12},
+		}},
+		// The change from 0 is left out
+		{"percent change", wm.TransformConfig{Transform: wm.TransformPctChange}, []*wm.TimeseriesValue{
+			{Timestamp: month(2020, 2), Value: -100},
+			{Timestamp: month(2021, 2), Value: 50},
+		}},
+		{"year over year percent change", wm.TransformConfig{Transform: wm.TransformYoYPctChange}, []*wm.TimeseriesValue{
+			{Timestamp: month(2021, 1), Value: 100},
+		}},
+	}
+	s := &Storage{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.TransformOutputTimeseriesByRegion(context.Background(), timeseries, tt.config)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := s.TransformOutputTimeseriesByRegion(context.Background(), timeseries, wm.TransformConfig{Transform: wm.TransformRollingMean})
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+	_, err = s.TransformRegionAggregation(context.Background(), &wm.ModelOutputRegionalAdmins{}, "0", wm.TransformConfig{Transform: wm.TransformCumulativeSum})
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+	// The timeseries is left as is
+	require.Equal(t, month(2021, 1), timeseries[0].Timestamp)
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gitlab.uncharted.software/WM/wm-go/pkg/fanout"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+// baselineIndexTimeseries expresses the values of the timeseries as a percentage of their mean over the baseline period
+func baselineIndexTimeseries(timeseries []*wm.TimeseriesValue, config wm.TransformConfig) ([]*wm.TimeseriesValue, error) {
+	op := "baselineIndexTimeseries"
+	if err := validateBaseline(config); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	var baseline []float64
+	for _, v := range timeseries {
+		if inBaseline(config, v.Timestamp) {
+			baseline = append(baseline, v.Value)
+		}
+	}
+	mean, _ := meanStdDev(baseline)
+	if mean == 0 {
+		return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: "The timeseries has no values, or a mean of 0, over the baseline period"}
+	}
+
+	result := make([]*wm.TimeseriesValue, 0, len(timeseries))
+	for _, v := range timeseries {
+		result = append(result, &wm.TimeseriesValue{Timestamp: v.Timestamp, Value: v.Value / mean * 100})
+	}
+	return result, nil
+}
+
+// zScoreTimeseries standardizes the values of the timeseries against the mean and standard deviation of the timeseries
+func zScoreTimeseries(timeseries []*wm.TimeseriesValue) []*wm.TimeseriesValue {
+	values := make([]float64, len(timeseries))
+	for i, v := range timeseries {
+		values[i] = v.Value
+	}
+	mean, sd := meanStdDev(values)
+
+	result := make([]*wm.TimeseriesValue, 0, len(timeseries))
+	for _, v := range timeseries {
+		result = append(result, &wm.TimeseriesValue{Timestamp: v.Timestamp, Value: zScore(v.Value, mean, sd)})
+	}
+	return result
+}
+
+// regionalZScoreTimeseries standardizes the values of the timeseries of a region against the values of all the regions
+// of its admin level at the same timestamp. The timestamps without regional data are left out.
+func (s *Storage) regionalZScoreTimeseries(ctx context.Context, timeseries []*wm.TimeseriesValue, config wm.TransformConfig) ([]*wm.TimeseriesValue, error) {
+	op := "Storage.regionalZScoreTimeseries"
+	if config.RegionID == "" {
+		return nil, &wm.Error{Op: op, Code: wm.EINVALID, Message: "Transform regional_zscore requires a region"}
+	}
+	if config.DatacubeParams == nil {
+		return nil, errMissingDatacubeParams(op)
+	}
+	adminLevel, err := getRegionAdminLevel(config.RegionID)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	timestamps := make([]int64, len(timeseries))
+	for i, v := range timeseries {
+		timestamps[i] = v.Timestamp
+	}
+	regional, err := s.getRegionalHistory(ctx, *config.DatacubeParams, adminLevel, timestamps)
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+
+	result := make([]*wm.TimeseriesValue, 0, len(timeseries))
+	for i, v := range timeseries {
+		if len(regional[i]) == 0 {
+			continue
+		}
+		mean, sd := meanStdDev(adminDataValues(regional[i]))
+		result = append(result, &wm.TimeseriesValue{Timestamp: v.Timestamp, Value: zScore(v.Value, mean, sd)})
+	}
+	return result, nil
+}
+
+// baselineIndexRegionAggregationByAdminLevel expresses the value of each region as a percentage of the mean of the
+// region over the baseline period. The regions without values, or with a mean of 0, over the period are left out.
+func (s *Storage) baselineIndexRegionAggregationByAdminLevel(ctx context.Context, data *wm.ModelOutputRegional, config wm.TransformConfig) (*wm.ModelOutputRegional, error) {
+	op := "Storage.baselineIndexRegionAggregationByAdminLevel"
+	if err := validateBaseline(config); err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	if config.DatacubeParams == nil {
+		return nil, errMissingDatacubeParams(op)
+	}
+	keep := func(timestamp int64) bool { return inBaseline(config, timestamp) }
+	result, err := s.transformByRegionHistory(ctx, data, *config.DatacubeParams, keep, func(value float64, history []float64) (float64, bool) {
+		mean, _ := meanStdDev(history)
+		return value / mean * 100, mean != 0
+	})
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	return result, nil
+}
+
+// zScoreRegionAggregationByAdminLevel standardizes the value of each region against the values of the region at all
+// the timestamps
+func (s *Storage) zScoreRegionAggregationByAdminLevel(ctx context.Context, data *wm.ModelOutputRegional, config wm.TransformConfig) (*wm.ModelOutputRegional, error) {
+	op := "Storage.zScoreRegionAggregationByAdminLevel"
+	if config.DatacubeParams == nil {
+		return nil, errMissingDatacubeParams(op)
+	}
+	keep := func(timestamp int64) bool { return true }
+	result, err := s.transformByRegionHistory(ctx, data, *config.DatacubeParams, keep, func(value float64, history []float64) (float64, bool) {
+		mean, sd := meanStdDev(history)
+		return zScore(value, mean, sd), len(history) > 0
+	})
+	if err != nil {
+		return nil, &wm.Error{Op: op, Err: err}
+	}
+	return result, nil
+}
+
+// regionalZScoreRegionAggregationByAdminLevel standardizes the value of each region against the values of all the
+// regions of the admin level
+func regionalZScoreRegionAggregationByAdminLevel(data *wm.ModelOutputRegional) *wm.ModelOutputRegional {
+	result := make(wm.ModelOutputRegional)
+	for adminLevel, points := range *data {
+		mean, sd := meanStdDev(adminDataValues(points))
+		for _, d := range points {
+			result[adminLevel] = append(result[adminLevel], wm.ModelOutputAdminData{ID: d.ID, Value: zScore(d.Value, mean, sd)})
+		}
+	}
+	return &result
+}
+
+// transformByRegionHistory transforms the value of each region with the values of the region at the timestamps matching
+// keep. The regions for which fn returns false are left out.
+func (s *Storage) transformByRegionHistory(ctx context.Context, data *wm.ModelOutputRegional, params wm.DatacubeParams, keep func(timestamp int64) bool,
+	fn func(value float64, history []float64) (float64, bool)) (*wm.ModelOutputRegional, error) {
+	op := "Storage.transformByRegionHistory"
+	result := make(wm.ModelOutputRegional)
+	for adminLevel, points := range *data {
+		params.AdminLevel = adminLevel
+		all, err := s.GetTimestamps(ctx, params)
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		var timestamps []int64
+		for _, ts := range all {
+			if keep(ts) {
+				timestamps = append(timestamps, ts)
+			}
+		}
+		regional, err := s.getRegionalHistory(ctx, params, adminLevel, timestamps)
+		if err != nil {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+		histories := make(map[string][]float64)
+		for _, points := range regional {
+			for _, d := range points {
+				histories[d.ID] = append(histories[d.ID], d.Value)
+			}
+		}
+
+		for _, d := range points {
+			if value, ok := fn(d.Value, histories[d.ID]); ok {
+				result[adminLevel] = append(result[adminLevel], wm.ModelOutputAdminData{ID: d.ID, Value: value})
+			}
+		}
+	}
+	return &result, nil
+}
+
+// getRegionalHistory returns the regional data of the admin level at each of the timestamps, which is empty for the
+// timestamps without regional data
+func (s *Storage) getRegionalHistory(ctx context.Context, params wm.DatacubeParams, adminLevel wm.AdminLevel, timestamps []int64) ([][]wm.ModelOutputAdminData, error) {
+	op := "Storage.getRegionalHistory"
+	data := make([][]wm.ModelOutputAdminData, len(timestamps))
+	errs := fanout.Run(ctx, len(timestamps), s.maxConcurrency, func(ctx context.Context, i int) error {
+		regional, err := s.GetRegionAggregationByAdminLevel(ctx, params, strconv.FormatInt(timestamps[i], 10), adminLevel)
+		if err != nil {
+			return err
+		}
+		data[i] = (*regional)[adminLevel]
+		return nil
+	})
+	for _, err := range errs {
+		if err != nil && wm.ErrorCode(err) != wm.ENOTFOUND {
+			return nil, &wm.Error{Op: op, Err: err}
+		}
+	}
+	return data, nil
+}
+
+// validateBaseline checks the baseline period of the config
+func validateBaseline(config wm.TransformConfig) error {
+	if config.BaselineEnd < config.BaselineStart {
+		return &wm.Error{Code: wm.EINVALID, Message: "The baseline period ends before it starts"}
+	}
+	return nil
+}
+
+// inBaseline returns whether the timestamp is in the baseline period of the config
+func inBaseline(config wm.TransformConfig, timestamp int64) bool {
+	return timestamp >= config.BaselineStart && timestamp <= config.BaselineEnd
+}
+
+// errMissingDatacubeParams returns the error of a transform config without the params of the transformed datacube,
+// which are set by the caller rather than the client
+func errMissingDatacubeParams(op string) error {
+	return &wm.Error{Op: op, Code: wm.EINTERNAL, Message: "Transform config is missing the datacube params"}
+}
+
+// getRegionAdminLevel returns the admin level of the region id, eg. admin1 for Ethiopia__Afar
+func getRegionAdminLevel(regionID string) (wm.AdminLevel, error) {
+	op := "getRegionAdminLevel"
+	adminLevels := []wm.AdminLevel{wm.AdminLevelCountry, wm.AdminLevel1, wm.AdminLevel2, wm.AdminLevel3}
+	parts := strings.Split(regionID, "__")
+	if regionID == "" || len(parts) > len(adminLevels) {
+		return "", &wm.Error{Op: op, Code: wm.EINVALID, Message: fmt.Sprintf("Invalid region id %q", regionID)}
+	}
+	return adminLevels[len(parts)-1], nil
+}
+
+func adminDataValues(data []wm.ModelOutputAdminData) []float64 {
+	values := make([]float64, len(data))
+	for i, d := range data {
+		values[i] = d.Value
+	}
+	return values
+}
+
+// meanStdDev returns the mean and the population standard deviation of the values, or zeros if there are none
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// zScore returns the z-score of the value, which is 0 if the values have no deviation
+func zScore(value float64, mean float64, sd float64) float64 {
+	if sd == 0 {
+		return 0
+	}
+	return (value - mean) / sd
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.uncharted.software/WM/wm-go/pkg/wm"
+)
+
+func TestStandardizeTimeseries(t *testing.T) {
+	timeseries := []*wm.TimeseriesValue{{Timestamp: 1, Value: 2}, {Timestamp: 2, Value: 6}, {Timestamp: 3, Value: 4}}
+	s := &Storage{}
+	ctx := context.Background()
+
+	got, err := s.TransformOutputTimeseriesByRegion(ctx, timeseries, wm.TransformConfig{Transform: wm.TransformBaselineIndex, BaselineStart: 1, BaselineEnd: 2})
+	require.NoError(t, err)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 1, Value: 50}, {Timestamp: 2, Value: 150}, {Timestamp: 3, Value: 100}}, got)
+
+	for _, config := range []wm.TransformConfig{
+		{Transform: wm.TransformBaselineIndex, BaselineStart: 4, BaselineEnd: 5},
+		{Transform: wm.TransformBaselineIndex, BaselineStart: 2, BaselineEnd: 1},
+		{Transform: wm.TransformRegionalZScore},
+	} {
+		_, err = s.TransformOutputTimeseriesByRegion(ctx, timeseries, config)
+		require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+	}
+
+	got, err = s.TransformOutputTimeseriesByRegion(ctx, timeseries, wm.TransformConfig{Transform: wm.TransformZScore})
+	require.NoError(t, err)
+	sd := math.Sqrt(8.0 / 3)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 1, Value: -2 / sd}, {Timestamp: 2, Value: 2 / sd}, {Timestamp: 3, Value: 0}}, got)
+
+	got, err = s.TransformOutputTimeseriesByRegion(ctx, timeseries[:1], wm.TransformConfig{Transform: wm.TransformZScore})
+	require.NoError(t, err)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 1, Value: 0}}, got)
+}
+
+func TestStandardizeRegional(t *testing.T) {
+	ctx := context.Background()
+	reader := NewMemoryReader()
+	prefix := "data/run/month/rain/regional/country/aggs/"
+	reader.Put("models", prefix+"1/default/default.csv", []byte("id,s_sum_t_sum\nEthiopia,2\nKenya,0\n"))
+	reader.Put("models", prefix+"2/default/default.csv", []byte("id,s_sum_t_sum\nEthiopia,4\nKenya,2\nSomalia,6\n"))
+	reader.Put("models", prefix+"3/default/default.csv", []byte("id,s_sum_t_sum\nEthiopia,6\nKenya,4\n"))
+	s, err := NewFromConfig(&Config{Reader: reader, BucketInfo: &BucketInfo{ModelsBucket: "models"}})
+	require.NoError(t, err)
+	params := wm.DatacubeParams{DataID: "data", RunID: "run", Feature: "rain", Resolution: "month", SpatialAggFunc: "sum", TemporalAggFunc: "sum"}
+	data, err := s.GetRegionAggregationByAdminLevel(ctx, params, "3", wm.AdminLevelCountry)
+	require.NoError(t, err)
+
+	got, err := s.TransformRegionAggregationByAdminLevel(ctx, data, wm.TransformConfig{Transform: wm.TransformBaselineIndex, BaselineStart: 1, BaselineEnd: 2, DatacubeParams: &params})
+	require.NoError(t, err)
+	require.Equal(t, &wm.ModelOutputRegional{wm.AdminLevelCountry: {{ID: "Ethiopia", Value: 200}, {ID: "Kenya", Value: 400}}}, got)
+
+	// Kenya has a baseline mean of 0, and is left out
+	got, err = s.TransformRegionAggregationByAdminLevel(ctx, data, wm.TransformConfig{Transform: wm.TransformBaselineIndex, BaselineStart: 1, BaselineEnd: 1, DatacubeParams: &params})
+	require.NoError(t, err)
+	require.Equal(t, &wm.ModelOutputRegional{wm.AdminLevelCountry: {{ID: "Ethiopia", Value: 300}}}, got)
+
+	got, err = s.TransformRegionAggregationByAdminLevel(ctx, data, wm.TransformConfig{Transform: wm.TransformZScore, DatacubeParams: &params})
+	require.NoError(t, err)
+	sd := math.Sqrt(8.0 / 3)
+	require.Equal(t, &wm.ModelOutputRegional{wm.AdminLevelCountry: {{ID: "Ethiopia", Value: 2 / sd}, {ID: "Kenya", Value: 2 / sd}}}, got)
+
+	got, err = s.TransformRegionAggregationByAdminLevel(ctx, data, wm.TransformConfig{Transform: wm.TransformRegionalZScore, DatacubeParams: &params})
+	require.NoError(t, err)
+	require.Equal(t, &wm.ModelOutputRegional{wm.AdminLevelCountry: {{ID: "Ethiopia", Value: 1}, {ID: "Kenya", Value: -1}}}, got)
+
+	// The values of Kenya against all the countries at each timestamp, without regional data at timestamp 4
+	timeseries := []*wm.TimeseriesValue{{Timestamp: 1, Value: 0}, {Timestamp: 2, Value: 2}, {Timestamp: 4, Value: 1}}
+	series, err := s.TransformOutputTimeseriesByRegion(ctx, timeseries, wm.TransformConfig{Transform: wm.TransformRegionalZScore, RegionID: "Kenya", DatacubeParams: &params})
+	require.NoError(t, err)
+	require.Equal(t, []*wm.TimeseriesValue{{Timestamp: 1, Value: -1}, {Timestamp: 2, Value: -2 / math.Sqrt(8.0/3)}}, series)
+
+	_, err = s.TransformRegionAggregation(ctx, &wm.ModelOutputRegionalAdmins{}, "3", wm.TransformConfig{Transform: wm.TransformZScore})
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+
+	_, err = s.TransformOutputTimeseriesByRegion(ctx, timeseries, wm.TransformConfig{Transform: wm.TransformRegionalZScore, RegionID: "a__b__c__d__e", DatacubeParams: &params})
+	require.Equal(t, wm.EINVALID, wm.ErrorCode(err))
+	// The datacube params are set by the API
+	_, err = s.TransformOutputTimeseriesByRegion(ctx, timeseries, wm.TransformConfig{Transform: wm.TransformRegionalZScore, RegionID: "Kenya"})
+	require.Equal(t, wm.EINTERNAL, wm.ErrorCode(err))
+	_, err = s.TransformRegionAggregationByAdminLevel(ctx, data, wm.TransformConfig{Transform: wm.TransformZScore})
+	require.Equal(t, wm.EINTERNAL, wm.ErrorCode(err))
+}